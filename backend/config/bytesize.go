@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ByteSize is a number of bytes, written in configuration as a plain number or with a unit such as "20MB".
+type ByteSize int64
+
+// Units understood by ByteSize, in powers of 1024.
+const (
+	B  ByteSize = 1
+	KB          = 1 << 10 * B
+	MB          = 1 << 20 * B
+	GB          = 1 << 30 * B
+)
+
+var byteUnits = []struct {
+	suffix string
+	size   ByteSize
+}{
+	{"GB", GB},
+	{"MB", MB},
+	{"KB", KB},
+	{"B", B},
+}
+
+// UnmarshalText reads sizes such as "512KB", "20MB" or "1048576".
+func (s *ByteSize) UnmarshalText(text []byte) error {
+	value := strings.ToUpper(strings.TrimSpace(string(text)))
+	unit := B
+	for _, u := range byteUnits {
+		if strings.HasSuffix(value, u.suffix) {
+			value, unit = strings.TrimSpace(strings.TrimSuffix(value, u.suffix)), u.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q, use a number of bytes or a size such as 20MB", text)
+	}
+	*s = ByteSize(n) * unit
+	return nil
+}
+
+// String writes the size in the largest unit that divides it, such as "20MB".
+func (s ByteSize) String() string {
+	for _, u := range byteUnits {
+		if s != 0 && s%u.size == 0 {
+			return strconv.FormatInt(int64(s/u.size), 10) + u.suffix
+		}
+	}
+	return "0B"
+}
@@ -0,0 +1,341 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Config holds everything the forum can be configured with. It is read by Load from, in increasing order of precedence, built-in defaults, a YAML file, environment variables (including those in a .env file) and command line flags.
+*/
+type Config struct {
+	Server    Server              `yaml:"server"`
+	Database  Database            `yaml:"database"`
+	Session   Session             `yaml:"session"`
+	Uploads   Uploads             `yaml:"uploads"`
+	Templates Templates           `yaml:"templates"`
+	Mail      Mail                `yaml:"mail"`
+	OAuth     map[string]Provider `yaml:"oauth"`
+	Jobs      Jobs                `yaml:"jobs"`
+	Features  Features            `yaml:"features"`
+	Metrics   Metrics             `yaml:"metrics"`
+	Log       Log                 `yaml:"log"`
+	Tracing   Tracing             `yaml:"tracing"`
+}
+
+// Server configures the HTTP server.
+type Server struct {
+	Port int `yaml:"port"`
+	// BaseURL is the public address of the forum, used in emailed links and by sign-in providers. The request's host is used when empty, if it is one of AllowedHosts.
+	BaseURL string `yaml:"base_url"`
+	// AllowedHosts are the host names, without a port, that requests may be addressed to when BaseURL is empty.
+	AllowedHosts []string `yaml:"allowed_hosts"`
+	// SecretKey signs the values handed to browsers. It is required once the forum has a base URL or sends email; otherwise a random key is used, which does not survive a restart.
+	SecretKey string `yaml:"secret_key"`
+	// TrustedProxies are the IP addresses or CIDR ranges of reverse proxies whose X-Forwarded-For header is believed.
+	TrustedProxies []string      `yaml:"trusted_proxies"`
+	ReadTimeout    time.Duration `yaml:"read_timeout"`
+	WriteTimeout   time.Duration `yaml:"write_timeout"`
+	// DrainDelay is how long the server keeps answering, while reporting itself as draining, before it stops accepting connections on shutdown. It gives load balancers time to stop sending requests.
+	DrainDelay time.Duration `yaml:"drain_delay"`
+	// ShutdownTimeout bounds how long shutdown waits for in-flight requests and then for running jobs.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+// Database configures the SQLite database.
+type Database struct {
+	Path string `yaml:"path"`
+}
+
+// Session configures sign-in sessions and the cookies that carry them.
+type Session struct {
+	// IdleTimeout signs users out after this long without activity.
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	// Lifetime is the longest a session can be kept alive by activity.
+	Lifetime time.Duration `yaml:"lifetime"`
+	// RememberMe is both the idle timeout and the lifetime of "remember me" sessions.
+	RememberMe time.Duration `yaml:"remember_me"`
+	// SecureCookies restricts cookies to HTTPS. Browsers also accept them on http://localhost.
+	SecureCookies bool `yaml:"secure_cookies"`
+}
+
+// Uploads configures the media attached to posts.
+type Uploads struct {
+	Dir          string   `yaml:"dir"`
+	MaxFiles     int      `yaml:"max_files"`
+	MaxFileSize  ByteSize `yaml:"max_file_size"`
+	MaxTotalSize ByteSize `yaml:"max_total_size"`
+}
+
+// Templates configures the page templates.
+type Templates struct {
+	// Dir holds the pages, with their shared layouts in layouts/ and partials in partials/.
+	Dir string `yaml:"dir"`
+	// Reload parses the templates again on every page rendered, so edits show without a restart. Meant for development.
+	Reload bool `yaml:"reload"`
+}
+
+/*
+Mail configures outgoing email. Mail goes through SMTP when SMTPHost is set, is written to .eml files in Dir when that is set, and is logged otherwise.
+*/
+type Mail struct {
+	From         string `yaml:"from"`
+	SMTPHost     string `yaml:"smtp_host"`
+	SMTPPort     string `yaml:"smtp_port"`
+	SMTPUsername string `yaml:"smtp_username"`
+	SMTPPassword string `yaml:"smtp_password"`
+	Dir          string `yaml:"dir"`
+}
+
+/*
+Provider configures an OAuth 2.0 or OpenID Connect sign-in provider, keyed by its name in Config.OAuth. Fields left empty keep the settings of the built-in providers, google and github.
+*/
+type Provider struct {
+	ClientID     string            `yaml:"client_id"`
+	ClientSecret string            `yaml:"client_secret"`
+	DisplayName  string            `yaml:"display_name"`
+	Issuer       string            `yaml:"issuer"`
+	AuthURL      string            `yaml:"auth_url"`
+	TokenURL     string            `yaml:"token_url"`
+	UserInfoURL  string            `yaml:"userinfo_url"`
+	JWKSURL      string            `yaml:"jwks_url"`
+	EmailsURL    string            `yaml:"emails_url"`
+	Scopes       []string          `yaml:"scopes"`
+	AuthParams   map[string]string `yaml:"auth_params"`
+	Claims       Claims            `yaml:"claims"`
+	// PKCE turns PKCE off for providers that reject it when set to false. It is on by default.
+	PKCE *bool `yaml:"pkce"`
+}
+
+// Claims names the claims or user info fields holding the user's details.
+type Claims struct {
+	Subject       string `yaml:"subject"`
+	Email         string `yaml:"email"`
+	EmailVerified string `yaml:"email_verified"`
+	Username      string `yaml:"username"`
+}
+
+// Jobs configures the background job runner.
+type Jobs struct {
+	Workers int `yaml:"workers"`
+	// Digest is the schedule of the digest emails subscribers get, such as "@weekly". They are not sent when it is empty.
+	Digest string `yaml:"digest"`
+}
+
+// Metrics configures the Prometheus metrics served at /metrics.
+type Metrics struct {
+	// Token is the bearer token Prometheus has to send to scrape the metrics. Anyone can read them when it is empty.
+	Token string `yaml:"token"`
+}
+
+// Log configures what the server logs and how.
+type Log struct {
+	// Level is the least severe level logged: debug, info, warn or error.
+	Level string `yaml:"level"`
+	// Format is text, easy to read, or json, for log collectors.
+	Format string `yaml:"format"`
+	// AccessLog logs a line for every request served.
+	AccessLog bool `yaml:"access_log"`
+}
+
+/*
+Tracing configures OpenTelemetry tracing. Requests, database queries and calls to sign-in providers are traced whatever the exporter, so their trace IDs appear in the logs; the exporter decides where the spans go.
+*/
+type Tracing struct {
+	// Exporter is none, stdout to print spans to standard output, or otlp to send them to a collector over OTLP/HTTP.
+	Exporter string `yaml:"exporter"`
+	// Endpoint is the address of the OTLP collector, such as http://localhost:4318. OTEL_EXPORTER_OTLP_ENDPOINT, or else localhost:4318, is used when empty.
+	Endpoint string `yaml:"endpoint"`
+	// SampleRatio is the share of traces started by the forum that are exported, from 0 to 1. Requests follow the sampling decision of a traced caller.
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+// Features turns parts of the forum on and off.
+type Features struct {
+	// Registration lets new users create accounts, with a password or through a sign-in provider.
+	Registration bool `yaml:"registration"`
+	// Passkeys lets users add passkeys and sign in with them.
+	Passkeys bool `yaml:"passkeys"`
+}
+
+// Enabled reports whether the feature with the given name, as used in the configuration file, is on.
+func (f Features) Enabled(name string) bool {
+	switch name {
+	case "registration":
+		return f.Registration
+	case "passkeys":
+		return f.Passkeys
+	}
+	return false
+}
+
+// Default returns the configuration used for anything left unset.
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Port:            9000,
+			AllowedHosts:    []string{"localhost", "127.0.0.1", "::1"},
+			ReadTimeout:     10 * time.Second,
+			WriteTimeout:    10 * time.Second,
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Database: Database{Path: "backend/database/forum.db"},
+		Session: Session{
+			IdleTimeout:   24 * time.Hour,
+			Lifetime:      7 * 24 * time.Hour,
+			RememberMe:    30 * 24 * time.Hour,
+			SecureCookies: true,
+		},
+		Uploads: Uploads{
+			Dir:          "uploads",
+			MaxFiles:     4,
+			MaxFileSize:  20 * MB,
+			MaxTotalSize: 50 * MB,
+		},
+		Templates: Templates{Dir: "frontend/templates"},
+		Mail:      Mail{From: "forum@localhost", SMTPPort: "587"},
+		OAuth:     make(map[string]Provider),
+		Jobs:      Jobs{Workers: 2},
+		Features:  Features{Registration: true, Passkeys: true},
+		Log:       Log{Level: "info", Format: "text", AccessLog: true},
+		Tracing:   Tracing{Exporter: "none", SampleRatio: 1},
+	}
+}
+
+// TrustsProxy reports whether addr is the IP address of one of the trusted proxies.
+func (s Server) TrustsProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range s.TrustedProxies {
+		if network, err := parseProxy(proxy); err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseProxy returns the network of a trusted proxy, given as an IP address or a CIDR range.
+func parseProxy(proxy string) (*net.IPNet, error) {
+	proxy = strings.TrimSpace(proxy)
+	if !strings.Contains(proxy, "/") {
+		ip := net.ParseIP(proxy)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", proxy)
+		}
+		if ip.To4() != nil {
+			return &net.IPNet{IP: ip.To4(), Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	_, network, err := net.ParseCIDR(proxy)
+	return network, err
+}
+
+// Validate reports every setting that is out of range, so they can all be fixed at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Port >= 1024 && c.Server.Port <= 65535, "server.port: use a port between 1024 and 65535, not %d", c.Server.Port)
+	if c.Server.BaseURL != "" {
+		u, err := url.Parse(c.Server.BaseURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && (u.Path == "" || u.Path == "/"),
+			"server.base_url: %q is not an http(s) address without a path", c.Server.BaseURL)
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		_, err := parseProxy(proxy)
+		check(err == nil, "server.trusted_proxies: %q is not an IP address or CIDR range", proxy)
+	}
+	for _, host := range c.Server.AllowedHosts {
+		check(host != "" && host == strings.ToLower(host) && !strings.ContainsAny(host, "/[]") &&
+			(!strings.Contains(host, ":") || net.ParseIP(host) != nil),
+			"server.allowed_hosts: %q is not a lowercase host name without a port", host)
+	}
+	check(c.Server.ReadTimeout > 0, "server.read_timeout must be positive")
+	check(c.Server.WriteTimeout > 0, "server.write_timeout must be positive")
+	check(c.Server.DrainDelay >= 0, "server.drain_delay must not be negative")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	check(c.Server.SecretKey != "" || (c.Server.BaseURL == "" && c.Mail.SMTPHost == "" && c.Mail.Dir == ""),
+		"server.secret_key is required with server.base_url or a mailer, as the links it sends must outlive a restart")
+
+	check(c.Database.Path != "", "database.path is required")
+
+	check(c.Session.IdleTimeout > 0, "session.idle_timeout must be positive")
+	check(c.Session.Lifetime >= c.Session.IdleTimeout, "session.lifetime must be at least session.idle_timeout")
+	check(c.Session.RememberMe > 0, "session.remember_me must be positive")
+
+	check(c.Uploads.Dir != "", "uploads.dir is required")
+	check(c.Uploads.MaxFiles >= 0, "uploads.max_files must not be negative")
+	check(c.Uploads.MaxFileSize > 0, "uploads.max_file_size must be positive")
+	check(c.Uploads.MaxTotalSize >= c.Uploads.MaxFileSize, "uploads.max_total_size must be at least uploads.max_file_size")
+	check(c.Templates.Dir != "", "templates.dir is required")
+
+	check(c.Mail.From != "", "mail.from is required")
+	if c.Mail.SMTPHost != "" {
+		port, err := strconv.Atoi(c.Mail.SMTPPort)
+		check(err == nil && port > 0 && port <= 65535, "mail.smtp_port: %q is not a port", c.Mail.SMTPPort)
+	}
+
+	for name := range c.OAuth {
+		check(validProviderName(name), "oauth: %q is not a valid provider name, use lower case letters, digits and dashes", name)
+	}
+
+	check(c.Jobs.Workers >= 1, "jobs.workers must be at least 1")
+	check(c.Jobs.Digest == "" || c.Server.BaseURL != "", "jobs.digest needs server.base_url, the address its emails link to")
+
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		check(false, "log.level: %q is not one of debug, info, warn or error", c.Log.Level)
+	}
+	check(c.Log.Format == "text" || c.Log.Format == "json", "log.format: %q is not text or json", c.Log.Format)
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	default:
+		check(false, "tracing.exporter: %q is not one of none, stdout or otlp", c.Tracing.Exporter)
+	}
+	if c.Tracing.Endpoint != "" {
+		u, err := url.Parse(c.Tracing.Endpoint)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "tracing.endpoint: %q is not an http(s) address", c.Tracing.Endpoint)
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1")
+	return errors.Join(errs...)
+}
+
+// validProviderName reports whether name can be used in the /auth/<name> paths and in environment variables.
+func validProviderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// Addr is the address the server listens on.
+func (c *Config) Addr() string {
+	return ":" + strconv.Itoa(c.Server.Port)
+}
+
+// Limits returns the idle timeout and absolute lifetime for a new session.
+func (s Session) Limits(rememberMe bool) (idle, lifetime time.Duration) {
+	if rememberMe {
+		return s.RememberMe, s.RememberMe
+	}
+	return s.IdleTimeout, s.Lifetime
+}
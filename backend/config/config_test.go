@@ -0,0 +1,235 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"flag"
+)
+
+// inTempDir runs the test from an empty directory, so no .env or forum.yaml is picked up by accident.
+func inTempDir(t *testing.T) string {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+func writeFile(t *testing.T, path, content string) {
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDefaultsAreValid(t *testing.T) {
+	inTempDir(t)
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != 9000 || cfg.Database.Path != "backend/database/forum.db" || cfg.Uploads.MaxFileSize != 20*MB {
+		t.Errorf("unexpected defaults: %+v", cfg)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	dir := inTempDir(t)
+	writeFile(t, filepath.Join(dir, "forum.yaml"), `
+server:
+  port: 8000
+  base_url: https://file.example
+  trusted_proxies: [127.0.0.1, 10.0.0.0/8]
+database:
+  path: file.db
+session:
+  idle_timeout: 2h
+uploads:
+  max_file_size: 5MB
+  max_total_size: 10MB
+features:
+  passkeys: false
+oauth:
+  gitlab:
+    client_id: gl-id
+    issuer: https://gitlab.example
+    auth_params:
+      prompt: consent
+`)
+	writeFile(t, filepath.Join(dir, ".env"), "DATABASE_PATH=dotenv.db\nJOB_WORKERS=3\nSESSION_IDLE_TIMEOUT=3h\n")
+	t.Cleanup(func() {
+		os.Unsetenv("DATABASE_PATH")
+		os.Unsetenv("JOB_WORKERS")
+	})
+	t.Setenv("SESSION_IDLE_TIMEOUT", "4h")
+	t.Setenv("BASE_URL", "https://env.example")
+	t.Setenv("SECRET_KEY", "test-secret")
+	t.Setenv("TEMPLATE_RELOAD", "true")
+
+	cfg, err := Load([]string{"-db", "flag.db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"port from the file", cfg.Server.Port, 8000},
+		{"base URL from the environment over the file", cfg.Server.BaseURL, "https://env.example"},
+		{"database path from the flag over .env and the file", cfg.Database.Path, "flag.db"},
+		{"workers from .env", cfg.Jobs.Workers, 3},
+		{"environment over .env", cfg.Session.IdleTimeout, 4 * time.Hour},
+		{"lifetime keeps its default", cfg.Session.Lifetime, 7 * 24 * time.Hour},
+		{"sizes with units", cfg.Uploads.MaxTotalSize, 10 * MB},
+		{"feature turned off", cfg.Features.Passkeys, false},
+		{"other features stay on", cfg.Features.Registration, true},
+		{"template reloading from the environment", cfg.Templates.Reload, true},
+		{"template directory keeps its default", cfg.Templates.Dir, "frontend/templates"},
+		{"trusted proxies", strings.Join(cfg.Server.TrustedProxies, ","), "127.0.0.1,10.0.0.0/8"},
+		{"provider from the file", cfg.OAuth["gitlab"].AuthParams["prompt"], "consent"},
+	}
+	for _, tc := range tests {
+		if tc.got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, tc.got, tc.want)
+		}
+	}
+}
+
+func TestLoadPortArgument(t *testing.T) {
+	inTempDir(t)
+
+	cfg, err := Load([]string{"8080"})
+	if err != nil || cfg.Server.Port != 8080 {
+		t.Fatalf("Load(8080) = %v, %v", cfg, err)
+	}
+	if _, err := Load([]string{"80"}); err == nil {
+		t.Error("expected a privileged port to be refused")
+	}
+	if _, err := Load([]string{"8080", "9090"}); err == nil {
+		t.Error("expected extra arguments to be refused")
+	}
+}
+
+func TestFlags(t *testing.T) {
+	dir := inTempDir(t)
+	writeFile(t, filepath.Join(dir, "other.yaml"), "uploads:\n  dir: other-uploads\n")
+
+	// A command's own flags mix with the configuration flags
+	flags := flag.NewFlagSet("gc-uploads", flag.ContinueOnError)
+	load := Flags(flags)
+	dryRun := flags.Bool("dry-run", false, "")
+	if err := flags.Parse([]string{"-config", "other.yaml", "-dry-run", "-db", "other.db"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !*dryRun || cfg.Uploads.Dir != "other-uploads" || cfg.Database.Path != "other.db" {
+		t.Errorf("got dry run %v, uploads %q and database %q, want the flags and other.yaml applied", *dryRun, cfg.Uploads.Dir, cfg.Database.Path)
+	}
+}
+
+func TestLoadProvidersFromEnv(t *testing.T) {
+	inTempDir(t)
+	t.Setenv("GITHUB_CLIENT_ID", "gh-id")
+	t.Setenv("OAUTH_PROVIDERS", "my-idp")
+	t.Setenv("OAUTH_MY_IDP_CLIENT_ID", "idp-id")
+	t.Setenv("OAUTH_MY_IDP_SCOPES", "openid email")
+	t.Setenv("OAUTH_MY_IDP_PKCE", "false")
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.OAuth["github"].ClientID != "gh-id" {
+		t.Errorf("github = %+v", cfg.OAuth["github"])
+	}
+	idp := cfg.OAuth["my-idp"]
+	if idp.ClientID != "idp-id" || strings.Join(idp.Scopes, ",") != "openid,email" || idp.PKCE == nil || *idp.PKCE {
+		t.Errorf("my-idp = %+v", idp)
+	}
+}
+
+func TestLoadRejectsInvalidSettings(t *testing.T) {
+	tests := []struct {
+		name, file, env, want string
+	}{
+		{"unknown setting", "server:\n  prot: 8000\n", "", "field prot not found"},
+		{"invalid duration", "", "SESSION_LIFETIME=soon", "SESSION_LIFETIME"},
+		{"invalid boolean", "", "FEATURE_PASSKEYS=maybe", "FEATURE_PASSKEYS"},
+		{"invalid size", "uploads:\n  max_file_size: huge\n", "", "invalid size"},
+		{"lifetime shorter than idle timeout", "session:\n  idle_timeout: 200h\n", "", "session.lifetime"},
+		{"base URL with a path", "server:\n  base_url: https://example.com/forum\n", "", "server.base_url"},
+		{"trusted proxy", "", "TRUSTED_PROXIES=10.0.0.0/8,not-an-ip", "server.trusted_proxies"},
+		{"allowed host with a port", "", "ALLOWED_HOSTS=localhost:9000", "server.allowed_hosts"},
+		{"base URL without a secret key", "", "BASE_URL=https://forum.example", "server.secret_key"},
+		{"mailer without a secret key", "mail:\n  dir: outbox\n", "", "server.secret_key"},
+		{"digest without a base URL", "jobs:\n  digest: \"@weekly\"\n", "", "jobs.digest"},
+		{"log level", "", "LOG_LEVEL=verbose", "log.level"},
+		{"log format", "log:\n  format: xml\n", "", "log.format"},
+		{"tracing exporter", "", "TRACING_EXPORTER=jaeger", "tracing.exporter"},
+		{"sample ratio", "tracing:\n  sample_ratio: 2\n", "", "tracing.sample_ratio"},
+		{"provider name", "oauth:\n  My_IdP:\n    client_id: x\n", "", "not a valid provider name"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := inTempDir(t)
+			if tc.file != "" {
+				writeFile(t, filepath.Join(dir, "forum.yaml"), tc.file)
+			}
+			if key, value, ok := strings.Cut(tc.env, "="); ok {
+				t.Setenv(key, value)
+			}
+
+			_, err := Load(nil)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Load() error = %v, want it to mention %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadNamedFileMustExist(t *testing.T) {
+	inTempDir(t)
+	if _, err := Load([]string{"-config", "missing.yaml"}); err == nil {
+		t.Error("expected an error for a missing configuration file")
+	}
+}
+
+func TestByteSize(t *testing.T) {
+	tests := []struct {
+		text string
+		want ByteSize
+	}{
+		{"1048576", MB},
+		{"512KB", 512 * KB},
+		{"20mb", 20 * MB},
+		{"1 GB", GB},
+	}
+	for _, tc := range tests {
+		var s ByteSize
+		if err := s.UnmarshalText([]byte(tc.text)); err != nil || s != tc.want {
+			t.Errorf("UnmarshalText(%q) = %d, %v, want %d", tc.text, s, err, tc.want)
+		}
+	}
+	if got := (20 * MB).String(); got != "20MB" {
+		t.Errorf("String() = %q, want 20MB", got)
+	}
+	var s ByteSize
+	if err := s.UnmarshalText([]byte("-1MB")); err == nil {
+		t.Error("expected negative sizes to be refused")
+	}
+}
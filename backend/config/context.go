@@ -0,0 +1,40 @@
+package config
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+)
+
+type contextKey struct{}
+
+// defaults is the configuration seen by requests that were not given one, such as in tests. Its secret key is random, as when the forum starts without one.
+var defaults = func() *Config {
+	cfg := Default()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("failed to generate secret key: %v", err))
+	}
+	cfg.Server.SecretKey = base64.RawURLEncoding.EncodeToString(key)
+	return cfg
+}()
+
+// NewContext returns a copy of ctx carrying cfg.
+func NewContext(ctx context.Context, cfg *Config) context.Context {
+	return context.WithValue(ctx, contextKey{}, cfg)
+}
+
+// FromContext returns the configuration carried by ctx, or the defaults when it carries none.
+func FromContext(ctx context.Context) *Config {
+	if cfg, ok := ctx.Value(contextKey{}).(*Config); ok {
+		return cfg
+	}
+	return defaults
+}
+
+// From returns the configuration the request is served with.
+func From(r *http.Request) *Config {
+	return FromContext(r.Context())
+}
@@ -0,0 +1,332 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is the configuration file read when none is named with -config or CONFIG_FILE. It is optional.
+const DefaultFile = "forum.yaml"
+
+/*
+Load reads the configuration from, in increasing order of precedence, the defaults, the YAML file named by the -config flag or CONFIG_FILE (forum.yaml when present), the environment and the flags in args. Variables in a .env file in the working directory are added to the environment, without replacing variables that are already set. A lone number in args is taken as the port, as in 'go run main.go 8080'.
+*/
+func Load(args []string) (*Config, error) {
+	flags := flag.NewFlagSet("forum", flag.ContinueOnError)
+	load := Flags(flags)
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	switch rest := flags.Args(); len(rest) {
+	case 0:
+	case 1:
+		n, err := strconv.Atoi(rest[0])
+		if err != nil {
+			return nil, fmt.Errorf("error converting %v to int: %v", rest[0], err)
+		}
+		if err := flags.Set("port", strconv.Itoa(n)); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("usage: 'go run main.go' OR 'go run main.go [PORT]'")
+	}
+
+	return load()
+}
+
+/*
+Flags adds the -config, -port, -db and -base-url flags to flags, for commands with flags of their own. Once flags is parsed, the returned function reads the configuration as Load does, with the flags that were set.
+*/
+func Flags(flags *flag.FlagSet) func() (*Config, error) {
+	def := Default()
+	file := flags.String("config", "", "YAML configuration file (default "+DefaultFile+" when present)")
+	port := flags.Int("port", def.Server.Port, "port to listen on")
+	dbPath := flags.String("db", def.Database.Path, "path of the SQLite database")
+	baseURL := flags.String("base-url", "", "public address of the forum, such as https://forum.example.com")
+
+	return func() (*Config, error) {
+		cfg := Default()
+
+		if err := loadDotEnv(".env"); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read .env: %w", err)
+		}
+
+		path := *file
+		if path == "" {
+			path = os.Getenv("CONFIG_FILE")
+		}
+		if path != "" {
+			if err := cfg.readFile(path); err != nil {
+				return nil, err
+			}
+		} else if err := cfg.readFile(DefaultFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+
+		if err := cfg.readEnv(); err != nil {
+			return nil, err
+		}
+
+		flags.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "port":
+				cfg.Server.Port = *port
+			case "db":
+				cfg.Database.Path = *dbPath
+			case "base-url":
+				cfg.Server.BaseURL = *baseURL
+			}
+		})
+
+		if err := cfg.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid configuration:\n%w", err)
+		}
+		return cfg, nil
+	}
+}
+
+// readFile reads a YAML configuration file over c. Unknown settings are an error, to catch typos.
+func (c *Config) readFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadDotEnv sets the variables of a .env file that are not already set in the environment.
+func loadDotEnv(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		if _, set := os.LookupEnv(key); !set {
+			os.Setenv(key, strings.TrimSpace(value))
+		}
+	}
+	return scanner.Err()
+}
+
+// readEnv applies the environment variables that are set over c.
+func (c *Config) readEnv() error {
+	e := &envReader{}
+
+	e.int(&c.Server.Port, "PORT")
+	e.string(&c.Server.BaseURL, "BASE_URL")
+	e.list(&c.Server.AllowedHosts, "ALLOWED_HOSTS")
+	e.string(&c.Server.SecretKey, "SECRET_KEY")
+	e.list(&c.Server.TrustedProxies, "TRUSTED_PROXIES")
+	e.duration(&c.Server.ReadTimeout, "SERVER_READ_TIMEOUT")
+	e.duration(&c.Server.WriteTimeout, "SERVER_WRITE_TIMEOUT")
+	e.duration(&c.Server.DrainDelay, "DRAIN_DELAY")
+	e.duration(&c.Server.ShutdownTimeout, "SHUTDOWN_TIMEOUT")
+
+	e.string(&c.Database.Path, "DATABASE_PATH")
+
+	e.duration(&c.Session.IdleTimeout, "SESSION_IDLE_TIMEOUT")
+	e.duration(&c.Session.Lifetime, "SESSION_LIFETIME")
+	e.duration(&c.Session.RememberMe, "REMEMBER_ME_LIFETIME")
+	e.bool(&c.Session.SecureCookies, "SECURE_COOKIES")
+
+	e.string(&c.Uploads.Dir, "UPLOAD_DIR")
+	e.int(&c.Uploads.MaxFiles, "UPLOAD_MAX_FILES")
+	e.size(&c.Uploads.MaxFileSize, "UPLOAD_MAX_FILE_SIZE")
+	e.size(&c.Uploads.MaxTotalSize, "UPLOAD_MAX_TOTAL_SIZE")
+
+	e.string(&c.Templates.Dir, "TEMPLATE_DIR")
+	e.bool(&c.Templates.Reload, "TEMPLATE_RELOAD")
+
+	e.string(&c.Mail.From, "MAIL_FROM")
+	e.string(&c.Mail.SMTPHost, "SMTP_HOST")
+	e.string(&c.Mail.SMTPPort, "SMTP_PORT")
+	e.string(&c.Mail.SMTPUsername, "SMTP_USERNAME")
+	e.string(&c.Mail.SMTPPassword, "SMTP_PASSWORD")
+	e.string(&c.Mail.Dir, "MAIL_DIR")
+
+	e.int(&c.Jobs.Workers, "JOB_WORKERS")
+	e.string(&c.Jobs.Digest, "DIGEST_SCHEDULE")
+
+	e.bool(&c.Features.Registration, "FEATURE_REGISTRATION")
+	e.bool(&c.Features.Passkeys, "FEATURE_PASSKEYS")
+
+	e.string(&c.Metrics.Token, "METRICS_TOKEN")
+
+	e.string(&c.Log.Level, "LOG_LEVEL")
+	e.string(&c.Log.Format, "LOG_FORMAT")
+	e.bool(&c.Log.AccessLog, "ACCESS_LOG")
+
+	e.string(&c.Tracing.Exporter, "TRACING_EXPORTER")
+	e.string(&c.Tracing.Endpoint, "TRACING_ENDPOINT")
+	e.float(&c.Tracing.SampleRatio, "TRACING_SAMPLE_RATIO")
+
+	c.readProviderEnv(e)
+	return errors.Join(e.errs...)
+}
+
+/*
+readProviderEnv applies the sign-in provider variables: GOOGLE_* and GITHUB_* for the credentials of the built-in providers, OAUTH_PROVIDERS to name other providers, and OAUTH_<NAME>_* for the settings of any provider.
+*/
+func (c *Config) readProviderEnv(e *envReader) {
+	if c.OAuth == nil {
+		c.OAuth = make(map[string]Provider)
+	}
+	for _, name := range []string{"google", "github"} {
+		p := c.OAuth[name]
+		prefix := strings.ToUpper(name) + "_"
+		e.string(&p.ClientID, prefix+"CLIENT_ID")
+		e.string(&p.ClientSecret, prefix+"CLIENT_SECRET")
+		c.OAuth[name] = p
+	}
+	for _, name := range strings.FieldsFunc(os.Getenv("OAUTH_PROVIDERS"), isListSeparator) {
+		name = strings.ToLower(name)
+		if _, ok := c.OAuth[name]; !ok {
+			c.OAuth[name] = Provider{}
+		}
+	}
+
+	names := make([]string, 0, len(c.OAuth))
+	for name := range c.OAuth {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		p := c.OAuth[name]
+		prefix := "OAUTH_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		e.string(&p.ClientID, prefix+"CLIENT_ID")
+		e.string(&p.ClientSecret, prefix+"CLIENT_SECRET")
+		e.string(&p.DisplayName, prefix+"DISPLAY_NAME")
+		e.string(&p.Issuer, prefix+"ISSUER")
+		e.string(&p.AuthURL, prefix+"AUTH_URL")
+		e.string(&p.TokenURL, prefix+"TOKEN_URL")
+		e.string(&p.UserInfoURL, prefix+"USERINFO_URL")
+		e.string(&p.JWKSURL, prefix+"JWKS_URL")
+		e.string(&p.EmailsURL, prefix+"EMAILS_URL")
+		e.list(&p.Scopes, prefix+"SCOPES")
+		e.string(&p.Claims.Subject, prefix+"CLAIM_SUBJECT")
+		e.string(&p.Claims.Email, prefix+"CLAIM_EMAIL")
+		e.string(&p.Claims.EmailVerified, prefix+"CLAIM_EMAIL_VERIFIED")
+		e.string(&p.Claims.Username, prefix+"CLAIM_USERNAME")
+		if _, ok := lookupEnv(prefix + "PKCE"); ok {
+			pkce := true
+			e.bool(&pkce, prefix+"PKCE")
+			p.PKCE = &pkce
+		}
+		c.OAuth[name] = p
+	}
+}
+
+func isListSeparator(r rune) bool {
+	return r == ',' || r == ' '
+}
+
+// lookupEnv returns an environment variable, treating empty variables as unset like the rest of the forum always has.
+func lookupEnv(key string) (string, bool) {
+	value := strings.TrimSpace(os.Getenv(key))
+	return value, value != ""
+}
+
+// envReader reads typed environment variables into configuration fields, collecting the invalid ones.
+type envReader struct {
+	errs []error
+}
+
+func (e *envReader) invalid(key, value, want string) {
+	e.errs = append(e.errs, fmt.Errorf("%s: %q is not %s", key, value, want))
+}
+
+func (e *envReader) string(field *string, key string) {
+	if value, ok := lookupEnv(key); ok {
+		*field = value
+	}
+}
+
+func (e *envReader) list(field *[]string, key string) {
+	if value, ok := lookupEnv(key); ok {
+		*field = strings.FieldsFunc(value, isListSeparator)
+	}
+}
+
+func (e *envReader) int(field *int, key string) {
+	if value, ok := lookupEnv(key); ok {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			e.invalid(key, value, "a number")
+			return
+		}
+		*field = n
+	}
+}
+
+func (e *envReader) float(field *float64, key string) {
+	if value, ok := lookupEnv(key); ok {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			e.invalid(key, value, "a number")
+			return
+		}
+		*field = f
+	}
+}
+
+func (e *envReader) bool(field *bool, key string) {
+	if value, ok := lookupEnv(key); ok {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			e.invalid(key, value, "true or false")
+			return
+		}
+		*field = b
+	}
+}
+
+func (e *envReader) duration(field *time.Duration, key string) {
+	if value, ok := lookupEnv(key); ok {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			e.invalid(key, value, "a duration such as 12h")
+			return
+		}
+		*field = d
+	}
+}
+
+func (e *envReader) size(field *ByteSize, key string) {
+	if value, ok := lookupEnv(key); ok {
+		if err := field.UnmarshalText([]byte(value)); err != nil {
+			e.invalid(key, value, "a size such as 20MB")
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"runtime"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/jesee-kuya/forum/backend/metrics"
+	"github.com/jesee-kuya/forum/backend/tracing"
+)
+
+// modulePath prefixes the functions of the forum; the first of them up the stack names a query.
+const modulePath = "github.com/jesee-kuya/forum/"
+
+/*
+InstrumentDriver wraps d so that every query and statement run through it is timed in the forum_db_query_duration_seconds metric and traced in a span when it is run with the context of a request or job, as a child of its span. Queries are named after the forum function that ran them, such as "repositories.GetUserByEmail", so the timings read per repository call without touching the repositories themselves. A query is followed until its rows are closed, as SQLite steps through results lazily. Statements prepared explicitly are not instrumented.
+*/
+func InstrumentDriver(d driver.Driver) driver.Driver {
+	return instrumentedDriver{d}
+}
+
+type instrumentedDriver struct {
+	driver.Driver
+}
+
+func (d instrumentedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{conn}, nil
+}
+
+// instrumentedConn times and traces the queries run on a connection and passes everything else through.
+type instrumentedConn struct {
+	driver.Conn
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	q := startQuery(ctx, query)
+	result, err := execer.ExecContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		q.end(err)
+	}
+	return result, err
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	q := startQuery(ctx, query)
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if err != nil {
+		if err != driver.ErrSkip {
+			q.end(err)
+		}
+		return nil, err
+	}
+	return &instrumentedRows{Rows: rows, query: q}, nil
+}
+
+func (c *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *instrumentedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+// instrumentedRows ends its query once it is closed.
+type instrumentedRows struct {
+	driver.Rows
+	query  *runningQuery
+	closed bool
+}
+
+func (r *instrumentedRows) Close() error {
+	err := r.Rows.Close()
+	if !r.closed {
+		r.closed = true
+		r.query.end(err)
+	}
+	return err
+}
+
+// runningQuery is a query being timed and traced.
+type runningQuery struct {
+	label string
+	start time.Time
+	span  trace.Span
+}
+
+/*
+startQuery names a query after the forum function running it and starts its span. It must be called directly by the method of instrumentedConn running the query, as it looks for that function a fixed number of frames up the stack.
+*/
+func startQuery(ctx context.Context, query string) *runningQuery {
+	label := queryLabel()
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		// Outside of a trace, such as the job runner polling for work, a span would only be noise
+		return &runningQuery{label: label, start: time.Now(), span: trace.SpanFromContext(ctx)}
+	}
+	_, span := tracing.Tracer().Start(ctx, label,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemSqlite,
+			semconv.DBOperationName(operation(query)),
+			semconv.DBQueryText(query),
+			attribute.String("code.function", label),
+		))
+	return &runningQuery{label: label, start: time.Now(), span: span}
+}
+
+func (q *runningQuery) end(err error) {
+	metrics.ObserveQuery(q.label, time.Since(q.start))
+	if err != nil {
+		q.span.RecordError(err)
+		q.span.SetStatus(codes.Error, err.Error())
+	}
+	q.span.End()
+}
+
+// operation returns the SQL keyword a statement starts with, such as SELECT or INSERT.
+func operation(query string) string {
+	keyword, _, _ := strings.Cut(strings.TrimSpace(query), " ")
+	return strings.ToUpper(keyword)
+}
+
+/*
+queryLabel names the forum function a query was run from, the first one up the stack past the instrumented connection, trimmed to its package and name. Queries run from elsewhere are labelled "other".
+*/
+func queryLabel() string {
+	pcs := make([]uintptr, 32)
+	// Skip runtime.Callers, queryLabel, startQuery and the instrumentedConn method
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(4, pcs)])
+	for {
+		frame, more := frames.Next()
+		if name := frame.Function; strings.HasPrefix(name, modulePath) {
+			return name[strings.LastIndex(name, "/")+1:]
+		}
+		if !more {
+			return "other"
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/jesee-kuya/forum/backend/metrics"
+)
+
+// countUsers stands in for a repository function running queries.
+func countUsers(ctx context.Context, db *sql.DB) (int, error) {
+	var count int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&count)
+	return count, err
+}
+
+// queryCount returns how many queries were timed under label.
+func queryCount(t *testing.T, label string) uint64 {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	metrics.Handler(func() (int, error) { return 0, nil }, "").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	prefix := fmt.Sprintf("forum_db_query_duration_seconds_count{query=%q} ", label)
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if count, ok := strings.CutPrefix(line, prefix); ok {
+			n, err := strconv.ParseUint(count, 10, 64)
+			if err != nil {
+				t.Fatalf("Failed to read %q: %v", line, err)
+			}
+			return n
+		}
+	}
+	return 0
+}
+
+// recordSpans sends the spans started for the rest of the test to a recorder.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func openInstrumented(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open(DriverName, filepath.Join(t.TempDir(), "instrumented.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO users (id) VALUES (?), (?)", 1, 2); err != nil {
+		t.Fatalf("Failed to insert users: %v", err)
+	}
+	return db
+}
+
+func TestInstrumentDriverTimesQueries(t *testing.T) {
+	db := openInstrumented(t)
+	if got := queryCount(t, "database.openInstrumented"); got < 2 {
+		t.Errorf("Expected the statements of openInstrumented to be timed, got %d", got)
+	}
+
+	before := queryCount(t, "database.countUsers")
+	for i := 0; i < 3; i++ {
+		count, err := countUsers(context.Background(), db)
+		if err != nil {
+			t.Fatalf("Failed to count users: %v", err)
+		}
+		if count != 2 {
+			t.Errorf("Expected 2 users, got %d", count)
+		}
+	}
+	if got := queryCount(t, "database.countUsers") - before; got != 3 {
+		t.Errorf("Expected 3 queries timed for countUsers, got %d", got)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin transaction: %v", err)
+	}
+	before = queryCount(t, "database.TestInstrumentDriverTimesQueries")
+	if _, err := tx.Exec("INSERT INTO users (id) VALUES (3)"); err != nil {
+		t.Fatalf("Failed to insert in a transaction: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+	if got := queryCount(t, "database.TestInstrumentDriverTimesQueries") - before; got != 1 {
+		t.Errorf("Expected statements in transactions to be timed, got %d", got)
+	}
+	if err := db.Ping(); err != nil {
+		t.Errorf("Expected the wrapped connection to answer pings, got %v", err)
+	}
+}
+
+func TestInstrumentDriverTracesQueries(t *testing.T) {
+	db := openInstrumented(t)
+	recorder := recordSpans(t)
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+	if _, err := countUsers(ctx, db); err != nil {
+		t.Fatalf("Failed to count users: %v", err)
+	}
+	parent.End()
+	if _, err := countUsers(context.Background(), db); err != nil {
+		t.Fatalf("Failed to count users: %v", err)
+	}
+	if ended := len(recorder.Ended()); ended != 2 {
+		t.Errorf("Expected only the query run in the trace to be traced, got %d spans", ended)
+	}
+
+	var query sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == "database.countUsers" {
+			query = span
+		}
+	}
+	if query == nil {
+		t.Fatalf("Expected a span named after countUsers, got %d spans", len(recorder.Ended()))
+	}
+	if query.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("Expected the query span to be a child of the request span")
+	}
+	attrs := map[string]string{}
+	for _, attr := range query.Attributes() {
+		attrs[string(attr.Key)] = attr.Value.Emit()
+	}
+	if attrs["db.operation.name"] != "SELECT" || attrs["db.query.text"] != "SELECT COUNT(*) FROM users" {
+		t.Errorf("Expected the statement to be recorded, got %v", attrs)
+	}
+}
@@ -0,0 +1,207 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"html"
+)
+
+// migration upgrades a database created from an older version of schema.sql.
+type migration func(tx *sql.Tx) error
+
+/*
+migrations are applied in order after schema.sql, and the number already applied is stored in PRAGMA user_version. schema.sql only creates missing tables, so a column added to an existing table must be added both there and here.
+*/
+var migrations = []migration{
+	addSessionMetadata,
+	addSessionRenewal,
+	addAccountLockout,
+	addEmailVerification,
+	addTwoFactor,
+	unescapeText,
+	addUserLanguage,
+	addUserDigest,
+}
+
+// SchemaVersion is the user_version of a database with every migration applied.
+var SchemaVersion = len(migrations)
+
+// Version returns the schema version of the database, SchemaVersion once it is up to date.
+func Version(ctx context.Context, db *sql.DB) (int, error) {
+	var version int
+	if err := db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// migrate applies the migrations the database has not seen yet.
+func migrate(db *sql.DB) error {
+	version, err := Version(context.Background(), db)
+	if err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to start migration %d: %w", i+1, err)
+		}
+
+		if err := migrations[i](tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", i+1, err)
+		}
+
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %d: %w", i+1, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// addColumn adds a column to a table unless it already exists, as it does in databases created from the current schema.sql.
+func addColumn(tx *sql.Tx, table, column, definition string) error {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, colType    string
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return fmt.Errorf("failed to scan column of %s: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating columns of %s: %w", table, err)
+	}
+	rows.Close()
+
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return fmt.Errorf("failed to add %s.%s: %w", table, column, err)
+	}
+	return nil
+}
+
+// addSessionMetadata records where and when each session was used, so users can review their sessions.
+func addSessionMetadata(tx *sql.Tx) error {
+	columns := [][2]string{
+		{"created_on", "TIMESTAMP NULL"},
+		{"last_seen", "TIMESTAMP NULL"},
+		{"ip_address", "TEXT NOT NULL DEFAULT ''"},
+		{"user_agent", "TEXT NOT NULL DEFAULT ''"},
+		{"device", "TEXT NOT NULL DEFAULT ''"},
+	}
+	for _, column := range columns {
+		if err := addColumn(tx, "tblSessions", column[0], column[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addSessionRenewal lets sessions slide forward with activity up to an absolute expiry.
+func addSessionRenewal(tx *sql.Tx) error {
+	if err := addColumn(tx, "tblSessions", "absolute_expires_at", "TIMESTAMP NULL"); err != nil {
+		return err
+	}
+	return addColumn(tx, "tblSessions", "remember_me", "INTEGER NOT NULL DEFAULT 0")
+}
+
+// addAccountLockout lets accounts be locked temporarily after repeated failed sign-ins.
+func addAccountLockout(tx *sql.Tx) error {
+	return addColumn(tx, "tblUsers", "locked_until", "TIMESTAMP NULL")
+}
+
+// addEmailVerification tracks whether users confirmed their email address. Accounts that existed before are trusted.
+func addEmailVerification(tx *sql.Tx) error {
+	if err := addColumn(tx, "tblUsers", "email_verified", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	_, err := tx.Exec("UPDATE tblUsers SET email_verified = 1")
+	return err
+}
+
+// addTwoFactor gives users a role and lets them protect their account with a TOTP second factor.
+func addTwoFactor(tx *sql.Tx) error {
+	columns := [][2]string{
+		{"user_role", "TEXT NOT NULL DEFAULT 'user'"},
+		{"totp_secret", "TEXT NULL"},
+		{"totp_enabled", "INTEGER NOT NULL DEFAULT 0"},
+		{"totp_last_step", "INTEGER NOT NULL DEFAULT 0"},
+	}
+	for _, column := range columns {
+		if err := addColumn(tx, "tblUsers", column[0], column[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+unescapeText undoes the HTML escaping posts, comments and attachment texts were stored with. Pages now escape text as they render it, so text stored escaped would show its entities, such as &amp;#39; for an apostrophe.
+*/
+func unescapeText(tx *sql.Tx) error {
+	columns := [][2]string{
+		{"tblPosts", "post_title"},
+		{"tblPosts", "body"},
+		{"tblAttachments", "caption"},
+		{"tblAttachments", "alt_text"},
+	}
+	for _, column := range columns {
+		table, name := column[0], column[1]
+		rows, err := tx.Query(fmt.Sprintf("SELECT id, %s FROM %s WHERE %s LIKE '%%&%%'", name, table, name))
+		if err != nil {
+			return fmt.Errorf("failed to read %s.%s: %w", table, name, err)
+		}
+		texts := make(map[int]string)
+		for rows.Next() {
+			var (
+				id   int
+				text string
+			)
+			if err := rows.Scan(&id, &text); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan %s.%s: %w", table, name, err)
+			}
+			texts[id] = text
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for id, text := range texts {
+			if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET %s = ? WHERE id = ?", table, name), html.UnescapeString(text), id); err != nil {
+				return fmt.Errorf("failed to update %s.%s: %w", table, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// addUserLanguage saves the language users chose for the forum, empty until they choose one.
+func addUserLanguage(tx *sql.Tx) error {
+	return addColumn(tx, "tblUsers", "user_language", "TEXT NOT NULL DEFAULT ''")
+}
+
+// addUserDigest subscribes users to the digest emails: NULL when they are not subscribed, otherwise the time their next digest starts from.
+func addUserDigest(tx *sql.Tx) error {
+	return addColumn(tx, "tblUsers", "user_digest_since", "TIMESTAMP NULL")
+}
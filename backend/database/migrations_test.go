@@ -0,0 +1,178 @@
+package database
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// firstReleaseSchema is schema.sql as shipped before migrations existed
+const firstReleaseSchema = `
+	CREATE TABLE IF NOT EXISTS tblUsers (
+	  id INTEGER PRIMARY KEY,
+	  username TEXT UNIQUE NOT NULL, 
+	  email TEXT UNIQUE NOT NULL,
+	  user_password TEXT NULL,
+	  auth_provider TEXT NOT NULL DEFAULT '',
+	  joined_on TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS tblPosts (
+	  id INTEGER PRIMARY KEY,
+	  user_id INTEGER NOT NULL,
+	  post_title TEXT,
+	  body TEXT,
+	  parent_id INTEGER DEFAULT NULL,
+	  created_on TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	  post_status TEXT DEFAULT 'visible',
+	  media_url TEXT DEFAULT '', 
+	  FOREIGN KEY (user_id) REFERENCES tblUsers (id),
+	  FOREIGN KEY (parent_id) REFERENCES tblPosts (id)
+	);
+
+	CREATE TABLE IF NOT EXISTS tblPostCategories (
+	  id INTEGER PRIMARY KEY,
+	  post_id INTEGER NOT NULL,
+	  category TEXT,
+	  FOREIGN KEY (post_id) REFERENCES tblPosts (id)
+	);
+
+	CREATE TABLE IF NOT EXISTS tblReactions (
+	  id INTEGER PRIMARY KEY,
+	  reaction TEXT,
+	  reaction_status TEXT DEFAULT 'clicked',
+	  user_id INTEGER NOT NULL,
+	  post_id INTEGER NOT NULL,
+	  FOREIGN KEY (user_id) REFERENCES tblUsers (id),
+	  FOREIGN KEY (post_id) REFERENCES tblPosts (id)
+	);
+
+	CREATE TABLE IF NOT EXISTS tblSessions (
+	  id INTEGER PRIMARY KEY,
+	  user_id INTEGER NOT NULL,
+	  session_token TEXT NOT NULL UNIQUE,
+	  expires_at TIMESTAMP NULL,
+	  FOREIGN KEY (user_id) REFERENCES tblUsers (id)
+	);
+`
+
+// openTestDB applies a schema to a temporary database and then schema.sql, as CreateConnection does
+func openTestDB(t *testing.T, initial string) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test_migrate.db"))
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if initial != "" {
+		if _, err := db.Exec(initial); err != nil {
+			t.Fatalf("Failed to create initial schema: %v", err)
+		}
+	}
+
+	current, err := os.ReadFile("schema.sql")
+	if err != nil {
+		t.Fatalf("Failed to read schema.sql: %v", err)
+	}
+	if _, err := db.Exec(string(current)); err != nil {
+		t.Fatalf("Failed to apply schema.sql: %v", err)
+	}
+	return db
+}
+
+// columnNames returns the columns of a table in the test database
+func columnNames(t *testing.T, db *sql.DB, table string) map[string]bool {
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		t.Fatalf("Failed to inspect %s: %v", table, err)
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatalf("Failed to scan column: %v", err)
+		}
+		columns[name] = true
+	}
+	return columns
+}
+
+// assertMigrated runs the migrations twice and checks the resulting schema
+func assertMigrated(t *testing.T, db *sql.DB) {
+	// Running twice must be a no-op the second time
+	for i := 0; i < 2; i++ {
+		if err := migrate(db); err != nil {
+			t.Fatalf("migrate failed on run %d: %v", i+1, err)
+		}
+	}
+
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		t.Fatalf("Failed to read user_version: %v", err)
+	}
+	if version != SchemaVersion {
+		t.Errorf("Expected schema version %d, got %d", SchemaVersion, version)
+	}
+
+	expected := map[string][]string{
+		"tblSessions": {"created_on", "last_seen", "ip_address", "user_agent", "device", "absolute_expires_at", "remember_me"},
+		"tblUsers":    {"locked_until", "email_verified", "user_role", "totp_secret", "totp_enabled", "totp_last_step", "user_language", "user_digest_since"},
+	}
+	for table, names := range expected {
+		columns := columnNames(t, db, table)
+		for _, column := range names {
+			if !columns[column] {
+				t.Errorf("Expected column %s.%s", table, column)
+			}
+		}
+	}
+}
+
+func TestMigrate_UpgradesFirstRelease(t *testing.T) {
+	db := openTestDB(t, firstReleaseSchema+`INSERT INTO tblUsers (username, email, user_password) VALUES ('alice', 'alice@example.com', 'hash');`)
+	assertMigrated(t, db)
+
+	// Accounts created before email verification existed are trusted
+	var verified bool
+	if err := db.QueryRow("SELECT email_verified FROM tblUsers WHERE username = 'alice'").Scan(&verified); err != nil || !verified {
+		t.Errorf("Expected existing user to be verified, got %v (%v)", verified, err)
+	}
+}
+
+func TestMigrate_FreshDatabase(t *testing.T) {
+	db := openTestDB(t, "")
+	assertMigrated(t, db)
+}
+
+func TestMigrate_UnescapesText(t *testing.T) {
+	db := openTestDB(t, firstReleaseSchema+`
+INSERT INTO tblUsers (username, email, user_password) VALUES ('alice', 'alice@example.com', 'hash');
+INSERT INTO tblPosts (id, user_id, post_title, body) VALUES (1, 1, 'Fish &amp; chips', 'It&#39;s 3 &lt; 4, &#34;really&#34; &amp;lt;');`)
+	if _, err := db.Exec(`INSERT INTO tblAttachments (post_id, file_url, caption, alt_text) VALUES (1, 'uploads/a.png', 'Tom &amp; Jerry', 'A &lt;cat&gt;')`); err != nil {
+		t.Fatalf("Failed to add attachment: %v", err)
+	}
+	assertMigrated(t, db)
+
+	var title, body, caption, alt string
+	if err := db.QueryRow("SELECT post_title, body FROM tblPosts WHERE id = 1").Scan(&title, &body); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow("SELECT caption, alt_text FROM tblAttachments WHERE post_id = 1").Scan(&caption, &alt); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct{ got, want string }{
+		{title, "Fish & chips"},
+		{body, `It's 3 < 4, "really" &lt;`},
+		{caption, "Tom & Jerry"},
+		{alt, "A <cat>"},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("Expected %q, got %q", tc.want, tc.got)
+		}
+	}
+}
@@ -4,11 +4,19 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 
-	_ "github.com/mattn/go-sqlite3" // SQLite3 driver
+	"github.com/mattn/go-sqlite3"
 )
 
+// DriverName is the SQLite driver the forum opens its database with, timing and tracing every query.
+const DriverName = "sqlite3-instrumented"
+
+func init() {
+	sql.Register(DriverName, InstrumentDriver(&sqlite3.SQLiteDriver{}))
+}
+
 // executeSQLFile reads and executes SQL statements from a file on the given database connection
 func executeSQLFile(db *sql.DB) error {
 	content, err := os.ReadFile("./backend/database/schema.sql")
@@ -26,9 +34,12 @@ func executeSQLFile(db *sql.DB) error {
 	return nil
 }
 
-func CreateConnection() *sql.DB {
+// CreateConnection opens the SQLite database at path, creating it and bringing its schema up to date as needed.
+func CreateConnection(path string) *sql.DB {
 	// Open SQLite database connection
-	db, err := sql.Open("sqlite3", "backend/database/forum.db")
+	// Wait for locks instead of failing, as handlers and background jobs write concurrently,
+	// and use write-ahead logging so readers are not blocked by a writer
+	db, err := sql.Open(DriverName, path+"?_busy_timeout=5000&_journal_mode=WAL")
 	if err != nil {
 		log.Fatalf("failed to open database: %v", err)
 	}
@@ -39,7 +50,22 @@ func CreateConnection() *sql.DB {
 		log.Fatalf("failed to execute SQL file: %v", err)
 	}
 
-	log.Println("Database schema successfully applied!")
+	err = migrate(db)
+	if err != nil {
+		log.Fatalf("failed to migrate database: %v", err)
+	}
+
+	slog.Info("Database schema successfully applied!")
 
 	return db
 }
+
+/*
+Close checkpoints the write-ahead log into the database file and closes the connection, so the database is complete on its own once the forum has stopped. It must be called after everything using db is done.
+*/
+func Close(db *sql.DB) error {
+	if _, err := db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		slog.Error("Failed to checkpoint the database", "err", err)
+	}
+	return db.Close()
+}
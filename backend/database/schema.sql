@@ -6,7 +6,15 @@ CREATE TABLE IF NOT EXISTS tblUsers (
   email TEXT UNIQUE NOT NULL,
   user_password TEXT NULL,
   auth_provider TEXT NOT NULL DEFAULT '',
-  joined_on TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+  joined_on TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  locked_until TIMESTAMP NULL,
+  email_verified INTEGER NOT NULL DEFAULT 0,
+  user_role TEXT NOT NULL DEFAULT 'user',
+  totp_secret TEXT NULL,
+  totp_enabled INTEGER NOT NULL DEFAULT 0,
+  totp_last_step INTEGER NOT NULL DEFAULT 0,
+  user_language TEXT NOT NULL DEFAULT '',
+  user_digest_since TIMESTAMP NULL
 );
 
 CREATE TABLE IF NOT EXISTS tblPosts (
@@ -44,5 +52,123 @@ CREATE TABLE IF NOT EXISTS tblSessions (
   user_id INTEGER NOT NULL,
   session_token TEXT NOT NULL UNIQUE,
   expires_at TIMESTAMP NULL,
+  created_on TIMESTAMP NULL,
+  last_seen TIMESTAMP NULL,
+  ip_address TEXT NOT NULL DEFAULT '',
+  user_agent TEXT NOT NULL DEFAULT '',
+  device TEXT NOT NULL DEFAULT '',
+  absolute_expires_at TIMESTAMP NULL,
+  remember_me INTEGER NOT NULL DEFAULT 0,
+  FOREIGN KEY (user_id) REFERENCES tblUsers (id)
+);
+
+CREATE INDEX IF NOT EXISTS idxSessionsUser ON tblSessions (user_id);
+
+CREATE TABLE IF NOT EXISTS tblAttachments (
+  id INTEGER PRIMARY KEY,
+  post_id INTEGER NOT NULL,
+  file_url TEXT NOT NULL,
+  caption TEXT DEFAULT '',
+  alt_text TEXT DEFAULT '',
+  position INTEGER NOT NULL DEFAULT 0,
+  file_size INTEGER NOT NULL DEFAULT 0,
+  created_on TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (post_id) REFERENCES tblPosts (id)
+);
+
+CREATE TABLE IF NOT EXISTS tblJobs (
+  id INTEGER PRIMARY KEY,
+  job_type TEXT NOT NULL,
+  payload TEXT NOT NULL DEFAULT '{}',
+  job_status TEXT NOT NULL DEFAULT 'pending',
+  attempts INTEGER NOT NULL DEFAULT 0,
+  max_attempts INTEGER NOT NULL DEFAULT 5,
+  run_at TIMESTAMP NOT NULL,
+  last_error TEXT NOT NULL DEFAULT '',
+  created_on TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  updated_on TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idxJobsDue ON tblJobs (job_status, run_at);
+
+CREATE TABLE IF NOT EXISTS tblLoginAttempts (
+  id INTEGER PRIMARY KEY,
+  user_id INTEGER NULL,
+  identifier TEXT NOT NULL DEFAULT '',
+  ip_address TEXT NOT NULL DEFAULT '',
+  succeeded INTEGER NOT NULL DEFAULT 0,
+  attempted_on TIMESTAMP NOT NULL,
+  FOREIGN KEY (user_id) REFERENCES tblUsers (id)
+);
+
+CREATE INDEX IF NOT EXISTS idxLoginAttemptsUser ON tblLoginAttempts (user_id, attempted_on);
+CREATE INDEX IF NOT EXISTS idxLoginAttemptsIP ON tblLoginAttempts (ip_address, attempted_on);
+
+CREATE TABLE IF NOT EXISTS tblAuditLog (
+  id INTEGER PRIMARY KEY,
+  user_id INTEGER NULL,
+  event TEXT NOT NULL,
+  ip_address TEXT NOT NULL DEFAULT '',
+  user_agent TEXT NOT NULL DEFAULT '',
+  details TEXT NOT NULL DEFAULT '',
+  created_on TIMESTAMP NOT NULL,
+  FOREIGN KEY (user_id) REFERENCES tblUsers (id)
+);
+
+CREATE INDEX IF NOT EXISTS idxAuditLogUser ON tblAuditLog (user_id, created_on);
+
+CREATE TABLE IF NOT EXISTS tblUserTokens (
+  id INTEGER PRIMARY KEY,
+  user_id INTEGER NOT NULL,
+  purpose TEXT NOT NULL,
+  token_hash TEXT NOT NULL UNIQUE,
+  expires_at TIMESTAMP NOT NULL,
+  used_at TIMESTAMP NULL,
+  created_on TIMESTAMP NOT NULL,
+  FOREIGN KEY (user_id) REFERENCES tblUsers (id)
+);
+
+CREATE TABLE IF NOT EXISTS tblUsernameHistory (
+  id INTEGER PRIMARY KEY,
+  user_id INTEGER NOT NULL,
+  username TEXT NOT NULL UNIQUE,
+  changed_on TIMESTAMP NOT NULL,
+  FOREIGN KEY (user_id) REFERENCES tblUsers (id)
+);
+
+CREATE TABLE IF NOT EXISTS tblRecoveryCodes (
+  id INTEGER PRIMARY KEY,
+  user_id INTEGER NOT NULL,
+  code_hash TEXT NOT NULL,
+  used_at TIMESTAMP NULL,
+  created_on TIMESTAMP NOT NULL,
+  FOREIGN KEY (user_id) REFERENCES tblUsers (id)
+);
+
+CREATE TABLE IF NOT EXISTS tblSiteSettings (
+  name TEXT PRIMARY KEY,
+  value TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS tblPasskeys (
+  id INTEGER PRIMARY KEY,
+  user_id INTEGER NOT NULL,
+  credential_id TEXT NOT NULL UNIQUE,
+  credential TEXT NOT NULL,
+  name TEXT NOT NULL DEFAULT '',
+  created_on TIMESTAMP NOT NULL,
+  last_used_on TIMESTAMP NULL,
+  FOREIGN KEY (user_id) REFERENCES tblUsers (id)
+);
+
+CREATE TABLE IF NOT EXISTS tblUserIdentities (
+  id INTEGER PRIMARY KEY,
+  user_id INTEGER NOT NULL,
+  provider TEXT NOT NULL,
+  subject TEXT NOT NULL,
+  email TEXT NOT NULL DEFAULT '',
+  created_on TIMESTAMP NOT NULL,
+  UNIQUE (provider, subject),
+  UNIQUE (user_id, provider),
   FOREIGN KEY (user_id) REFERENCES tblUsers (id)
 );
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCloseCheckpointsTheLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "forum.db")
+	db, err := sql.Open("sqlite3", path+"?_journal_mode=WAL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE TABLE tblNotes (body TEXT); INSERT INTO tblNotes VALUES ('kept')"); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path + "-wal"); err != nil || info.Size() == 0 {
+		t.Fatalf("expected the write to go to the log first: %v", err)
+	}
+
+	// Another connection, such as a backup tool, keeps SQLite from cleaning up the log by itself on close.
+	other, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	var body string
+	if err := other.QueryRow("SELECT body FROM tblNotes").Scan(&body); err != nil || body != "kept" {
+		t.Fatalf("got %q, %v from another connection", body, err)
+	}
+
+	if err := Close(db); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path + "-wal"); err == nil && info.Size() > 0 {
+		t.Errorf("the log still holds %d bytes after Close", info.Size())
+	}
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jesee-kuya/forum/backend/i18n"
+	"github.com/jesee-kuya/forum/backend/models"
+	"github.com/jesee-kuya/forum/backend/repositories"
+	"github.com/jesee-kuya/forum/backend/util"
+)
+
+// AuditTwoFactorPolicyChanged is written to the audit log when an admin changes which roles must use two-factor authentication.
+const AuditTwoFactorPolicyChanged = "two_factor_policy_changed"
+
+// staffRoles are the roles two-factor authentication can be enforced for.
+var staffRoles = []string{models.RoleModerator, models.RoleAdmin}
+
+/*
+AdminSecurityHandler lets admins choose which staff roles must use two-factor authentication, and lists the staff with whether they have set it up. Staff without it are sent to set it up the next time they use the forum.
+*/
+func (a *App) AdminSecurityHandler(w http.ResponseWriter, r *http.Request) error {
+	user, _, ok := a.settingsRequest(w, r, r.Method)
+	if !ok {
+		return nil
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			return util.NewError(http.StatusBadRequest, "error.bad_request", fmt.Errorf("error parsing form: %w", err))
+		}
+
+		var roles []string
+		for _, role := range staffRoles {
+			if r.Form.Get("require-"+role) == "on" {
+				roles = append(roles, role)
+			}
+		}
+		if err := repositories.SetTwoFactorRequiredRoles(r.Context(), a.DB, roles); err != nil {
+			return util.Internal(fmt.Errorf("failed to store two-factor policy: %w", err))
+		}
+		a.Audit(r, user.ID, AuditTwoFactorPolicyChanged, "required for: "+strings.Join(roles, ","))
+
+		http.Redirect(w, r, "/admin/security?notice=saved", http.StatusSeeOther)
+		return nil
+	default:
+		return util.MethodNotAllowed()
+	}
+
+	required, err := repositories.TwoFactorRequiredRoles(r.Context(), a.DB)
+	if err != nil {
+		return util.Internal(fmt.Errorf("failed to load two-factor policy: %w", err))
+	}
+	staff, err := repositories.ListStaff(r.Context(), a.DB)
+	if err != nil {
+		return util.Internal(fmt.Errorf("failed to list staff: %w", err))
+	}
+
+	data := struct {
+		Required map[string]bool
+		Staff    []models.StaffMember
+		Notice   string
+	}{
+		Required: make(map[string]bool),
+		Staff:    staff,
+	}
+	for _, role := range required {
+		data.Required[role] = true
+	}
+	if r.URL.Query().Get("notice") == "saved" {
+		data.Notice = i18n.T(r.Context(), "admin.policy_saved")
+	}
+
+	return a.render(w, r, "admin-security.html", data)
+}
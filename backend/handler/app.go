@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jesee-kuya/forum/backend/config"
+	"github.com/jesee-kuya/forum/backend/repositories"
+	"github.com/jesee-kuya/forum/backend/util"
+)
+
+/*
+App holds everything the handlers work with: the database, the configuration, the page templates and the sign-in providers. Handlers are methods on it, so several forums can run side by side, as tests do, each with its own state.
+*/
+type App struct {
+	DB     *sql.DB
+	Config *config.Config
+
+	// Templates renders the pages, read from the configured template directory.
+	Templates *util.Templates
+
+	providerMu sync.RWMutex
+	providers  []IdentityProvider
+
+	ceremonyMu sync.Mutex
+	ceremonies map[string]passkeyCeremony
+
+	draining atomic.Bool
+}
+
+/*
+New returns an App serving the forum stored in db, configured by cfg. A nil cfg means the defaults. When cfg has no secret key, which config.Load only allows while the forum has no base URL and sends no email, a random one is set and a warning logged; it signs the values handed to browsers until the App stops.
+*/
+func New(db *sql.DB, cfg *config.Config) *App {
+	if cfg == nil {
+		cfg = config.Default()
+	}
+	if cfg.Server.SecretKey == "" {
+		slog.Warn("No secret key is configured, signed tokens will not survive a restart")
+		cfg.Server.SecretKey = util.RandomToken(32)
+	}
+	return &App{
+		DB:         db,
+		Config:     cfg,
+		Templates:  util.NewTemplates(cfg.Templates.Dir, cfg.Templates.Reload),
+		ceremonies: make(map[string]passkeyCeremony),
+	}
+}
+
+// ActiveSessions counts the sessions that have not expired, for the metrics.
+func (a *App) ActiveSessions() (int, error) {
+	return repositories.CountActiveSessions(context.Background(), a.DB)
+}
+
+// Health states reported by App.Health.
+const (
+	HealthOK       = "ok"
+	HealthDraining = "draining"
+)
+
+/*
+Drain marks the App as shutting down. It is the first step of a shutdown: Health reports HealthDraining from then on so load balancers stop sending requests. Requests keep being served normally. Calling Drain again does nothing.
+*/
+func (a *App) Drain() {
+	a.draining.Store(true)
+}
+
+// Health returns HealthOK, or HealthDraining once Drain was called.
+func (a *App) Health() string {
+	if a.draining.Load() {
+		return HealthDraining
+	}
+	return HealthOK
+}
+
+/*
+render writes the page name, a file of the template directory, rendered with data. The template helpers see the App's configuration, so pages show the features the handlers serve. Nothing is written when rendering fails, so the error returned can still be answered with an error page.
+*/
+func (a *App) render(w http.ResponseWriter, r *http.Request, name string, data interface{}) error {
+	r = r.WithContext(config.NewContext(r.Context(), a.Config))
+	if err := a.Templates.Render(w, r, http.StatusOK, name, data); err != nil {
+		return util.Internal(err)
+	}
+	return nil
+}
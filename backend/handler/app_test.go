@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jesee-kuya/forum/backend/repositories"
+	"github.com/jesee-kuya/forum/backend/util"
+)
+
+func TestAppsAreIsolated(t *testing.T) {
+	first, second := newTestApp(t), newTestApp(t)
+	first.RegisterIdentityProvider("google", "Google")
+	second.Config.Features.Passkeys = false
+
+	res, err := first.DB.Exec("INSERT INTO tblUsers (username, email, user_password) VALUES ('ivan', 'ivan@example.com', NULL)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, _ := res.LastInsertId()
+
+	rec := httptest.NewRecorder()
+	if err := first.StartSession(rec, httptest.NewRequest(http.MethodPost, "/sign-in", nil), int(userID), false); err != nil {
+		t.Fatal(err)
+	}
+	token := rec.Result().Cookies()[0].Value
+
+	req := httptest.NewRequest(http.MethodGet, "/home", nil)
+	req.AddCookie(&http.Cookie{Name: util.SessionCookieName, Value: token})
+	if _, ok := first.signedInUser(req); !ok {
+		t.Error("a session started on an app is unknown to it")
+	}
+	if _, ok := second.signedInUser(req); ok {
+		t.Error("a session started on one app is known to the other")
+	}
+	var sessions int
+	second.DB.QueryRow("SELECT COUNT(*) FROM tblSessions").Scan(&sessions)
+	if sessions != 0 {
+		t.Errorf("the other app's database has %d sessions, want 0", sessions)
+	}
+
+	signInPage := func(app *App) string {
+		rec := httptest.NewRecorder()
+		util.Handle(app.LoginHandler)(rec, httptest.NewRequest(http.MethodGet, "/sign-in", nil))
+		return rec.Body.String()
+	}
+	if page := signInPage(first); !strings.Contains(page, "/auth/google") || !strings.Contains(page, "passkey") {
+		t.Error("the sign-in page leaves out the app's provider or passkeys")
+	}
+	if page := signInPage(second); strings.Contains(page, "/auth/google") || strings.Contains(page, "passkey") {
+		t.Error("the sign-in page shows another app's provider or a feature turned off")
+	}
+}
+
+func TestSessionsSurviveRestart(t *testing.T) {
+	app := newTestApp(t)
+	userID := insertUser(t, app, "judy", "judy@example.com", "", true)
+
+	rec := httptest.NewRecorder()
+	if err := app.StartSession(rec, httptest.NewRequest(http.MethodPost, "/sign-in", nil), userID, true); err != nil {
+		t.Fatal(err)
+	}
+	session := rec.Result().Cookies()[0]
+
+	// A new App on the same database knows the session from tblSessions alone
+	restarted := New(app.DB, app.Config)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(session)
+	rec = httptest.NewRecorder()
+	util.Handle(restarted.HomeHandler)(rec, req)
+	if got := rec.Header().Get("Location"); got != "/home" {
+		t.Errorf("signed in user redirected to %q after a restart, want /home", got)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/language", strings.NewReader("lang=sw"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(session)
+	util.Handle(restarted.LanguageHandler)(httptest.NewRecorder(), req)
+	if lang, err := repositories.GetUserLanguage(context.Background(), app.DB, userID); err != nil || lang != "sw" {
+		t.Errorf("language saved as %q (%v) after a restart, want sw", lang, err)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	app := New(nil, nil)
+	if app.Health() != HealthOK {
+		t.Fatalf("Health() = %q before draining", app.Health())
+	}
+
+	app.Drain()
+	app.Drain()
+	if app.Health() != HealthDraining {
+		t.Errorf("Health() = %q after draining", app.Health())
+	}
+}
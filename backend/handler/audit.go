@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/jesee-kuya/forum/backend/models"
+	"github.com/jesee-kuya/forum/backend/repositories"
+	"github.com/jesee-kuya/forum/backend/util"
+)
+
+// Events written to the audit log.
+const (
+	AuditLoginSucceeded = "login_succeeded"
+	AuditLoginFailed    = "login_failed"
+	AuditAccountLocked  = "account_locked"
+	AuditAccountUnlock  = "account_unlocked"
+)
+
+// Audit records an event for the user making the request. userID is 0 when no account is known.
+func (a *App) Audit(r *http.Request, userID int, event, details string) {
+	err := repositories.InsertAuditEvent(r.Context(), a.DB, models.AuditEvent{
+		UserID:    userID,
+		Event:     event,
+		IPAddress: util.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		Details:   details,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to record audit event", "event", event, "err", err)
+	}
+}
@@ -1,8 +1,9 @@
 package handler
 
 import (
-	"html"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"strings"
 
@@ -10,47 +11,35 @@ import (
 	"github.com/jesee-kuya/forum/backend/util"
 )
 
-func CommentHandler(w http.ResponseWriter, r *http.Request) {
+func (a *App) CommentHandler(w http.ResponseWriter, r *http.Request) error {
 	if r.URL.Path != "/comments" {
-		log.Println("url not found", r.URL.Path)
-		util.ErrorHandler(w, "Page does not exist", http.StatusNotFound)
-		return
+		return util.NewError(http.StatusNotFound, "error.page_not_found", nil)
 	}
 
 	if r.Method != http.MethodPost {
-		log.Println("Method not allowed in comment handler", r.Method)
-		util.ErrorHandler(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
+		return util.MethodNotAllowed()
 	}
-	cookie, err := getSessionID(r)
-	if err != nil {
-		log.Println("Invalid Session")
+	userId, ok := a.signedInUser(r)
+	if !ok {
+		slog.InfoContext(r.Context(), "Invalid session")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
-	}
-	sessionData, err := getSessionData(cookie)
-	if err != nil {
-		log.Println("Invalid Session")
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
+		return nil
 	}
 	id := r.FormValue("id")
-	userId := sessionData["userId"].(int)
 	comment := r.FormValue("comment")
-	comment = html.EscapeString(comment)
 	if len(strings.TrimSpace(comment)) == 0 {
-		log.Println("Empty comment")
-		util.ErrorHandler(w, "Bad Request", http.StatusBadRequest)
-		http.Redirect(w, r, "/home", http.StatusSeeOther)
-		return
+		return util.NewError(http.StatusBadRequest, "error.bad_request", errors.New("empty comment"))
 	}
 
 	if comment == "" {
-		log.Println("Empty comment")
+		slog.InfoContext(r.Context(), "Empty comment")
 		http.Redirect(w, r, "/home", http.StatusSeeOther)
-		return
+		return nil
 	}
 
-	repositories.InsertRecord(util.DB, "tblPosts", []string{"user_id", "body", "parent_id", "post_title"}, userId, comment, id, "comment")
+	if _, err := repositories.InsertRecord(r.Context(), a.DB, "tblPosts", []string{"user_id", "body", "parent_id", "post_title"}, userId, comment, id, "comment"); err != nil {
+		return util.Internal(fmt.Errorf("failed to insert comment: %w", err))
+	}
 	http.Redirect(w, r, "/home", http.StatusSeeOther)
+	return nil
 }
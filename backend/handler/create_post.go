@@ -1,141 +1,181 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
-	"html"
 	"io"
-	"log"
+	"log/slog"
 	"mime/multipart"
 	"net/http"
 	"os"
+	"path/filepath"
 
+	"github.com/jesee-kuya/forum/backend/metrics"
+	"github.com/jesee-kuya/forum/backend/models"
 	"github.com/jesee-kuya/forum/backend/repositories"
 	"github.com/jesee-kuya/forum/backend/util"
 )
 
+var errInvalidMedia = errors.New("invalid media file")
+
 /*
-UploadMedia handler function is responsible for performing server operations to enable media upload with a file size limit of up to 20 megabytes.
+CreatePost handler function is responsible for performing server operations to create a post with the images attached to it, within the configured upload limits.
 */
-func CreatePost(w http.ResponseWriter, r *http.Request) {
-	var url string
+func (a *App) CreatePost(w http.ResponseWriter, r *http.Request) error {
 	if r.Method != http.MethodPost {
-		log.Println("Invalid request method:", r.Method)
-		util.ErrorHandler(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
+		return util.MethodNotAllowed()
 	}
 
-	// Create the img directory if it does not exist
-	if err := os.MkdirAll("uploads", os.ModePerm); err != nil {
-		log.Println("Failed to create uploads directory:", err)
-		util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-		return
+	userID, ok := a.signedInUser(r)
+	if !ok {
+		slog.InfoContext(r.Context(), "Invalid session")
+		http.Redirect(w, r, "/sign-in", http.StatusSeeOther)
+		return nil
 	}
 
-	// Parse the multipart form with a 20MB limit
-	err := r.ParseMultipartForm(20 << 20)
-	if err != nil {
-		log.Println("Failed parsing multipart form:", err)
-		util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-		return
+	limits := a.Config.Uploads
+
+	// Create the img directory if it does not exist
+	if err := os.MkdirAll(limits.Dir, os.ModePerm); err != nil {
+		return util.Internal(fmt.Errorf("failed to create uploads directory: %w", err))
 	}
 
-	file, header, err := r.FormFile("uploaded-file")
+	// Reject bodies larger than the combined attachment limit, allowing some room for the text fields
+	r.Body = http.MaxBytesReader(w, r.Body, int64(limits.MaxTotalSize)+1<<20)
+	err := r.ParseMultipartForm(int64(limits.MaxFileSize))
 	if err != nil {
-		if err.Error() == "http: no such file" {
-			log.Println("No file uploaded, continuing process.")
-		} else {
-			log.Println("Failed retrieving media file:", err)
-			util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-			return
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return util.NewError(http.StatusBadRequest, "error.files_too_large", fmt.Errorf("upload exceeds total size limit: %w", err), limits.MaxTotalSize)
 		}
+		return util.Internal(fmt.Errorf("failed parsing multipart form: %w", err))
 	}
 
-	if file != nil {
-		defer file.Close()
+	// The CSRF middleware leaves multipart bodies to us so the size limit above applies first
+	if err := util.VerifyCSRF(r); err != nil {
+		return util.CSRFError(fmt.Errorf("rejected post: %w", err))
+	}
 
-		if header.Size > 20<<20 {
-			log.Println("File size exceeds 20MB limit")
-			util.ErrorHandler(w, "The uploaded file is too large. Please upload a file less than 20MB.", http.StatusBadRequest)
-			return
+	files := r.MultipartForm.File["uploaded-file"]
+	if len(files) > limits.MaxFiles {
+		if limits.MaxFiles == 0 {
+			return util.NewError(http.StatusBadRequest, "error.uploads_disabled", nil)
 		}
+		return util.NewError(http.StatusBadRequest, "error.too_many_files", nil, limits.MaxFiles)
+	}
 
-		// Validate MIME type and get the file extension
-		fileExt, err := ValidateMimeType(file)
-		if err != nil {
-			log.Println("Invalid extension associated with file:", err)
-			util.ErrorHandler(w, "Invalid extension associated with file", http.StatusBadRequest)
-			return
+	var totalSize int64
+	for _, header := range files {
+		if header.Size > int64(limits.MaxFileSize) {
+			return util.NewError(http.StatusBadRequest, "error.file_too_large", nil, limits.MaxFileSize)
 		}
+		totalSize += header.Size
+	}
+	if totalSize > int64(limits.MaxTotalSize) {
+		return util.NewError(http.StatusBadRequest, "error.files_too_large", nil, limits.MaxTotalSize)
+	}
 
-		_, err = file.Seek(0, 0)
-		if err != nil {
-			log.Println("Failed to reset file pointer:", err)
-			util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-			return
+	captions := r.MultipartForm.Value["attachment-caption[]"]
+	altTexts := r.MultipartForm.Value["attachment-alt[]"]
+	for _, caption := range captions {
+		if err := util.ValidateCaption(caption); err != nil {
+			return util.NewError(http.StatusBadRequest, "error.caption_too_long", err, util.MaxCaptionLength)
 		}
-
-		// Create a temporary file with the correct extension
-		tempFile, err := os.CreateTemp("uploads", "upload-*"+fileExt)
-		if err != nil {
-			log.Println("Failed to read file:", err)
-			util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-			return
+	}
+	for _, altText := range altTexts {
+		if err := util.ValidateAltText(altText); err != nil {
+			return util.NewError(http.StatusBadRequest, "error.alt_text_too_long", err, util.MaxAltTextLength)
 		}
-		defer tempFile.Close()
+	}
 
-		fileBytes, err := io.ReadAll(file)
+	var attachments []models.Attachment
+	for i, header := range files {
+		url, err := saveUpload(limits.Dir, header)
 		if err != nil {
-			log.Println("Failed to read file:", err)
-			util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-			return
+			removeUploads(limits.Dir, attachments)
+			if errors.Is(err, errInvalidMedia) {
+				return util.NewError(http.StatusBadRequest, "error.invalid_file_type", fmt.Errorf("invalid extension associated with file: %w", err))
+			}
+			return util.Internal(fmt.Errorf("failed to save file: %w", err))
 		}
 
-		// Write the uploaded file content to the temp file
-		_, err = tempFile.Write(fileBytes)
-		if err != nil {
-			log.Println("Failed to write file:", err)
-			util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-			return
-		}
-		tempFilePath := tempFile.Name()
-		url = fmt.Sprintf("%v", tempFilePath)
+		attachments = append(attachments, models.Attachment{
+			FileURL:  url,
+			Caption:  valueAt(captions, i),
+			AltText:  valueAt(altTexts, i),
+			FileSize: header.Size,
+		})
 	}
 
-	cookie, err := getSessionID(r)
+	categories := r.MultipartForm.Value["category[]"]
+	_, err = repositories.InsertPost(r.Context(), a.DB, userID, r.FormValue("post-title"), r.FormValue("post-content"), categories, attachments)
 	if err != nil {
-		log.Println("Invalid Session")
-		http.Redirect(w, r, "/sign-in", http.StatusSeeOther)
-		return
+		removeUploads(limits.Dir, attachments)
+		return util.Internal(fmt.Errorf("failed to add post: %w", err))
+	}
+
+	r.Method = http.MethodGet
+	http.Redirect(w, r, "/home", http.StatusSeeOther)
+	return nil
+}
+
+/*
+saveUpload validates an uploaded image and writes it to dir. It returns the path the file is served from.
+*/
+func saveUpload(dir string, header *multipart.FileHeader) (string, error) {
+	file, err := header.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open uploaded file: %w", err)
 	}
-	sessionData, err := getSessionData(cookie)
+	defer file.Close()
+
+	// Validate MIME type and get the file extension
+	fileExt, err := ValidateMimeType(file)
 	if err != nil {
-		log.Println("Invalid Session")
-		http.Redirect(w, r, "/sign-in", http.StatusSeeOther)
-		return
+		return "", fmt.Errorf("%w: %v", errInvalidMedia, err)
 	}
 
-	id, err := repositories.InsertRecord(util.DB, "tblPosts", []string{"post_title", "body", "media_url", "user_id"}, html.EscapeString(r.FormValue("post-title")), html.EscapeString(r.FormValue("post-content")), url, sessionData["userId"].(int))
+	_, err = file.Seek(0, io.SeekStart)
 	if err != nil {
-		log.Println("failed to add post", err)
-		http.Redirect(w, r, "/sign-in", http.StatusSeeOther)
-		return
+		return "", fmt.Errorf("failed to reset file pointer: %w", err)
 	}
 
-	err = r.ParseForm()
+	// Create a temporary file with the correct extension
+	tempFile, err := os.CreateTemp(dir, "upload-*"+fileExt)
 	if err != nil {
-		log.Println("error parsing form:", err)
-		util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-		return
+		return "", fmt.Errorf("failed to create file: %w", err)
 	}
+	defer tempFile.Close()
 
-	categories := r.Form["category[]"]
+	// Write the uploaded file content to the temp file
+	written, err := io.Copy(tempFile, file)
+	if err != nil {
+		os.Remove(tempFile.Name())
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+	metrics.AddUploadBytes(written)
+
+	// Uploads are served from /uploads/ wherever they are stored
+	return "uploads/" + filepath.Base(tempFile.Name()), nil
+}
 
-	for _, category := range categories {
-		repositories.InsertRecord(util.DB, "tblPostCategories", []string{"post_id", "category"}, id, category)
+/*
+removeUploads deletes files written for a post that could not be saved. Anything left behind is picked up later by the upload janitor.
+*/
+func removeUploads(dir string, attachments []models.Attachment) {
+	for _, attachment := range attachments {
+		if err := os.Remove(filepath.Join(dir, filepath.Base(attachment.FileURL))); err != nil {
+			slog.Error("Failed to remove upload", "file", attachment.FileURL, "err", err)
+		}
 	}
+}
 
-	r.Method = http.MethodGet
-	http.Redirect(w, r, "/home", http.StatusSeeOther)
+// valueAt returns the i-th value of a repeated form field, or an empty string if it was not sent.
+func valueAt(values []string, i int) string {
+	if i < len(values) {
+		return values[i]
+	}
+	return ""
 }
 
 /*
@@ -164,7 +204,7 @@ func ValidateMimeType(file multipart.File) (string, error) {
 	buffer := make([]byte, 512)
 	_, err := file.Read(buffer)
 	if err != nil {
-		log.Printf("Failed to read buffer: %v\n", err)
+		slog.Error("Failed to read buffer", "err", err)
 		return "", fmt.Errorf("failed to read file data")
 	}
 
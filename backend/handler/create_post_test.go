@@ -2,11 +2,15 @@ package handler
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"github.com/jesee-kuya/forum/backend/util"
 )
 
 var TestCase2 = []struct {
@@ -16,7 +20,7 @@ var TestCase2 = []struct {
 	expectedBody string
 	code         int
 }{
-	{"Test1", http.MethodGet, "/upload", "Invalid request method", http.StatusMethodNotAllowed},
+	{"Test1", http.MethodGet, "/upload", "Method Not Allowed", http.StatusMethodNotAllowed},
 }
 
 var TestCase3 = []struct {
@@ -39,7 +43,7 @@ func TestUploadMedia(t *testing.T) {
 			req := httptest.NewRequest(tc.method, tc.endPoint, nil)
 			w := httptest.NewRecorder()
 
-			CreatePost(w, req)
+			util.Handle(New(nil, nil).CreatePost)(w, req)
 
 			resp := w.Result()
 			if resp.StatusCode != tc.code {
@@ -84,3 +88,43 @@ func TestValidateMimeType(t *testing.T) {
 		})
 	}
 }
+
+func TestCreatePostLimitsAttachmentText(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.Uploads.Dir = t.TempDir()
+	userID := insertUser(t, app, "pat", "pat@example.com", "", true)
+
+	tests := []struct {
+		field, value, code string
+	}{
+		{"attachment-caption[]", strings.Repeat("a", util.MaxCaptionLength+1), "error.caption_too_long"},
+		{"attachment-alt[]", strings.Repeat("a", util.MaxAltTextLength+1), "error.alt_text_too_long"},
+	}
+	for _, tc := range tests {
+		token := util.NewCSRFToken(context.Background())
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		form.WriteField(util.CSRFFieldName, token)
+		form.WriteField("post-title", "Title")
+		form.WriteField("post-content", "Body")
+		form.WriteField(tc.field, tc.value)
+		form.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/create-post", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		req.AddCookie(&http.Cookie{Name: util.CSRFCookieName, Value: token})
+		req = util.WithSessionUser(req, userID)
+
+		err := app.CreatePost(httptest.NewRecorder(), req)
+		var appErr *util.AppError
+		if !errors.As(err, &appErr) || appErr.Status != http.StatusBadRequest || appErr.Message != tc.code {
+			t.Errorf("%s: CreatePost = %v, want %s", tc.field, err, tc.code)
+		}
+	}
+
+	var posts int
+	app.DB.QueryRow("SELECT COUNT(*) FROM tblPosts").Scan(&posts)
+	if posts != 0 {
+		t.Errorf("got %d posts, want the posts with overlong attachment text refused", posts)
+	}
+}
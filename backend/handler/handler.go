@@ -1,39 +1,33 @@
 package handler
 
 import (
-	"log"
+	"fmt"
 	"net/http"
 
 	"github.com/jesee-kuya/forum/backend/repositories"
 	"github.com/jesee-kuya/forum/backend/util"
 )
 
-func HomeHandler(w http.ResponseWriter, r *http.Request) {
+func (a *App) HomeHandler(w http.ResponseWriter, r *http.Request) error {
 	if r.URL.Path != "/" {
-		util.ErrorHandler(w, "Page does not exist", http.StatusNotFound)
-		return
+		return util.NewError(http.StatusNotFound, "error.page_not_found", nil)
 	}
 
 	if r.Method != http.MethodGet {
-		log.Println("Method not allowed", r.Method)
-		util.ErrorHandler(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
+		return util.MethodNotAllowed()
 	}
 
-	cookie, _ := getSessionID(r)
-	_, ok := SessionStore[cookie]
-	if ok {
+	if _, ok := a.signedInUser(r); ok {
 		http.Redirect(w, r, "/home", http.StatusSeeOther)
-		return
+		return nil
 	}
 
 	// Load posts
-	posts, err := repositories.GetPosts(util.DB)
+	posts, err := repositories.GetPosts(r.Context(), a.DB)
 	if err != nil {
-		log.Printf("Failed to get posts: %v", err)
-		util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-		return
+		return util.Internal(fmt.Errorf("failed to get posts: %w", err))
 	}
 
-	PostDetails(w, r, posts, false)
+	a.PostDetails(w, r, posts, false)
+	return nil
 }
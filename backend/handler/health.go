@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jesee-kuya/forum/backend/database"
+	"github.com/jesee-kuya/forum/backend/version"
+)
+
+// ReadinessTimeout bounds the checks behind /readyz, so a stuck database makes the forum unready instead of hanging the probe.
+const ReadinessTimeout = 2 * time.Second
+
+// readiness is the answer of /readyz: the overall status and the result of each check, "ok" or "fail". What went wrong is only logged, as the probe is public.
+type readiness struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// writeStatus answers a probe with JSON. Probes are only read, so other methods are refused.
+func writeStatus(w http.ResponseWriter, r *http.Request, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Method Not Allowed"})
+		return
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+/*
+HealthzHandler reports that the process is alive and answering. It checks nothing else, so a restart is only called for when the forum is stuck; while shutting down it still answers 200, with the status "draining".
+*/
+func (a *App) HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeStatus(w, r, http.StatusOK, map[string]string{"status": a.Health()})
+}
+
+/*
+ReadyzHandler reports whether the forum can serve requests: the database answers, its schema is up to date and the uploads directory is writable. It answers 503 when a check fails or the forum is shutting down, so load balancers and the Docker health check stop counting on it.
+*/
+func (a *App) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), ReadinessTimeout)
+	defer cancel()
+
+	result := readiness{
+		Status: "ready",
+		Checks: map[string]string{
+			"database": checkResult(ctx, "database", a.DB.PingContext(ctx)),
+			"schema":   checkResult(ctx, "schema", a.checkSchema(ctx)),
+			"uploads":  checkResult(ctx, "uploads", checkWritable(a.Config.Uploads.Dir)),
+		},
+	}
+	for _, outcome := range result.Checks {
+		if outcome != "ok" {
+			result.Status = "unready"
+		}
+	}
+	if a.Health() == HealthDraining {
+		result.Status = HealthDraining
+	}
+
+	status := http.StatusOK
+	if result.Status != "ready" {
+		status = http.StatusServiceUnavailable
+	}
+	writeStatus(w, r, status, result)
+}
+
+// VersionHandler reports the commit, build time and Go version of the running build.
+func VersionHandler(w http.ResponseWriter, r *http.Request) {
+	writeStatus(w, r, http.StatusOK, version.Get())
+}
+
+// checkResult logs why a readiness check failed and reports only that it did.
+func checkResult(ctx context.Context, check string, err error) string {
+	if err != nil {
+		slog.WarnContext(ctx, "Readiness check failed", "check", check, "err", err)
+		return "fail"
+	}
+	return "ok"
+}
+
+// checkSchema fails when the database has not been brought up to the schema this build expects.
+func (a *App) checkSchema(ctx context.Context) error {
+	current, err := database.Version(ctx, a.DB)
+	if err != nil {
+		return err
+	}
+	if current != database.SchemaVersion {
+		return fmt.Errorf("schema version %d, want %d", current, database.SchemaVersion)
+	}
+	return nil
+}
+
+// checkWritable fails unless a file can be created in dir, creating dir as uploading does.
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(dir, ".readyz-*")
+	if err != nil {
+		return err
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
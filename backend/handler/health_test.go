@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readyz(app *App) (int, readiness) {
+	rec := httptest.NewRecorder()
+	app.ReadyzHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var result readiness
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	return rec.Code, result
+}
+
+func TestReadyz(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.Uploads.Dir = filepath.Join(t.TempDir(), "uploads")
+
+	if code, result := readyz(app); code != http.StatusOK || result.Status != "ready" {
+		t.Fatalf("readyz = %d %+v, want ready", code, result)
+	}
+	if entries, _ := os.ReadDir(app.Config.Uploads.Dir); len(entries) != 0 {
+		t.Errorf("the writability check left %d files behind", len(entries))
+	}
+
+	tests := []struct {
+		name, check string
+		breakIt     func(t *testing.T, app *App)
+	}{
+		{"old schema", "schema", func(t *testing.T, app *App) {
+			app.DB.Exec("PRAGMA user_version = 1")
+		}},
+		{"uploads not a directory", "uploads", func(t *testing.T, app *App) {
+			path := filepath.Join(t.TempDir(), "file")
+			os.WriteFile(path, nil, 0o600)
+			app.Config.Uploads.Dir = path
+		}},
+		{"database closed", "database", func(t *testing.T, app *App) {
+			app.DB.Close()
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			app := newTestApp(t)
+			app.Config.Uploads.Dir = t.TempDir()
+			tc.breakIt(t, app)
+
+			code, result := readyz(app)
+			if code != http.StatusServiceUnavailable || result.Status != "unready" || result.Checks[tc.check] != "fail" {
+				t.Errorf("readyz = %d %+v, want the %s check to fail", code, result, tc.check)
+			}
+		})
+	}
+}
+
+func TestProbesWhileDraining(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.Uploads.Dir = t.TempDir()
+	app.Drain()
+
+	if code, result := readyz(app); code != http.StatusServiceUnavailable || result.Status != HealthDraining {
+		t.Errorf("readyz = %d %+v, want draining", code, result)
+	}
+
+	rec := httptest.NewRecorder()
+	app.HealthzHandler(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "{\"status\":\"draining\"}\n" {
+		t.Errorf("healthz = %d %s, want 200 while draining", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	app.HealthzHandler(rec, httptest.NewRequest(http.MethodPost, "/healthz", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /healthz = %d, want 405", rec.Code)
+	}
+}
@@ -0,0 +1,386 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jesee-kuya/forum/backend/jobs"
+	"github.com/jesee-kuya/forum/backend/mailer"
+	"github.com/jesee-kuya/forum/backend/metrics"
+	"github.com/jesee-kuya/forum/backend/models"
+	"github.com/jesee-kuya/forum/backend/repositories"
+	"github.com/jesee-kuya/forum/backend/util"
+)
+
+// LinkLifetime is how long a user has to finish signing in to a provider they are linking.
+const LinkLifetime = 10 * time.Minute
+
+// Events written to the audit log by account linking.
+const (
+	AuditIdentityLinked   = "identity_linked"
+	AuditIdentityUnlinked = "identity_unlinked"
+)
+
+// IdentityProvider is a sign-in provider accounts can be linked to.
+type IdentityProvider struct {
+	Name, DisplayName string
+}
+
+// RegisterIdentityProvider adds a sign-in provider to the sign-in pages and the account settings.
+func (a *App) RegisterIdentityProvider(name, displayName string) {
+	a.providerMu.Lock()
+	defer a.providerMu.Unlock()
+	for i, p := range a.providers {
+		if p.Name == name {
+			a.providers[i].DisplayName = displayName
+			return
+		}
+	}
+	a.providers = append(a.providers, IdentityProvider{Name: name, DisplayName: displayName})
+}
+
+// IdentityProviders returns the registered sign-in providers in the order they were registered.
+func (a *App) IdentityProviders() []IdentityProvider {
+	a.providerMu.RLock()
+	defer a.providerMu.RUnlock()
+	return append([]IdentityProvider(nil), a.providers...)
+}
+
+// providerName returns the display name of a registered provider.
+func (a *App) providerName(name string) (string, bool) {
+	for _, p := range a.IdentityProviders() {
+		if p.Name == name {
+			return p.DisplayName, true
+		}
+	}
+	return "", false
+}
+
+// linkedProvider is a provider as listed in the account settings.
+type linkedProvider struct {
+	Provider, Name, Email string
+	Linked                bool
+}
+
+// errEmailTaken means a provider's email address belongs to an account that cannot safely be linked to it.
+var errEmailTaken = errors.New("email registered to another account")
+
+// errRegistrationClosed means a provider account would need a new forum account while registration is turned off.
+var errRegistrationClosed = errors.New("registration is closed")
+
+/*
+OAuthSignIn finishes a sign-in through a provider, given the provider account that signed in. A user who started from their settings gets the account linked to them instead.
+
+Otherwise the user the account is linked to is signed in. An account that is not linked yet is linked to the user with the same email address, but only when the provider says it verified the address and the forum verified it as well, so neither side can be used to take over the other. Accounts made through the provider before linking existed are linked on their next sign-in, again only when the provider verified the address. Without any match a new user is created.
+*/
+func (a *App) OAuthSignIn(w http.ResponseWriter, r *http.Request, identity models.Identity, username string, emailVerified bool) {
+	if userID, ok := a.linkingUser(w, r); ok {
+		a.linkIdentity(w, r, userID, identity)
+		return
+	}
+
+	userID, err := repositories.IdentityUser(r.Context(), a.DB, identity.Provider, identity.Subject)
+	isNewUser := false
+	if errors.Is(err, sql.ErrNoRows) {
+		userID, isNewUser, err = a.matchIdentity(r, identity, username, emailVerified)
+	}
+	if errors.Is(err, errEmailTaken) {
+		slog.WarnContext(r.Context(), "Email already registered to an account not linked to the provider", "provider", identity.Provider, "email", identity.Email)
+		metrics.Login(loginOAuth, false)
+		http.Redirect(w, r, "/sign-in?notice=link-account", http.StatusTemporaryRedirect)
+		return
+	}
+	if errors.Is(err, errRegistrationClosed) {
+		slog.WarnContext(r.Context(), "Refused to create an account: registration is closed", "provider", identity.Provider, "email", identity.Email)
+		metrics.Login(loginOAuth, false)
+		http.Redirect(w, r, "/sign-in?notice=registration-closed", http.StatusTemporaryRedirect)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Database error", "err", err)
+		http.Redirect(w, r, "/sign-in?error=database_error", http.StatusTemporaryRedirect)
+		return
+	}
+
+	user, err := repositories.GetUserByID(r.Context(), a.DB, userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Database error", "err", err)
+		http.Redirect(w, r, "/sign-in?error=database_error", http.StatusTemporaryRedirect)
+		return
+	}
+
+	// A locked account stays locked whichever way its owner signs in
+	lockedUntil, err := repositories.AccountLockedUntil(r.Context(), a.DB, user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Database error", "err", err)
+		http.Redirect(w, r, "/sign-in?error=database_error", http.StatusTemporaryRedirect)
+		return
+	}
+	if !lockedUntil.IsZero() {
+		metrics.Login(loginOAuth, false)
+		http.Redirect(w, r, "/sign-in?notice=locked", http.StatusTemporaryRedirect)
+		return
+	}
+
+	// Enable CORS
+	EnableCors(w)
+
+	// Start a session alongside any the user already has on other devices
+	pending, err := a.BeginSignIn(w, r, user.ID, false)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to store session token", "err", err)
+		http.Redirect(w, r, "/sign-in?error=session_error", http.StatusTemporaryRedirect)
+		return
+	}
+	if pending {
+		// The sign-in is recorded once the second factor checks out
+		http.Redirect(w, r, "/sign-in/2fa", http.StatusSeeOther)
+		return
+	}
+	a.recordLoginSuccess(r, loginOAuth, user, identity.Provider+":"+identity.Subject)
+
+	// Redirect based on whether this is a new user or not
+	if isNewUser {
+		http.Redirect(w, r, "/home?status=new_user", http.StatusSeeOther)
+	} else {
+		http.Redirect(w, r, "/home?status=returning_user", http.StatusSeeOther)
+	}
+}
+
+// matchIdentity finds the user for a provider account that is not linked yet, creating one if there is none.
+func (a *App) matchIdentity(r *http.Request, identity models.Identity, username string, emailVerified bool) (int, bool, error) {
+	if identity.Email == "" {
+		return 0, false, errors.New("provider did not share an email address")
+	}
+
+	var (
+		userID        int
+		authProvider  string
+		localVerified bool
+	)
+	err := a.DB.QueryRowContext(r.Context(), "SELECT id, auth_provider, email_verified FROM tblUsers WHERE email = ?", identity.Email).
+		Scan(&userID, &authProvider, &localVerified)
+	if errors.Is(err, sql.ErrNoRows) {
+		if !a.Config.Features.Registration {
+			return 0, false, errRegistrationClosed
+		}
+		userID, err = a.createIdentityUser(r.Context(), username, identity, emailVerified)
+		return userID, err == nil, err
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	// The provider must vouch for the email; the forum must too, unless the account was made through this provider
+	legacy := authProvider == identity.Provider
+	if !emailVerified || (!legacy && !localVerified) {
+		return 0, false, errEmailTaken
+	}
+
+	identity.UserID = userID
+	err = repositories.LinkIdentity(r.Context(), a.DB, identity)
+	if errors.Is(err, repositories.ErrIdentityLinked) {
+		// The user has linked another account at this provider
+		return 0, false, errEmailTaken
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	if !legacy {
+		a.Audit(r, userID, AuditIdentityLinked, identity.Provider+" by verified email")
+		if user, err := repositories.GetUserByID(r.Context(), a.DB, userID); err == nil {
+			a.notifyIdentityChange(r.Context(), user, fmt.Sprintf("Your %s account %s was linked to", a.displayName(identity.Provider), identity.Email))
+		}
+	}
+	return userID, false, nil
+}
+
+// createIdentityUser creates a user for a provider account, picking a free username based on the provider's.
+func (a *App) createIdentityUser(ctx context.Context, username string, identity models.Identity, emailVerified bool) (int, error) {
+	available, err := repositories.UsernameAvailable(ctx, a.DB, username, 0)
+	if err != nil {
+		return 0, err
+	}
+	if !available {
+		// Username is taken, generate a unique one
+		b := make([]byte, 3)
+		rand.Read(b)
+		username = fmt.Sprintf("%s_%s", username, base64.RawURLEncoding.EncodeToString(b))
+	}
+	return repositories.CreateIdentityUser(ctx, a.DB, username, identity, emailVerified)
+}
+
+/*
+linkingUser returns the signed in user who went to a provider to link it from their settings. The linking cookie must match the session the browser came back with.
+*/
+func (a *App) linkingUser(w http.ResponseWriter, r *http.Request) (int, bool) {
+	cookie, err := r.Cookie(util.LinkCookieName)
+	if err != nil {
+		return 0, false
+	}
+	util.ClearLinkCookie(w, r)
+
+	id, signature, _ := strings.Cut(cookie.Value, ".")
+	if !util.ValidSignature(r.Context(), signature, "link-identity", id) {
+		return 0, false
+	}
+	user, _, err := a.settingsUser(r)
+	if err != nil || strconv.Itoa(user.ID) != id {
+		return 0, false
+	}
+	return user.ID, true
+}
+
+func (a *App) linkIdentity(w http.ResponseWriter, r *http.Request, userID int, identity models.Identity) {
+	owner, err := repositories.IdentityUser(r.Context(), a.DB, identity.Provider, identity.Subject)
+	if err == nil {
+		notice := "error=identity-taken"
+		if owner == userID {
+			notice = "notice=identity-linked"
+		}
+		http.Redirect(w, r, "/settings?"+notice, http.StatusSeeOther)
+		return
+	}
+
+	identity.UserID = userID
+	err = repositories.LinkIdentity(r.Context(), a.DB, identity)
+	if errors.Is(err, repositories.ErrIdentityLinked) {
+		http.Redirect(w, r, "/settings?error=identity-taken", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		util.WriteError(w, r, util.Internal(fmt.Errorf("failed to link identity: %w", err)))
+		return
+	}
+
+	a.Audit(r, userID, AuditIdentityLinked, identity.Provider)
+	if user, err := repositories.GetUserByID(r.Context(), a.DB, userID); err == nil {
+		a.notifyIdentityChange(r.Context(), user, fmt.Sprintf("Your %s account %s was linked to", a.displayName(identity.Provider), identity.Email))
+	}
+	http.Redirect(w, r, "/settings?notice=identity-linked", http.StatusSeeOther)
+}
+
+// LinkIdentityHandler sends the signed in user to a provider to link their account there.
+func (a *App) LinkIdentityHandler(w http.ResponseWriter, r *http.Request) error {
+	user, _, ok := a.settingsRequest(w, r, http.MethodPost)
+	if !ok {
+		return nil
+	}
+
+	provider := r.FormValue("provider")
+	if _, ok := a.providerName(provider); !ok {
+		return util.NewError(http.StatusBadRequest, "error.bad_request", nil)
+	}
+
+	id := strconv.Itoa(user.ID)
+	util.SetLinkCookie(w, r, id+"."+util.Sign(r.Context(), "link-identity", id), time.Now().Add(LinkLifetime))
+	http.Redirect(w, r, "/auth/"+provider, http.StatusSeeOther)
+	return nil
+}
+
+/*
+UnlinkIdentityHandler removes the signed in user's link to a provider. The last way to sign in cannot be removed, so users without a password or passkey must keep one provider.
+*/
+func (a *App) UnlinkIdentityHandler(w http.ResponseWriter, r *http.Request) error {
+	user, _, ok := a.settingsRequest(w, r, http.MethodPost)
+	if !ok {
+		return nil
+	}
+
+	provider := r.FormValue("provider")
+	if _, ok := a.providerName(provider); !ok {
+		return util.NewError(http.StatusBadRequest, "error.bad_request", nil)
+	}
+
+	methods, err := a.signInMethods(r, user)
+	if err != nil {
+		return util.Internal(fmt.Errorf("failed to count sign-in methods: %w", err))
+	}
+	if methods <= 1 {
+		http.Redirect(w, r, "/settings?error=identity-last", http.StatusSeeOther)
+		return nil
+	}
+
+	err = repositories.UnlinkIdentity(r.Context(), a.DB, user.ID, provider)
+	if errors.Is(err, sql.ErrNoRows) {
+		return util.NewError(http.StatusBadRequest, "error.bad_request", nil)
+	}
+	if err != nil {
+		return util.Internal(fmt.Errorf("failed to unlink identity: %w", err))
+	}
+
+	a.Audit(r, user.ID, AuditIdentityUnlinked, provider)
+	a.notifyIdentityChange(r.Context(), user, fmt.Sprintf("Your %s account was unlinked from", a.displayName(provider)))
+	http.Redirect(w, r, "/settings?notice=identity-unlinked", http.StatusSeeOther)
+	return nil
+}
+
+// signInMethods counts the ways a user can sign in: their password, linked providers and, while they are turned on, passkeys.
+func (a *App) signInMethods(r *http.Request, user models.User) (int, error) {
+	identities, err := repositories.ListIdentities(r.Context(), a.DB, user.ID)
+	if err != nil {
+		return 0, err
+	}
+	methods := len(identities)
+	if a.Config.Features.Passkeys {
+		passkeys, err := repositories.ListPasskeys(r.Context(), a.DB, user.ID)
+		if err != nil {
+			return 0, err
+		}
+		methods += len(passkeys)
+	}
+	if user.Password != "" {
+		methods++
+	}
+	return methods, nil
+}
+
+// linkedProviders lists every provider with whether the user has linked it.
+func (a *App) linkedProviders(ctx context.Context, userID int) ([]linkedProvider, error) {
+	identities, err := repositories.ListIdentities(ctx, a.DB, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var providers []linkedProvider
+	for _, provider := range a.IdentityProviders() {
+		p := linkedProvider{Provider: provider.Name, Name: provider.DisplayName}
+		for _, identity := range identities {
+			if identity.Provider == provider.Name {
+				p.Linked, p.Email = true, identity.Email
+			}
+		}
+		providers = append(providers, p)
+	}
+	return providers, nil
+}
+
+// displayName returns the name of a provider for messages, even one no longer registered.
+func (a *App) displayName(provider string) string {
+	if name, ok := a.providerName(provider); ok {
+		return name
+	}
+	return provider
+}
+
+func (a *App) notifyIdentityChange(ctx context.Context, user models.User, change string) {
+	err := jobs.SendEmail(ctx, a.DB, mailer.Message{
+		To:      user.Email,
+		Subject: "The sign-in methods of your forum account changed",
+		Body: fmt.Sprintf("Hi %s,\n\n%s your forum account. "+
+			"If this was not you, reset your password and review your linked accounts in your settings straight away.\n", user.Username, change),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to queue account linking email", "err", err)
+	}
+}
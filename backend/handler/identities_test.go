@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jesee-kuya/forum/backend/models"
+	"github.com/jesee-kuya/forum/backend/repositories"
+	"github.com/jesee-kuya/forum/backend/util"
+)
+
+func insertUser(t *testing.T, app *App, username, email, provider string, verified bool) int {
+	res, err := app.DB.Exec("INSERT INTO tblUsers (username, email, user_password, auth_provider, email_verified) VALUES (?, ?, 'hash', ?, ?)",
+		username, email, provider, verified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := res.LastInsertId()
+	return int(id)
+}
+
+func oauthSignIn(app *App, identity models.Identity, username string, verified bool, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/auth/google/callback", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	app.OAuthSignIn(rec, req, identity, username, verified)
+	return rec
+}
+
+func TestOAuthSignInLinking(t *testing.T) {
+	app := newTestApp(t)
+
+	verified := insertUser(t, app, "carol", "carol@example.com", "", true)
+	unverified := insertUser(t, app, "dave", "dave@example.com", "", false)
+	legacy := insertUser(t, app, "erin", "erin@example.com", "github", true)
+
+	tests := []struct {
+		name     string
+		identity models.Identity
+		verified bool
+		location string
+		userID   int // the user the identity should end up linked to, 0 for none
+	}{
+		{"verified on both sides", models.Identity{Provider: "google", Subject: "g-carol", Email: "carol@example.com"}, true, "/home?status=returning_user", verified},
+		{"unverified at the provider", models.Identity{Provider: "github", Subject: "1", Email: "carol@example.com"}, false, "/sign-in?notice=link-account", 0},
+		{"unverified at the forum", models.Identity{Provider: "google", Subject: "g-dave", Email: "dave@example.com"}, true, "/sign-in?notice=link-account", 0},
+		{"account made by the provider, unverified there", models.Identity{Provider: "github", Subject: "2", Email: "erin@example.com"}, false, "/sign-in?notice=link-account", 0},
+		{"account made by the provider", models.Identity{Provider: "github", Subject: "2", Email: "erin@example.com"}, true, "/home?status=returning_user", legacy},
+		{"new email", models.Identity{Provider: "google", Subject: "g-frank", Email: "frank@example.com"}, true, "/home?status=new_user", -1},
+		{"already linked", models.Identity{Provider: "google", Subject: "g-carol", Email: "changed@example.com"}, false, "/home?status=returning_user", verified},
+	}
+
+	for _, tc := range tests {
+		rec := oauthSignIn(app, tc.identity, "frank", tc.verified)
+		if got := rec.Header().Get("Location"); got != tc.location {
+			t.Errorf("%s: redirected to %q, want %q", tc.name, got, tc.location)
+		}
+
+		userID, err := repositories.IdentityUser(context.Background(), app.DB, tc.identity.Provider, tc.identity.Subject)
+		switch {
+		case tc.userID == 0 && err == nil:
+			t.Errorf("%s: identity was linked to user %d", tc.name, userID)
+		case tc.userID > 0 && userID != tc.userID:
+			t.Errorf("%s: identity linked to user %d (%v), want %d", tc.name, userID, err, tc.userID)
+		case tc.userID < 0 && (err != nil || userID == verified || userID == unverified || userID == legacy):
+			t.Errorf("%s: expected a new user, got %d (%v)", tc.name, userID, err)
+		}
+	}
+}
+
+func TestOAuthSignInRegistrationClosed(t *testing.T) {
+	app := newTestApp(t)
+	existing := insertUser(t, app, "grace", "grace@example.com", "", true)
+
+	app.Config.Features.Registration = false
+	signIn := func(identity models.Identity) string {
+		rec := oauthSignIn(app, identity, "heidi", true)
+		return rec.Header().Get("Location")
+	}
+
+	if got := signIn(models.Identity{Provider: "google", Subject: "g-heidi", Email: "heidi@example.com"}); got != "/sign-in?notice=registration-closed" {
+		t.Errorf("new user redirected to %q, want the registration closed notice", got)
+	}
+	var users int
+	app.DB.QueryRow("SELECT COUNT(*) FROM tblUsers").Scan(&users)
+	if users != 1 {
+		t.Errorf("%d users after a refused sign-up, want 1", users)
+	}
+
+	if got := signIn(models.Identity{Provider: "google", Subject: "g-grace", Email: "grace@example.com"}); got != "/home?status=returning_user" {
+		t.Errorf("existing user redirected to %q, want to be signed in", got)
+	}
+	if userID, err := repositories.IdentityUser(context.Background(), app.DB, "google", "g-grace"); err != nil || userID != existing {
+		t.Errorf("identity linked to %d (%v), want %d", userID, err, existing)
+	}
+}
+
+func TestOAuthSignInLockedAccount(t *testing.T) {
+	app := newTestApp(t)
+	userID := insertUser(t, app, "ivan", "ivan@example.com", "", true)
+	identity := models.Identity{Provider: "google", Subject: "g-ivan", Email: "ivan@example.com"}
+
+	if err := repositories.LockAccount(context.Background(), app.DB, userID, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	rec := oauthSignIn(app, identity, "ivan", true)
+	if got := rec.Header().Get("Location"); got != "/sign-in?notice=locked" {
+		t.Errorf("locked account redirected to %q, want the locked notice", got)
+	}
+	if len(rec.Result().Cookies()) != 0 {
+		t.Error("a session was started for a locked account")
+	}
+
+	if err := repositories.UnlockAccount(context.Background(), app.DB, userID); err != nil {
+		t.Fatal(err)
+	}
+	rec = oauthSignIn(app, identity, "ivan", true)
+	if got := rec.Header().Get("Location"); got != "/home?status=returning_user" {
+		t.Errorf("unlocked account redirected to %q, want to be signed in", got)
+	}
+	var attempts, events int
+	app.DB.QueryRow("SELECT COUNT(*) FROM tblLoginAttempts WHERE user_id = ? AND succeeded = 1", userID).Scan(&attempts)
+	app.DB.QueryRow("SELECT COUNT(*) FROM tblAuditLog WHERE user_id = ? AND event = ?", userID, AuditLoginSucceeded).Scan(&events)
+	if attempts != 1 || events != 1 {
+		t.Errorf("recorded %d successful attempts and %d audit events, want 1 of each", attempts, events)
+	}
+}
+
+func TestLinkAndUnlinkIdentity(t *testing.T) {
+	app := newTestApp(t)
+	app.RegisterIdentityProvider("google", "Google")
+
+	userID := insertUser(t, app, "grace", "grace@example.com", "", false)
+	other := insertUser(t, app, "heidi", "heidi@example.com", "", false)
+	repositories.LinkIdentity(context.Background(), app.DB, models.Identity{UserID: other, Provider: "github", Subject: "taken"})
+
+	rec := httptest.NewRecorder()
+	if err := app.StartSession(rec, httptest.NewRequest(http.MethodPost, "/sign-in", nil), userID, false); err != nil {
+		t.Fatal(err)
+	}
+	session := rec.Result().Cookies()[0]
+	id := strconv.Itoa(userID)
+	link := &http.Cookie{Name: util.LinkCookieName, Value: id + "." + util.Sign(context.Background(), "link-identity", id)}
+
+	// A provider account with a different email links to the signed in user.
+	rec = oauthSignIn(app, models.Identity{Provider: "google", Subject: "g-grace", Email: "grace@gmail.example"}, "grace", true, session, link)
+	if got := rec.Header().Get("Location"); got != "/settings?notice=identity-linked" {
+		t.Fatalf("linking redirected to %q", got)
+	}
+	if owner, _ := repositories.IdentityUser(context.Background(), app.DB, "google", "g-grace"); owner != userID {
+		t.Fatalf("identity linked to %d, want %d", owner, userID)
+	}
+
+	// Accounts linked to someone else stay theirs.
+	rec = oauthSignIn(app, models.Identity{Provider: "github", Subject: "taken", Email: "x@example.com"}, "x", true, session, link)
+	if got := rec.Header().Get("Location"); got != "/settings?error=identity-taken" {
+		t.Errorf("linking a taken identity redirected to %q", got)
+	}
+
+	// A forged linking cookie is ignored and the provider sign-in goes ahead as usual.
+	forged := &http.Cookie{Name: util.LinkCookieName, Value: strconv.Itoa(other) + ".forged"}
+	rec = oauthSignIn(app, models.Identity{Provider: "google", Subject: "g-grace", Email: "grace@gmail.example"}, "grace", true, session, forged)
+	if got := rec.Header().Get("Location"); got != "/home?status=returning_user" {
+		t.Errorf("forged link cookie redirected to %q", got)
+	}
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == util.SessionCookieName {
+			session = c // the sign-in replaced the old session
+		}
+	}
+
+	unlink := func() string {
+		req := httptest.NewRequest(http.MethodPost, "/settings/identities/unlink", nil)
+		req.Form = map[string][]string{"provider": {"google"}}
+		req.AddCookie(session)
+		rec := httptest.NewRecorder()
+		util.Handle(app.UnlinkIdentityHandler)(rec, req)
+		return rec.Header().Get("Location")
+	}
+
+	// The password is another way in, so the provider can go.
+	if got := unlink(); got != "/settings?notice=identity-unlinked" {
+		t.Errorf("unlinking redirected to %q", got)
+	}
+
+	// Without a password the last provider must stay.
+	repositories.LinkIdentity(context.Background(), app.DB, models.Identity{UserID: userID, Provider: "google", Subject: "g-grace"})
+	app.DB.Exec("UPDATE tblUsers SET user_password = NULL WHERE id = ?", userID)
+	if got := unlink(); got != "/settings?error=identity-last" {
+		t.Errorf("unlinking the last sign-in method redirected to %q", got)
+	}
+}
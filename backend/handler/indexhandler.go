@@ -1,7 +1,8 @@
 package handler
 
 import (
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
 
 	"github.com/jesee-kuya/forum/backend/repositories"
@@ -13,47 +14,38 @@ type RequestData struct {
 }
 
 type Response struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
+	Success  bool   `json:"success"`
+	Message  string `json:"message"`
+	Redirect string `json:"redirect,omitempty"`
 }
 
-func IndexHandler(w http.ResponseWriter, r *http.Request) {
+func (a *App) IndexHandler(w http.ResponseWriter, r *http.Request) error {
 	if r.URL.Path != "/home" {
-		util.ErrorHandler(w, "Page does not exist", http.StatusNotFound)
-		return
+		return util.NewError(http.StatusNotFound, "error.page_not_found", nil)
 	}
 
 	if r.Method != http.MethodGet {
-		log.Println("wrong method used", r.Method)
-		util.ErrorHandler(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
+		return util.MethodNotAllowed()
 	}
 
-	cookie, err := getSessionID(r)
-	if err != nil {
-		log.Println("Invalid Session")
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
-	}
-	sessionData, err := getSessionData(cookie)
-	if err != nil {
-		log.Println("Invalid Session")
+	userID, ok := a.signedInUser(r)
+	if !ok {
+		slog.InfoContext(r.Context(), "Invalid session")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
+		return nil
 	}
 	// Fetch user information
-	_, err = repositories.GetUserByEmail(sessionData["userEmail"].(string))
+	_, err := repositories.GetUserByID(r.Context(), a.DB, userID)
 	if err != nil {
-		log.Printf("Invalid session token: %v", err)
+		slog.InfoContext(r.Context(), "Invalid session token", "err", err)
 		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
+		return nil
 	}
 
-	posts, err := repositories.GetPosts(util.DB)
+	posts, err := repositories.GetPosts(r.Context(), a.DB)
 	if err != nil {
-		log.Printf("Failed to get posts: %v", err)
-		util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-		return
+		return util.Internal(fmt.Errorf("failed to get posts: %w", err))
 	}
-	PostDetails(w, r, posts, true)
+	a.PostDetails(w, r, posts, true)
+	return nil
 }
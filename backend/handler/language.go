@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/jesee-kuya/forum/backend/i18n"
+	"github.com/jesee-kuya/forum/backend/repositories"
+	"github.com/jesee-kuya/forum/backend/util"
+)
+
+/*
+LanguageHandler switches the forum to the language picked from the language menu. The choice is kept in the language cookie and, for a signed in user, saved to their account so it follows them to other browsers. The user is sent back to the page they picked it on.
+*/
+func (a *App) LanguageHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return util.MethodNotAllowed()
+	}
+
+	t, ok := i18n.Lookup(r.FormValue("lang"))
+	if !ok {
+		return util.NewError(http.StatusBadRequest, "error.bad_request", errors.New("unknown language"))
+	}
+	util.SetLanguageCookie(w, r, t.Lang())
+
+	if userID, ok := a.signedInUser(r); ok {
+		if err := repositories.SetUserLanguage(r.Context(), a.DB, userID, t.Lang()); err != nil {
+			return util.Internal(fmt.Errorf("failed to save language: %w", err))
+		}
+	}
+
+	http.Redirect(w, r, returnPath(r), http.StatusSeeOther)
+	return nil
+}
+
+// returnPath returns the path of the page r was sent from on this site, or "/" when there is none.
+func returnPath(r *http.Request) string {
+	referer, err := url.Parse(r.Referer())
+	if err != nil || referer.Host != r.Host || !strings.HasPrefix(referer.Path, "/") {
+		return "/"
+	}
+	// Browsers read "//host" and "/\host" as another site
+	if len(referer.Path) > 1 && (referer.Path[1] == '/' || referer.Path[1] == '\\') {
+		return "/"
+	}
+	if referer.RawQuery != "" {
+		return referer.Path + "?" + referer.RawQuery
+	}
+	return referer.Path
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/jesee-kuya/forum/backend/i18n"
+	"github.com/jesee-kuya/forum/backend/util"
+)
+
+func TestLanguageHandler(t *testing.T) {
+	tests := []struct {
+		name, method, lang, referer string
+		code                        int
+		location, cookie            string
+	}{
+		{"back to the page", http.MethodPost, "sw", "http://example.com/settings?notice=x", http.StatusSeeOther, "/settings?notice=x", "sw"},
+		{"other site", http.MethodPost, "en", "https://evil.example/phish", http.StatusSeeOther, "/", "en"},
+		{"protocol relative path", http.MethodPost, "en", "http://example.com//evil.example/", http.StatusSeeOther, "/", "en"},
+		{"no referer", http.MethodPost, "SW", "", http.StatusSeeOther, "/", "sw"},
+		{"unknown language", http.MethodPost, "xx", "", http.StatusBadRequest, "", ""},
+		{"wrong method", http.MethodGet, "sw", "", http.StatusMethodNotAllowed, "", ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			form := url.Values{"lang": {tc.lang}}
+			req := httptest.NewRequest(tc.method, "http://example.com/language", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tc.referer != "" {
+				req.Header.Set("Referer", tc.referer)
+			}
+			w := httptest.NewRecorder()
+			util.Handle(New(nil, nil).LanguageHandler)(w, req)
+
+			if w.Code != tc.code {
+				t.Fatalf("Expected status %d, got %d", tc.code, w.Code)
+			}
+			if got := w.Header().Get("Location"); got != tc.location {
+				t.Errorf("Expected to be sent to %q, got %q", tc.location, got)
+			}
+			var lang string
+			for _, c := range w.Result().Cookies() {
+				if c.Name == i18n.CookieName {
+					lang = c.Value
+				}
+			}
+			if lang != tc.cookie {
+				t.Errorf("Expected the language cookie %q, got %q", tc.cookie, lang)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/jesee-kuya/forum/backend/jobs"
+	"github.com/jesee-kuya/forum/backend/mailer"
+	"github.com/jesee-kuya/forum/backend/metrics"
+	"github.com/jesee-kuya/forum/backend/models"
+	"github.com/jesee-kuya/forum/backend/repositories"
+	"github.com/jesee-kuya/forum/backend/util"
+)
+
+/*
+Limits on failed sign-ins. Failures are counted over LoginAttemptWindow; past the free attempts every further failure doubles the wait before the next attempt is accepted, up to MaxLoginDelay. An account reaching AccountLockoutThreshold failures is locked for AccountLockoutDuration and its owner is emailed an unlock link.
+*/
+const (
+	LoginAttemptWindow      = 15 * time.Minute
+	MaxLoginDelay           = time.Minute
+	FreeAccountAttempts     = 3
+	FreeIPAttempts          = 10
+	AccountLockoutThreshold = 10
+	AccountLockoutDuration  = 30 * time.Minute
+	UnlockTokenLifetime     = 24 * time.Hour
+)
+
+// TokenUnlockAccount is the purpose of tokens in account unlock links.
+const TokenUnlockAccount = "unlock_account"
+
+// LoginDelay returns how long to wait after the latest of the given number of failed sign-ins.
+func LoginDelay(failures, free int) time.Duration {
+	if failures <= free {
+		return 0
+	}
+	delay := time.Second << min(failures-free-1, 16)
+	if delay > MaxLoginDelay {
+		return MaxLoginDelay
+	}
+	return delay
+}
+
+// retryAfter returns how much longer a client has to wait before signing in again, if at all.
+func retryAfter(failures, free int, latest time.Time) time.Duration {
+	wait := time.Until(latest.Add(LoginDelay(failures, free)))
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// loginThrottled checks the failed sign-ins from the client's IP address and, when an account is known, for that account.
+func (a *App) loginThrottled(r *http.Request, userID int) (time.Duration, error) {
+	since := time.Now().Add(-LoginAttemptWindow)
+
+	failures, latest, err := repositories.IPLoginFailures(r.Context(), a.DB, util.ClientIP(r), since)
+	if err != nil {
+		return 0, err
+	}
+	wait := retryAfter(failures, FreeIPAttempts, latest)
+
+	if userID != 0 {
+		failures, latest, err = repositories.AccountLoginFailures(r.Context(), a.DB, userID, since)
+		if err != nil {
+			return 0, err
+		}
+		wait = max(wait, retryAfter(failures, FreeAccountAttempts, latest))
+	}
+	return wait, nil
+}
+
+// Sign-in methods, as counted by the forum_logins_total metric.
+const (
+	loginPassword  = "password"
+	loginPasskey   = "passkey"
+	loginTwoFactor = "two_factor"
+	loginOAuth     = "oauth"
+)
+
+/*
+recordLoginFailure stores a failed sign-in made with method, a wrong password or second factor as given by reason, and locks the account once it reaches AccountLockoutThreshold failures. It reports whether the account was locked.
+*/
+func (a *App) recordLoginFailure(r *http.Request, method string, user models.User, identifier, reason string) bool {
+	metrics.Login(method, false)
+	if err := repositories.RecordLoginAttempt(r.Context(), a.DB, user.ID, identifier, util.ClientIP(r), false); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to record login attempt", "err", err)
+	}
+	if user.ID == 0 {
+		a.Audit(r, 0, AuditLoginFailed, "unknown account "+identifier)
+		return false
+	}
+	a.Audit(r, user.ID, AuditLoginFailed, reason)
+
+	failures, _, err := repositories.AccountLoginFailures(r.Context(), a.DB, user.ID, time.Now().Add(-LoginAttemptWindow))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to count login failures", "err", err)
+		return false
+	}
+	if failures < AccountLockoutThreshold {
+		return false
+	}
+
+	if err := repositories.LockAccount(r.Context(), a.DB, user.ID, time.Now().Add(AccountLockoutDuration)); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to lock account", "err", err)
+		return false
+	}
+	a.Audit(r, user.ID, AuditAccountLocked, fmt.Sprintf("%d failed sign-ins", failures))
+	a.sendUnlockEmail(r, user)
+	return true
+}
+
+// recordLoginSuccess stores a successful sign-in made with method and forgets the account's earlier failures.
+func (a *App) recordLoginSuccess(r *http.Request, method string, user models.User, identifier string) {
+	metrics.Login(method, true)
+	if err := repositories.RecordLoginAttempt(r.Context(), a.DB, user.ID, identifier, util.ClientIP(r), true); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to record login attempt", "err", err)
+	}
+	if err := repositories.ClearLoginFailures(r.Context(), a.DB, user.ID); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to clear login failures", "err", err)
+	}
+	a.Audit(r, user.ID, AuditLoginSucceeded, "")
+}
+
+func (a *App) sendUnlockEmail(r *http.Request, user models.User) {
+	base, err := util.BaseURL(r)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Not sending unlock email", "err", err)
+		return
+	}
+	token, err := repositories.CreateUserToken(r.Context(), a.DB, user.ID, TokenUnlockAccount, UnlockTokenLifetime)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to create unlock token", "err", err)
+		return
+	}
+
+	link := base + "/unlock?token=" + token
+	err = jobs.SendEmail(r.Context(), a.DB, mailer.Message{
+		To:      user.Email,
+		Subject: "Your forum account has been locked",
+		Body: fmt.Sprintf("Hi %s,\n\nYour account was locked for %d minutes after %d failed sign-in attempts. "+
+			"If this was you, you can unlock it right away by opening this link:\n\n%s\n\n"+
+			"If it wasn't you, someone may be trying to guess your password. Consider changing it once you are signed in.\n",
+			user.Username, int(AccountLockoutDuration.Minutes()), AccountLockoutThreshold, link),
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to queue unlock email", "err", err)
+	}
+}
+
+/*
+UnlockAccountHandler lifts a lockout using the link emailed when the account was locked.
+*/
+func (a *App) UnlockAccountHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return util.MethodNotAllowed()
+	}
+
+	userID, err := repositories.ConsumeUserToken(r.Context(), a.DB, TokenUnlockAccount, r.URL.Query().Get("token"))
+	if err != nil {
+		return util.NewError(http.StatusBadRequest, "error.unlock_link_invalid", fmt.Errorf("failed to unlock account: %w", err))
+	}
+
+	if err := repositories.UnlockAccount(r.Context(), a.DB, userID); err != nil {
+		return util.Internal(fmt.Errorf("failed to unlock account: %w", err))
+	}
+	a.Audit(r, userID, AuditAccountUnlock, "unlock link")
+
+	http.Redirect(w, r, "/sign-in?notice=unlocked", http.StatusSeeOther)
+	return nil
+}
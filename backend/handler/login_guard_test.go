@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/jesee-kuya/forum/backend/repositories"
+	"github.com/jesee-kuya/forum/backend/util"
+)
+
+func TestLoginDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{0, 0},
+		{FreeAccountAttempts, 0},
+		{FreeAccountAttempts + 1, time.Second},
+		{FreeAccountAttempts + 2, 2 * time.Second},
+		{FreeAccountAttempts + 4, 8 * time.Second},
+		{FreeAccountAttempts + 7, MaxLoginDelay},
+		{1000, MaxLoginDelay},
+	}
+
+	for _, tc := range tests {
+		if got := LoginDelay(tc.failures, FreeAccountAttempts); got != tc.expected {
+			t.Errorf("LoginDelay(%d) = %v, want %v", tc.failures, got, tc.expected)
+		}
+	}
+}
+
+func TestLoginDoesNotRevealAccounts(t *testing.T) {
+	app := newTestApp(t)
+	hash, err := util.PasswordEncrypt([]byte("correct horse"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID := insertUser(t, app, "kim", "kim@example.com", "", true)
+	app.DB.Exec("UPDATE tblUsers SET user_password = ? WHERE id = ?", string(hash), userID)
+	if err := repositories.LockAccount(context.Background(), app.DB, userID, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	signIn := func(email, password string) (int, string) {
+		form := url.Values{"email": {email}, "password": {password}}
+		req := httptest.NewRequest(http.MethodPost, "/sign-in", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		util.Handle(app.LoginHandler)(rec, req)
+		return rec.Code, rec.Body.String()
+	}
+
+	unknownCode, unknownBody := signIn("nobody@example.com", "wrong password")
+	lockedCode, lockedBody := signIn("kim@example.com", "wrong password")
+	if unknownCode != lockedCode || unknownBody != lockedBody {
+		t.Errorf("a locked account answers %d %s, an unknown one %d %s", lockedCode, lockedBody, unknownCode, unknownBody)
+	}
+	if code, _ := signIn("kim@example.com", "correct horse"); code != http.StatusLocked {
+		t.Errorf("the right password on a locked account got %d, want 423", code)
+	}
+
+	if cost, err := bcrypt.Cost(dummyPasswordHash()); err != nil || cost != 10 {
+		t.Errorf("dummy hash cost %d (%v), want the cost of real hashes", cost, err)
+	}
+}
@@ -1,101 +1,130 @@
 package handler
 
 import (
+	"database/sql"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
-	"text/template"
-	"time"
+	"strconv"
+	"strings"
 
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/jesee-kuya/forum/backend/i18n"
 	"github.com/jesee-kuya/forum/backend/models"
 	"github.com/jesee-kuya/forum/backend/repositories"
 	"github.com/jesee-kuya/forum/backend/util"
-	"golang.org/x/crypto/bcrypt"
+	"sync"
 )
 
-var SessionStore = make(map[string]map[string]interface{})
+// signInNotices are the keys of the messages other pages can show on the sign in page through its notice parameter.
+var signInNotices = map[string]string{
+	"locked":              accountLockedMessage,
+	"unlocked":            "auth.notice.unlocked",
+	"verified":            "auth.notice.verified",
+	"password-reset":      "auth.notice.password_reset",
+	"email-changed":       "auth.notice.email_changed",
+	"link-account":        "auth.notice.link_account",
+	"registration-closed": "auth.notice.registration_closed",
+}
+
+const accountLockedMessage = "auth.account_locked"
+
+// dummyPasswordHash returns the hash passwords are compared with when the account has none, made at the cost real hashes use.
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, err := util.PasswordEncrypt([]byte(util.RandomToken(16)), 10)
+	if err != nil {
+		panic(fmt.Sprintf("failed to hash dummy password: %v", err))
+	}
+	return hash
+})
 
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
+func (a *App) LoginHandler(w http.ResponseWriter, r *http.Request) error {
 	var user models.User
 	var err error
 	if r.URL.Path != "/sign-in" {
-		util.ErrorHandler(w, "Page does not exist", http.StatusNotFound)
-		return
+		return util.NewError(http.StatusNotFound, "error.page_not_found", nil)
 	}
 
 	if r.Method == http.MethodPost {
-		email := r.FormValue("email")
-		if isValidEmail(email) {
-			user, err = repositories.GetUserByEmail(email)
-			if err != nil {
-				log.Println("Error fetching user", err)
-				util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-				return
-			}
+		identifier := strings.TrimSpace(r.FormValue("email"))
+		if isValidEmail(identifier) {
+			user, err = repositories.GetUserByEmail(r.Context(), a.DB, identifier)
 		} else {
-			user, err = repositories.GetUserByName(email)
-			if err != nil {
-				log.Println("Error fetching user", err)
-				util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-				return
-			}
+			user, err = repositories.GetUserByName(r.Context(), a.DB, identifier)
+		}
+		// An unknown account is treated like a wrong password, with user.ID left at 0
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return util.Internal(fmt.Errorf("error fetching user: %w", err))
 		}
 
-		// decrypt password & authorize user
-		storedPassword := user.Password
-
-		err = bcrypt.CompareHashAndPassword([]byte(storedPassword), []byte(r.FormValue("password")))
+		wait, err := a.loginThrottled(r, user.ID)
 		if err != nil {
-			log.Printf("Failed to hash: %v", err)
-			w.Header().Set("Content-Type", "application/json")
-			response := Response{Success: false}
-			json.NewEncoder(w).Encode(response)
-			return
+			return util.Internal(fmt.Errorf("error checking login attempts: %w", err))
+		}
+		if wait > 0 {
+			seconds := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			loginFailed(w, http.StatusTooManyRequests, i18n.N(r.Context(), "auth.too_many_attempts", seconds))
+			return nil
 		}
 
-		sessionToken := CreateSession()
-
-		if user.ID != 0 {
-			DeleteSession(user.ID)
+		// Unknown accounts and accounts without a password are checked against a dummy hash, so they take as long to refuse
+		storedPassword := []byte(user.Password)
+		if user.ID == 0 || user.Password == "" {
+			storedPassword = dummyPasswordHash()
 		}
-		err = repositories.DeleteSessionByUser(user.ID)
-		if err != nil {
-			log.Printf("Failed to delete session token: %v", err)
-			util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-			return
+		err = bcrypt.CompareHashAndPassword(storedPassword, []byte(r.FormValue("password")))
+		if user.ID == 0 || user.Password == "" || err != nil {
+			slog.WarnContext(r.Context(), "Failed sign-in", "identifier", identifier, "err", err)
+			// A lock is only told to whoever knows the password, and by the unlock email, so the answer does not reveal the account
+			a.recordLoginFailure(r, loginPassword, user, identifier, "wrong password")
+			loginFailed(w, http.StatusOK, i18n.T(r.Context(), "auth.invalid_credentials"))
+			return nil
 		}
 
+		lockedUntil, err := repositories.AccountLockedUntil(r.Context(), a.DB, user.ID)
+		if err != nil {
+			return util.Internal(fmt.Errorf("error checking account lock: %w", err))
+		}
+		if !lockedUntil.IsZero() {
+			loginFailed(w, http.StatusLocked, i18n.T(r.Context(), accountLockedMessage))
+			return nil
+		}
 		EnableCors(w)
 
-		SetSessionCookie(w, sessionToken)
-		SetSessionData(sessionToken, "userId", user.ID)
-		SetSessionData(sessionToken, "userEmail", user.Email)
-		expiryTime := time.Now().Add(24 * time.Hour)
-
-		err = repositories.StoreSession(user.ID, sessionToken, expiryTime)
+		pending, err := a.BeginSignIn(w, r, user.ID, r.FormValue("remember-me") == "on")
 		if err != nil {
-			log.Printf("Failed to store session token: %v", err)
-			util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-			return
+			return util.Internal(fmt.Errorf("failed to store session token: %w", err))
 		}
 		response := Response{Success: true}
+		if pending {
+			// The sign-in is recorded once the second factor checks out
+			response.Redirect = "/sign-in/2fa"
+		} else {
+			a.recordLoginSuccess(r, loginPassword, user, identifier)
+		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(response)
-		http.Redirect(w, r, "/home", http.StatusSeeOther)
-		return
+		return nil
 	} else if r.Method == http.MethodGet {
-		tmpl, err := template.ParseFiles("frontend/templates/sign-in.html")
-		if err != nil {
-			log.Println("Error parsing sign in template:", err)
-			util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-			return
-		}
-
-		tmpl.Execute(w, nil)
-
-	} else {
-		log.Println("Method not allowed", r.Method)
-		util.ErrorHandler(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
+		return a.render(w, r, "sign-in.html", struct {
+			Notice    string
+			Providers []IdentityProvider
+		}{
+			Notice:    i18n.T(r.Context(), signInNotices[r.URL.Query().Get("notice")]),
+			Providers: a.IdentityProviders(),
+		})
 	}
+	return util.MethodNotAllowed()
+}
+
+// loginFailed answers the sign-in form's script with an error message.
+func loginFailed(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Response{Success: false, Message: message})
 }
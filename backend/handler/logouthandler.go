@@ -1,33 +1,31 @@
 package handler
 
 import (
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
 
 	"github.com/jesee-kuya/forum/backend/repositories"
 	"github.com/jesee-kuya/forum/backend/util"
 )
 
-func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+func (a *App) LogoutHandler(w http.ResponseWriter, r *http.Request) error {
 	if r.Method != http.MethodPost {
-		log.Println("method not allowed")
-		util.ErrorHandler(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
+		return util.MethodNotAllowed()
 	}
 
 	cookie, err := getSessionID(r)
 	if err != nil {
-		log.Println("Invalid Session:", err)
+		slog.InfoContext(r.Context(), "Invalid session", "err", err)
 		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
+		return nil
 	}
 
-	err = repositories.DeleteSession(cookie)
+	err = repositories.DeleteSession(r.Context(), a.DB, cookie)
 	if err != nil {
-		log.Println("error deleting session:", err)
-		util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-		return
+		return util.Internal(fmt.Errorf("error deleting session: %w", err))
 	}
-	delete(SessionStore, cookie)
+	util.ClearSessionCookie(w, r)
 	http.Redirect(w, r, "/", http.StatusSeeOther)
+	return nil
 }
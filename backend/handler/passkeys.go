@@ -0,0 +1,404 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"github.com/jesee-kuya/forum/backend/i18n"
+	"github.com/jesee-kuya/forum/backend/jobs"
+	"github.com/jesee-kuya/forum/backend/mailer"
+	"github.com/jesee-kuya/forum/backend/models"
+	"github.com/jesee-kuya/forum/backend/repositories"
+	"github.com/jesee-kuya/forum/backend/util"
+)
+
+// PasskeyCeremonyLifetime is how long the browser has to answer a passkey challenge.
+const PasskeyCeremonyLifetime = 5 * time.Minute
+
+// Events written to the audit log for passkeys.
+const (
+	AuditPasskeyAdded   = "passkey_added"
+	AuditPasskeyRemoved = "passkey_removed"
+)
+
+// passkeyUser adapts a user and their passkeys to the WebAuthn library.
+type passkeyUser struct {
+	user        models.User
+	credentials []webauthn.Credential
+}
+
+func (u passkeyUser) WebAuthnID() []byte                         { return userHandle(u.user.ID) }
+func (u passkeyUser) WebAuthnName() string                       { return u.user.Username }
+func (u passkeyUser) WebAuthnDisplayName() string                { return u.user.Username }
+func (u passkeyUser) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
+
+// userHandle is the id authenticators store with a passkey to name its account. It is the user id, which says nothing about the person.
+func userHandle(userID int) []byte {
+	handle := make([]byte, 8)
+	binary.BigEndian.PutUint64(handle, uint64(userID))
+	return handle
+}
+
+// loadPasskeyUser returns a user together with the WebAuthn records of their passkeys.
+func (a *App) loadPasskeyUser(ctx context.Context, userID int) (passkeyUser, error) {
+	user, err := repositories.GetUserByID(ctx, a.DB, userID)
+	if err != nil {
+		return passkeyUser{}, err
+	}
+	passkeys, err := repositories.ListPasskeys(ctx, a.DB, userID)
+	if err != nil {
+		return passkeyUser{}, err
+	}
+
+	pu := passkeyUser{user: user}
+	for _, passkey := range passkeys {
+		var credential webauthn.Credential
+		if err := json.Unmarshal([]byte(passkey.Credential), &credential); err != nil {
+			return passkeyUser{}, fmt.Errorf("failed to decode passkey %d: %w", passkey.ID, err)
+		}
+		pu.credentials = append(pu.credentials, credential)
+	}
+	return pu, nil
+}
+
+// newWebAuthn returns a relying party for the forum's address, as passkeys are bound to the domain they were made on.
+func newWebAuthn(r *http.Request) (*webauthn.WebAuthn, error) {
+	base, err := util.BaseURL(r)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	return webauthn.New(&webauthn.Config{
+		RPID:          u.Hostname(),
+		RPDisplayName: TwoFactorIssuer,
+		RPOrigins:     []string{base},
+	})
+}
+
+// passkeyCeremony is a challenge handed to the browser, waiting for its answer.
+type passkeyCeremony struct {
+	session webauthn.SessionData
+	userID  int // 0 for sign-ins, where the user is not known yet
+	expires time.Time
+}
+
+// startCeremony keeps a challenge until the browser answers it and returns the id the browser must answer with.
+func (a *App) startCeremony(session *webauthn.SessionData, userID int) string {
+	id := util.RandomToken(16)
+	now := time.Now()
+
+	a.ceremonyMu.Lock()
+	defer a.ceremonyMu.Unlock()
+	for key, ceremony := range a.ceremonies {
+		if now.After(ceremony.expires) {
+			delete(a.ceremonies, key)
+		}
+	}
+	a.ceremonies[id] = passkeyCeremony{session: *session, userID: userID, expires: now.Add(PasskeyCeremonyLifetime)}
+	return id
+}
+
+// finishCeremony returns a challenge and forgets it, so each can be answered only once.
+func (a *App) finishCeremony(id string, userID int) (webauthn.SessionData, bool) {
+	a.ceremonyMu.Lock()
+	defer a.ceremonyMu.Unlock()
+
+	ceremony, ok := a.ceremonies[id]
+	delete(a.ceremonies, id)
+	if !ok || ceremony.userID != userID || time.Now().After(ceremony.expires) {
+		return webauthn.SessionData{}, false
+	}
+	return ceremony.session, true
+}
+
+// writePasskeyOptions sends the options for navigator.credentials to the browser along with the ceremony id.
+func writePasskeyOptions(w http.ResponseWriter, ceremony string, options interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Ceremony string      `json:"ceremony"`
+		Options  interface{} `json:"options"`
+	}{ceremony, options})
+}
+
+// PasskeysHandler renders the passkeys page of the account settings.
+func (a *App) PasskeysHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.URL.Path != "/settings/passkeys" {
+		return util.NewError(http.StatusNotFound, "error.page_not_found", nil)
+	}
+
+	user, _, ok := a.settingsRequest(w, r, http.MethodGet)
+	if !ok {
+		return nil
+	}
+
+	passkeys, err := repositories.ListPasskeys(r.Context(), a.DB, user.ID)
+	if err != nil {
+		return util.Internal(fmt.Errorf("failed to list passkeys: %w", err))
+	}
+
+	data := struct {
+		Passkeys []models.Passkey
+		Notice   string
+	}{Passkeys: passkeys}
+	if r.URL.Query().Get("notice") == "removed" {
+		data.Notice = i18n.T(r.Context(), "passkeys.removed")
+	}
+
+	return a.render(w, r, "passkeys.html", data)
+}
+
+/*
+BeginPasskeyRegistrationHandler starts adding a passkey for the signed in user. It answers with the options for navigator.credentials.create, asking for a discoverable credential so the passkey can sign in without a username.
+*/
+func (a *App) BeginPasskeyRegistrationHandler(w http.ResponseWriter, r *http.Request) error {
+	user, _, ok := a.settingsRequest(w, r, http.MethodPost)
+	if !ok {
+		return nil
+	}
+
+	pu, err := a.loadPasskeyUser(r.Context(), user.ID)
+	if err == nil {
+		var wa *webauthn.WebAuthn
+		if wa, err = newWebAuthn(r); err == nil {
+			var exclusions []protocol.CredentialDescriptor
+			for _, credential := range pu.credentials {
+				exclusions = append(exclusions, credential.Descriptor())
+			}
+
+			var creation *protocol.CredentialCreation
+			var session *webauthn.SessionData
+			creation, session, err = wa.BeginRegistration(pu,
+				webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+				webauthn.WithExclusions(exclusions))
+			if err == nil {
+				writePasskeyOptions(w, a.startCeremony(session, user.ID), creation)
+				return nil
+			}
+		}
+	}
+	return util.Internal(fmt.Errorf("failed to start passkey registration: %w", err))
+}
+
+/*
+FinishPasskeyRegistrationHandler verifies the new credential made by the browser and saves it as a passkey of the signed in user.
+*/
+func (a *App) FinishPasskeyRegistrationHandler(w http.ResponseWriter, r *http.Request) error {
+	user, _, ok := a.settingsRequest(w, r, http.MethodPost)
+	if !ok {
+		return nil
+	}
+
+	session, ok := a.finishCeremony(r.URL.Query().Get("ceremony"), user.ID)
+	if !ok {
+		loginFailed(w, http.StatusBadRequest, i18n.T(r.Context(), "passkeys.request_expired"))
+		return nil
+	}
+
+	pu, err := a.loadPasskeyUser(r.Context(), user.ID)
+	if err != nil {
+		return util.Internal(fmt.Errorf("failed to load passkeys: %w", err))
+	}
+	wa, err := newWebAuthn(r)
+	if err != nil {
+		return util.Internal(fmt.Errorf("failed to set up WebAuthn: %w", err))
+	}
+
+	credential, err := wa.FinishRegistration(pu, session, r)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Rejected passkey registration", "err", describeWebAuthnError(err))
+		loginFailed(w, http.StatusBadRequest, i18n.T(r.Context(), "passkeys.not_verified"))
+		return nil
+	}
+
+	record, err := json.Marshal(credential)
+	if err != nil {
+		return util.Internal(fmt.Errorf("failed to encode passkey: %w", err))
+	}
+
+	name := strings.TrimSpace(r.URL.Query().Get("name"))
+	if name == "" {
+		name = util.DescribeDevice(r.UserAgent())
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+
+	err = repositories.StorePasskey(r.Context(), a.DB, models.Passkey{
+		UserID:       user.ID,
+		CredentialID: base64.RawURLEncoding.EncodeToString(credential.ID),
+		Credential:   string(record),
+		Name:         name,
+	})
+	if err != nil {
+		return util.Internal(fmt.Errorf("failed to store passkey: %w", err))
+	}
+	a.Audit(r, user.ID, AuditPasskeyAdded, name)
+	a.notifyPasskeyChange(r.Context(), user, fmt.Sprintf("A passkey named %q was added to", name))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Response{Success: true})
+	return nil
+}
+
+// DeletePasskeyHandler removes one of the signed in user's passkeys.
+func (a *App) DeletePasskeyHandler(w http.ResponseWriter, r *http.Request) error {
+	user, _, ok := a.settingsRequest(w, r, http.MethodPost)
+	if !ok {
+		return nil
+	}
+
+	passkeyID, err := strconv.Atoi(r.FormValue("passkey_id"))
+	if err != nil {
+		return util.NewError(http.StatusBadRequest, "error.bad_request", nil)
+	}
+
+	name, err := repositories.DeletePasskey(r.Context(), a.DB, user.ID, passkeyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return util.NewError(http.StatusNotFound, "error.passkey_not_found", nil)
+	}
+	if err != nil {
+		return util.Internal(fmt.Errorf("failed to remove passkey: %w", err))
+	}
+	a.Audit(r, user.ID, AuditPasskeyRemoved, name)
+	a.notifyPasskeyChange(r.Context(), user, fmt.Sprintf("The passkey named %q was removed from", name))
+
+	http.Redirect(w, r, "/settings/passkeys?notice=removed", http.StatusSeeOther)
+	return nil
+}
+
+/*
+BeginPasskeyLoginHandler starts a passkey sign-in. No username is asked for: the browser offers the passkeys it has for the forum and the chosen one names its account.
+*/
+func (a *App) BeginPasskeyLoginHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return util.MethodNotAllowed()
+	}
+
+	wa, err := newWebAuthn(r)
+	if err != nil {
+		return util.Internal(fmt.Errorf("failed to set up WebAuthn: %w", err))
+	}
+	assertion, session, err := wa.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return util.Internal(fmt.Errorf("failed to start passkey sign-in: %w", err))
+	}
+	writePasskeyOptions(w, a.startCeremony(session, 0), assertion)
+	return nil
+}
+
+/*
+FinishPasskeyLoginHandler checks the browser's answer to a passkey sign-in and starts a session for the passkey's owner. A passkey stands in for both the password and the second factor, so the authenticator must verify the user with a fingerprint, face or PIN. Failures count against the client's IP address like failed passwords.
+*/
+func (a *App) FinishPasskeyLoginHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return util.MethodNotAllowed()
+	}
+
+	wait, err := a.loginThrottled(r, 0)
+	if err != nil {
+		return util.Internal(fmt.Errorf("error checking login attempts: %w", err))
+	}
+	if wait > 0 {
+		seconds := int(wait.Seconds()) + 1
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		loginFailed(w, http.StatusTooManyRequests, i18n.N(r.Context(), "auth.too_many_attempts", seconds))
+		return nil
+	}
+
+	session, ok := a.finishCeremony(r.URL.Query().Get("ceremony"), 0)
+	if !ok {
+		loginFailed(w, http.StatusBadRequest, i18n.T(r.Context(), "passkeys.sign_in_expired"))
+		return nil
+	}
+	parsed, err := protocol.ParseCredentialRequestResponse(r)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Rejected passkey sign-in", "err", describeWebAuthnError(err))
+		loginFailed(w, http.StatusBadRequest, i18n.T(r.Context(), "passkeys.not_verified"))
+		return nil
+	}
+	wa, err := newWebAuthn(r)
+	if err != nil {
+		return util.Internal(fmt.Errorf("failed to set up WebAuthn: %w", err))
+	}
+
+	var owner passkeyUser
+	_, credential, err := wa.ValidatePasskeyLogin(func(rawID, handle []byte) (webauthn.User, error) {
+		if len(handle) != 8 {
+			return nil, errors.New("unknown user handle")
+		}
+		owner, err = a.loadPasskeyUser(r.Context(), int(binary.BigEndian.Uint64(handle)))
+		return owner, err
+	}, session, parsed)
+	if err == nil && credential.Authenticator.CloneWarning {
+		err = errors.New("signature counter went backwards, the passkey may have been cloned")
+	}
+	if err != nil {
+		slog.WarnContext(r.Context(), "Rejected passkey sign-in", "err", describeWebAuthnError(err))
+		a.recordLoginFailure(r, loginPasskey, owner.user, "passkey", "passkey not verified")
+		loginFailed(w, http.StatusOK, i18n.T(r.Context(), "passkeys.not_verified"))
+		return nil
+	}
+	user := owner.user
+
+	lockedUntil, err := repositories.AccountLockedUntil(r.Context(), a.DB, user.ID)
+	if err != nil {
+		return util.Internal(fmt.Errorf("error checking account lock: %w", err))
+	}
+	if !lockedUntil.IsZero() {
+		loginFailed(w, http.StatusLocked, i18n.T(r.Context(), accountLockedMessage))
+		return nil
+	}
+
+	if record, err := json.Marshal(credential); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode passkey", "err", err)
+	} else if err := repositories.UpdatePasskeyCredential(r.Context(), a.DB, base64.RawURLEncoding.EncodeToString(credential.ID), string(record)); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to update passkey", "err", err)
+	}
+
+	if err := a.StartSession(w, r, user.ID, r.URL.Query().Get("remember-me") == "on"); err != nil {
+		return util.Internal(fmt.Errorf("failed to store session token: %w", err))
+	}
+	a.recordLoginSuccess(r, loginPasskey, user, "passkey")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Response{Success: true})
+	return nil
+}
+
+// describeWebAuthnError includes the details the WebAuthn library keeps for developers in the log.
+func describeWebAuthnError(err error) string {
+	var protoErr *protocol.Error
+	if errors.As(err, &protoErr) && protoErr.DevInfo != "" {
+		return fmt.Sprintf("%v (%s)", err, protoErr.DevInfo)
+	}
+	return err.Error()
+}
+
+func (a *App) notifyPasskeyChange(ctx context.Context, user models.User, change string) {
+	err := jobs.SendEmail(ctx, a.DB, mailer.Message{
+		To:      user.Email,
+		Subject: "The passkeys of your forum account changed",
+		Body: fmt.Sprintf("Hi %s,\n\n%s your forum account. "+
+			"If this was not you, remove any passkey you don't recognise and reset your password straight away.\n", user.Username, change),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to queue passkey email", "err", err)
+	}
+}
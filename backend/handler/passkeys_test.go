@@ -0,0 +1,337 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/jesee-kuya/forum/backend/config"
+	"github.com/jesee-kuya/forum/backend/database"
+	"github.com/jesee-kuya/forum/backend/repositories"
+	"github.com/jesee-kuya/forum/backend/util"
+)
+
+const testOrigin = "http://example.com"
+
+// softAuthenticator stands in for a security key or phone, holding one passkey.
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	counter      uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &softAuthenticator{key: key, credentialID: id}
+}
+
+func (a *softAuthenticator) authData(flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte("example.com"))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.counter)
+	return append(data, attested...)
+}
+
+func clientData(t *testing.T, typ, challenge string) []byte {
+	data, err := json.Marshal(map[string]string{"type": typ, "challenge": challenge, "origin": testOrigin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// create answers navigator.credentials.create with a "none" attestation.
+func (a *softAuthenticator) create(t *testing.T, options json.RawMessage) []byte {
+	var opts struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+			User      struct {
+				ID string `json:"id"`
+			} `json:"user"`
+		} `json:"publicKey"`
+	}
+	if err := json.Unmarshal(options, &opts); err != nil {
+		t.Fatal(err)
+	}
+	a.userHandle, _ = base64.RawURLEncoding.DecodeString(opts.PublicKey.User.ID)
+
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{KeyType: int64(webauthncose.EllipticKey), Algorithm: int64(webauthncose.AlgES256)},
+		Curve:         1, // P-256
+		XCoord:        a.key.X.FillBytes(make([]byte, 32)),
+		YCoord:        a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	attested := make([]byte, 16) // zero AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, publicKey...)
+
+	attestation, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authData(0x45, attested), // user present, user verified, attested credential data
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.response(map[string]string{
+		"clientDataJSON":    b64(clientData(t, "webauthn.create", opts.PublicKey.Challenge)),
+		"attestationObject": b64(attestation),
+	})
+}
+
+// get answers navigator.credentials.get by signing the challenge.
+func (a *softAuthenticator) get(t *testing.T, options json.RawMessage) []byte {
+	var opts struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+		} `json:"publicKey"`
+	}
+	if err := json.Unmarshal(options, &opts); err != nil {
+		t.Fatal(err)
+	}
+
+	a.counter++
+	authData := a.authData(0x05, nil) // user present, user verified
+	client := clientData(t, "webauthn.get", opts.PublicKey.Challenge)
+	clientHash := sha256.Sum256(client)
+	digest := sha256.Sum256(append(authData, clientHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.response(map[string]string{
+		"clientDataJSON":    b64(client),
+		"authenticatorData": b64(authData),
+		"signature":         b64(signature),
+		"userHandle":        b64(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) response(response map[string]string) []byte {
+	body, _ := json.Marshal(map[string]any{
+		"id":       b64(a.credentialID),
+		"rawId":    b64(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	return body
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// newTestApp returns an App with a database of its own, created from the schema.
+func newTestApp(t *testing.T) *App {
+	schema, err := os.ReadFile("../database/schema.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "forum.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(string(schema)); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+	// schema.sql has every column the migrations add
+	if _, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", database.SchemaVersion)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	cfg := config.Default()
+	cfg.Templates.Dir = filepath.Join("..", "..", cfg.Templates.Dir)
+	return New(db, cfg)
+}
+
+// passkeyRequest returns a request to the forum at testOrigin, which passkeys are bound to.
+func passkeyRequest(method, target string, body io.Reader) *http.Request {
+	cfg := config.Default()
+	cfg.Server.BaseURL = testOrigin
+	req := httptest.NewRequest(method, target, body)
+	return req.WithContext(config.NewContext(req.Context(), cfg))
+}
+
+// begin calls a begin handler and returns the ceremony id and the options for the browser.
+func begin(t *testing.T, handler util.HandlerFunc, cookies []*http.Cookie) (string, json.RawMessage) {
+	req := passkeyRequest(http.MethodPost, "/", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	util.Handle(handler)(rec, req)
+
+	var resp struct {
+		Ceremony string          `json:"ceremony"`
+		Options  json.RawMessage `json:"options"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("begin answered %d %q: %v", rec.Code, rec.Body.String(), err)
+	}
+	return resp.Ceremony, resp.Options
+}
+
+func finish(handler util.HandlerFunc, target string, body []byte, cookies []*http.Cookie) (*httptest.ResponseRecorder, Response) {
+	req := passkeyRequest(http.MethodPost, target, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	util.Handle(handler)(rec, req)
+
+	var resp Response
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	return rec, resp
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	app := newTestApp(t)
+
+	res, err := app.DB.Exec("INSERT INTO tblUsers (username, email, user_password) VALUES ('alice', 'alice@example.com', NULL)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, _ := res.LastInsertId()
+
+	// Sign in the usual way to add a passkey from the settings.
+	rec := httptest.NewRecorder()
+	if err := app.StartSession(rec, httptest.NewRequest(http.MethodPost, "/sign-in", nil), int(userID), false); err != nil {
+		t.Fatal(err)
+	}
+	cookies := rec.Result().Cookies()
+
+	authenticator := newSoftAuthenticator(t)
+	ceremony, options := begin(t, app.BeginPasskeyRegistrationHandler, cookies)
+	rec, resp := finish(app.FinishPasskeyRegistrationHandler, "/settings/passkeys/register/finish?name=Laptop&ceremony="+ceremony,
+		authenticator.create(t, options), cookies)
+	if !resp.Success {
+		t.Fatalf("registration failed: %d %s", rec.Code, rec.Body.String())
+	}
+
+	passkeys, err := repositories.ListPasskeys(context.Background(), app.DB, int(userID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(passkeys) != 1 || passkeys[0].Name != "Laptop" || passkeys[0].CredentialID != b64(authenticator.credentialID) {
+		t.Fatalf("unexpected passkeys after registration: %+v", passkeys)
+	}
+
+	// A second passkey for another device.
+	second := newSoftAuthenticator(t)
+	ceremony, options = begin(t, app.BeginPasskeyRegistrationHandler, cookies)
+	if _, resp := finish(app.FinishPasskeyRegistrationHandler, "/?ceremony="+ceremony, second.create(t, options), cookies); !resp.Success {
+		t.Fatal("registering a second passkey failed")
+	}
+
+	// Sign in with each passkey, with no session and no username.
+	for _, a := range []*softAuthenticator{authenticator, second} {
+		ceremony, options = begin(t, app.BeginPasskeyLoginHandler, nil)
+		body := a.get(t, options)
+		rec, resp = finish(app.FinishPasskeyLoginHandler, "/passkeys/login/finish?ceremony="+ceremony, body, nil)
+		if !resp.Success {
+			t.Fatalf("sign-in failed: %d %s", rec.Code, rec.Body.String())
+		}
+
+		var token string
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == util.SessionCookieName {
+				token = c.Value
+			}
+		}
+		var sessionUser int64
+		if err := app.DB.QueryRow("SELECT user_id FROM tblSessions WHERE session_token = ?", token).Scan(&sessionUser); err != nil {
+			t.Fatalf("no session stored for the passkey sign-in: %v", err)
+		}
+		if sessionUser != userID {
+			t.Errorf("session belongs to user %d, want %d", sessionUser, userID)
+		}
+
+		// The same answer cannot be used again.
+		if _, resp := finish(app.FinishPasskeyLoginHandler, "/passkeys/login/finish?ceremony="+ceremony, body, nil); resp.Success {
+			t.Error("a ceremony was accepted twice")
+		}
+	}
+
+	passkeys, _ = repositories.ListPasskeys(context.Background(), app.DB, int(userID))
+	for _, p := range passkeys {
+		if p.LastUsedOn.IsZero() || time.Since(p.LastUsedOn) > time.Minute {
+			t.Errorf("passkey %q has no recent last use: %v", p.Name, p.LastUsedOn)
+		}
+	}
+}
+
+func TestPasskeyLoginRejectsWrongKey(t *testing.T) {
+	app := newTestApp(t)
+
+	res, err := app.DB.Exec("INSERT INTO tblUsers (username, email, user_password) VALUES ('bob', 'bob@example.com', NULL)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, _ := res.LastInsertId()
+
+	rec := httptest.NewRecorder()
+	if err := app.StartSession(rec, httptest.NewRequest(http.MethodPost, "/sign-in", nil), int(userID), false); err != nil {
+		t.Fatal(err)
+	}
+	cookies := rec.Result().Cookies()
+
+	authenticator := newSoftAuthenticator(t)
+	ceremony, options := begin(t, app.BeginPasskeyRegistrationHandler, cookies)
+	if _, resp := finish(app.FinishPasskeyRegistrationHandler, "/?ceremony="+ceremony, authenticator.create(t, options), cookies); !resp.Success {
+		t.Fatal("registration failed")
+	}
+
+	// Another key claiming the registered credential must not verify.
+	impostor := newSoftAuthenticator(t)
+	impostor.credentialID = authenticator.credentialID
+	impostor.userHandle = authenticator.userHandle
+
+	ceremony, options = begin(t, app.BeginPasskeyLoginHandler, nil)
+	rec, resp := finish(app.FinishPasskeyLoginHandler, "/?ceremony="+ceremony, impostor.get(t, options), nil)
+	if resp.Success {
+		t.Fatal("a signature from the wrong key was accepted")
+	}
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == util.SessionCookieName {
+			t.Error("a session cookie was set for a rejected passkey")
+		}
+	}
+
+	// Answers to an unknown ceremony are rejected before being checked.
+	if _, resp := finish(app.FinishPasskeyLoginHandler, "/?ceremony=unknown", authenticator.get(t, options), nil); resp.Success {
+		t.Error("an unknown ceremony was accepted")
+	}
+}
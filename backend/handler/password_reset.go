@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jesee-kuya/forum/backend/i18n"
+	"github.com/jesee-kuya/forum/backend/jobs"
+	"github.com/jesee-kuya/forum/backend/mailer"
+	"github.com/jesee-kuya/forum/backend/repositories"
+	"github.com/jesee-kuya/forum/backend/util"
+)
+
+// PasswordResetLifetime is how long a password reset link stays valid.
+const PasswordResetLifetime = time.Hour
+
+// TokenResetPassword is the purpose of tokens in password reset links.
+const TokenResetPassword = "reset_password"
+
+// Events written to the audit log by the password reset flow.
+const (
+	AuditPasswordResetRequested = "password_reset_requested"
+	AuditPasswordReset          = "password_reset"
+)
+
+// The same answer is given whether or not an account exists, so the form cannot be used to find accounts.
+const resetRequestedMessage = "password.reset_requested"
+
+type passwordResetPage struct {
+	Notice, Error string
+	Token         string
+}
+
+func (a *App) renderPasswordPage(w http.ResponseWriter, r *http.Request, name string, data passwordResetPage) {
+	if err := a.render(w, r, name, data); err != nil {
+		util.WriteError(w, r, err)
+	}
+}
+
+/*
+ForgotPasswordHandler shows the "forgot password" form and emails a reset link to the address entered, if it belongs to an account.
+*/
+func (a *App) ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case http.MethodGet:
+		a.renderPasswordPage(w, r, "forgot-password.html", passwordResetPage{})
+	case http.MethodPost:
+		email := strings.TrimSpace(r.FormValue("email"))
+
+		user, err := repositories.GetUserByEmail(r.Context(), a.DB, email)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return util.Internal(fmt.Errorf("error fetching user: %w", err))
+		}
+
+		if err == nil {
+			if err := a.sendPasswordResetEmail(r, user.ID, user.Username, user.Email); err != nil {
+				slog.ErrorContext(r.Context(), "Failed to send password reset email", "err", err)
+			}
+			a.Audit(r, user.ID, AuditPasswordResetRequested, "")
+		}
+
+		a.renderPasswordPage(w, r, "forgot-password.html", passwordResetPage{Notice: i18n.T(r.Context(), resetRequestedMessage)})
+	default:
+		return util.MethodNotAllowed()
+	}
+	return nil
+}
+
+func (a *App) sendPasswordResetEmail(r *http.Request, userID int, username, email string) error {
+	base, err := util.BaseURL(r)
+	if err != nil {
+		return err
+	}
+	token, err := repositories.CreateUserToken(r.Context(), a.DB, userID, TokenResetPassword, PasswordResetLifetime)
+	if err != nil {
+		return err
+	}
+
+	link := base + "/reset-password?token=" + token
+	return jobs.SendEmail(r.Context(), a.DB, mailer.Message{
+		To:      email,
+		Subject: "Reset your forum password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your forum account. "+
+			"To choose a new password, open this link within the next hour:\n\n%s\n\n"+
+			"If you did not ask for this, you can ignore this email. Your password will not change.\n",
+			username, link),
+	})
+}
+
+/*
+ResetPasswordHandler shows the form a password reset link leads to and sets the new password. Every session of the account is signed out afterwards.
+*/
+func (a *App) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) error {
+	token := r.FormValue("token")
+
+	switch r.Method {
+	case http.MethodGet:
+		if _, err := repositories.FindUserToken(r.Context(), a.DB, TokenResetPassword, token); err != nil {
+			return util.NewError(http.StatusBadRequest, "error.reset_link_invalid", fmt.Errorf("rejected password reset link: %w", err))
+		}
+		a.renderPasswordPage(w, r, "reset-password.html", passwordResetPage{Token: token})
+	case http.MethodPost:
+		password := strings.TrimSpace(r.FormValue("password"))
+		if err := util.ValidatePassword(password); err != nil {
+			a.renderPasswordPage(w, r, "reset-password.html", passwordResetPage{Token: token, Error: i18n.T(r.Context(), "password.too_short")})
+			return nil
+		}
+		if password != strings.TrimSpace(r.FormValue("confirmed-password")) {
+			a.renderPasswordPage(w, r, "reset-password.html", passwordResetPage{Token: token, Error: i18n.T(r.Context(), "password.mismatch")})
+			return nil
+		}
+
+		userID, err := repositories.ConsumeUserToken(r.Context(), a.DB, TokenResetPassword, token)
+		if err != nil {
+			return util.NewError(http.StatusBadRequest, "error.reset_link_invalid", fmt.Errorf("rejected password reset: %w", err))
+		}
+
+		if err := a.resetPassword(r.Context(), userID, password); err != nil {
+			return util.Internal(fmt.Errorf("failed to reset password: %w", err))
+		}
+		a.Audit(r, userID, AuditPasswordReset, "")
+
+		http.Redirect(w, r, "/sign-in?notice=password-reset", http.StatusSeeOther)
+	default:
+		return util.MethodNotAllowed()
+	}
+	return nil
+}
+
+/*
+resetPassword stores the new password and signs the account out everywhere, so whoever knew the old password loses access. Having used a link sent to the account's address also proves the address and lifts any lockout.
+*/
+func (a *App) resetPassword(ctx context.Context, userID int, password string) error {
+	user, err := repositories.GetUserByID(ctx, a.DB, userID)
+	if err != nil {
+		return err
+	}
+
+	hashed, err := util.PasswordEncrypt([]byte(password), 10)
+	if err != nil {
+		return err
+	}
+	if err := repositories.UpdatePassword(ctx, a.DB, userID, string(hashed)); err != nil {
+		return err
+	}
+
+	if _, err := repositories.DeleteUserSessions(ctx, a.DB, userID); err != nil {
+		return err
+	}
+
+	if err := repositories.DeleteUserTokens(ctx, a.DB, userID, TokenResetPassword); err != nil {
+		slog.Error("Failed to revoke other reset links", "err", err)
+	}
+	if err := repositories.UnlockAccount(ctx, a.DB, userID); err != nil {
+		slog.Error("Failed to unlock account", "err", err)
+	}
+	if err := repositories.MarkEmailVerified(ctx, a.DB, userID, user.Email); err != nil {
+		slog.Error("Failed to verify email", "err", err)
+	}
+	return nil
+}
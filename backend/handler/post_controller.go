@@ -1,144 +1,95 @@
 package handler
 
 import (
-	"database/sql"
 	"encoding/json"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
-	"text/template"
 
 	"github.com/jesee-kuya/forum/backend/models"
 	"github.com/jesee-kuya/forum/backend/repositories"
 	"github.com/jesee-kuya/forum/backend/util"
 )
 
-func GetAllPosts(db *sql.DB, tmpl *template.Template, posts []models.Post) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// fetch comments for each post
-		for i, post := range posts {
-			comments, err := repositories.GetComments(db, post.ID)
-			if err != nil {
-				log.Printf("Failed to get comments: %v", err)
-				util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-				return
-			}
-
-			posts[i].Comments = comments
-		}
-
-		// Set content type to text/html and serve the index page
-		w.Header().Set("Content-Type", "text/html")
-		w.WriteHeader(http.StatusOK)
-
-		err := tmpl.ExecuteTemplate(w, "index.html", struct {
-			Posts []models.Post
-		}{Posts: posts})
+// GetAllPostsAPI answers with every post, its comments and its attachments as JSON.
+func (a *App) GetAllPostsAPI(w http.ResponseWriter, r *http.Request) error {
+	posts, err := repositories.GetPosts(r.Context(), a.DB)
+	if err != nil {
+		return util.Internal(fmt.Errorf("failed to get posts: %w", err))
+	}
+	// fetch comments for each post
+	for i, post := range posts {
+		comments, err := repositories.GetComments(r.Context(), a.DB, post.ID)
 		if err != nil {
-			log.Printf("Failed to render template: %v", err)
-			util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-			return
+			return util.Internal(fmt.Errorf("failed to get posts: %w", err))
 		}
-	}
-}
 
-func GetAllPostsAPI(db *sql.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		posts, err := repositories.GetPosts(db)
+		attachments, err := repositories.GetAttachments(r.Context(), a.DB, post.ID)
 		if err != nil {
-			log.Printf("Failed to get posts: %v", err)
-			util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-			return
-		}
-		// fetch comments for each post
-		for i, post := range posts {
-			comments, err := repositories.GetComments(db, post.ID)
-			if err != nil {
-				log.Printf("Failed to get posts: %v", err)
-				util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-				return
-			}
-
-			posts[i].Comments = comments
+			return util.Internal(fmt.Errorf("failed to get attachments: %w", err))
 		}
 
-		w.Header().Set("Content-Type", "application/json")
+		posts[i].Comments = comments
+		posts[i].Attachments = attachments
+	}
 
-		if err = json.NewEncoder(w).Encode(posts); err != nil {
-			log.Printf("Failed to encode posts to JSON: %v", err)
-			util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-			return
-		}
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(posts); err != nil {
+		return util.Internal(fmt.Errorf("failed to encode posts to JSON: %w", err))
 	}
+	return nil
 }
 
 // FilterPosts - Handles filtering posts by category or user
-func FilterPosts(w http.ResponseWriter, r *http.Request) {
+func (a *App) FilterPosts(w http.ResponseWriter, r *http.Request) error {
 	logged := false
 	if r.URL.Path != "/filter" {
-		util.ErrorHandler(w, "Page does not exist", http.StatusNotFound)
-		return
+		return util.NewError(http.StatusNotFound, "error.page_not_found", nil)
 	}
 
 	if r.Method != http.MethodGet {
-		log.Println("Method not allowed", r.Method)
-		util.ErrorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+		return util.MethodNotAllowed()
 	}
 
 	err := r.ParseForm()
 	if err != nil {
-		log.Println("Error parsing form", err)
-		util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-		return
+		return util.Internal(fmt.Errorf("error parsing form: %w", err))
 	}
 
 	categories := r.Form["category"]
 	filter := r.FormValue("filter")
 
 	if len(categories) != 0 {
-		posts, err := repositories.FilterPostsByCategories(util.DB, categories)
+		posts, err := repositories.FilterPostsByCategories(r.Context(), a.DB, categories)
 		if err != nil {
-			log.Println("error filtering posts:", err)
-			util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-			return
+			return util.Internal(fmt.Errorf("error filtering posts: %w", err))
 		}
 
-		cookie, _ := getSessionID(r)
-		_, ok := SessionStore[cookie]
-		if ok {
-			logged = true
-		}
+		_, logged = a.signedInUser(r)
 
-		PostDetails(w, r, posts, logged)
-		return
+		a.PostDetails(w, r, posts, logged)
+		return nil
 	}
 
-	cookie, err := getSessionID(r)
-	if err != nil {
-		log.Println("Invalid Session:", err)
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
-	}
-	sessionData, err := getSessionData(cookie)
-	if err != nil {
-		log.Println("Invalid Session:", err)
+	userID, ok := a.signedInUser(r)
+	if !ok {
+		slog.InfoContext(r.Context(), "Invalid session")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
+		return nil
 	}
 
 	posts := []models.Post{}
 
 	if filter == "created" {
-		posts, err = repositories.FilterPostsByUser(util.DB, sessionData["userId"].(int))
+		posts, err = repositories.FilterPostsByUser(r.Context(), a.DB, userID)
 	}
 	if filter == "liked" {
-		posts, err = repositories.FilterPostsByLikes(util.DB, sessionData["userId"].(int))
+		posts, err = repositories.FilterPostsByLikes(r.Context(), a.DB, userID)
 	}
 	if err != nil {
-		log.Println(err)
-		util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-		return
+		return util.Internal(fmt.Errorf("failed to filter posts by %s: %w", filter, err))
 	}
 
-	PostDetails(w, r, posts, true)
+	a.PostDetails(w, r, posts, true)
+	return nil
 }
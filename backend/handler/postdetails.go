@@ -1,37 +1,40 @@
 package handler
 
 import (
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
-	"text/template"
 
+	"github.com/jesee-kuya/forum/backend/i18n"
 	"github.com/jesee-kuya/forum/backend/models"
 	"github.com/jesee-kuya/forum/backend/repositories"
 	"github.com/jesee-kuya/forum/backend/util"
 )
 
-func PostDetails(w http.ResponseWriter, r *http.Request, posts []models.Post, logged bool) {
+// homeNotices are the keys of the messages other pages can show above the posts through the notice parameter.
+var homeNotices = map[string]string{
+	"verification-sent": "home.notice.verification_sent",
+}
+
+func (a *App) PostDetails(w http.ResponseWriter, r *http.Request, posts []models.Post, logged bool) {
 	for i, post := range posts {
-		comments, err1 := repositories.GetComments(util.DB, post.ID)
+		comments, err1 := repositories.GetComments(r.Context(), a.DB, post.ID)
 		if err1 != nil {
-			log.Println("Failed to get comments:", err1)
-			util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
+			util.WriteError(w, r, util.Internal(fmt.Errorf("failed to get comments: %w", err1)))
 			return
 		}
 
 		// Getting comment reactions
 		for j, comment := range comments {
-			commentLikes, errLikes := repositories.GetReactions(util.DB, comment.ID, "Like")
+			commentLikes, errLikes := repositories.GetReactions(r.Context(), a.DB, comment.ID, "Like")
 			if errLikes != nil {
-				log.Println("Failed to get likes", errLikes)
-				util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
+				util.WriteError(w, r, util.Internal(fmt.Errorf("failed to get likes: %w", errLikes)))
 				return
 			}
 
-			commentDislikes, errDislikes := repositories.GetReactions(util.DB, comment.ID, "Dislike")
+			commentDislikes, errDislikes := repositories.GetReactions(r.Context(), a.DB, comment.ID, "Dislike")
 			if errDislikes != nil {
-				log.Println("Failed to get dislikes", errDislikes)
-				util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
+				util.WriteError(w, r, util.Internal(fmt.Errorf("failed to get dislikes: %w", errDislikes)))
 				return
 			}
 
@@ -39,70 +42,72 @@ func PostDetails(w http.ResponseWriter, r *http.Request, posts []models.Post, lo
 			comments[j].Dislikes = len(commentDislikes)
 		}
 
-		categories, err3 := repositories.GetCategories(util.DB, post.ID)
+		categories, err3 := repositories.GetCategories(r.Context(), a.DB, post.ID)
 		if err3 != nil {
-			log.Println("Failed to get categories", err3)
-			util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
+			util.WriteError(w, r, util.Internal(fmt.Errorf("failed to get categories: %w", err3)))
+			return
+		}
+		attachments, err5 := repositories.GetAttachments(r.Context(), a.DB, post.ID)
+		if err5 != nil {
+			util.WriteError(w, r, util.Internal(fmt.Errorf("failed to get attachments: %w", err5)))
 			return
 		}
-		likes, err4 := repositories.GetReactions(util.DB, post.ID, "Like")
+		likes, err4 := repositories.GetReactions(r.Context(), a.DB, post.ID, "Like")
 		if err4 != nil {
-			log.Println("Failed to get likes", err4)
-			util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
+			util.WriteError(w, r, util.Internal(fmt.Errorf("failed to get likes: %w", err4)))
 			return
 		}
-		dislikes, err := repositories.GetReactions(util.DB, post.ID, "Dislike")
+		dislikes, err := repositories.GetReactions(r.Context(), a.DB, post.ID, "Dislike")
 		if err != nil {
-			log.Printf("Failed to get dislikes: %v", err)
-			util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
+			util.WriteError(w, r, util.Internal(fmt.Errorf("failed to get dislikes: %w", err)))
 			return
 		}
 
 		posts[i].Comments = comments
 		posts[i].CommentCount = len(comments)
 		posts[i].Categories = categories
+		posts[i].Attachments = attachments
 		posts[i].Likes = len(likes)
 		posts[i].Dislikes = len(dislikes)
 	}
 	var user models.User
+	verified := true
 	if logged {
-		cookie, err := getSessionID(r)
-		if err != nil {
-			log.Println("Invalid Session")
+		userID, ok := a.signedInUser(r)
+		if !ok {
+			slog.InfoContext(r.Context(), "Invalid session")
 			http.Redirect(w, r, "/", http.StatusSeeOther)
 			return
 		}
-		sessionData, err := getSessionData(cookie)
+		var err error
+		user, err = repositories.GetUserByID(r.Context(), a.DB, userID)
 		if err != nil {
-			log.Println("Invalid Session")
-			http.Redirect(w, r, "/", http.StatusSeeOther)
+			util.WriteError(w, r, util.Internal(fmt.Errorf("user not found: %w", err)))
 			return
 		}
-		user, err = repositories.GetUserByEmail(sessionData["userEmail"].(string))
+		verified, err = repositories.IsEmailVerified(r.Context(), a.DB, user.ID)
 		if err != nil {
-			log.Println("User not found", err)
-			util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
+			util.WriteError(w, r, util.Internal(fmt.Errorf("failed to check email verification: %w", err)))
 			return
 		}
 	}
 
 	data := struct {
-		IsLoggedIn  bool
-		Name, Email string
-		Posts       []models.Post
+		IsLoggedIn    bool
+		EmailVerified bool
+		Name, Email   string
+		Notice        string
+		Posts         []models.Post
 	}{
-		IsLoggedIn: logged,
-		Name:       user.Username,
-		Email:      user.Email,
-		Posts:      posts,
+		IsLoggedIn:    logged,
+		EmailVerified: verified,
+		Name:          user.Username,
+		Email:         user.Email,
+		Notice:        i18n.T(r.Context(), homeNotices[r.URL.Query().Get("notice")]),
+		Posts:         posts,
 	}
 
-	// Parse and execute the template
-	tmpl, err := template.ParseFiles("frontend/templates/index.html")
-	if err != nil {
-		log.Printf("Failed to load index template: %v", err)
-		util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-		return
+	if err := a.render(w, r, "index.html", data); err != nil {
+		util.WriteError(w, r, err)
 	}
-	tmpl.Execute(w, data)
 }
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/jesee-kuya/forum/backend/repositories"
+	"github.com/jesee-kuya/forum/backend/util"
+)
+
+/*
+UserPostsHandler lists the posts of the user named in /user/<name>. Old usernames redirect permanently to the current one, so links keep working after a rename.
+*/
+func (a *App) UserPostsHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return util.MethodNotAllowed()
+	}
+
+	// Names are query-escaped in links, as OAuth accounts may have spaces in theirs
+	name, err := url.QueryUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/user/"))
+	if err != nil || name == "" || strings.Contains(name, "/") {
+		return util.NewError(http.StatusNotFound, "error.page_not_found", nil)
+	}
+
+	current, err := repositories.ResolveUsername(r.Context(), a.DB, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return util.NewError(http.StatusNotFound, "error.page_not_found", nil)
+	}
+	if err != nil {
+		return util.Internal(fmt.Errorf("failed to resolve username: %w", err))
+	}
+	if current != name {
+		http.Redirect(w, r, "/user/"+url.QueryEscape(current), http.StatusMovedPermanently)
+		return nil
+	}
+
+	user, err := repositories.GetUserByName(r.Context(), a.DB, current)
+	if err != nil {
+		return util.Internal(fmt.Errorf("user not found: %w", err))
+	}
+	posts, err := repositories.FilterPostsByUser(r.Context(), a.DB, user.ID)
+	if err != nil {
+		return util.Internal(fmt.Errorf("error filtering posts: %w", err))
+	}
+
+	_, logged := a.signedInUser(r)
+	a.PostDetails(w, r, posts, logged)
+	return nil
+}
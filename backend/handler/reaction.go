@@ -1,7 +1,8 @@
 package handler
 
 import (
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"strconv"
 
@@ -9,67 +10,52 @@ import (
 	"github.com/jesee-kuya/forum/backend/util"
 )
 
-func ReactionHandler(w http.ResponseWriter, r *http.Request) {
+func (a *App) ReactionHandler(w http.ResponseWriter, r *http.Request) error {
 	if r.Method != http.MethodPost {
-		log.Println("Method not allowed", r.Method)
-		util.ErrorHandler(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
+		return util.MethodNotAllowed()
 	}
 
 	err := r.ParseForm()
 	if err != nil {
-		log.Println("error parsing form:", err)
-		util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-		return
+		return util.Internal(fmt.Errorf("error parsing form: %w", err))
 	}
 
 	reactionType := r.FormValue("reaction")
 	postID, _ := strconv.Atoi(r.FormValue("post_id"))
 
-	cookie, err := getSessionID(r)
-	if err != nil {
-		log.Println("Invalid Session")
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
-	}
-	sessionData, err := getSessionData(cookie)
-	if err != nil {
-		log.Println("Invalid Session")
+	userID, ok := a.signedInUser(r)
+	if !ok {
+		slog.InfoContext(r.Context(), "Invalid session")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
+		return nil
 	}
 
-	check, reaction := repositories.CheckReactions(util.DB, sessionData["userId"].(int), postID)
+	check, reaction := repositories.CheckReactions(r.Context(), a.DB, userID, postID)
 
 	if !check {
-		_, err := repositories.InsertRecord(util.DB, "tblReactions", []string{"user_id", "post_id", "reaction"}, sessionData["userId"].(int), postID, reactionType)
+		_, err := repositories.InsertRecord(r.Context(), a.DB, "tblReactions", []string{"user_id", "post_id", "reaction"}, userID, postID, reactionType)
 		if err != nil {
-			log.Println("Failed to insert record:", err)
-			util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-			return
+			return util.Internal(fmt.Errorf("failed to insert record: %w", err))
 		}
 		http.Redirect(w, r, "/home", http.StatusSeeOther)
-		return
+		return nil
 	}
 
 	if reactionType == reaction {
-		err := repositories.UpdateReactionStatus(util.DB, sessionData["userId"].(int), postID)
+		err := repositories.UpdateReactionStatus(r.Context(), a.DB, userID, postID)
 		if err != nil {
-			log.Println("Failed to update reaction status:", err)
-			util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-			return
+			return util.Internal(fmt.Errorf("failed to update reaction status: %w", err))
 		}
 
 		http.Redirect(w, r, "/home", http.StatusSeeOther)
-		return
+		return nil
 	} else {
-		err := repositories.UpdateReaction(util.DB, reactionType, sessionData["userId"].(int), postID)
+		err := repositories.UpdateReaction(r.Context(), a.DB, reactionType, userID, postID)
 		if err != nil {
-			log.Println("Failed to update reaction:", err)
-			util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-			return
+			return util.Internal(fmt.Errorf("failed to update reaction: %w", err))
 		}
 	}
 	r.Method = http.MethodGet
 	http.Redirect(w, r, "/home", http.StatusSeeOther)
+	return nil
 }
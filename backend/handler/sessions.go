@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/jesee-kuya/forum/backend/models"
+	"github.com/jesee-kuya/forum/backend/repositories"
+	"github.com/jesee-kuya/forum/backend/util"
+)
+
+/*
+SessionsHandler renders the "Your sessions" page listing every device the user is signed in on.
+*/
+func (a *App) SessionsHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.URL.Path != "/sessions" {
+		return util.NewError(http.StatusNotFound, "error.page_not_found", nil)
+	}
+
+	if r.Method != http.MethodGet {
+		return util.MethodNotAllowed()
+	}
+
+	cookie, err := getSessionID(r)
+	if err != nil {
+		slog.InfoContext(r.Context(), "Invalid session")
+		http.Redirect(w, r, "/sign-in", http.StatusSeeOther)
+		return nil
+	}
+	userID, ok := a.signedInUser(r)
+	if !ok {
+		slog.InfoContext(r.Context(), "Invalid session")
+		http.Redirect(w, r, "/sign-in", http.StatusSeeOther)
+		return nil
+	}
+
+	user, err := repositories.GetUserByID(r.Context(), a.DB, userID)
+	if err != nil {
+		return util.Internal(fmt.Errorf("user not found: %w", err))
+	}
+
+	sessions, err := repositories.ListUserSessions(r.Context(), a.DB, user.ID)
+	if err != nil {
+		return util.Internal(fmt.Errorf("failed to list sessions: %w", err))
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].Token == cookie
+	}
+
+	data := struct {
+		Name     string
+		Sessions []models.Session
+	}{
+		Name:     user.Username,
+		Sessions: sessions,
+	}
+
+	return a.render(w, r, "sessions.html", data)
+}
+
+/*
+RevokeSessionHandler signs the user out of a single session. Revoking the current session behaves like logging out.
+*/
+func (a *App) RevokeSessionHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return util.MethodNotAllowed()
+	}
+
+	cookie, err := getSessionID(r)
+	if err != nil {
+		slog.InfoContext(r.Context(), "Invalid session")
+		http.Redirect(w, r, "/sign-in", http.StatusSeeOther)
+		return nil
+	}
+	userID, ok := a.signedInUser(r)
+	if !ok {
+		slog.InfoContext(r.Context(), "Invalid session")
+		http.Redirect(w, r, "/sign-in", http.StatusSeeOther)
+		return nil
+	}
+
+	sessionID, err := strconv.Atoi(r.FormValue("session_id"))
+	if err != nil {
+		return util.NewError(http.StatusBadRequest, "error.bad_request", fmt.Errorf("invalid session id: %w", err))
+	}
+
+	token, err := repositories.DeleteUserSession(r.Context(), a.DB, userID, sessionID)
+	if err != nil {
+		return util.NewError(http.StatusNotFound, "error.session_not_found", fmt.Errorf("failed to revoke session: %w", err))
+	}
+
+	if token == cookie {
+		util.ClearSessionCookie(w, r)
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return nil
+	}
+	http.Redirect(w, r, "/sessions", http.StatusSeeOther)
+	return nil
+}
+
+/*
+RevokeOtherSessionsHandler signs the user out everywhere except the session making the request.
+*/
+func (a *App) RevokeOtherSessionsHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return util.MethodNotAllowed()
+	}
+
+	cookie, err := getSessionID(r)
+	if err != nil {
+		slog.InfoContext(r.Context(), "Invalid session")
+		http.Redirect(w, r, "/sign-in", http.StatusSeeOther)
+		return nil
+	}
+	userID, ok := a.signedInUser(r)
+	if !ok {
+		slog.InfoContext(r.Context(), "Invalid session")
+		http.Redirect(w, r, "/sign-in", http.StatusSeeOther)
+		return nil
+	}
+
+	if _, err := repositories.DeleteOtherSessions(r.Context(), a.DB, userID, cookie); err != nil {
+		return util.Internal(fmt.Errorf("failed to revoke sessions: %w", err))
+	}
+
+	http.Redirect(w, r, "/sessions", http.StatusSeeOther)
+	return nil
+}
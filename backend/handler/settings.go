@@ -0,0 +1,397 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/jesee-kuya/forum/backend/config"
+	"github.com/jesee-kuya/forum/backend/i18n"
+	"github.com/jesee-kuya/forum/backend/jobs"
+	"github.com/jesee-kuya/forum/backend/mailer"
+	"github.com/jesee-kuya/forum/backend/models"
+	"github.com/jesee-kuya/forum/backend/repositories"
+	"github.com/jesee-kuya/forum/backend/util"
+)
+
+// EmailChangeLifetime is how long the link confirming a new email address stays valid.
+const EmailChangeLifetime = 24 * time.Hour
+
+// Events written to the audit log by the account settings.
+const (
+	AuditUsernameChanged      = "username_changed"
+	AuditEmailChangeRequested = "email_change_requested"
+	AuditEmailChanged         = "email_changed"
+	AuditPasswordChanged      = "password_changed"
+	AuditPasswordSet          = "password_set"
+)
+
+const changeEmailPurpose = "change-email"
+
+// settingsNotices are the keys of the messages shown on the settings page through its notice parameter.
+var settingsNotices = map[string]string{
+	"username-changed":    "settings.notice.username_changed",
+	"email-sent":          "settings.notice.email_sent",
+	"email-changed":       "settings.notice.email_changed",
+	"password-changed":    "settings.notice.password_changed",
+	"password-set":        "settings.notice.password_set",
+	"two-factor-disabled": "settings.notice.two_factor_disabled",
+	"identity-linked":     "settings.notice.identity_linked",
+	"identity-unlinked":   "settings.notice.identity_unlinked",
+	"digest-on":           "settings.notice.digest_on",
+	"digest-off":          "settings.notice.digest_off",
+}
+
+// settingsErrors are the keys of the errors shown on the settings page through its error parameter.
+var settingsErrors = map[string]string{
+	"identity-taken": "settings.error.identity_taken",
+	"identity-last":  "settings.error.identity_last",
+}
+
+type settingsPage struct {
+	Username, Email  string
+	HasPassword      bool
+	TwoFactorEnabled bool
+	Providers        []linkedProvider
+	// DigestEnabled is set when digest emails are sent, and Digest when the user subscribed to them.
+	DigestEnabled, Digest bool
+	Notice, Error         string
+}
+
+/*
+settingsUser returns the signed in user together with their session token.
+*/
+func (a *App) settingsUser(r *http.Request) (models.User, string, error) {
+	cookie, err := getSessionID(r)
+	if err != nil {
+		return models.User{}, "", err
+	}
+	userID, ok := a.signedInUser(r)
+	if !ok {
+		return models.User{}, "", errors.New("invalid session")
+	}
+	user, err := repositories.GetUserByID(r.Context(), a.DB, userID)
+	return user, cookie, err
+}
+
+func (a *App) renderSettings(w http.ResponseWriter, r *http.Request, user models.User, notice, errMsg string) {
+	tf, err := repositories.GetTwoFactor(r.Context(), a.DB, user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to load two-factor settings", "err", err)
+	}
+	providers, err := a.linkedProviders(r.Context(), user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to load linked accounts", "err", err)
+	}
+	digest, err := repositories.GetUserDigest(r.Context(), a.DB, user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to load digest subscription", "err", err)
+	}
+	err = a.render(w, r, "settings.html", settingsPage{
+		Username:         user.Username,
+		Email:            user.Email,
+		HasPassword:      user.Password != "",
+		TwoFactorEnabled: tf.Enabled,
+		Providers:        providers,
+		DigestEnabled:    config.From(r).Jobs.Digest != "",
+		Digest:           digest,
+		Notice:           notice,
+		Error:            errMsg,
+	})
+	if err != nil {
+		util.WriteError(w, r, err)
+	}
+}
+
+/*
+settingsRequest checks the method of a settings form and loads the signed in user. It writes the response itself and returns false when the request cannot go on.
+*/
+func (a *App) settingsRequest(w http.ResponseWriter, r *http.Request, method string) (models.User, string, bool) {
+	if r.Method != method {
+		util.WriteError(w, r, util.MethodNotAllowed())
+		return models.User{}, "", false
+	}
+
+	user, cookie, err := a.settingsUser(r)
+	if err != nil {
+		slog.InfoContext(r.Context(), "Invalid session", "err", err)
+		http.Redirect(w, r, "/sign-in", http.StatusSeeOther)
+		return models.User{}, "", false
+	}
+	return user, cookie, true
+}
+
+// checkPassword reports whether password is the current password of user.
+func checkPassword(user models.User, password string) bool {
+	return user.Password != "" && bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) == nil
+}
+
+// SettingsHandler renders the account settings page.
+func (a *App) SettingsHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.URL.Path != "/settings" {
+		return util.NewError(http.StatusNotFound, "error.page_not_found", nil)
+	}
+
+	user, _, ok := a.settingsRequest(w, r, http.MethodGet)
+	if !ok {
+		return nil
+	}
+	a.renderSettings(w, r, user, i18n.T(r.Context(), settingsNotices[r.URL.Query().Get("notice")]), i18n.T(r.Context(), settingsErrors[r.URL.Query().Get("error")]))
+	return nil
+}
+
+/*
+ChangeUsernameHandler renames the signed in user. The old name stays reserved for them, and links to it redirect to the new one.
+*/
+func (a *App) ChangeUsernameHandler(w http.ResponseWriter, r *http.Request) error {
+	user, _, ok := a.settingsRequest(w, r, http.MethodPost)
+	if !ok {
+		return nil
+	}
+
+	username := strings.TrimSpace(r.FormValue("username"))
+	if err := util.ValidateUsername(username); err != nil {
+		a.renderSettings(w, r, user, "", i18n.T(r.Context(), "settings.username_invalid"))
+		return nil
+	}
+	if username == user.Username {
+		a.renderSettings(w, r, user, "", i18n.T(r.Context(), "settings.same_username"))
+		return nil
+	}
+
+	available, err := repositories.UsernameAvailable(r.Context(), a.DB, username, user.ID)
+	if err != nil {
+		return util.Internal(fmt.Errorf("failed to check username: %w", err))
+	}
+	if !available {
+		a.renderSettings(w, r, user, "", i18n.T(r.Context(), "settings.username_taken"))
+		return nil
+	}
+
+	if err := repositories.UpdateUsername(r.Context(), a.DB, user.ID, user.Username, username); err != nil {
+		return util.Internal(fmt.Errorf("failed to change username: %w", err))
+	}
+	a.Audit(r, user.ID, AuditUsernameChanged, user.Username+" -> "+username)
+
+	http.Redirect(w, r, "/settings?notice=username-changed", http.StatusSeeOther)
+	return nil
+}
+
+/*
+ChangeEmailHandler starts changing the email address of the signed in user. The current password is required, and the address only changes once the link sent to the new address is opened; the old address is told about the request.
+*/
+func (a *App) ChangeEmailHandler(w http.ResponseWriter, r *http.Request) error {
+	user, _, ok := a.settingsRequest(w, r, http.MethodPost)
+	if !ok {
+		return nil
+	}
+
+	if user.Password == "" {
+		a.renderSettings(w, r, user, "", i18n.T(r.Context(), "settings.set_password_first"))
+		return nil
+	}
+	if !checkPassword(user, r.FormValue("password")) {
+		a.renderSettings(w, r, user, "", i18n.T(r.Context(), "settings.wrong_password"))
+		return nil
+	}
+
+	email := strings.TrimSpace(r.FormValue("email"))
+	if !isValidEmail(email) {
+		a.renderSettings(w, r, user, "", i18n.T(r.Context(), "settings.invalid_email"))
+		return nil
+	}
+	if strings.EqualFold(email, user.Email) {
+		a.renderSettings(w, r, user, "", i18n.T(r.Context(), "settings.same_email"))
+		return nil
+	}
+
+	available, err := repositories.EmailAvailable(r.Context(), a.DB, email, user.ID)
+	if err != nil {
+		return util.Internal(fmt.Errorf("failed to check email: %w", err))
+	}
+	if !available {
+		a.renderSettings(w, r, user, "", i18n.T(r.Context(), "settings.email_taken"))
+		return nil
+	}
+
+	if err := a.sendEmailChangeEmails(r, user, email); err != nil {
+		return util.Internal(fmt.Errorf("failed to queue email change emails: %w", err))
+	}
+	a.Audit(r, user.ID, AuditEmailChangeRequested, email)
+
+	http.Redirect(w, r, "/settings?notice=email-sent", http.StatusSeeOther)
+	return nil
+}
+
+/*
+sendEmailChangeEmails sends the confirmation link to the new address and a warning to the current one. The link names both addresses, so it stops working if the address changes in the meantime.
+*/
+func (a *App) sendEmailChangeEmails(r *http.Request, user models.User, email string) error {
+	base, err := util.BaseURL(r)
+	if err != nil {
+		return err
+	}
+	params := util.SignValues(r.Context(), changeEmailPurpose, url.Values{
+		"user":    {strconv.Itoa(user.ID)},
+		"current": {user.Email},
+		"email":   {email},
+	}, EmailChangeLifetime)
+	link := base + "/settings/email/confirm?" + params.Encode()
+
+	err = jobs.SendEmail(r.Context(), a.DB, mailer.Message{
+		To:      email,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf("Hi %s,\n\nTo use this address for your forum account, open this link within the next %d hours:\n\n%s\n\n"+
+			"If you did not ask for this, you can ignore this email.\n",
+			user.Username, int(EmailChangeLifetime.Hours()), link),
+	})
+	if err != nil {
+		return err
+	}
+
+	return jobs.SendEmail(r.Context(), a.DB, mailer.Message{
+		To:      user.Email,
+		Subject: "Your forum email address is being changed",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone signed in to your forum account asked to change its email address to %s. "+
+			"It will change once the link we sent to that address is opened.\n\n"+
+			"If this was not you, change your password and sign out of your other sessions from the account settings.\n",
+			user.Username, email),
+	})
+}
+
+/*
+ConfirmEmailChangeHandler changes the email address from the link sent by sendEmailChangeEmails. It does not need a session, as the link may be opened on another device.
+*/
+func (a *App) ConfirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return util.MethodNotAllowed()
+	}
+
+	query := r.URL.Query()
+	if err := util.VerifyValues(r.Context(), changeEmailPurpose, query); err != nil {
+		return util.NewError(http.StatusBadRequest, "error.email_link_invalid", fmt.Errorf("rejected email change link: %w", err))
+	}
+
+	userID, err := strconv.Atoi(query.Get("user"))
+	if err != nil {
+		return util.NewError(http.StatusBadRequest, "error.email_link_invalid", fmt.Errorf("rejected email change link: %w", err))
+	}
+	user, err := repositories.GetUserByID(r.Context(), a.DB, userID)
+	if err == nil && user.Email != query.Get("current") {
+		err = errors.New("email address changed since the link was sent")
+	}
+	if err != nil {
+		return util.NewError(http.StatusBadRequest, "error.email_link_invalid", fmt.Errorf("rejected email change link: %w", err))
+	}
+
+	email := query.Get("email")
+	available, err := repositories.EmailAvailable(r.Context(), a.DB, email, userID)
+	if err != nil {
+		return util.Internal(fmt.Errorf("failed to check email: %w", err))
+	}
+	if !available {
+		return util.NewError(http.StatusConflict, "error.email_taken", nil)
+	}
+
+	if err := repositories.UpdateEmail(r.Context(), a.DB, userID, email); err != nil {
+		return util.Internal(fmt.Errorf("failed to change email: %w", err))
+	}
+	a.Audit(r, userID, AuditEmailChanged, user.Email+" -> "+email)
+
+	if _, ok := a.signedInUser(r); ok {
+		http.Redirect(w, r, "/settings?notice=email-changed", http.StatusSeeOther)
+		return nil
+	}
+	http.Redirect(w, r, "/sign-in?notice=email-changed", http.StatusSeeOther)
+	return nil
+}
+
+/*
+ChangePasswordHandler changes the password of the signed in user, or sets one for accounts created through OAuth. Changing a password needs the current one; either way the user's other sessions are signed out and the current session gets a new token.
+*/
+func (a *App) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) error {
+	user, cookie, ok := a.settingsRequest(w, r, http.MethodPost)
+	if !ok {
+		return nil
+	}
+
+	hadPassword := user.Password != ""
+	if hadPassword && !checkPassword(user, r.FormValue("current-password")) {
+		a.renderSettings(w, r, user, "", i18n.T(r.Context(), "settings.wrong_password"))
+		return nil
+	}
+
+	password := strings.TrimSpace(r.FormValue("password"))
+	if err := util.ValidatePassword(password); err != nil {
+		a.renderSettings(w, r, user, "", i18n.T(r.Context(), "password.too_short"))
+		return nil
+	}
+	if password != strings.TrimSpace(r.FormValue("confirmed-password")) {
+		a.renderSettings(w, r, user, "", i18n.T(r.Context(), "settings.new_passwords_mismatch"))
+		return nil
+	}
+
+	hashed, err := util.PasswordEncrypt([]byte(password), 10)
+	if err != nil {
+		return util.Internal(fmt.Errorf("failed to hash password: %w", err))
+	}
+	if err := repositories.UpdatePassword(r.Context(), a.DB, user.ID, string(hashed)); err != nil {
+		return util.Internal(fmt.Errorf("failed to change password: %w", err))
+	}
+
+	if _, err := repositories.DeleteOtherSessions(r.Context(), a.DB, user.ID, cookie); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to revoke sessions", "err", err)
+	}
+	if err := a.RotateSession(w, r); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to rotate session", "err", err)
+	}
+
+	event, notice := AuditPasswordChanged, "password-changed"
+	if !hadPassword {
+		event, notice = AuditPasswordSet, "password-set"
+	}
+	a.Audit(r, user.ID, event, "")
+
+	err = jobs.SendEmail(r.Context(), a.DB, mailer.Message{
+		To:      user.Email,
+		Subject: "Your forum password was changed",
+		Body: fmt.Sprintf("Hi %s,\n\nThe password of your forum account was just changed from the account settings. "+
+			"If this was not you, reset your password from the sign in page straight away.\n", user.Username),
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to queue password change email", "err", err)
+	}
+
+	http.Redirect(w, r, "/settings?notice="+notice, http.StatusSeeOther)
+	return nil
+}
+
+// DigestSettingsHandler subscribes the signed in user to the digest emails, or unsubscribes them.
+func (a *App) DigestSettingsHandler(w http.ResponseWriter, r *http.Request) error {
+	if config.From(r).Jobs.Digest == "" {
+		return util.NewError(http.StatusNotFound, "error.page_not_found", nil)
+	}
+	user, _, ok := a.settingsRequest(w, r, http.MethodPost)
+	if !ok {
+		return nil
+	}
+
+	subscribed := r.FormValue("digest") == "on"
+	if err := repositories.SetUserDigest(r.Context(), a.DB, user.ID, subscribed); err != nil {
+		return util.Internal(fmt.Errorf("failed to change digest subscription: %w", err))
+	}
+
+	notice := "digest-off"
+	if subscribed {
+		notice = "digest-on"
+	}
+	http.Redirect(w, r, "/settings?notice="+notice, http.StatusSeeOther)
+	return nil
+}
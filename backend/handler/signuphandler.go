@@ -2,30 +2,30 @@ package handler
 
 import (
 	"encoding/json"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"reflect"
 	"strings"
-	"text/template"
 
 	"github.com/jesee-kuya/forum/backend/models"
 	"github.com/jesee-kuya/forum/backend/repositories"
 	"github.com/jesee-kuya/forum/backend/util"
 )
 
-func SignupHandler(w http.ResponseWriter, r *http.Request) {
+func (a *App) SignupHandler(w http.ResponseWriter, r *http.Request) error {
 	var user models.User
 	if r.URL.Path != "/sign-up" {
-		util.ErrorHandler(w, "Page does not exist", http.StatusNotFound)
-		return
+		return util.NewError(http.StatusNotFound, "error.page_not_found", nil)
+	}
+	if !a.Config.Features.Registration {
+		return util.NewError(http.StatusForbidden, "error.registration_closed", nil)
 	}
 
 	if r.Method == http.MethodPost {
 		err := r.ParseForm()
 		if err != nil {
-			log.Printf("Failed parsing form: %v\n", err)
-			util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-			return
+			return util.Internal(fmt.Errorf("failed parsing form: %w", err))
 		}
 
 		user.Username = strings.TrimSpace(r.FormValue("username"))
@@ -35,50 +35,44 @@ func SignupHandler(w http.ResponseWriter, r *http.Request) {
 
 		err = util.ValidateFormFields(user.Username, user.Email, user.Password)
 		if err != nil {
-			log.Printf("Invalid form values from user: %v\n", err)
+			slog.InfoContext(r.Context(), "Invalid form values from user", "err", err)
 			response := Response{Success: false}
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(response)
-			return
+			return nil
 		}
 
 		if !reflect.DeepEqual(user.Password, user.ConfirmedPassword) {
-			log.Printf("User password %q and confirmed password %q do not match.\n", user.Password, user.ConfirmedPassword)
+			slog.InfoContext(r.Context(), "Password and confirmed password do not match")
 			response := Response{Success: false}
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(response)
-			return
+			return nil
 		}
 
 		hashed, err := util.PasswordEncrypt([]byte(user.Password), 10)
 		if err != nil {
-			log.Printf("Failed encrypting password: %v\n", err)
-			util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-			return
+			return util.Internal(fmt.Errorf("failed encrypting password: %w", err))
 		}
 
-		_, err = repositories.InsertRecord(util.DB, "tblUsers", []string{"username", "email", "user_password"}, user.Username, user.Email, string(hashed))
+		id, err := repositories.InsertRecord(r.Context(), a.DB, "tblUsers", []string{"username", "email", "user_password"}, user.Username, user.Email, string(hashed))
 		if err != nil {
-			log.Println("Error adding user:", err)
+			slog.ErrorContext(r.Context(), "Error adding user", "err", err)
 			http.Redirect(w, r, "/sign-in", http.StatusSeeOther)
-			return
+			return nil
+		}
+		user.ID = int(id)
+
+		// The account works without it, so a failure here is only logged; the user can ask for a new link
+		if err := a.sendVerificationEmail(r, user); err != nil {
+			slog.ErrorContext(r.Context(), "Failed to queue verification email", "err", err)
 		}
 		response := Response{Success: true}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(response)
-		http.Redirect(w, r, "/sign-in", http.StatusSeeOther)
-		return
+		return nil
 	} else if r.Method == http.MethodGet {
-		tmpl, err := template.ParseFiles("frontend/templates/sign-up.html")
-		if err != nil {
-			log.Println("failed parsing files:", err)
-			util.ErrorHandler(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
-			return
-		}
-		tmpl.Execute(w, nil)
-	} else {
-		log.Println("Method not allowed", r.Method)
-		util.ErrorHandler(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
+		return a.render(w, r, "sign-up.html", struct{ Providers []IdentityProvider }{Providers: a.IdentityProviders()})
 	}
+	return util.MethodNotAllowed()
 }
@@ -1,50 +1,107 @@
 package handler
 
 import (
-	"fmt"
+	"log/slog"
 	"net/http"
 	"regexp"
 	"time"
 
 	"github.com/gofrs/uuid"
+
+	"github.com/jesee-kuya/forum/backend/models"
+	"github.com/jesee-kuya/forum/backend/repositories"
+	"github.com/jesee-kuya/forum/backend/util"
 )
 
-func CreateSession() string {
-	sessionID := uuid.Must(uuid.NewV4()).String()
-	SessionStore[sessionID] = make(map[string]interface{})
-	return sessionID
-}
+/*
+StartSession signs a user in: it creates a session token, stores it alongside the client's device details, and sets the session cookie, along with the language cookie when the user chose a language. Any session the browser already presented is discarded so a planted token cannot be reused, while sessions on other devices stay valid.
+*/
+func (a *App) StartSession(w http.ResponseWriter, r *http.Request, userID int, rememberMe bool) error {
+	if previous, err := getSessionID(r); err == nil {
+		if err := repositories.DeleteSession(r.Context(), a.DB, previous); err != nil {
+			slog.ErrorContext(r.Context(), "Failed to discard previous session", "err", err)
+		}
+	}
+
+	sessionToken := uuid.Must(uuid.NewV4()).String()
+
+	now := time.Now()
+	idle, lifetime := a.Config.Session.Limits(rememberMe)
+	userAgent := r.UserAgent()
+	session := models.Session{
+		UserID:            userID,
+		Token:             sessionToken,
+		ExpiresAt:         now.Add(idle),
+		AbsoluteExpiresAt: now.Add(lifetime),
+		RememberMe:        rememberMe,
+		IPAddress:         util.ClientIP(r),
+		UserAgent:         userAgent,
+		Device:            util.DescribeDevice(userAgent),
+	}
+
+	err := repositories.StoreSession(r.Context(), a.DB, session)
+	if err != nil {
+		return err
+	}
+
+	util.SetSessionCookie(w, r, sessionToken, session.ExpiresAt, rememberMe)
 
-func SetSessionCookie(w http.ResponseWriter, sessionID string) {
-	cookie := &http.Cookie{
-		Name:     "session_token",
-		Value:    sessionID,
-		Path:     "/",
-		Expires:  time.Now().UTC().Add(24 * time.Hour),
-		HttpOnly: true,
-		Secure:   true,
+	// The forum follows the user's language to every browser they sign in on
+	lang, err := repositories.GetUserLanguage(r.Context(), a.DB, userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to read language preference", "err", err)
+	} else if lang != "" {
+		util.SetLanguageCookie(w, r, lang)
 	}
-	http.SetCookie(w, cookie)
+	return nil
 }
 
-func getSessionID(r *http.Request) (string, error) {
-	cookie, err := r.Cookie("session_token")
+/*
+RotateSession gives the current session a new token, keeping its user and expiry. It should be called whenever a session gains privileges so a token captured earlier becomes useless.
+*/
+func (a *App) RotateSession(w http.ResponseWriter, r *http.Request) error {
+	oldToken, err := getSessionID(r)
 	if err != nil {
-		return "", err
+		return err
 	}
-	return cookie.Value, nil
+	session, err := repositories.ValidateSession(r.Context(), a.DB, oldToken)
+	if err != nil {
+		return err
+	}
+
+	newToken := uuid.Must(uuid.NewV4()).String()
+	if err := repositories.RotateSessionToken(r.Context(), a.DB, oldToken, newToken); err != nil {
+		return err
+	}
+
+	util.SetSessionCookie(w, r, newToken, session.ExpiresAt, session.RememberMe)
+	return nil
 }
 
-func getSessionData(sessionID string) (map[string]interface{}, error) {
-	sessionData, exists := SessionStore[sessionID]
-	if !exists {
-		return nil, fmt.Errorf("session not found")
+/*
+signedInUser returns the id of the user signed in to r. Routes behind Authenticate find it in the request; elsewhere the session cookie is checked against tblSessions, the only record of sessions, so sessions survive a restart.
+*/
+func (a *App) signedInUser(r *http.Request) (int, bool) {
+	if userID, ok := util.SessionUser(r); ok {
+		return userID, true
 	}
-	return sessionData, nil
+	token, err := getSessionID(r)
+	if err != nil {
+		return 0, false
+	}
+	session, err := repositories.ValidateSession(r.Context(), a.DB, token)
+	if err != nil {
+		return 0, false
+	}
+	return session.UserID, true
 }
 
-func SetSessionData(sessionID string, key string, value interface{}) {
-	SessionStore[sessionID][key] = value
+func getSessionID(r *http.Request) (string, error) {
+	cookie, err := r.Cookie(util.SessionCookieName)
+	if err != nil {
+		return "", err
+	}
+	return cookie.Value, nil
 }
 
 func EnableCors(w http.ResponseWriter) {
@@ -58,20 +115,3 @@ func isValidEmail(email string) bool {
 	re := regexp.MustCompile(emailRegex)
 	return re.MatchString(email)
 }
-
-func DeleteSession(userId int) {
-	if len(SessionStore) == 0 {
-		return
-	}
-	for k := range SessionStore {
-		sessionData, _ := getSessionData(k)
-		if len(sessionData) == 0 {
-			continue
-		}
-		id := sessionData["userId"].(int)
-		if id == userId {
-			delete(SessionStore, k)
-			return
-		}
-	}
-}
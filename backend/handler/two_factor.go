@@ -0,0 +1,466 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+
+	"github.com/jesee-kuya/forum/backend/i18n"
+	"github.com/jesee-kuya/forum/backend/jobs"
+	"github.com/jesee-kuya/forum/backend/mailer"
+	"github.com/jesee-kuya/forum/backend/models"
+	"github.com/jesee-kuya/forum/backend/repositories"
+	"github.com/jesee-kuya/forum/backend/util"
+)
+
+// TwoFactorLoginLifetime is how long a user has to enter their second factor after their password.
+const TwoFactorLoginLifetime = 5 * time.Minute
+
+// TokenTwoFactorLogin is the purpose of tokens for sign-ins waiting for their second factor.
+const TokenTwoFactorLogin = "two_factor_login"
+
+// RecoveryCodeCount is how many recovery codes a user gets when enabling two-factor authentication.
+const RecoveryCodeCount = 10
+
+// TwoFactorIssuer names the forum in authenticator apps.
+const TwoFactorIssuer = "Forum"
+
+// Events written to the audit log by two-factor authentication.
+const (
+	AuditTwoFactorEnabled         = "two_factor_enabled"
+	AuditTwoFactorDisabled        = "two_factor_disabled"
+	AuditRecoveryCodesRegenerated = "recovery_codes_regenerated"
+	AuditRecoveryCodeUsed         = "recovery_code_used"
+)
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+/*
+BeginSignIn signs a user in whose password or OAuth provider checked out. Users with two-factor authentication get a short-lived pending sign-in instead of a session, and BeginSignIn reports true so the caller sends them to /sign-in/2fa.
+*/
+func (a *App) BeginSignIn(w http.ResponseWriter, r *http.Request, userID int, rememberMe bool) (bool, error) {
+	tf, err := repositories.GetTwoFactor(r.Context(), a.DB, userID)
+	if err != nil {
+		return false, err
+	}
+	if !tf.Enabled {
+		return false, a.StartSession(w, r, userID, rememberMe)
+	}
+
+	token, err := repositories.CreateUserToken(r.Context(), a.DB, userID, TokenTwoFactorLogin, TwoFactorLoginLifetime)
+	if err != nil {
+		return false, err
+	}
+	remember := "0"
+	if rememberMe {
+		remember = "1"
+	}
+	util.SetTwoFactorCookie(w, r, token+"."+remember, time.Now().Add(TwoFactorLoginLifetime))
+	return true, nil
+}
+
+// pendingSignIn returns the token and "remember me" choice of the sign-in waiting for its second factor.
+func (a *App) pendingSignIn(r *http.Request) (string, bool, error) {
+	cookie, err := r.Cookie(util.TwoFactorCookieName)
+	if err != nil {
+		return "", false, err
+	}
+	token, remember, _ := strings.Cut(cookie.Value, ".")
+	return token, remember == "1", nil
+}
+
+// normalizeCode strips the spaces and dashes people type or paste along with codes.
+func normalizeCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
+
+/*
+verifySecondFactor checks a TOTP code or, failing that, an unused recovery code. A TOTP code is accepted only once. It reports whether the code was a recovery code.
+*/
+func (a *App) verifySecondFactor(ctx context.Context, userID int, code string) (recovery bool, ok bool, err error) {
+	code = normalizeCode(code)
+
+	tf, err := repositories.GetTwoFactor(ctx, a.DB, userID)
+	if err != nil {
+		return false, false, err
+	}
+	if tf.Secret == "" {
+		return false, false, nil
+	}
+
+	if step, valid := util.ValidateTOTP(tf.Secret, code, time.Now()); valid {
+		fresh, err := repositories.UseTOTPStep(ctx, a.DB, userID, step)
+		return false, fresh, err
+	}
+	if !tf.Enabled {
+		return false, false, nil
+	}
+
+	err = repositories.UseRecoveryCode(ctx, a.DB, userID, util.HashToken(code))
+	if errors.Is(err, repositories.ErrInvalidToken) {
+		return false, false, nil
+	}
+	return err == nil, err == nil, err
+}
+
+// newRecoveryCodes replaces a user's recovery codes and returns the new ones, formatted for display. Only their hashes are kept.
+func (a *App) newRecoveryCodes(ctx context.Context, userID int) ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(recoveryEncoding.EncodeToString(b))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = util.HashToken(code)
+	}
+
+	if err := repositories.ReplaceRecoveryCodes(ctx, a.DB, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// roleRequiresTwoFactor reports whether the user's role must use two-factor authentication.
+func (a *App) roleRequiresTwoFactor(ctx context.Context, userID int) (bool, error) {
+	role, err := repositories.GetUserRole(ctx, a.DB, userID)
+	if err != nil {
+		return false, err
+	}
+	roles, err := repositories.TwoFactorRequiredRoles(ctx, a.DB)
+	if err != nil {
+		return false, err
+	}
+	for _, required := range roles {
+		if role == required {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+/*
+TwoFactorLoginHandler asks for the second factor of a sign-in started by BeginSignIn and signs the user in once it checks out. Wrong codes count as failed sign-ins, so they are throttled and can lock the account.
+*/
+func (a *App) TwoFactorLoginHandler(w http.ResponseWriter, r *http.Request) error {
+	token, rememberMe, err := a.pendingSignIn(r)
+	if err != nil {
+		http.Redirect(w, r, "/sign-in", http.StatusSeeOther)
+		return nil
+	}
+	userID, err := repositories.FindUserToken(r.Context(), a.DB, TokenTwoFactorLogin, token)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Rejected two-factor sign-in", "err", err)
+		util.ClearTwoFactorCookie(w, r)
+		http.Redirect(w, r, "/sign-in", http.StatusSeeOther)
+		return nil
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		a.renderTwoFactorLogin(w, r, "")
+	case http.MethodPost:
+		user, err := repositories.GetUserByID(r.Context(), a.DB, userID)
+		if err != nil {
+			return util.Internal(fmt.Errorf("user not found: %w", err))
+		}
+
+		wait, err := a.loginThrottled(r, user.ID)
+		if err != nil {
+			return util.Internal(fmt.Errorf("error checking login attempts: %w", err))
+		}
+		if wait > 0 {
+			a.renderTwoFactorLogin(w, r, i18n.N(r.Context(), "auth.too_many_attempts", int(wait.Seconds())+1))
+			return nil
+		}
+
+		lockedUntil, err := repositories.AccountLockedUntil(r.Context(), a.DB, user.ID)
+		if err != nil {
+			return util.Internal(fmt.Errorf("error checking account lock: %w", err))
+		}
+		if !lockedUntil.IsZero() {
+			util.ClearTwoFactorCookie(w, r)
+			return util.NewError(http.StatusLocked, accountLockedMessage, nil)
+		}
+
+		recovery, ok, err := a.verifySecondFactor(r.Context(), user.ID, r.FormValue("code"))
+		if err != nil {
+			return util.Internal(fmt.Errorf("error checking second factor: %w", err))
+		}
+		if !ok {
+			if a.recordLoginFailure(r, loginTwoFactor, user, user.Email, "wrong two-factor code") {
+				if err := repositories.DeleteUserTokens(r.Context(), a.DB, user.ID, TokenTwoFactorLogin); err != nil {
+					slog.ErrorContext(r.Context(), "Failed to cancel pending sign-ins", "err", err)
+				}
+				util.ClearTwoFactorCookie(w, r)
+				return util.NewError(http.StatusLocked, accountLockedMessage, nil)
+			}
+			a.renderTwoFactorLogin(w, r, i18n.T(r.Context(), "two_factor.invalid_login_code"))
+			return nil
+		}
+
+		if _, err := repositories.ConsumeUserToken(r.Context(), a.DB, TokenTwoFactorLogin, token); err != nil {
+			slog.WarnContext(r.Context(), "Rejected two-factor sign-in", "err", err)
+			util.ClearTwoFactorCookie(w, r)
+			http.Redirect(w, r, "/sign-in", http.StatusSeeOther)
+			return nil
+		}
+		util.ClearTwoFactorCookie(w, r)
+		a.recordLoginSuccess(r, loginTwoFactor, user, user.Email)
+		if recovery {
+			a.recoveryCodeUsed(r, user)
+		}
+
+		if err := a.StartSession(w, r, user.ID, rememberMe); err != nil {
+			return util.Internal(fmt.Errorf("failed to store session token: %w", err))
+		}
+		http.Redirect(w, r, "/home", http.StatusSeeOther)
+	default:
+		return util.MethodNotAllowed()
+	}
+	return nil
+}
+
+func (a *App) renderTwoFactorLogin(w http.ResponseWriter, r *http.Request, errMsg string) {
+	if err := a.render(w, r, "two-factor-login.html", struct{ Error string }{Error: errMsg}); err != nil {
+		util.WriteError(w, r, err)
+	}
+}
+
+// recoveryCodeUsed audits the use of a recovery code and tells the user how many they have left.
+func (a *App) recoveryCodeUsed(r *http.Request, user models.User) {
+	left, err := repositories.CountRecoveryCodes(r.Context(), a.DB, user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to count recovery codes", "err", err)
+	}
+	a.Audit(r, user.ID, AuditRecoveryCodeUsed, fmt.Sprintf("%d left", left))
+
+	err = jobs.SendEmail(r.Context(), a.DB, mailer.Message{
+		To:      user.Email,
+		Subject: "A recovery code was used to sign in",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone signed in to your forum account with one of your recovery codes. You have %d left. "+
+			"You can create new ones from the two-factor authentication settings.\n\n"+
+			"If this was not you, reset your password and create new recovery codes straight away.\n", user.Username, left),
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to queue recovery code email", "err", err)
+	}
+}
+
+type twoFactorPage struct {
+	Enabled, Required bool
+	HasPassword       bool
+	Secret            string
+	// URI is an otpauth: link, a scheme html/template only lets through as a template.URL.
+	URI           template.URL
+	QRCode        string
+	RecoveryCodes []string
+	CodesLeft     int
+	Notice, Error string
+}
+
+/*
+renderTwoFactor shows the two-factor settings of a user. Users who have not enabled it get a pending secret, kept until they confirm it, with its QR code.
+*/
+func (a *App) renderTwoFactor(w http.ResponseWriter, r *http.Request, user models.User, page twoFactorPage) {
+	tf, err := repositories.GetTwoFactor(r.Context(), a.DB, user.ID)
+	if err == nil {
+		page.Required, err = a.roleRequiresTwoFactor(r.Context(), user.ID)
+	}
+	if err != nil {
+		util.WriteError(w, r, util.Internal(fmt.Errorf("failed to load two-factor settings: %w", err)))
+		return
+	}
+	page.Enabled = tf.Enabled
+	page.HasPassword = user.Password != ""
+
+	if tf.Enabled {
+		page.CodesLeft, err = repositories.CountRecoveryCodes(r.Context(), a.DB, user.ID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to count recovery codes", "err", err)
+		}
+	} else {
+		if tf.Secret == "" {
+			tf.Secret = util.NewTOTPSecret()
+			if err := repositories.SetPendingTOTPSecret(r.Context(), a.DB, user.ID, tf.Secret); err != nil {
+				util.WriteError(w, r, util.Internal(fmt.Errorf("failed to store TOTP secret: %w", err)))
+				return
+			}
+		}
+		page.Secret = tf.Secret
+		uri := util.OTPAuthURI(TwoFactorIssuer, user.Email, tf.Secret)
+		page.URI = template.URL(uri)
+
+		png, err := qrcode.Encode(uri, qrcode.Medium, 240)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to draw QR code", "err", err)
+		} else {
+			page.QRCode = base64.StdEncoding.EncodeToString(png)
+		}
+	}
+
+	if err := a.render(w, r, "two-factor.html", page); err != nil {
+		util.WriteError(w, r, err)
+	}
+}
+
+// TwoFactorSettingsHandler renders the two-factor authentication settings.
+func (a *App) TwoFactorSettingsHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.URL.Path != "/settings/2fa" {
+		return util.NewError(http.StatusNotFound, "error.page_not_found", nil)
+	}
+
+	user, _, ok := a.settingsRequest(w, r, http.MethodGet)
+	if !ok {
+		return nil
+	}
+	a.renderTwoFactor(w, r, user, twoFactorPage{})
+	return nil
+}
+
+/*
+EnableTwoFactorHandler turns on two-factor authentication once the user enters a code for their pending secret, and shows their recovery codes, this one time only.
+*/
+func (a *App) EnableTwoFactorHandler(w http.ResponseWriter, r *http.Request) error {
+	user, _, ok := a.settingsRequest(w, r, http.MethodPost)
+	if !ok {
+		return nil
+	}
+
+	tf, err := repositories.GetTwoFactor(r.Context(), a.DB, user.ID)
+	if err != nil {
+		return util.Internal(fmt.Errorf("failed to load two-factor settings: %w", err))
+	}
+	if tf.Enabled {
+		http.Redirect(w, r, "/settings/2fa", http.StatusSeeOther)
+		return nil
+	}
+
+	step, valid := util.ValidateTOTP(tf.Secret, normalizeCode(r.FormValue("code")), time.Now())
+	if tf.Secret == "" || !valid {
+		a.renderTwoFactor(w, r, user, twoFactorPage{Error: i18n.T(r.Context(), "two_factor.invalid_setup_code")})
+		return nil
+	}
+
+	if err := repositories.EnableTwoFactor(r.Context(), a.DB, user.ID, step); err != nil {
+		return util.Internal(fmt.Errorf("failed to enable two-factor authentication: %w", err))
+	}
+	codes, err := a.newRecoveryCodes(r.Context(), user.ID)
+	if err != nil {
+		return util.Internal(fmt.Errorf("failed to create recovery codes: %w", err))
+	}
+	if err := a.RotateSession(w, r); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to rotate session", "err", err)
+	}
+	a.Audit(r, user.ID, AuditTwoFactorEnabled, "")
+	a.notifyTwoFactorChange(r.Context(), user, "turned on")
+
+	a.renderTwoFactor(w, r, user, twoFactorPage{
+		RecoveryCodes: codes,
+		Notice:        i18n.T(r.Context(), "two_factor.enabled"),
+	})
+	return nil
+}
+
+/*
+DisableTwoFactorHandler turns off two-factor authentication. It needs a current code, and the password if the account has one, and is refused while the user's role requires two-factor authentication.
+*/
+func (a *App) DisableTwoFactorHandler(w http.ResponseWriter, r *http.Request) error {
+	user, _, ok := a.settingsRequest(w, r, http.MethodPost)
+	if !ok {
+		return nil
+	}
+
+	required, err := a.roleRequiresTwoFactor(r.Context(), user.ID)
+	if err != nil {
+		return util.Internal(fmt.Errorf("failed to check two-factor requirement: %w", err))
+	}
+	if required {
+		a.renderTwoFactor(w, r, user, twoFactorPage{Error: i18n.T(r.Context(), "two_factor.required_on")})
+		return nil
+	}
+	if user.Password != "" && !checkPassword(user, r.FormValue("password")) {
+		a.renderTwoFactor(w, r, user, twoFactorPage{Error: i18n.T(r.Context(), "settings.wrong_password")})
+		return nil
+	}
+
+	_, valid, err := a.verifySecondFactor(r.Context(), user.ID, r.FormValue("code"))
+	if err != nil {
+		return util.Internal(fmt.Errorf("error checking second factor: %w", err))
+	}
+	if !valid {
+		a.renderTwoFactor(w, r, user, twoFactorPage{Error: i18n.T(r.Context(), "two_factor.invalid_code")})
+		return nil
+	}
+
+	if err := repositories.DisableTwoFactor(r.Context(), a.DB, user.ID); err != nil {
+		return util.Internal(fmt.Errorf("failed to disable two-factor authentication: %w", err))
+	}
+	a.Audit(r, user.ID, AuditTwoFactorDisabled, "")
+	a.notifyTwoFactorChange(r.Context(), user, "turned off")
+
+	http.Redirect(w, r, "/settings?notice=two-factor-disabled", http.StatusSeeOther)
+	return nil
+}
+
+// RegenerateRecoveryCodesHandler replaces the user's recovery codes after checking a current code.
+func (a *App) RegenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) error {
+	user, _, ok := a.settingsRequest(w, r, http.MethodPost)
+	if !ok {
+		return nil
+	}
+
+	tf, err := repositories.GetTwoFactor(r.Context(), a.DB, user.ID)
+	if err != nil {
+		return util.Internal(fmt.Errorf("failed to load two-factor settings: %w", err))
+	}
+	if !tf.Enabled {
+		http.Redirect(w, r, "/settings/2fa", http.StatusSeeOther)
+		return nil
+	}
+
+	_, valid, err := a.verifySecondFactor(r.Context(), user.ID, r.FormValue("code"))
+	if err != nil {
+		return util.Internal(fmt.Errorf("error checking second factor: %w", err))
+	}
+	if !valid {
+		a.renderTwoFactor(w, r, user, twoFactorPage{Error: i18n.T(r.Context(), "two_factor.invalid_code")})
+		return nil
+	}
+
+	codes, err := a.newRecoveryCodes(r.Context(), user.ID)
+	if err != nil {
+		return util.Internal(fmt.Errorf("failed to create recovery codes: %w", err))
+	}
+	a.Audit(r, user.ID, AuditRecoveryCodesRegenerated, "")
+
+	a.renderTwoFactor(w, r, user, twoFactorPage{
+		RecoveryCodes: codes,
+		Notice:        i18n.T(r.Context(), "two_factor.regenerated"),
+	})
+	return nil
+}
+
+func (a *App) notifyTwoFactorChange(ctx context.Context, user models.User, change string) {
+	err := jobs.SendEmail(ctx, a.DB, mailer.Message{
+		To:      user.Email,
+		Subject: "Two-factor authentication was " + change,
+		Body: fmt.Sprintf("Hi %s,\n\nTwo-factor authentication was just %s for your forum account. "+
+			"If this was not you, reset your password straight away.\n", user.Username, change),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to queue two-factor email", "err", err)
+	}
+}
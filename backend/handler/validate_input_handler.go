@@ -1,63 +1,47 @@
 package handler
 
 import (
-	"database/sql"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 
+	"github.com/jesee-kuya/forum/backend/repositories"
 	"github.com/jesee-kuya/forum/backend/util"
 )
 
 /*
 ValidateInputHandler checks if a name or email already exists in the database.
 */
-func ValidateInputHandler(w http.ResponseWriter, r *http.Request) {
+func (a *App) ValidateInputHandler(w http.ResponseWriter, r *http.Request) error {
 	if r.URL.Path != "/validate" {
-		log.Printf("Failed finding %q route.\n", r.URL.Path)
-		util.ErrorHandler(w, "Not Found", http.StatusNotFound)
-		return
+		return util.NewError(http.StatusNotFound, "error.not_found", nil)
 	}
 
 	if r.Method != http.MethodGet {
-		log.Printf("Invalid request method: %v\n", r.Method)
-		util.ErrorHandler(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
+		return util.MethodNotAllowed()
 	}
 
 	if err := r.ParseForm(); err != nil {
-		log.Printf("Failed parsing form: %v\n", err)
-		util.ErrorHandler(w, "Bad Request", http.StatusBadRequest)
-		return
+		return util.NewError(http.StatusBadRequest, "error.bad_request", fmt.Errorf("failed parsing form: %w", err))
 	}
 
 	username, email := strings.TrimSpace(r.FormValue("username")), strings.TrimSpace(r.FormValue("email"))
-	var query, value string
+	var available bool
+	var err error
 
 	if username != "" {
-		query = "SELECT id FROM tblUsers WHERE username = ?"
-		value = username
+		available, err = repositories.UsernameAvailable(r.Context(), a.DB, username, 0)
 	} else if email != "" {
-		query = "SELECT id FROM tblUsers WHERE email = ?"
-		value = email
+		available, err = repositories.EmailAvailable(r.Context(), a.DB, email, 0)
 	} else {
-		log.Println("Invalid input provided.")
-		util.ErrorHandler(w, "Bad Request", http.StatusBadRequest)
-		return
+		return util.NewError(http.StatusBadRequest, "error.bad_request", errors.New("invalid input provided"))
 	}
 
-	var userID int
-	err := util.DB.QueryRow(query, value).Scan(&userID)
-	// Provided credentials are unique
-	if err == sql.ErrNoRows {
-		json.NewEncoder(w).Encode(map[string]bool{"available": true})
-		return
-	} else if err != nil {
-		log.Printf("Failed quering databse: %v\n", err)
-		util.ErrorHandler(w, "Something Unexpected Happened. Try Again Later", http.StatusInternalServerError)
-		return
+	if err != nil {
+		return util.NewError(http.StatusInternalServerError, util.InternalErrorMessage, fmt.Errorf("failed quering databse: %w", err))
 	}
-	// Provided credentials are taken
-	json.NewEncoder(w).Encode(map[string]bool{"available": false})
+	json.NewEncoder(w).Encode(map[string]bool{"available": available})
+	return nil
 }
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/jesee-kuya/forum/backend/jobs"
+	"github.com/jesee-kuya/forum/backend/mailer"
+	"github.com/jesee-kuya/forum/backend/models"
+	"github.com/jesee-kuya/forum/backend/repositories"
+	"github.com/jesee-kuya/forum/backend/util"
+)
+
+// EmailVerificationLifetime is how long a verification link stays valid.
+const EmailVerificationLifetime = 48 * time.Hour
+
+// AuditEmailVerified is written to the audit log when a user confirms their email address.
+const AuditEmailVerified = "email_verified"
+
+const verifyEmailPurpose = "verify-email"
+
+/*
+sendVerificationEmail queues an email with a signed link confirming that user.Email belongs to the user. The link names the address, so it stops working if the address changes.
+*/
+func (a *App) sendVerificationEmail(r *http.Request, user models.User) error {
+	base, err := util.BaseURL(r)
+	if err != nil {
+		return err
+	}
+	params := util.SignValues(r.Context(), verifyEmailPurpose, url.Values{
+		"user":  {strconv.Itoa(user.ID)},
+		"email": {user.Email},
+	}, EmailVerificationLifetime)
+	link := base + "/verify-email?" + params.Encode()
+
+	return jobs.SendEmail(r.Context(), a.DB, mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening this link:\n\n%s\n\n"+
+			"You can read the forum in the meantime, but you need to confirm your address before you can post or comment. "+
+			"The link expires in %d hours.\n\nIf you did not sign up, you can ignore this email.\n",
+			user.Username, link, int(EmailVerificationLifetime.Hours())),
+	})
+}
+
+/*
+VerifyEmailHandler confirms an email address from the link sent by sendVerificationEmail.
+*/
+func (a *App) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return util.MethodNotAllowed()
+	}
+
+	query := r.URL.Query()
+	if err := util.VerifyValues(r.Context(), verifyEmailPurpose, query); err != nil {
+		return util.NewError(http.StatusBadRequest, "error.verification_link_invalid", fmt.Errorf("rejected verification link: %w", err))
+	}
+
+	userID, err := strconv.Atoi(query.Get("user"))
+	if err == nil {
+		err = repositories.MarkEmailVerified(r.Context(), a.DB, userID, query.Get("email"))
+	}
+	if err != nil {
+		return util.NewError(http.StatusBadRequest, "error.verification_link_invalid", fmt.Errorf("failed to verify email: %w", err))
+	}
+	a.Audit(r, userID, AuditEmailVerified, query.Get("email"))
+
+	http.Redirect(w, r, "/sign-in?notice=verified", http.StatusSeeOther)
+	return nil
+}
+
+/*
+ResendVerificationHandler sends a new verification link to the signed in user.
+*/
+func (a *App) ResendVerificationHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return util.MethodNotAllowed()
+	}
+
+	userID, ok := a.signedInUser(r)
+	if !ok {
+		slog.InfoContext(r.Context(), "Invalid session")
+		http.Redirect(w, r, "/sign-in", http.StatusSeeOther)
+		return nil
+	}
+
+	user, err := repositories.GetUserByID(r.Context(), a.DB, userID)
+	if err != nil {
+		return util.Internal(fmt.Errorf("user not found: %w", err))
+	}
+
+	verified, err := repositories.IsEmailVerified(r.Context(), a.DB, user.ID)
+	if err != nil {
+		return util.Internal(fmt.Errorf("failed to check email verification: %w", err))
+	}
+	if verified {
+		http.Redirect(w, r, "/home", http.StatusSeeOther)
+		return nil
+	}
+
+	if err := a.sendVerificationEmail(r, user); err != nil {
+		return util.Internal(fmt.Errorf("failed to queue verification email: %w", err))
+	}
+	http.Redirect(w, r, "/home?notice=verification-sent", http.StatusSeeOther)
+	return nil
+}
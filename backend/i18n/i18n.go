@@ -0,0 +1,198 @@
+/*
+Package i18n translates the forum's user-facing text. Messages are kept in a catalog per language, locales/<lang>.json, mapping keys such as "nav.sign_in" to text with fmt verbs for their arguments. Messages that depend on a count have a form per plural category of the language, such as "one" and "other".
+*/
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// DefaultLanguage is used when a request asks for no language with a catalog, and for messages missing from another catalog.
+const DefaultLanguage = "en"
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+/*
+message is a catalog entry: either plain text, or an object with a form per plural category when the text depends on a count.
+*/
+type message struct {
+	text  string
+	forms map[string]string
+}
+
+func (m *message) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &m.text); err == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, &m.forms); err != nil {
+		return fmt.Errorf("a message must be a string or an object of plural forms: %w", err)
+	}
+	if _, ok := m.forms["other"]; !ok {
+		return fmt.Errorf("plural forms need an \"other\" form")
+	}
+	return nil
+}
+
+// Translator translates messages into one language.
+type Translator struct {
+	lang     string
+	messages map[string]message
+	plural   func(n int) string
+	fallback *Translator
+}
+
+// catalogs holds a Translator for every catalog in locales, keyed by language.
+var catalogs = mustLoad(localeFiles)
+
+func mustLoad(fsys fs.FS) map[string]*Translator {
+	translators, err := load(fsys)
+	if err != nil {
+		panic(err)
+	}
+	return translators
+}
+
+// load reads the catalogs in fsys. Every language falls back to DefaultLanguage, which must have a catalog.
+func load(fsys fs.FS) (map[string]*Translator, error) {
+	files, err := fs.Glob(fsys, "locales/*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	translators := make(map[string]*Translator)
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		lang := strings.TrimSuffix(path.Base(file), ".json")
+		t := &Translator{lang: lang, plural: pluralRule(lang)}
+		if err := json.Unmarshal(data, &t.messages); err != nil {
+			return nil, fmt.Errorf("catalog %s: %w", file, err)
+		}
+		translators[lang] = t
+	}
+
+	fallback, ok := translators[DefaultLanguage]
+	if !ok {
+		return nil, fmt.Errorf("no catalog for the default language %q", DefaultLanguage)
+	}
+	for lang, t := range translators {
+		if lang != DefaultLanguage {
+			t.fallback = fallback
+		}
+	}
+	return translators, nil
+}
+
+// Default returns the Translator of DefaultLanguage.
+func Default() *Translator {
+	return catalogs[DefaultLanguage]
+}
+
+// Lookup returns the Translator of a language such as "sw", and whether it has a catalog.
+func Lookup(lang string) (*Translator, bool) {
+	t, ok := catalogs[strings.ToLower(lang)]
+	return t, ok
+}
+
+// Languages returns the Translators of every language with a catalog, sorted by language.
+func Languages() []*Translator {
+	translators := make([]*Translator, 0, len(catalogs))
+	for _, t := range catalogs {
+		translators = append(translators, t)
+	}
+	sort.Slice(translators, func(i, j int) bool { return translators[i].lang < translators[j].lang })
+	return translators
+}
+
+// Lang returns the language translated into, such as "en".
+func (t *Translator) Lang() string {
+	return t.lang
+}
+
+// Name returns the name of the language in that language, such as "Kiswahili", for language menus.
+func (t *Translator) Name() string {
+	return t.T("language.name")
+}
+
+// lookup finds the message for key, in the default language when this catalog lacks it.
+func (t *Translator) lookup(key string) (message, bool) {
+	if m, ok := t.messages[key]; ok {
+		return m, true
+	}
+	if t.fallback != nil {
+		return t.fallback.lookup(key)
+	}
+	return message{}, false
+}
+
+/*
+T returns the message for key with args formatted into it as by fmt.Sprintf. A key missing from every catalog is returned as it is, so text that is not a key, such as an error message from before messages were translated, still reads. An empty key gives an empty message.
+*/
+func (t *Translator) T(key string, args ...interface{}) string {
+	if key == "" {
+		return ""
+	}
+	m, ok := t.lookup(key)
+	if !ok {
+		return key
+	}
+	text := m.text
+	if m.forms != nil {
+		text = m.forms["other"]
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+/*
+N returns the form of the message for key matching the count n, formatted with n followed by args. The form is chosen by the plural rule of the language, falling back to "other".
+*/
+func (t *Translator) N(key string, n int, args ...interface{}) string {
+	m, ok := t.lookup(key)
+	if !ok {
+		return key
+	}
+	text := m.text
+	if m.forms != nil {
+		form, ok := m.forms[t.plural(n)]
+		if !ok {
+			form = m.forms["other"]
+		}
+		text = form
+	}
+	return fmt.Sprintf(text, append([]interface{}{n}, args...)...)
+}
+
+/*
+pluralRules give the plural category of a count, following the Unicode CLDR rules for whole numbers. English and Swahili both use "one" for 1 and "other" for everything else.
+*/
+var pluralRules = map[string]func(n int) string{
+	"en": oneOther,
+	"sw": oneOther,
+}
+
+func oneOther(n int) string {
+	if n == 1 {
+		return "one"
+	}
+	return "other"
+}
+
+// pluralRule returns the plural rule of lang, or the English one for a language without its own.
+func pluralRule(lang string) func(n int) string {
+	if rule, ok := pluralRules[lang]; ok {
+		return rule
+	}
+	return oneOther
+}
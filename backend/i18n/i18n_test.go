@@ -0,0 +1,322 @@
+package i18n
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// Keys are looked up in the templates and the Go sources of the forum, relative to this package
+var (
+	templateDir = filepath.Join("..", "..", "frontend", "templates")
+	sourceDirs  = []string{"..", filepath.Join("..", "..", "main.go")}
+)
+
+var (
+	// templateKey matches the key of {{ t "key" }} and {{ tn "key" .Count }}
+	templateKey = regexp.MustCompile(`\{\{-?\s*tn?\s+"([^"]+)"`)
+	// sourceKey matches string literals shaped like a key, such as "error.page_not_found"
+	sourceKey = regexp.MustCompile(`"([a-z_]+(?:\.[a-z0-9_]+)+)"`)
+	// verb matches a fmt verb, with its explicit argument index if it has one
+	verb = regexp.MustCompile(`%(?:\[(\d+)\])?[-+# 0]*[0-9]*(?:\.[0-9]+)?([a-zA-Z%])`)
+)
+
+func TestCatalogsMatchDefault(t *testing.T) {
+	en := Default()
+	for _, tr := range Languages() {
+		for key, m := range tr.messages {
+			want, ok := en.messages[key]
+			if !ok {
+				t.Errorf("%s: %q is not in the %s catalog", tr.lang, key, DefaultLanguage)
+				continue
+			}
+			if (m.forms == nil) != (want.forms == nil) {
+				t.Errorf("%s: %q must have plural forms exactly when the %s message has them", tr.lang, key, DefaultLanguage)
+				continue
+			}
+			for _, text := range texts(m) {
+				if got, exp := verbs(text), verbs(texts(want)[0]); got != exp {
+					t.Errorf("%s: %q takes the arguments %s, want %s", tr.lang, key, got, exp)
+				}
+			}
+			if m.forms != nil {
+				for n := 0; n <= 1000; n++ {
+					if _, ok := m.forms[tr.plural(n)]; !ok {
+						t.Errorf("%s: %q has no %q form, used for %d", tr.lang, key, tr.plural(n), n)
+						break
+					}
+				}
+			}
+		}
+		for key := range en.messages {
+			if _, ok := tr.messages[key]; !ok {
+				t.Errorf("%s: %q is missing", tr.lang, key)
+			}
+		}
+	}
+}
+
+// texts returns the text of m, or each of its plural forms.
+func texts(m message) []string {
+	if m.forms == nil {
+		return []string{m.text}
+	}
+	var forms []string
+	for _, form := range m.forms {
+		forms = append(forms, form)
+	}
+	return forms
+}
+
+// verbs describes the arguments a text formats, such as "1:d 2:s", whatever order it places them in.
+func verbs(text string) string {
+	var args []string
+	next := 1
+	for _, match := range verb.FindAllStringSubmatch(text, -1) {
+		if match[2] == "%" {
+			continue
+		}
+		if match[1] != "" {
+			next, _ = strconv.Atoi(match[1])
+		}
+		args = append(args, strconv.Itoa(next)+":"+match[2])
+		next++
+	}
+	sort.Strings(args)
+	return strings.Join(args, " ")
+}
+
+/*
+TestMissingKeys checks every key the templates and the Go sources use has a message, and every message is used. Go string literals count as keys when they start with the namespace of a message, such as "error.".
+*/
+func TestMissingKeys(t *testing.T) {
+	en := Default()
+	used := make(map[string]bool)
+
+	err := filepath.WalkDir(templateDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".html" {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, match := range templateKey.FindAllStringSubmatch(string(data), -1) {
+			used[match[1]] = true
+			if _, ok := en.messages[match[1]]; !ok {
+				t.Errorf("%s: no message for %q", path, match[1])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	namespaces := make(map[string]bool)
+	for key := range en.messages {
+		namespace, _, _ := strings.Cut(key, ".")
+		namespaces[namespace] = true
+	}
+	for _, dir := range sourceDirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || filepath.Ext(path) != ".go" || strings.HasSuffix(path, "_test.go") {
+				return err
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			for _, match := range sourceKey.FindAllStringSubmatch(string(data), -1) {
+				key := match[1]
+				namespace, _, _ := strings.Cut(key, ".")
+				// Template names such as "error.html" share a namespace with messages
+				if !namespaces[namespace] || strings.HasSuffix(key, ".html") {
+					continue
+				}
+				used[key] = true
+				if _, ok := en.messages[key]; !ok {
+					t.Errorf("%s: no message for %q", path, key)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for key := range en.messages {
+		if !used[key] {
+			t.Errorf("%q is not used", key)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	sw, ok := Lookup("SW")
+	if !ok {
+		t.Fatal("Expected a Swahili catalog")
+	}
+	tests := []struct {
+		tr   *Translator
+		key  string
+		args []interface{}
+		want string
+	}{
+		{Default(), "nav.sign_in", nil, "Sign In"},
+		{sw, "nav.sign_in", nil, "Ingia"},
+		{sw, "settings.link", []interface{}{"GitHub"}, "Unganisha GitHub"},
+		{sw, "Slow down", nil, "Slow down"},
+		{sw, "", nil, ""},
+	}
+	for _, tc := range tests {
+		if got := tc.tr.T(tc.key, tc.args...); got != tc.want {
+			t.Errorf("%s: T(%q) = %q, want %q", tc.tr.Lang(), tc.key, got, tc.want)
+		}
+	}
+	if sw.Name() != "Kiswahili" || Default().Name() != "English" {
+		t.Errorf("Unexpected language names %q and %q", sw.Name(), Default().Name())
+	}
+}
+
+func TestN(t *testing.T) {
+	sw, _ := Lookup("sw")
+	tests := []struct {
+		tr   *Translator
+		n    int
+		want string
+	}{
+		{Default(), 0, "You have 0 unused recovery codes."},
+		{Default(), 1, "You have 1 unused recovery code."},
+		{Default(), 7, "You have 7 unused recovery codes."},
+		{sw, 1, "Una msimbo 1 wa kurejesha ambao haujatumika."},
+		{sw, 2, "Una misimbo 2 ya kurejesha ambayo haijatumika."},
+	}
+	for _, tc := range tests {
+		if got := tc.tr.N("two_factor.codes_left", tc.n); got != tc.want {
+			t.Errorf("%s: N(%d) = %q, want %q", tc.tr.Lang(), tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestFallback(t *testing.T) {
+	fsys := fstest.MapFS{
+		"locales/en.json": {Data: []byte(`{"a": "A", "b": {"one": "%d B", "other": "%d Bs"}}`)},
+		"locales/xx.json": {Data: []byte(`{"a": "Ax"}`)},
+	}
+	translators, err := load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xx := translators["xx"]
+	if got := xx.T("a"); got != "Ax" {
+		t.Errorf("Expected the message of the language, got %q", got)
+	}
+	if got := xx.N("b", 2); got != "2 Bs" {
+		t.Errorf("Expected the default language for a missing message, got %q", got)
+	}
+
+	if _, err := load(fstest.MapFS{"locales/xx.json": {Data: []byte(`{}`)}}); err == nil {
+		t.Error("Expected an error without a catalog for the default language")
+	}
+	if _, err := load(fstest.MapFS{"locales/en.json": {Data: []byte(`{"b": {"one": "%d B"}}`)}}); err == nil {
+		t.Error("Expected an error for plural forms without an \"other\" form")
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name, accept, cookie, want string
+	}{
+		{"nothing", "", "", "en"},
+		{"exact", "sw", "", "sw"},
+		{"region", "sw-KE", "", "sw"},
+		{"quality order", "en;q=0.5, sw;q=0.9", "", "sw"},
+		{"refused", "sw;q=0, en", "", "en"},
+		{"first known", "fr, de;q=0.9, sw;q=0.1", "", "sw"},
+		{"unknown only", "fr, *", "", "en"},
+		{"cookie", "en", "sw", "sw"},
+		{"unknown cookie", "sw", "xx", "sw"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.accept != "" {
+				r.Header.Set("Accept-Language", tc.accept)
+			}
+			if tc.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: CookieName, Value: tc.cookie})
+			}
+			if got := Negotiate(r).Lang(); got != tc.want {
+				t.Errorf("Negotiate = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestContext(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if got := FromContext(r.Context()); got != Default() {
+		t.Errorf("Expected the default language without one in the context, got %q", got.Lang())
+	}
+	sw, _ := Lookup("sw")
+	ctx := NewContext(r.Context(), sw)
+	if got := T(ctx, "nav.sign_up"); got != "Jisajili" {
+		t.Errorf("T = %q, want the Swahili message", got)
+	}
+	if got := N(ctx, "post.comment_count", 3); got != "Maoni 3" {
+		t.Errorf("N = %q, want the Swahili message", got)
+	}
+}
+
+func TestAgo(t *testing.T) {
+	fixed := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return fixed }
+	t.Cleanup(func() { now = time.Now })
+
+	sw, _ := Lookup("sw")
+	tests := []struct {
+		tr   *Translator
+		ago  time.Duration
+		want string
+	}{
+		{Default(), 0, "0 seconds ago"},
+		{Default(), time.Second, "1 second ago"},
+		{Default(), 90 * time.Second, "1 minute ago"},
+		{Default(), 5 * time.Hour, "5 hours ago"},
+		{Default(), 24 * time.Hour, "1 day ago"},
+		{Default(), 15 * 24 * time.Hour, "2 weeks ago"},
+		{Default(), 60 * 24 * time.Hour, "2 months ago"},
+		{Default(), 800 * 24 * time.Hour, "2 years ago"},
+		{Default(), -time.Minute, "0 seconds ago"},
+		{sw, 3 * time.Hour, "saa 3 zilizopita"},
+		{sw, 30 * 24 * time.Hour, "mwezi 1 uliopita"},
+		{sw, 400 * 24 * time.Hour, "mwaka 1 uliopita"},
+	}
+	for _, tc := range tests {
+		if got := tc.tr.Ago(fixed.Add(-tc.ago)); got != tc.want {
+			t.Errorf("%s: Ago(-%v) = %q, want %q", tc.tr.Lang(), tc.ago, got, tc.want)
+		}
+	}
+}
+
+func TestDate(t *testing.T) {
+	tm := time.Date(2025, 3, 1, 14, 5, 0, 0, time.UTC)
+	sw, _ := Lookup("sw")
+	if got := Default().Date(tm); got != "Mar 1, 2025 14:05 UTC" {
+		t.Errorf("English date = %q", got)
+	}
+	if got := sw.Date(tm); got != "1 Mac 2025, 14:05 UTC" {
+		t.Errorf("Swahili date = %q", got)
+	}
+}
@@ -0,0 +1,93 @@
+package i18n
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CookieName is the cookie holding the language a visitor chose, or the preference of the signed in user.
+const CookieName = "lang"
+
+/*
+Negotiate picks the language to answer r in: the one chosen with the language menu or saved to the user's account, carried by the language cookie, and otherwise the most preferred language of the Accept-Language header with a catalog. Regional variants such as "sw-KE" match their language.
+*/
+func Negotiate(r *http.Request) *Translator {
+	if cookie, err := r.Cookie(CookieName); err == nil {
+		if t, ok := Lookup(cookie.Value); ok {
+			return t
+		}
+	}
+	for _, lang := range acceptedLanguages(r.Header.Get("Accept-Language")) {
+		if t, ok := Lookup(lang); ok {
+			return t
+		}
+		if base, _, found := strings.Cut(lang, "-"); found {
+			if t, ok := Lookup(base); ok {
+				return t
+			}
+		}
+	}
+	return Default()
+}
+
+// acceptedLanguages returns the languages of an Accept-Language header, most preferred first, leaving out those refused with q=0.
+func acceptedLanguages(header string) []string {
+	type weighted struct {
+		lang string
+		q    float64
+	}
+	var langs []weighted
+	for _, part := range strings.Split(header, ",") {
+		lang, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang = strings.ToLower(strings.TrimSpace(lang))
+		if lang == "" || lang == "*" {
+			continue
+		}
+		q := 1.0
+		if value, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q > 0 {
+			langs = append(langs, weighted{lang, q})
+		}
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+
+	names := make([]string, len(langs))
+	for i, l := range langs {
+		names[i] = l.lang
+	}
+	return names
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying t, for handlers and templates to translate with.
+func NewContext(ctx context.Context, t *Translator) context.Context {
+	return context.WithValue(ctx, contextKey{}, t)
+}
+
+// FromContext returns the Translator carried by ctx, or that of the default language when it carries none.
+func FromContext(ctx context.Context) *Translator {
+	if t, ok := ctx.Value(contextKey{}).(*Translator); ok {
+		return t
+	}
+	return Default()
+}
+
+// T translates key into the language of ctx, as Translator.T does.
+func T(ctx context.Context, key string, args ...interface{}) string {
+	return FromContext(ctx).T(key, args...)
+}
+
+// N returns the form of the message for key matching the count n in the language of ctx, as Translator.N does.
+func N(ctx context.Context, key string, n int, args ...interface{}) string {
+	return FromContext(ctx).N(key, n, args...)
+}
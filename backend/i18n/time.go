@@ -0,0 +1,50 @@
+package i18n
+
+import (
+	"time"
+)
+
+// now is the clock Ago measures from, replaced in tests.
+var now = time.Now
+
+// timeUnits are the units Ago counts in, largest first, with the keys of their messages.
+var timeUnits = []struct {
+	key  string
+	size time.Duration
+}{
+	{"time.years_ago", 365 * 24 * time.Hour},
+	{"time.months_ago", 30 * 24 * time.Hour},
+	{"time.weeks_ago", 7 * 24 * time.Hour},
+	{"time.days_ago", 24 * time.Hour},
+	{"time.hours_ago", time.Hour},
+	{"time.minutes_ago", time.Minute},
+}
+
+// Ago says how long ago tm was in its largest whole unit, such as "2 days ago".
+func (t *Translator) Ago(tm time.Time) string {
+	elapsed := now().Sub(tm)
+	for _, unit := range timeUnits {
+		if elapsed >= unit.size {
+			return t.N(unit.key, int(elapsed/unit.size))
+		}
+	}
+	seconds := int(elapsed / time.Second)
+	if seconds < 0 {
+		seconds = 0
+	}
+	return t.N("time.seconds_ago", seconds)
+}
+
+/*
+Date formats tm as a date and time in the order and with the month names of the language, such as "Mar 1, 2025 14:05 UTC". The "date.format" message receives the day, the month's name, the year, the time and the time zone, in that order.
+*/
+func (t *Translator) Date(tm time.Time) string {
+	month := t.T(monthKeys[tm.Month()-1])
+	return t.T("date.format", tm.Day(), month, tm.Year(), tm.Format("15:04"), tm.Format("MST"))
+}
+
+// monthKeys are the keys of the short month names, January first.
+var monthKeys = [12]string{
+	"date.month.jan", "date.month.feb", "date.month.mar", "date.month.apr", "date.month.may", "date.month.jun",
+	"date.month.jul", "date.month.aug", "date.month.sep", "date.month.oct", "date.month.nov", "date.month.dec",
+}
@@ -0,0 +1,110 @@
+package janitor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jesee-kuya/forum/backend/repositories"
+)
+
+// Options controls which files CollectUploads considers orphaned.
+type Options struct {
+	Dir    string        // directory holding uploaded media
+	Grace  time.Duration // orphans younger than this are kept, as their post may still be in flight
+	DryRun bool          // report orphans without deleting them
+}
+
+// Report summarises a single collection run.
+type Report struct {
+	Scanned        int
+	Orphans        []string
+	Kept           int
+	ReclaimedBytes int64
+}
+
+// String formats the report for logs and the command line.
+func (r Report) String() string {
+	return fmt.Sprintf("scanned %d files, found %d orphans, kept %d within grace period, reclaimed %s",
+		r.Scanned, len(r.Orphans), r.Kept, FormatBytes(r.ReclaimedBytes))
+}
+
+/*
+CollectUploads reconciles the files in the uploads directory against the media referenced by visible posts and deletes the files nobody references anymore once they are older than the grace period.
+*/
+func CollectUploads(ctx context.Context, db *sql.DB, opts Options) (Report, error) {
+	var report Report
+
+	referenced, err := repositories.GetReferencedMedia(ctx, db)
+	if err != nil {
+		return report, fmt.Errorf("failed to load referenced media: %w", err)
+	}
+
+	// Stored URLs are paths relative to the working directory, so compare by file name
+	names := make(map[string]bool, len(referenced))
+	for url := range referenced {
+		names[filepath.Base(url)] = true
+	}
+
+	entries, err := os.ReadDir(opts.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return report, nil
+		}
+		return report, fmt.Errorf("failed to read %s: %w", opts.Dir, err)
+	}
+
+	cutoff := time.Now().Add(-opts.Grace)
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		report.Scanned++
+
+		if names[entry.Name()] {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			slog.Error("Failed to stat upload", "file", entry.Name(), "err", err)
+			continue
+		}
+		if info.ModTime().After(cutoff) {
+			report.Kept++
+			continue
+		}
+
+		path := filepath.Join(opts.Dir, entry.Name())
+		if !opts.DryRun {
+			if err := os.Remove(path); err != nil {
+				slog.Error("Failed to remove orphaned upload", "path", path, "err", err)
+				continue
+			}
+		}
+		report.Orphans = append(report.Orphans, path)
+		report.ReclaimedBytes += info.Size()
+	}
+
+	return report, nil
+}
+
+// FormatBytes renders a byte count in a human readable unit.
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,122 @@
+package janitor
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// setupTestDB initializes a temporary SQLite database referencing a few uploads
+func setupTestDB(t *testing.T) *sql.DB {
+	tempDBFile := filepath.Join(t.TempDir(), "test_janitor.db")
+	db, err := sql.Open("sqlite3", tempDBFile)
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE tblPosts (
+			id INTEGER PRIMARY KEY,
+			post_status TEXT DEFAULT 'visible',
+			media_url TEXT DEFAULT ''
+		);
+
+		CREATE TABLE tblAttachments (
+			id INTEGER PRIMARY KEY,
+			post_id INTEGER NOT NULL,
+			file_url TEXT NOT NULL
+		);
+
+		INSERT INTO tblPosts (id, post_status, media_url) VALUES
+			(1, 'visible', 'uploads/legacy.png'),
+			(2, 'visible', ''),
+			(3, 'Deleted', '');
+
+		INSERT INTO tblAttachments (post_id, file_url) VALUES
+			(2, 'uploads/kept.jpg'),
+			(3, 'uploads/deleted-post.jpg');
+	`)
+	if err != nil {
+		t.Fatalf("Failed to set up test data: %v", err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// writeUpload creates a file in dir with the given age
+func writeUpload(t *testing.T, dir, name string, age time.Duration) {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("image-bytes"), 0o644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	modTime := time.Now().Add(-age)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Failed to set times on %s: %v", name, err)
+	}
+}
+
+func TestCollectUploads(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+
+	writeUpload(t, dir, "legacy.png", 48*time.Hour)
+	writeUpload(t, dir, "kept.jpg", 48*time.Hour)
+	writeUpload(t, dir, "deleted-post.jpg", 48*time.Hour)
+	writeUpload(t, dir, "orphan.gif", 48*time.Hour)
+	writeUpload(t, dir, "in-flight.png", time.Minute)
+
+	opts := Options{Dir: dir, Grace: time.Hour, DryRun: true}
+
+	report, err := CollectUploads(context.Background(), db, opts)
+	if err != nil {
+		t.Fatalf("CollectUploads failed: %v", err)
+	}
+	if report.Scanned != 5 || len(report.Orphans) != 2 || report.Kept != 1 {
+		t.Fatalf("Unexpected dry run report: %+v", report)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "orphan.gif")); err != nil {
+		t.Fatalf("Dry run removed a file: %v", err)
+	}
+
+	opts.DryRun = false
+	report, err = CollectUploads(context.Background(), db, opts)
+	if err != nil {
+		t.Fatalf("CollectUploads failed: %v", err)
+	}
+	if report.ReclaimedBytes != int64(2*len("image-bytes")) {
+		t.Errorf("Expected %d reclaimed bytes, got %d", 2*len("image-bytes"), report.ReclaimedBytes)
+	}
+
+	for name, shouldExist := range map[string]bool{
+		"legacy.png":       true,
+		"kept.jpg":         true,
+		"in-flight.png":    true,
+		"deleted-post.jpg": false,
+		"orphan.gif":       false,
+	} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if exists := err == nil; exists != shouldExist {
+			t.Errorf("File %s: expected exists=%v, got %v", name, shouldExist, exists)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[int64]string{
+		512:       "512 B",
+		2048:      "2.0 KB",
+		5 << 20:   "5.0 MB",
+		3<<30 + 1: "3.0 GB",
+	}
+	for n, expected := range tests {
+		if got := FormatBytes(n); got != expected {
+			t.Errorf("FormatBytes(%d) = %q, want %q", n, got, expected)
+		}
+	}
+}
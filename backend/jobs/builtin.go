@@ -0,0 +1,104 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/jesee-kuya/forum/backend/janitor"
+	"github.com/jesee-kuya/forum/backend/mailer"
+	"github.com/jesee-kuya/forum/backend/repositories"
+)
+
+// Job types run on a schedule by every forum instance.
+const (
+	TypeSessionCleanup = "session_cleanup"
+	TypeUploadGC       = "upload_gc"
+	TypeJobCleanup     = "job_cleanup"
+	TypeAuthCleanup    = "auth_cleanup"
+	TypeSendEmail      = "send_email"
+	TypeDigest         = "digest"
+)
+
+// Builtins configures the housekeeping jobs registered by RegisterBuiltins.
+type Builtins struct {
+	UploadDir string
+	// Mailer delivers the emails queued with SendEmail. Messages are only logged when it is nil.
+	Mailer mailer.Mailer
+	// Digest is the schedule of the digest emails, which are not sent when it is empty.
+	Digest string
+	// BaseURL is the address of the forum the digest emails link to.
+	BaseURL string
+}
+
+// SendEmail queues an email to be delivered by a worker, retrying if the mail server is unavailable. The message is erased from the queue once it is sent.
+func SendEmail(ctx context.Context, db *sql.DB, msg mailer.Message) error {
+	_, err := Enqueue(ctx, db, TypeSendEmail, msg)
+	return err
+}
+
+// RegisterBuiltins registers the housekeeping jobs and their schedules.
+func RegisterBuiltins(r *Runner, db *sql.DB, opts Builtins) error {
+	r.Register(TypeSessionCleanup, func(ctx context.Context, _ []byte) error {
+		tokens, err := repositories.DeleteExpiredSessions(ctx, db)
+		if err != nil {
+			return err
+		}
+		if len(tokens) > 0 {
+			slog.InfoContext(ctx, "Removed expired sessions", "count", len(tokens))
+		}
+		return nil
+	})
+
+	r.Register(TypeUploadGC, func(ctx context.Context, _ []byte) error {
+		report, err := janitor.CollectUploads(ctx, db, janitor.Options{Dir: opts.UploadDir, Grace: 24 * time.Hour})
+		if err != nil {
+			return err
+		}
+		if len(report.Orphans) > 0 {
+			slog.InfoContext(ctx, "Upload garbage collection", "report", report)
+		}
+		return nil
+	})
+
+	r.Register(TypeJobCleanup, func(ctx context.Context, _ []byte) error {
+		_, err := repositories.DeleteFinishedJobs(ctx, db, time.Now().Add(-7*24*time.Hour))
+		return err
+	})
+
+	r.Register(TypeAuthCleanup, func(ctx context.Context, _ []byte) error {
+		if _, err := repositories.DeleteLoginAttempts(ctx, db, time.Now().Add(-24*time.Hour)); err != nil {
+			return err
+		}
+		_, err := repositories.DeleteExpiredUserTokens(ctx, db, time.Now().Add(-7*24*time.Hour))
+		return err
+	})
+
+	r.Register(TypeDigest, func(ctx context.Context, _ []byte) error {
+		return SendDigests(ctx, db, opts.BaseURL)
+	})
+
+	mail := opts.Mailer
+	if mail == nil {
+		mail = mailer.LogMailer{}
+	}
+	// Emails carry the links of password resets, unlocks and address confirmations
+	r.RegisterSensitive(TypeSendEmail, Typed(mail.Send))
+
+	schedules := map[string]string{
+		TypeSessionCleanup: "*/15 * * * *",
+		TypeUploadGC:       "@hourly",
+		TypeJobCleanup:     "@daily",
+		TypeAuthCleanup:    "@daily",
+	}
+	if opts.Digest != "" {
+		schedules[TypeDigest] = opts.Digest
+	}
+	for jobType, spec := range schedules {
+		if err := r.Schedule(spec, jobType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
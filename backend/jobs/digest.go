@@ -0,0 +1,70 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/jesee-kuya/forum/backend/mailer"
+	"github.com/jesee-kuya/forum/backend/repositories"
+)
+
+// DigestPostLimit bounds the posts listed in one digest email.
+const DigestPostLimit = 20
+
+/*
+SendDigests queues a digest email to every subscriber for whom others posted since their last digest, listing the newest of those posts with links to the forum at baseURL. A subscriber's next digest starts where this one ends, so no post is listed twice.
+*/
+func SendDigests(ctx context.Context, db *sql.DB, baseURL string) error {
+	// Posts are timed to the second, so a digest ends before the current second, whose posts may still be coming
+	until := time.Now().Truncate(time.Second).Add(-time.Second)
+	subscribers, err := repositories.DigestSubscribers(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	sent := 0
+	for _, s := range subscribers {
+		posts, err := repositories.DigestPosts(ctx, db, s.Since, until, s.ID, DigestPostLimit+1)
+		if err != nil {
+			return err
+		}
+		if len(posts) > 0 {
+			if err := SendEmail(ctx, db, digestMessage(s, posts, baseURL)); err != nil {
+				return err
+			}
+			sent++
+		}
+		if err := repositories.MarkDigestSent(ctx, db, s.ID, until); err != nil {
+			return err
+		}
+	}
+	if sent > 0 {
+		slog.InfoContext(ctx, "Queued digest emails", "count", sent)
+	}
+	return nil
+}
+
+// digestMessage lists posts for a subscriber. posts holds one more post than is listed when there were more.
+func digestMessage(s repositories.DigestSubscriber, posts []repositories.DigestPost, baseURL string) mailer.Message {
+	var list strings.Builder
+	for i, p := range posts {
+		if i == DigestPostLimit {
+			list.WriteString("- and more\n")
+			break
+		}
+		fmt.Fprintf(&list, "- %q by %s\n", p.Title, p.Username)
+	}
+
+	return mailer.Message{
+		To:      s.Email,
+		Subject: "New on the forum",
+		Body: fmt.Sprintf("Hi %s,\n\nHere is what was posted on the forum since your last digest:\n\n%s\n"+
+			"Read and join the discussions at %s/home\n\n"+
+			"You get this email because you subscribed to the digest. You can unsubscribe from your account settings at %s/settings\n",
+			s.Username, list.String(), baseURL, baseURL),
+	}
+}
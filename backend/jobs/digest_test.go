@@ -0,0 +1,152 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jesee-kuya/forum/backend/mailer"
+	"github.com/jesee-kuya/forum/backend/repositories"
+)
+
+// setupForumDB creates a temporary database with the forum's schema.
+func setupForumDB(t *testing.T) *sql.DB {
+	schema, err := os.ReadFile(filepath.Join("..", "database", "schema.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "forum.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec(string(schema)); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+	return db
+}
+
+// queuedEmails returns the emails queued with SendEmail.
+func queuedEmails(t *testing.T, db *sql.DB) []mailer.Message {
+	rows, err := db.Query("SELECT payload FROM tblJobs WHERE job_type = ? ORDER BY id", TypeSendEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var messages []mailer.Message
+	for rows.Next() {
+		var payload string
+		var msg mailer.Message
+		if err := rows.Scan(&payload); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+func TestSendDigests(t *testing.T) {
+	db := setupForumDB(t)
+	ctx := context.Background()
+	weekAgo := time.Now().Add(-7 * 24 * time.Hour).UTC()
+
+	// alice and bob are subscribed; carol has not confirmed her address and dave is not subscribed
+	_, err := db.Exec(`INSERT INTO tblUsers (id, username, email, email_verified, user_digest_since) VALUES
+		(1, 'alice', 'alice@example.com', 1, ?),
+		(2, 'bob', 'bob@example.com', 1, ?),
+		(3, 'carol', 'carol@example.com', 0, ?),
+		(4, 'dave', 'dave@example.com', 1, NULL)`, weekAgo, weekAgo, weekAgo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`INSERT INTO tblPosts (id, user_id, post_title, body, parent_id, created_on, post_status) VALUES
+		(1, 1, 'Old news', 'x', NULL, ?, 'visible'),
+		(2, 4, 'Gardening tips', 'x', NULL, ?, 'visible'),
+		(3, 1, 'Alice asks', 'x', NULL, ?, 'visible'),
+		(4, 4, '', 'a comment', 2, ?, 'visible'),
+		(5, 4, 'Removed', 'x', NULL, ?, 'deleted')`,
+		weekAgo.Add(-time.Hour), weekAgo.Add(time.Hour), weekAgo.Add(2*time.Hour), weekAgo.Add(3*time.Hour), weekAgo.Add(4*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SendDigests(ctx, db, "https://forum.example"); err != nil {
+		t.Fatalf("SendDigests failed: %v", err)
+	}
+
+	emails := queuedEmails(t, db)
+	if len(emails) != 2 {
+		t.Fatalf("Expected a digest for alice and bob, got %+v", emails)
+	}
+	alice, bob := emails[0], emails[1]
+	if alice.To != "alice@example.com" || !strings.Contains(alice.Body, `"Gardening tips" by dave`) || strings.Contains(alice.Body, "Alice asks") {
+		t.Errorf("Expected alice's digest to list the posts of others only, got %+v", alice)
+	}
+	if bob.To != "bob@example.com" || !strings.Contains(bob.Body, `"Alice asks" by alice`) || !strings.Contains(bob.Body, "https://forum.example/settings") {
+		t.Errorf("Unexpected digest for bob: %+v", bob)
+	}
+	for _, left := range []string{"Old news", "a comment", "Removed"} {
+		if strings.Contains(alice.Body+bob.Body, left) {
+			t.Errorf("Expected %q to be left out of the digests", left)
+		}
+	}
+
+	// The next digest starts where this one ended
+	if err := SendDigests(ctx, db, "https://forum.example"); err != nil {
+		t.Fatalf("SendDigests failed: %v", err)
+	}
+	if got := len(queuedEmails(t, db)); got != 2 {
+		t.Errorf("Expected no new digest without new posts, got %d emails", got)
+	}
+
+	// Unsubscribing stops them
+	if err := repositories.SetUserDigest(ctx, db, 1, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("UPDATE tblUsers SET user_digest_since = ? WHERE user_digest_since IS NOT NULL", time.Now().Add(-time.Hour).UTC()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO tblPosts (user_id, post_title, body, created_on) VALUES (4, 'Fresh', 'x', ?)", time.Now().Add(-time.Minute).UTC()); err != nil {
+		t.Fatal(err)
+	}
+	if err := SendDigests(ctx, db, "https://forum.example"); err != nil {
+		t.Fatalf("SendDigests failed: %v", err)
+	}
+	emails = queuedEmails(t, db)
+	if len(emails) != 3 || emails[2].To != "bob@example.com" {
+		t.Errorf("Expected only bob to get the new post, got %+v", emails[2:])
+	}
+}
+
+func TestDigestIsScheduledWhenConfigured(t *testing.T) {
+	scheduled := func(opts Builtins) bool {
+		r := NewRunner(setupTestDB(t), 1)
+		if err := RegisterBuiltins(r, nil, opts); err != nil {
+			t.Fatalf("RegisterBuiltins failed: %v", err)
+		}
+		for _, s := range r.schedules {
+			if s.jobType == TypeDigest {
+				return true
+			}
+		}
+		return false
+	}
+
+	if scheduled(Builtins{}) {
+		t.Error("Expected no digest without a schedule")
+	}
+	if !scheduled(Builtins{Digest: "@weekly", BaseURL: "https://forum.example"}) {
+		t.Error("Expected the digest to be scheduled")
+	}
+	if err := RegisterBuiltins(NewRunner(setupTestDB(t), 1), nil, Builtins{Digest: "sometimes"}); err == nil {
+		t.Error("Expected an error for an invalid digest schedule")
+	}
+}
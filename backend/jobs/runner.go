@@ -0,0 +1,299 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/jesee-kuya/forum/backend/models"
+	"github.com/jesee-kuya/forum/backend/repositories"
+	"github.com/jesee-kuya/forum/backend/tracing"
+)
+
+// Handler runs a single job. Returning an error retries the job with exponential backoff.
+type Handler func(ctx context.Context, payload []byte) error
+
+// Typed adapts a function taking a decoded JSON payload into a Handler.
+func Typed[T any](fn func(ctx context.Context, payload T) error) Handler {
+	return func(ctx context.Context, raw []byte) error {
+		var payload T
+		if err := json.Unmarshal(raw, &payload); err != nil {
+			return fmt.Errorf("invalid payload: %w", err)
+		}
+		return fn(ctx, payload)
+	}
+}
+
+const (
+	DefaultMaxAttempts = 5
+	baseBackoff        = 30 * time.Second
+	maxBackoff         = time.Hour
+)
+
+// Backoff returns how long to wait before retrying a job that failed on the given attempt.
+func Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	d := baseBackoff << (attempt - 1)
+	if d <= 0 || d > maxBackoff {
+		return maxBackoff
+	}
+	return d
+}
+
+// Enqueue stores a job to be run as soon as a worker is free.
+func Enqueue(ctx context.Context, db *sql.DB, jobType string, payload any) (int64, error) {
+	return EnqueueAt(ctx, db, jobType, payload, time.Now())
+}
+
+// EnqueueAt stores a job to be run no earlier than runAt.
+func EnqueueAt(ctx context.Context, db *sql.DB, jobType string, payload any, runAt time.Time) (int64, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode %s payload: %w", jobType, err)
+	}
+	return repositories.InsertJob(ctx, db, jobType, string(data), DefaultMaxAttempts, runAt)
+}
+
+type scheduledJob struct {
+	jobType  string
+	schedule Schedule
+	next     time.Time
+}
+
+// Runner executes jobs stored in tblJobs with a fixed pool of workers.
+type Runner struct {
+	db           *sql.DB
+	workers      int
+	handlers     map[string]Handler
+	sensitive    map[string]bool
+	schedules    []*scheduledJob
+	PollInterval time.Duration
+	Backoff      func(attempt int) time.Duration
+
+	wg        sync.WaitGroup
+	stop      context.CancelFunc
+	jobCtx    context.Context
+	cancelJob context.CancelFunc
+}
+
+// NewRunner creates a runner with the given number of workers.
+func NewRunner(db *sql.DB, workers int) *Runner {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Runner{
+		db:           db,
+		workers:      workers,
+		handlers:     make(map[string]Handler),
+		sensitive:    make(map[string]bool),
+		PollInterval: time.Second,
+		Backoff:      Backoff,
+	}
+}
+
+// Register sets the handler for a job type.
+func (r *Runner) Register(jobType string, handler Handler) {
+	r.handlers[jobType] = handler
+}
+
+/*
+RegisterSensitive sets the handler for a job type whose payloads hold secrets, such as the links of emails. Their payload is erased once the job is done or has failed for good, rather than kept in tblJobs until finished jobs are deleted.
+*/
+func (r *Runner) RegisterSensitive(jobType string, handler Handler) {
+	r.Register(jobType, handler)
+	r.sensitive[jobType] = true
+}
+
+// Schedule enqueues a job of the given type whenever the schedule spec is due.
+func (r *Runner) Schedule(spec, jobType string) error {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return err
+	}
+	r.schedules = append(r.schedules, &scheduledJob{jobType: jobType, schedule: schedule})
+	return nil
+}
+
+// Start launches the workers and the scheduler. They keep running until Shutdown is called or ctx is cancelled.
+func (r *Runner) Start(ctx context.Context) {
+	if n, err := repositories.ResetRunningJobs(ctx, r.db); err != nil {
+		slog.ErrorContext(ctx, "Failed to requeue interrupted jobs", "err", err)
+	} else if n > 0 {
+		slog.Info("Requeued interrupted jobs", "count", n)
+	}
+
+	ctx, r.stop = context.WithCancel(ctx)
+	r.jobCtx, r.cancelJob = context.WithCancel(context.Background())
+
+	for i := 0; i < r.workers; i++ {
+		r.wg.Add(1)
+		go r.work(ctx)
+	}
+
+	r.wg.Add(1)
+	go r.runSchedules(ctx)
+}
+
+/*
+Shutdown stops picking up new jobs and waits for running ones to finish. If ctx expires first, running jobs are cancelled and the context error is returned at once, without waiting for them; a job that has not recorded its outcome by then stays claimed and is requeued on the next Start.
+*/
+func (r *Runner) Shutdown(ctx context.Context) error {
+	if r.stop == nil {
+		return nil
+	}
+	r.stop()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		r.cancelJob()
+		return nil
+	case <-ctx.Done():
+		r.cancelJob()
+		return ctx.Err()
+	}
+}
+
+// work claims and runs due jobs until ctx is cancelled.
+func (r *Runner) work(ctx context.Context) {
+	defer r.wg.Done()
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		job, err := repositories.ClaimJob(ctx, r.db, time.Now())
+		if err == nil {
+			r.run(job)
+			continue
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "Failed to claim job", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.PollInterval):
+		}
+	}
+}
+
+/*
+run executes a claimed job in a span of its own and records the outcome. The outcome is recorded even when running jobs were cancelled by Shutdown, so the job is retried on the next start.
+*/
+func (r *Runner) run(job models.Job) {
+	ctx, span := tracing.Tracer().Start(context.Background(), "job "+job.JobType, trace.WithAttributes(
+		attribute.Int("job.id", job.ID),
+		attribute.Int("job.attempt", job.Attempts),
+	))
+	defer span.End()
+
+	handler, ok := r.handlers[job.JobType]
+	if !ok {
+		slog.ErrorContext(ctx, "No handler registered for job", "job_id", job.ID, "job_type", job.JobType)
+		if err := repositories.FailJob(ctx, r.db, job.ID, "no handler registered"); err != nil {
+			slog.ErrorContext(ctx, "Failed to record job outcome", "job_id", job.ID, "err", err)
+		}
+		return
+	}
+
+	err := call(trace.ContextWithSpan(r.jobCtx, span), handler, []byte(job.Payload))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	if err == nil {
+		if err := repositories.CompleteJob(ctx, r.db, job.ID); err != nil {
+			slog.ErrorContext(ctx, "Failed to record job outcome", "job_id", job.ID, "err", err)
+		}
+		r.clearPayload(ctx, job)
+		return
+	}
+
+	if job.Attempts >= job.MaxAttempts {
+		slog.ErrorContext(ctx, "Job failed permanently", "job_id", job.ID, "job_type", job.JobType, "attempts", job.Attempts, "err", err)
+		if err := repositories.FailJob(ctx, r.db, job.ID, err.Error()); err != nil {
+			slog.ErrorContext(ctx, "Failed to record job outcome", "job_id", job.ID, "err", err)
+		}
+		r.clearPayload(ctx, job)
+		return
+	}
+
+	delay := r.Backoff(job.Attempts)
+	slog.WarnContext(ctx, "Job failed, retrying", "job_id", job.ID, "job_type", job.JobType, "attempt", job.Attempts, "delay", delay, "err", err)
+	if err := repositories.RetryJob(ctx, r.db, job.ID, err.Error(), time.Now().Add(delay)); err != nil {
+		slog.ErrorContext(ctx, "Failed to record job outcome", "job_id", job.ID, "err", err)
+	}
+}
+
+// clearPayload erases the payload of a finished job registered with RegisterSensitive.
+func (r *Runner) clearPayload(ctx context.Context, job models.Job) {
+	if !r.sensitive[job.JobType] {
+		return
+	}
+	if err := repositories.ClearJobPayload(ctx, r.db, job.ID); err != nil {
+		slog.ErrorContext(ctx, "Failed to clear job payload", "job_id", job.ID, "err", err)
+	}
+}
+
+// call runs a handler, turning a panic into an error so one bad job cannot take down a worker.
+func call(ctx context.Context, handler Handler, payload []byte) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+	}()
+	return handler(ctx, payload)
+}
+
+// runSchedules enqueues scheduled jobs as they fall due.
+func (r *Runner) runSchedules(ctx context.Context) {
+	defer r.wg.Done()
+
+	if len(r.schedules) == 0 {
+		return
+	}
+
+	now := time.Now()
+	for _, s := range r.schedules {
+		s.next = s.schedule.Next(now)
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, s := range r.schedules {
+				if s.next.IsZero() || now.Before(s.next) {
+					continue
+				}
+				if _, err := Enqueue(ctx, r.db, s.jobType, struct{}{}); err != nil {
+					slog.ErrorContext(ctx, "Failed to enqueue scheduled job", "job_type", s.jobType, "err", err)
+				}
+				s.next = s.schedule.Next(now)
+			}
+		}
+	}
+}
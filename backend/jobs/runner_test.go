@@ -0,0 +1,259 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// setupTestDB initializes a temporary SQLite database with the jobs table
+func setupTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test_jobs.db")+"?_busy_timeout=5000")
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE tblJobs (
+			id INTEGER PRIMARY KEY,
+			job_type TEXT NOT NULL,
+			payload TEXT NOT NULL DEFAULT '{}',
+			job_status TEXT NOT NULL DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			max_attempts INTEGER NOT NULL DEFAULT 5,
+			run_at TIMESTAMP NOT NULL,
+			last_error TEXT NOT NULL DEFAULT '',
+			created_on TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_on TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create test table: %v", err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// waitForStatus polls a job until it reaches the expected status
+func waitForStatus(t *testing.T, db *sql.DB, id int64, expected string) (attempts int, lastError string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		var status string
+		err := db.QueryRow("SELECT job_status, attempts, last_error FROM tblJobs WHERE id = ?", id).Scan(&status, &attempts, &lastError)
+		if err != nil {
+			t.Fatalf("Failed to query job: %v", err)
+		}
+		if status == expected {
+			return attempts, lastError
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Job %d never reached status %q", id, expected)
+	return 0, ""
+}
+
+func newTestRunner(db *sql.DB) *Runner {
+	runner := NewRunner(db, 2)
+	runner.PollInterval = 10 * time.Millisecond
+	runner.Backoff = func(int) time.Duration { return 0 }
+	return runner
+}
+
+func TestRunner_RetriesUntilSuccess(t *testing.T) {
+	db := setupTestDB(t)
+	runner := newTestRunner(db)
+
+	type greeting struct {
+		Name string `json:"name"`
+	}
+	var calls atomic.Int32
+	var received atomic.Value
+	runner.Register("greet", Typed(func(ctx context.Context, payload greeting) error {
+		received.Store(payload.Name)
+		if calls.Add(1) < 3 {
+			return errors.New("temporary failure")
+		}
+		return nil
+	}))
+
+	id, err := Enqueue(context.Background(), db, "greet", greeting{Name: "forum"})
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	runner.Start(context.Background())
+	defer runner.Shutdown(context.Background())
+
+	attempts, _ := waitForStatus(t, db, id, "done")
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+	if received.Load() != "forum" {
+		t.Errorf("Expected payload name %q, got %v", "forum", received.Load())
+	}
+}
+
+func TestRunner_FailsAfterMaxAttempts(t *testing.T) {
+	db := setupTestDB(t)
+	runner := newTestRunner(db)
+	runner.Register("broken", func(ctx context.Context, payload []byte) error {
+		panic("boom")
+	})
+
+	id, err := Enqueue(context.Background(), db, "broken", nil)
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	runner.Start(context.Background())
+	defer runner.Shutdown(context.Background())
+
+	attempts, lastError := waitForStatus(t, db, id, "failed")
+	if attempts != DefaultMaxAttempts {
+		t.Errorf("Expected %d attempts, got %d", DefaultMaxAttempts, attempts)
+	}
+	if lastError != "job panicked: boom" {
+		t.Errorf("Unexpected last error: %q", lastError)
+	}
+}
+
+func TestRunner_ClearsSensitivePayloads(t *testing.T) {
+	db := setupTestDB(t)
+	runner := newTestRunner(db)
+	runner.RegisterSensitive("send", func(ctx context.Context, payload []byte) error { return nil })
+	runner.RegisterSensitive("bounce", func(ctx context.Context, payload []byte) error { return errors.New("rejected") })
+	runner.Register("keep", func(ctx context.Context, payload []byte) error { return nil })
+
+	ids := make(map[string]int64)
+	for _, jobType := range []string{"send", "bounce", "keep"} {
+		id, err := Enqueue(context.Background(), db, jobType, map[string]string{"link": "https://forum.example/reset?token=secret"})
+		if err != nil {
+			t.Fatalf("Enqueue failed: %v", err)
+		}
+		ids[jobType] = id
+	}
+
+	runner.Start(context.Background())
+	defer runner.Shutdown(context.Background())
+
+	waitForStatus(t, db, ids["send"], "done")
+	waitForStatus(t, db, ids["bounce"], "failed")
+	waitForStatus(t, db, ids["keep"], "done")
+	runner.Shutdown(context.Background())
+
+	for jobType, want := range map[string]bool{"send": true, "bounce": true, "keep": false} {
+		var payload string
+		if err := db.QueryRow("SELECT payload FROM tblJobs WHERE id = ?", ids[jobType]).Scan(&payload); err != nil {
+			t.Fatalf("Failed to query job: %v", err)
+		}
+		if cleared := payload == "{}"; cleared != want {
+			t.Errorf("%s: payload %q, want it cleared: %v", jobType, payload, want)
+		}
+	}
+}
+
+func TestRunner_DelayedJobWaits(t *testing.T) {
+	db := setupTestDB(t)
+	runner := newTestRunner(db)
+
+	var ran atomic.Bool
+	runner.Register("later", func(ctx context.Context, payload []byte) error {
+		ran.Store(true)
+		return nil
+	})
+
+	if _, err := EnqueueAt(context.Background(), db, "later", nil, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("EnqueueAt failed: %v", err)
+	}
+
+	runner.Start(context.Background())
+	time.Sleep(100 * time.Millisecond)
+	runner.Shutdown(context.Background())
+
+	if ran.Load() {
+		t.Error("Job scheduled for later ran immediately")
+	}
+}
+
+func TestRunner_ShutdownDrainsRunningJobs(t *testing.T) {
+	db := setupTestDB(t)
+	runner := newTestRunner(db)
+
+	started := make(chan struct{})
+	runner.Register("slow", func(ctx context.Context, payload []byte) error {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		return nil
+	})
+
+	id, err := Enqueue(context.Background(), db, "slow", nil)
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	runner.Start(context.Background())
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := runner.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	waitForStatus(t, db, id, "done")
+}
+
+func TestRunner_ShutdownGivesUpAtDeadline(t *testing.T) {
+	db := setupTestDB(t)
+	runner := newTestRunner(db)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	runner.Register("stuck", func(ctx context.Context, payload []byte) error {
+		close(started)
+		<-release // ignores its context
+		return nil
+	})
+
+	id, err := Enqueue(context.Background(), db, "stuck", nil)
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	runner.Start(context.Background())
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	begun := time.Now()
+	if err := runner.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown = %v, want the deadline error", err)
+	}
+	if waited := time.Since(begun); waited > time.Second {
+		t.Errorf("Shutdown waited %v for a job that ignores cancellation", waited)
+	}
+
+	close(release)
+	waitForStatus(t, db, id, "done")
+}
+
+func TestBackoff(t *testing.T) {
+	tests := map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		4:  4 * time.Minute,
+		8:  time.Hour,
+		80: time.Hour,
+	}
+	for attempt, expected := range tests {
+		if got := Backoff(attempt); got != expected {
+			t.Errorf("Backoff(%d) = %v, want %v", attempt, got, expected)
+		}
+	}
+}
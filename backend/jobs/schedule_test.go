@@ -0,0 +1,42 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	base := time.Date(2025, 3, 14, 10, 7, 30, 0, time.UTC)
+
+	tests := []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"@every 90s", base.Add(90 * time.Second)},
+		{"*/15 * * * *", time.Date(2025, 3, 14, 10, 15, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2025, 3, 14, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{"30 2 * * 1-5", time.Date(2025, 3, 17, 2, 30, 0, 0, time.UTC)},
+		{"0,45 10 14 3 *", time.Date(2025, 3, 14, 10, 45, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.spec, func(t *testing.T) {
+			schedule, err := ParseSchedule(tc.spec)
+			if err != nil {
+				t.Fatalf("ParseSchedule(%q) failed: %v", tc.spec, err)
+			}
+			if got := schedule.Next(base); !got.Equal(tc.expected) {
+				t.Errorf("Next() = %v, want %v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestParseSchedule_Invalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "@every", "@every 10ms", "a b c d e"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q) expected an error", spec)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+/*
+Package logging sets up the forum's structured logs: the level and format configured, the request ID of every record logged while serving a request, and the redaction of secrets.
+*/
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/jesee-kuya/forum/backend/config"
+)
+
+// Redacted replaces the value of attributes that hold secrets.
+const Redacted = "[REDACTED]"
+
+/*
+sensitiveWords mark an attribute as secret when they are a whole word of its key, ignoring case, so "password", "new_password" and "session_token" are all covered while "code" and "session_count" are not. Every record goes through this list, which keeps secrets out of the logs whatever the call site.
+*/
+var sensitiveWords = map[string]bool{
+	"password": true, "passwd": true, "secret": true, "token": true, "cookie": true,
+	"authorization": true, "otp": true, "credential": true, "credentials": true, "signature": true,
+}
+
+// sensitiveKeys are whole keys holding secrets whose words are harmless on their own, such as "code".
+var sensitiveKeys = map[string]bool{"recovery_code": true, "totp_code": true, "session_id": true}
+
+/*
+secretParams matches the value of query parameters carrying secrets in links, such as the token of a password reset link, in any logged text: emails written by the log mailer and errors quoting a URL alike.
+*/
+var secretParams = regexp.MustCompile(`(?i)([?&](?:[a-z_]*token|signature|code|code_verifier|state|client_secret|password)=)[^&\s"'<>]+`)
+
+// New returns a logger writing to w at the level and in the format of cfg.
+func New(w io.Writer, cfg config.Log) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", cfg.Level, err)
+	}
+
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redact}
+	var handler slog.Handler
+	switch cfg.Format {
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q", cfg.Format)
+	}
+	return slog.New(contextHandler{handler}), nil
+}
+
+/*
+Setup makes a logger writing to standard error, as configured by cfg, the default logger. Lines written through the log package, by the standard library and dependencies, go through it as well, at the info level.
+*/
+func Setup(cfg config.Log) error {
+	logger, err := New(os.Stderr, cfg)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
+}
+
+// ErrorLog returns a log.Logger writing errors to the default logger, for http.Server.ErrorLog.
+func ErrorLog() *log.Logger {
+	return slog.NewLogLogger(slog.Default().Handler(), slog.LevelError)
+}
+
+// redact replaces the value of attributes whose key names a secret, and the secrets of links in the others.
+func redact(groups []string, attr slog.Attr) slog.Attr {
+	if attr.Value.Kind() == slog.KindGroup {
+		return attr
+	}
+	if sensitive(attr.Key) {
+		return slog.String(attr.Key, Redacted)
+	}
+
+	var text string
+	switch value := attr.Value.Any().(type) {
+	case string:
+		text = value
+	case error:
+		text = value.Error()
+	default:
+		return attr
+	}
+	if scrubbed := secretParams.ReplaceAllString(text, "${1}"+Redacted); scrubbed != text {
+		return slog.String(attr.Key, scrubbed)
+	}
+	return attr
+}
+
+// sensitive reports whether key is one of sensitiveKeys or has one of sensitiveWords as a word, words being separated by anything but letters and digits.
+func sensitive(key string) bool {
+	key = strings.ToLower(key)
+	if sensitiveKeys[key] {
+		return true
+	}
+	words := strings.FieldsFunc(key, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		if sensitiveWords[word] {
+			return true
+		}
+	}
+	return false
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the ID of the request being served.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the ID of the request served with ctx, or "" outside of a request.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// contextHandler adds the request ID and the trace carried by the context to every record logged with one.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		record.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,156 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/jesee-kuya/forum/backend/config"
+)
+
+func TestRedactsSecrets(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, config.Log{Level: "info", Format: "json"})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	logger.Info("Signing in",
+		"email", "ada@example.com",
+		"password", "hunter2",
+		"new_password", "hunter3",
+		"session_token", "abc123",
+		slog.Group("form", "recovery_code", "1234-5678"),
+		"Authorization", "Bearer xyz",
+	)
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Expected a JSON record, got %q: %v", buf.String(), err)
+	}
+	for _, secret := range []string{"hunter2", "hunter3", "abc123", "1234-5678", "xyz"} {
+		if strings.Contains(buf.String(), secret) {
+			t.Errorf("Expected %q to be redacted from %s", secret, buf.String())
+		}
+	}
+	if record["email"] != "ada@example.com" {
+		t.Errorf("Expected the email to be logged, got %v", record["email"])
+	}
+	if record["password"] != Redacted {
+		t.Errorf("Expected the password to read %q, got %v", Redacted, record["password"])
+	}
+}
+
+func TestKeepsHarmlessKeys(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, config.Log{Level: "info", Format: "json"})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	logger.Info("Request failed", "code", "not_found", "session_count", 3, "tokenizer", "words")
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Expected a JSON record, got %q: %v", buf.String(), err)
+	}
+	if record["code"] != "not_found" || record["session_count"] != float64(3) || record["tokenizer"] != "words" {
+		t.Errorf("Expected keys that only contain a sensitive word to be logged, got %s", buf.String())
+	}
+}
+
+func TestRedactsLinkSecrets(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, config.Log{Level: "info", Format: "text"})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	logger.Info("Email",
+		"body", "Open this link:\n\nhttp://localhost:9000/reset-password?token=live-token\n",
+		"link", "http://localhost:9000/verify-email?email=ada%40example.com&expires=1&signature=live-signature&user=1",
+		"err", errors.New(`Post "https://idp.example/token?code=live-code&state=live-state": timeout`),
+	)
+
+	for _, secret := range []string{"live-token", "live-signature", "live-code", "live-state"} {
+		if strings.Contains(buf.String(), secret) {
+			t.Errorf("Expected %q to be redacted from %s", secret, buf.String())
+		}
+	}
+	for _, kept := range []string{"reset-password?token=" + Redacted, "ada%40example.com", "expires=1", "user=1", "timeout"} {
+		if !strings.Contains(buf.String(), kept) {
+			t.Errorf("Expected %q in %s", kept, buf.String())
+		}
+	}
+}
+
+func TestRequestIDIsAdded(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, config.Log{Level: "info", Format: "text"})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	logger.InfoContext(WithRequestID(context.Background(), "req-1"), "Served")
+	logger.With("user_id", 7).InfoContext(context.Background(), "Outside a request")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %q", buf.String())
+	}
+	if !strings.Contains(lines[0], "request_id=req-1") {
+		t.Errorf("Expected the request ID in %q", lines[0])
+	}
+	if strings.Contains(lines[1], "request_id") || !strings.Contains(lines[1], "user_id=7") {
+		t.Errorf("Expected only the logger's attributes in %q", lines[1])
+	}
+}
+
+func TestLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, config.Log{Level: "warn", Format: "text"})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	logger.Info("Hidden")
+	logger.Warn("Shown")
+	if strings.Contains(buf.String(), "Hidden") || !strings.Contains(buf.String(), "Shown") {
+		t.Errorf("Expected only warnings and above, got %q", buf.String())
+	}
+
+	if _, err := New(&buf, config.Log{Level: "loud", Format: "text"}); err == nil {
+		t.Error("Expected an unknown level to be rejected")
+	}
+	if _, err := New(&buf, config.Log{Level: "info", Format: "xml"}); err == nil {
+		t.Error("Expected an unknown format to be rejected")
+	}
+}
+
+func TestTraceIsAdded(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, config.Log{Level: "info", Format: "json"})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:  trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+	})
+	logger.InfoContext(trace.ContextWithSpanContext(context.Background(), sc), "Served")
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Expected a JSON record, got %q: %v", buf.String(), err)
+	}
+	if record["trace_id"] != "4bf92f3577b34da6a3ce929d0e0e4736" || record["span_id"] != "00f067aa0ba902b7" {
+		t.Errorf("Expected the trace and span IDs to be logged, got %s", buf.String())
+	}
+}
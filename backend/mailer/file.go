@@ -0,0 +1,35 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var fileCounter atomic.Int64
+
+// FileMailer writes every message to an .eml file in Dir instead of sending it, for local development and tests.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+// Send writes the message to a new file named after the time and recipient.
+func (m FileMailer) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create mail directory: %w", err)
+	}
+
+	now := time.Now()
+	recipient := strings.NewReplacer("@", "_at_", "/", "_", "\\", "_").Replace(msg.To)
+	name := fmt.Sprintf("%s-%d-%s.eml", now.Format("20060102-150405"), fileCounter.Add(1), recipient)
+
+	if err := os.WriteFile(filepath.Join(m.Dir, name), Format(m.From, msg, now), 0o644); err != nil {
+		return fmt.Errorf("failed to write email to %s: %w", msg.To, err)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package mailer
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/jesee-kuya/forum/backend/config"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Mailer delivers email.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogMailer writes messages to the server log instead of sending them, for development. The logger redacts the secrets of the links they hold.
+type LogMailer struct{}
+
+// Send logs the message.
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	slog.InfoContext(ctx, "Email", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
+
+/*
+New picks a mailer from the mail settings: SMTP when an SMTP host is set, .eml files in the mail directory when that is set, and the server log otherwise.
+*/
+func New(c config.Mail) Mailer {
+	if c.SMTPHost != "" {
+		return SMTPMailer{
+			Host:     c.SMTPHost,
+			Port:     c.SMTPPort,
+			Username: c.SMTPUsername,
+			Password: c.SMTPPassword,
+			From:     c.From,
+		}
+	}
+	if c.Dir != "" {
+		return FileMailer{Dir: c.Dir, From: c.From}
+	}
+	return LogMailer{}
+}
@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	msg := Message{To: "alice@example.com", Subject: "Hello", Body: "Line one\nLine two\n"}
+	date := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	got := string(Format("forum@example.com", msg, date))
+	for _, want := range []string{
+		"From: forum@example.com\r\n",
+		"To: alice@example.com\r\n",
+		"Subject: Hello\r\n",
+		"Date: Thu, 02 Jan 2025 03:04:05 +0000\r\n",
+		"\r\n\r\nLine one\r\nLine two\r\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected formatted message to contain %q, got %q", want, got)
+		}
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	m := FileMailer{Dir: dir, From: "forum@example.com"}
+
+	for _, to := range []string{"alice@example.com", "bob@example.com"} {
+		if err := m.Send(context.Background(), Message{To: to, Subject: "Hi", Body: "Welcome"}); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read mail directory: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(entries))
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+	if !strings.Contains(string(data), "Subject: Hi") || !strings.Contains(entries[0].Name(), "alice_at_example.com") {
+		t.Errorf("Unexpected message %s: %q", entries[0].Name(), data)
+	}
+}
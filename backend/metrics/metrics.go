@@ -0,0 +1,116 @@
+/*
+Package metrics collects the forum's Prometheus metrics: requests and their latency per route, database query timings, active sessions, uploaded bytes and sign-ins. They are served by Handler, which the forum mounts on /metrics.
+*/
+package metrics
+
+import (
+	"crypto/subtle"
+	"log"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+/*
+registry holds the metrics of the process: the Go runtime, the process itself, and the requests, queries, uploads and sign-ins counted by the functions of this package whichever forum served them. Metrics of a single forum, such as its active sessions, are added by its Handler.
+*/
+var registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "forum_http_requests_total",
+		Help: "HTTP requests served, by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "forum_http_request_duration_seconds",
+		Help:    "Time taken to serve HTTP requests, by route, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+
+	httpInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "forum_http_requests_in_flight",
+		Help: "HTTP requests being served.",
+	})
+
+	dbDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "forum_db_query_duration_seconds",
+		Help:    "Time taken by database queries, by the function running them.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"query"})
+
+	uploadBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "forum_upload_bytes_total",
+		Help: "Bytes of attachments written to the uploads directory.",
+	})
+
+	logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "forum_logins_total",
+		Help: "Sign-in attempts, by method and result: success or failure.",
+	}, []string{"method", "result"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration, httpInFlight,
+		dbDuration, uploadBytes, logins,
+	)
+}
+
+/*
+Handler serves the metrics in the Prometheus text format, along with the number of active sessions as returned by sessions every time the metrics are scraped. If sessions fails the error is logged and the gauge reads 0.
+
+When token is not empty, scrapes have to send it as a bearer token in the Authorization header; others are answered 401.
+*/
+func Handler(sessions func() (int, error), token string) http.Handler {
+	own := prometheus.NewRegistry()
+	own.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "forum_active_sessions",
+		Help: "Sessions that have not expired.",
+	}, func() float64 {
+		n, err := sessions()
+		if err != nil {
+			slog.Error("Failed to count active sessions", "err", err)
+			return 0
+		}
+		return float64(n)
+	}))
+	metrics := promhttp.HandlerFor(prometheus.Gatherers{registry, own}, promhttp.HandlerOpts{ErrorLog: log.Default()})
+	if token == "" {
+		return metrics
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		metrics.ServeHTTP(w, r)
+	})
+}
+
+// ObserveQuery records that a database query run from the function named by label took d.
+func ObserveQuery(label string, d time.Duration) {
+	dbDuration.WithLabelValues(label).Observe(d.Seconds())
+}
+
+// AddUploadBytes counts n bytes of attachments as written.
+func AddUploadBytes(n int64) {
+	uploadBytes.Add(float64(n))
+}
+
+// Login counts a sign-in attempt made with method, such as "password" or "passkey".
+func Login(method string, succeeded bool) {
+	result := "failure"
+	if succeeded {
+		result = "success"
+	}
+	logins.WithLabelValues(method, result).Inc()
+}
@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInstrument(t *testing.T) {
+	h := Instrument("/test/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			http.Error(w, "nope", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+
+	for _, method := range []string{http.MethodGet, http.MethodGet, http.MethodPost, "BREW"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/test/42", nil))
+	}
+
+	tests := []struct {
+		method, code string
+		want         float64
+	}{
+		{"GET", "200", 2},
+		{"POST", "403", 1},
+		{"other", "200", 1},
+	}
+	for _, tt := range tests {
+		got := testutil.ToFloat64(httpRequests.WithLabelValues("/test/{id}", tt.method, tt.code))
+		if got != tt.want {
+			t.Errorf("Expected %v %s requests answered %s, got %v", tt.want, tt.method, tt.code, got)
+		}
+	}
+	if got := testutil.CollectAndCount(httpDuration, "forum_http_request_duration_seconds"); got < 3 {
+		t.Errorf("Expected a latency series per method and code, got %d", got)
+	}
+	if got := testutil.ToFloat64(httpInFlight); got != 0 {
+		t.Errorf("Expected no requests in flight once served, got %v", got)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	Login("password", true)
+	Login("password", false)
+	Login("password", false)
+
+	if got := testutil.ToFloat64(logins.WithLabelValues("password", "success")); got != 1 {
+		t.Errorf("Expected 1 successful sign-in, got %v", got)
+	}
+	if got := testutil.ToFloat64(logins.WithLabelValues("password", "failure")); got != 2 {
+		t.Errorf("Expected 2 failed sign-ins, got %v", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	AddUploadBytes(1024)
+
+	// Each forum counts its own sessions, so two handlers can be served side by side
+	for _, sessions := range []int{3, 5} {
+		rec := httptest.NewRecorder()
+		Handler(func() (int, error) { return sessions, nil }, "").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		if want := fmt.Sprintf("forum_active_sessions %d", sessions); !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("Expected the metrics to include %q", want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	Handler(func() (int, error) { return 0, errors.New("database is closed") }, "").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	for _, want := range []string{"forum_upload_bytes_total 1024", "forum_active_sessions 0", "go_goroutines"} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("Expected the metrics to include %q", want)
+		}
+	}
+}
+
+func TestHandlerToken(t *testing.T) {
+	h := Handler(func() (int, error) { return 0, nil }, "s3cret")
+	for _, tc := range []struct {
+		name, authorization string
+		code                int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer guess", http.StatusUnauthorized},
+		{"right token", "Bearer s3cret", http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if tc.authorization != "" {
+			req.Header.Set("Authorization", tc.authorization)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.code {
+			t.Errorf("%s: got %d, want %d", tc.name, rec.Code, tc.code)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/jesee-kuya/forum/backend/config"
+	"github.com/jesee-kuya/forum/backend/util"
+)
+
+// WithConfig serves every request with cfg, which handlers read with config.From.
+func WithConfig(cfg *config.Config, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(config.NewContext(r.Context(), cfg)))
+	})
+}
+
+// WithTemplates renders the error pages of every request with t.
+func WithTemplates(t *util.Templates, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, util.WithTemplates(r, t))
+	})
+}
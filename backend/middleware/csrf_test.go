@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/jesee-kuya/forum/backend/util"
+)
+
+func TestCSRF(t *testing.T) {
+	var seenToken string
+	handler := CSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenToken = util.CSRFToken(r)
+		w.WriteHeader(http.StatusNoContent)
+	}), "/upload")
+
+	// A first visit issues the token cookie and exposes the token to templates
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/home", nil))
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != util.CSRFCookieName {
+		t.Fatalf("Expected a CSRF cookie, got %v", cookies)
+	}
+	token := cookies[0].Value
+	if seenToken != token {
+		t.Errorf("Expected handler to see token %q, got %q", token, seenToken)
+	}
+
+	postTo := func(path, field, contentType string) *httptest.ResponseRecorder {
+		form := url.Values{"comment": {"hi"}}
+		if field != "" {
+			form.Set(util.CSRFFieldName, field)
+		}
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", contentType)
+		req.AddCookie(&http.Cookie{Name: util.CSRFCookieName, Value: token})
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	post := func(field, contentType string) *httptest.ResponseRecorder {
+		return postTo("/comments", field, contentType)
+	}
+
+	if rr := post(token, "application/x-www-form-urlencoded"); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected matching token to pass, got %d", rr.Code)
+	}
+	if rr := post("", "application/x-www-form-urlencoded"); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected missing token to be rejected with 403, got %d", rr.Code)
+	}
+	if rr := post(util.NewCSRFToken(context.Background()), "application/x-www-form-urlencoded"); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected mismatched token to be rejected with 403, got %d", rr.Code)
+	}
+	// Multipart uploads are verified by the handler after it has limited their size
+	if rr := postTo("/upload", "", "multipart/form-data; boundary=x"); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected multipart upload to reach the handler, got %d", rr.Code)
+	}
+	// Any other route reads its form with r.FormValue, which parses multipart bodies too
+	for _, path := range []string{"/comments", "/logout", "/settings/password", "/sessions/revoke"} {
+		if rr := postTo(path, "", "multipart/form-data; boundary=x"); rr.Code != http.StatusForbidden {
+			t.Errorf("Expected multipart request to %s without a token to be rejected with 403, got %d", path, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/jesee-kuya/forum/backend/i18n"
+)
+
+/*
+Locale serves every request in the language i18n.Negotiate picks for it, which handlers and templates translate with. The response names the language in Content-Language and varies by Accept-Language, so caches keep a copy per language.
+*/
+func Locale(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := i18n.Negotiate(r)
+		w.Header().Set("Content-Language", t.Lang())
+		w.Header().Add("Vary", "Accept-Language")
+		next.ServeHTTP(w, r.WithContext(i18n.NewContext(r.Context(), t)))
+	})
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jesee-kuya/forum/backend/i18n"
+)
+
+func TestLocale(t *testing.T) {
+	var lang string
+	h := Locale(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lang = i18n.FromContext(r.Context()).Lang()
+	}))
+
+	tests := []struct {
+		name, accept, cookie, want string
+	}{
+		{"no preference", "", "", "en"},
+		{"accept language", "sw-KE,sw;q=0.9,en;q=0.8", "", "sw"},
+		{"cookie over header", "sw", "en", "en"},
+		{"unknown language", "fr-FR", "", "en"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept-Language", tc.accept)
+			}
+			if tc.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: i18n.CookieName, Value: tc.cookie})
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if lang != tc.want {
+				t.Errorf("Expected the request in %q, got %q", tc.want, lang)
+			}
+			if got := rec.Header().Get("Content-Language"); got != tc.want {
+				t.Errorf("Expected Content-Language %q, got %q", tc.want, got)
+			}
+			if rec.Header().Get("Vary") != "Accept-Language" {
+				t.Errorf("Expected the response to vary by Accept-Language, got %q", rec.Header().Get("Vary"))
+			}
+		})
+	}
+}
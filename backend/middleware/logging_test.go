@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jesee-kuya/forum/backend/config"
+	"github.com/jesee-kuya/forum/backend/logging"
+)
+
+// captureLogs sends the default logger to a buffer for the rest of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, config.Log{Level: "info", Format: "text"})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func TestRequestID(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.TrustedProxies = []string{"10.0.0.1"}
+
+	var seen string
+	h := WithConfig(cfg, RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = logging.RequestID(r.Context())
+	})))
+
+	tests := []struct {
+		name, remote, header string
+		keep                 bool
+	}{
+		{"Generated", "203.0.113.7:1234", "", false},
+		{"Kept from a trusted proxy", "10.0.0.1:1234", "proxy-id-1", true},
+		{"Ignored from a client", "203.0.113.7:1234", "spoofed", false},
+		{"Ignored when unsafe", "10.0.0.1:1234", "bad id\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			if tt.header != "" {
+				req.Header.Set(RequestIDHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if seen == "" || rec.Header().Get(RequestIDHeader) != seen {
+				t.Fatalf("Expected the request ID %q to be sent back, got %q", seen, rec.Header().Get(RequestIDHeader))
+			}
+			if (seen == tt.header) != tt.keep {
+				t.Errorf("Request ID %q, header %q, want kept = %v", seen, tt.header, tt.keep)
+			}
+		})
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	logs := captureLogs(t)
+
+	h := RequestID(AccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	})))
+	req := httptest.NewRequest(http.MethodGet, "/reset-password?token=secret-token", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	line := logs.String()
+	for _, want := range []string{"method=GET", "path=/reset-password", "status=418", "bytes=15", "request_id=" + rec.Header().Get(RequestIDHeader)} {
+		if !strings.Contains(line, want) {
+			t.Errorf("Expected %q in the access log %q", want, line)
+		}
+	}
+	if strings.Contains(line, "secret-token") {
+		t.Errorf("Expected the query to be left out of the access log %q", line)
+	}
+}
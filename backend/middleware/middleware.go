@@ -1,35 +1,106 @@
 package middleware
 
 import (
-	"context"
-	"log"
+	"database/sql"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/jesee-kuya/forum/backend/config"
 	"github.com/jesee-kuya/forum/backend/repositories"
+	"github.com/jesee-kuya/forum/backend/util"
 )
 
-type contextSession string
+/*
+Authenticate returns middleware that checks the session token against the sessions in db, the only record of who is signed in, and passes the user on to the handler through util.SessionUser.
+*/
+func Authenticate(db *sql.DB) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			cookie, err := r.Cookie(util.SessionCookieName)
+			if err != nil {
+				slog.InfoContext(r.Context(), "No session token", "err", err)
+				http.Redirect(w, r, "/sign-in", http.StatusSeeOther)
+				return
+			}
 
-var newSession contextSession = "userId"
+			session, err := repositories.ValidateSession(r.Context(), db, cookie.Value)
+			if err != nil {
+				slog.InfoContext(r.Context(), "Invalid session token", "err", err)
+				http.Redirect(w, r, "/sign-in", http.StatusSeeOther)
+				return
+			}
 
-// Authenticate middleware to check session token
-func Authenticate(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie("session_token")
-		if err != nil {
-			log.Println("NO session token", err)
-			http.Redirect(w, r, "/sign-in", http.StatusSeeOther)
-			return
+			// Slide the session forward, at most once a minute to keep writes down
+			now := time.Now()
+			if now.Sub(session.LastSeen) >= time.Minute {
+				expiresAt := util.SessionExpiry(config.From(r).Session, now, session.AbsoluteExpiresAt, session.RememberMe)
+				err = repositories.RenewSession(r.Context(), db, cookie.Value, now, expiresAt)
+				if err != nil {
+					slog.ErrorContext(r.Context(), "Failed to renew session", "err", err)
+				} else if session.RememberMe {
+					util.SetSessionCookie(w, r, cookie.Value, expiresAt, true)
+				}
+			}
+
+			// Users whose role requires two-factor authentication must set it up before doing anything else
+			if !strings.HasPrefix(r.URL.Path, "/settings/2fa") && r.URL.Path != "/logout" {
+				required, err := repositories.TwoFactorEnrollmentRequired(r.Context(), db, session.UserID)
+				if err != nil {
+					slog.ErrorContext(r.Context(), "Failed to check two-factor requirement", "err", err)
+				} else if required {
+					if util.WantsJSON(r) {
+						util.WriteError(w, r, util.NewError(http.StatusForbidden, "error.two_factor_required", nil))
+						return
+					}
+					http.Redirect(w, r, "/settings/2fa", http.StatusSeeOther)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, util.WithSessionUser(r, session.UserID))
 		}
+	}
+}
+
+// RequireRole lets only users with the given role in db through. It must be wrapped by Authenticate.
+func RequireRole(db *sql.DB, role string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			userID, _ := util.SessionUser(r)
 
-		userID, err := repositories.ValidateSession(cookie.Value)
-		if err != nil {
-			log.Printf("Invalid session token: %v", err)
-			http.Redirect(w, r, "/sign-in", http.StatusSeeOther)
-			return
+			userRole, err := repositories.GetUserRole(r.Context(), db, userID)
+			if err != nil {
+				util.WriteError(w, r, util.Internal(fmt.Errorf("failed to check user role: %w", err)))
+				return
+			}
+			if userRole != role {
+				util.WriteError(w, r, util.NewError(http.StatusForbidden, "error.forbidden", nil))
+				return
+			}
+			next(w, r)
 		}
+	}
+}
 
-		ctx := context.WithValue(r.Context(), newSession, userID)
-		next.ServeHTTP(w, r.WithContext(ctx))
+// RequireVerifiedEmail lets only users who confirmed their email address through. It must be wrapped by Authenticate.
+func RequireVerifiedEmail(db *sql.DB) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			userID, _ := util.SessionUser(r)
+
+			verified, err := repositories.IsEmailVerified(r.Context(), db, userID)
+			if err != nil {
+				util.WriteError(w, r, util.Internal(fmt.Errorf("failed to check email verification: %w", err)))
+				return
+			}
+			if !verified {
+				util.WriteError(w, r, util.NewError(http.StatusForbidden, "error.email_unverified", nil))
+				return
+			}
+			next(w, r)
+		}
 	}
 }
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jesee-kuya/forum/backend/util"
+)
+
+// Limit is a token bucket: Burst requests may be made at once, refilled at Rate requests per second.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerMinute allows n requests a minute, with bursts of up to burst requests.
+func PerMinute(n, burst int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: burst}
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// RateLimiter keeps a token bucket for every client of a group of routes.
+type RateLimiter struct {
+	limit     Limit
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewRateLimiter returns a limiter applying limit to each client separately.
+func NewRateLimiter(limit Limit) *RateLimiter {
+	return &RateLimiter{limit: limit, buckets: make(map[string]*bucket)}
+}
+
+/*
+Allow takes a token from the bucket of key. When the bucket is empty it returns false and how long until the next token is available.
+*/
+func (l *RateLimiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.limit.Burst), updated: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(l.limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*l.limit.Rate)
+	b.updated = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.limit.Rate * float64(time.Second))
+	return false, wait
+}
+
+// sweep drops buckets that have refilled completely, at most once a minute, so idle clients do not use memory.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	full := time.Duration(float64(l.limit.Burst) / l.limit.Rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= full {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+/*
+RateLimit limits how often each client may call a route. Signed in users are told apart by their user id, so it must be wrapped by Authenticate on authenticated routes; everyone else is told apart by their IP address. Rejected requests get a 429 with a Retry-After header.
+
+When methods are given only requests made with one of them are limited, so a form can be shown freely while submitting it is limited.
+*/
+func RateLimit(limit Limit, methods ...string) func(http.HandlerFunc) http.HandlerFunc {
+	limiter := NewRateLimiter(limit)
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if len(methods) > 0 && !slices.Contains(methods, r.Method) {
+				next(w, r)
+				return
+			}
+
+			key := "ip:" + util.ClientIP(r)
+			if userID, ok := util.SessionUser(r); ok {
+				key = "user:" + strconv.Itoa(userID)
+			}
+
+			allowed, wait := limiter.Allow(key, time.Now())
+			if !allowed {
+				seconds := int(math.Ceil(wait.Seconds()))
+				slog.WarnContext(r.Context(), "Rate limited", "key", key, "path", r.URL.Path)
+				w.Header().Set("Retry-After", strconv.Itoa(seconds))
+				util.WriteError(w, r, util.NewError(http.StatusTooManyRequests, "error.too_many_requests", nil, seconds))
+				return
+			}
+			next(w, r)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jesee-kuya/forum/backend/util"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	limiter := NewRateLimiter(PerMinute(60, 2))
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := limiter.Allow("a", now); !ok {
+			t.Fatalf("Expected request %d within the burst to be allowed", i+1)
+		}
+	}
+	ok, wait := limiter.Allow("a", now)
+	if ok {
+		t.Fatal("Expected request beyond the burst to be rejected")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Errorf("Expected to wait up to a second for the next token, got %v", wait)
+	}
+
+	// Other clients have their own bucket
+	if ok, _ := limiter.Allow("b", now); !ok {
+		t.Error("Expected a different key to be allowed")
+	}
+
+	// Tokens refill over time
+	if ok, _ := limiter.Allow("a", now.Add(time.Second)); !ok {
+		t.Error("Expected a token to be available after a second")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	limited := RateLimit(PerMinute(1, 1))(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	send := func(userID int, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/comments", nil)
+		req.RemoteAddr = "203.0.113.7:52100"
+		req.Header.Set("Accept", accept)
+		if userID != 0 {
+			req = util.WithSessionUser(req, userID)
+		}
+		rr := httptest.NewRecorder()
+		limited(rr, req)
+		return rr
+	}
+
+	if rr := send(1, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected first request to pass, got %d", rr.Code)
+	}
+
+	rr := send(1, "application/json")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") != "60" {
+		t.Errorf("Expected Retry-After of 60 seconds, got %q", rr.Header().Get("Retry-After"))
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || body["success"] != false {
+		t.Errorf("Expected a JSON error, got %q", rr.Body.String())
+	}
+
+	// Another user behind the same address is limited separately, as is an anonymous client
+	if rr := send(2, ""); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected another user to pass, got %d", rr.Code)
+	}
+	if rr := send(0, ""); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected anonymous client to pass, got %d", rr.Code)
+	}
+	if rr := send(0, ""); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected anonymous client to be limited by IP, got %d", rr.Code)
+	}
+}
+
+func TestRateLimitMethods(t *testing.T) {
+	limited := RateLimit(PerMinute(1, 1), http.MethodPost)(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	send := func(method string) int {
+		req := httptest.NewRequest(method, "/sign-up", nil)
+		req.RemoteAddr = "203.0.113.8:52100"
+		rr := httptest.NewRecorder()
+		limited(rr, req)
+		return rr.Code
+	}
+
+	// Showing the form is never limited, submitting it is
+	for i := 0; i < 3; i++ {
+		if code := send(http.MethodGet); code != http.StatusNoContent {
+			t.Fatalf("Expected GET %d to pass, got %d", i+1, code)
+		}
+	}
+	if code := send(http.MethodPost); code != http.StatusNoContent {
+		t.Errorf("Expected the first POST to pass, got %d", code)
+	}
+	if code := send(http.MethodPost); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the second POST to be limited, got %d", code)
+	}
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/jesee-kuya/forum/backend/util"
+)
+
+/*
+Recover turns a panic while serving a request into an internal error, logged with its stack, instead of a dropped connection. The error is only sent when the response has not been started; http.ErrAbortHandler, which aborts a response on purpose, is passed on.
+*/
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			slog.ErrorContext(r.Context(), "Panic serving request", "panic", fmt.Sprint(p), "stack", string(debug.Stack()))
+			if !rec.wroteHeader {
+				util.WriteError(w, r, util.Internal(nil))
+			}
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
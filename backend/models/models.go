@@ -18,20 +18,21 @@ type User struct {
 
 // Post model
 type Post struct {
-	ID           int        `json:"id"`
-	UserID       int        `json:"user_id"`
-	UserName     string     `json:"username"`
-	PostTitle    string     `json:"post_title"`
-	Body         string     `json:"body"`
-	ParentID     *int       `json:"parent_id"`
-	CreatedOn    time.Time  `json:"created_on"`
-	PostStatus   string     `json:"post_status"`
-	Likes        int        `json:"likes"`
-	Dislikes     int        `json:"dislikes"`
-	CommentCount int        `json:"comment_count"`
-	Categories   []Category `json:"categorie"`
-	MediaURL     string     `json:"imageurl"`
-	Comments     []Post     `json:"comments"`
+	ID           int          `json:"id"`
+	UserID       int          `json:"user_id"`
+	UserName     string       `json:"username"`
+	PostTitle    string       `json:"post_title"`
+	Body         string       `json:"body"`
+	ParentID     *int         `json:"parent_id"`
+	CreatedOn    time.Time    `json:"created_on"`
+	PostStatus   string       `json:"post_status"`
+	Likes        int          `json:"likes"`
+	Dislikes     int          `json:"dislikes"`
+	CommentCount int          `json:"comment_count"`
+	Categories   []Category   `json:"categorie"`
+	MediaURL     string       `json:"imageurl"`
+	Attachments  []Attachment `json:"attachments"`
+	Comments     []Post       `json:"comments"`
 }
 
 // Category model
@@ -41,6 +42,17 @@ type Category struct {
 	CategoryName string `json:"category"`
 }
 
+// Attachment model
+type Attachment struct {
+	ID       int    `json:"id"`
+	PostID   int    `json:"post_id"`
+	FileURL  string `json:"url"`
+	Caption  string `json:"caption"`
+	AltText  string `json:"alt_text"`
+	Position int    `json:"position"`
+	FileSize int64  `json:"file_size"`
+}
+
 // Reaction model
 type Reaction struct {
 	ID             int    `json:"id"`
@@ -49,3 +61,84 @@ type Reaction struct {
 	UserID         int    `json:"user_id"`
 	PostID         int    `json:"post_id"`
 }
+
+// Job model
+type Job struct {
+	ID          int       `json:"id"`
+	JobType     string    `json:"job_type"`
+	Payload     string    `json:"payload"`
+	JobStatus   string    `json:"job_status"`
+	Attempts    int       `json:"attempts"`
+	MaxAttempts int       `json:"max_attempts"`
+	RunAt       time.Time `json:"run_at"`
+	LastError   string    `json:"last_error"`
+}
+
+// Session model
+type Session struct {
+	ID                int       `json:"id"`
+	UserID            int       `json:"user_id"`
+	Token             string    `json:"-"`
+	ExpiresAt         time.Time `json:"expires_at"`
+	AbsoluteExpiresAt time.Time `json:"absolute_expires_at"`
+	RememberMe        bool      `json:"remember_me"`
+	CreatedOn         time.Time `json:"created_on"`
+	LastSeen          time.Time `json:"last_seen"`
+	IPAddress         string    `json:"ip_address"`
+	UserAgent         string    `json:"user_agent"`
+	Device            string    `json:"device"`
+	Current           bool      `json:"current"`
+}
+
+// AuditEvent model, a security relevant action such as a failed sign-in
+type AuditEvent struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Event     string    `json:"event"`
+	IPAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	Details   string    `json:"details"`
+	CreatedOn time.Time `json:"created_on"`
+}
+
+// Roles a user can have. Moderators and admins can be required to use two-factor authentication.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// TwoFactor model, the TOTP settings of a user. Secret is set but Enabled is false while enrollment is pending.
+type TwoFactor struct {
+	Secret   string `json:"-"`
+	Enabled  bool   `json:"enabled"`
+	LastStep int64  `json:"-"`
+}
+
+// StaffMember model, a moderator or admin as listed on the admin security page
+type StaffMember struct {
+	Username         string `json:"username"`
+	Role             string `json:"role"`
+	TwoFactorEnabled bool   `json:"two_factor_enabled"`
+}
+
+// Passkey model, a WebAuthn credential a user can sign in with. Credential holds the verifier's record as JSON.
+type Passkey struct {
+	ID           int       `json:"id"`
+	UserID       int       `json:"user_id"`
+	CredentialID string    `json:"credential_id"`
+	Credential   string    `json:"-"`
+	Name         string    `json:"name"`
+	CreatedOn    time.Time `json:"created_on"`
+	LastUsedOn   time.Time `json:"last_used_on"`
+}
+
+// Identity model, an account at a sign-in provider such as Google or GitHub linked to a user. Subject is the provider's id for the account.
+type Identity struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"-"`
+	Email     string    `json:"email"`
+	CreatedOn time.Time `json:"created_on"`
+}
@@ -0,0 +1,318 @@
+package openauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jesee-kuya/forum/backend/config"
+	"github.com/jesee-kuya/forum/backend/models"
+	"github.com/jesee-kuya/forum/backend/tracing"
+	"github.com/jesee-kuya/forum/backend/util"
+)
+
+// FlowLifetime is how long a user has to sign in at the provider.
+const FlowLifetime = 10 * time.Minute
+
+const flowCookieName = "oauth_state"
+
+// httpClient calls the sign-in providers, traced as children of the span of the request being served.
+var httpClient = &http.Client{Timeout: 10 * time.Second, Transport: tracing.Transport(http.DefaultTransport)}
+
+// flow is what the forum remembers about a sign-in while the user is at the provider.
+type flow struct {
+	Provider string `json:"p"`
+	State    string `json:"s"`
+	Verifier string `json:"v,omitempty"`
+	Nonce    string `json:"n,omitempty"`
+}
+
+/*
+Handler serves /auth/<provider>, which sends the user to the provider to sign in, and /auth/<provider>/callback, where the provider sends them back.
+*/
+func (s *Service) Handler(w http.ResponseWriter, r *http.Request) error {
+	name, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/auth/"), "/")
+	p, ok := s.lookup(name)
+	if !ok || (rest != "" && rest != "callback") {
+		return util.NewError(http.StatusNotFound, "error.page_not_found", nil)
+	}
+	if r.Method != http.MethodGet {
+		return util.MethodNotAllowed()
+	}
+
+	base, err := util.BaseURL(r)
+	if err != nil {
+		return err
+	}
+	redirectURI := base + "/auth/" + p.Name + "/callback"
+
+	if rest == "callback" {
+		s.callback(w, r, p, redirectURI)
+	} else {
+		authorize(w, r, p, redirectURI)
+	}
+	return nil
+}
+
+// authorize sends the user to the provider, remembering the state, PKCE verifier and nonce of the sign-in in a signed cookie.
+func authorize(w http.ResponseWriter, r *http.Request, p *Provider, redirectURI string) {
+	if err := p.discover(r.Context()); err != nil {
+		slog.ErrorContext(r.Context(), "Provider unavailable", "err", err)
+		http.Redirect(w, r, "/sign-in?error=provider_unavailable", http.StatusTemporaryRedirect)
+		return
+	}
+
+	f := flow{Provider: p.Name, State: util.RandomToken(16)}
+	params := url.Values{
+		"client_id":     {p.ClientID},
+		"redirect_uri":  {redirectURI},
+		"response_type": {"code"},
+		"scope":         {strings.Join(p.Scopes, " ")},
+		"state":         {f.State},
+	}
+	if p.PKCE {
+		f.Verifier = util.RandomToken(32)
+		challenge := sha256.Sum256([]byte(f.Verifier))
+		params.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+		params.Set("code_challenge_method", "S256")
+	}
+	if p.Issuer != "" {
+		f.Nonce = util.RandomToken(16)
+		params.Set("nonce", f.Nonce)
+	}
+	for key, value := range p.AuthParams {
+		params.Set(key, value)
+	}
+
+	payload, _ := json.Marshal(f)
+	value := base64.RawURLEncoding.EncodeToString(payload)
+	http.SetCookie(w, &http.Cookie{
+		Name:     flowCookieName,
+		Value:    value + "." + util.Sign(r.Context(), "oauth-flow", value),
+		Path:     "/auth/",
+		MaxAge:   int(FlowLifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   config.From(r).Session.SecureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, p.AuthURL+"?"+params.Encode(), http.StatusTemporaryRedirect)
+}
+
+// readFlow returns the sign-in the browser started, checking it belongs to the provider and state it came back with.
+func readFlow(r *http.Request, p *Provider) (flow, error) {
+	var f flow
+	cookie, err := r.Cookie(flowCookieName)
+	if err != nil {
+		return f, err
+	}
+	value, signature, _ := strings.Cut(cookie.Value, ".")
+	if !util.ValidSignature(r.Context(), signature, "oauth-flow", value) {
+		return f, errors.New("invalid flow cookie")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return f, err
+	}
+	if err := json.Unmarshal(payload, &f); err != nil {
+		return f, err
+	}
+
+	state := r.URL.Query().Get("state")
+	if f.Provider != p.Name || subtle.ConstantTimeCompare([]byte(state), []byte(f.State)) != 1 {
+		return f, errors.New("invalid state")
+	}
+	return f, nil
+}
+
+// callback exchanges the code the provider sent back for the user's details and signs them in.
+func (s *Service) callback(w http.ResponseWriter, r *http.Request, p *Provider, redirectURI string) {
+	f, err := readFlow(r, p)
+	http.SetCookie(w, &http.Cookie{Name: flowCookieName, Path: "/auth/", MaxAge: -1, HttpOnly: true, Secure: config.From(r).Session.SecureCookies, SameSite: http.SameSiteLaxMode})
+	if err != nil {
+		slog.WarnContext(r.Context(), "State validation failed", "err", err)
+		http.Redirect(w, r, "/sign-in?error=invalid_state", http.StatusTemporaryRedirect)
+		return
+	}
+	if reason := r.URL.Query().Get("error"); reason != "" {
+		slog.WarnContext(r.Context(), "Sign-in refused", "provider", p.Name, "reason", reason)
+		http.Redirect(w, r, "/sign-in?error="+url.QueryEscape(reason), http.StatusTemporaryRedirect)
+		return
+	}
+
+	tokens, err := p.exchange(r.Context(), r.URL.Query().Get("code"), redirectURI, f.Verifier)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Token exchange failed", "err", err)
+		http.Redirect(w, r, "/sign-in?error=token_exchange_failed", http.StatusTemporaryRedirect)
+		return
+	}
+
+	identity, username, verified, err := p.identity(r.Context(), tokens, f.Nonce)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to get user info", "err", err)
+		http.Redirect(w, r, "/sign-in?error=user_info_failed", http.StatusTemporaryRedirect)
+		return
+	}
+	s.accounts.OAuthSignIn(w, r, identity, username, verified)
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// exchange trades an authorization code for the provider's tokens.
+func (p *Provider) exchange(ctx context.Context, code, redirectURI, verifier string) (tokenResponse, error) {
+	var tokens tokenResponse
+	data := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {p.ClientID},
+		"client_secret": {p.ClientSecret},
+	}
+	if verifier != "" {
+		data.Set("code_verifier", verifier)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return tokens, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return tokens, err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return tokens, fmt.Errorf("%s answered %s: %w", p.TokenURL, resp.Status, err)
+	}
+	if tokens.Error != "" {
+		return tokens, fmt.Errorf("%s: %s", tokens.Error, tokens.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK || tokens.AccessToken == "" {
+		return tokens, fmt.Errorf("%s answered %s without an access token", p.TokenURL, resp.Status)
+	}
+	return tokens, nil
+}
+
+/*
+identity works out who signed in. OpenID Connect providers must send a valid ID token, and their user info, when they have any, can only add to it. Other providers are asked for the user's details with the access token.
+*/
+func (p *Provider) identity(ctx context.Context, tokens tokenResponse, nonce string) (models.Identity, string, bool, error) {
+	claims := make(map[string]interface{})
+	if p.Issuer != "" {
+		if tokens.IDToken == "" {
+			return models.Identity{}, "", false, errors.New("no ID token in the token response")
+		}
+		var err error
+		if claims, err = p.verifyIDToken(ctx, tokens.IDToken, nonce); err != nil {
+			return models.Identity{}, "", false, err
+		}
+	}
+
+	c := p.claims()
+	if p.UserInfoURL != "" {
+		var info map[string]interface{}
+		if err := getJSON(ctx, p.UserInfoURL, tokens.AccessToken, &info); err != nil {
+			return models.Identity{}, "", false, err
+		}
+		if sub, ok := claims[c.Subject]; ok && claimString(info[c.Subject]) != claimString(sub) {
+			return models.Identity{}, "", false, errors.New("user info is about another user than the ID token")
+		}
+		for key, value := range info {
+			if _, ok := claims[key]; !ok {
+				claims[key] = value
+			}
+		}
+	}
+
+	identity := models.Identity{
+		Provider: p.Name,
+		Subject:  claimString(claims[c.Subject]),
+		Email:    claimString(claims[c.Email]),
+	}
+	if identity.Subject == "" {
+		return models.Identity{}, "", false, fmt.Errorf("no %q claim for the user", c.Subject)
+	}
+	verified := claimBool(claims[c.EmailVerified])
+
+	if p.EmailsURL != "" {
+		email, ok, err := p.verifiedEmail(ctx, tokens.AccessToken, identity.Email)
+		if err != nil {
+			return models.Identity{}, "", false, err
+		}
+		identity.Email, verified = email, ok
+	}
+
+	username := claimString(claims[c.Username])
+	if username == "" {
+		username = claimString(claims["name"])
+	}
+	if username == "" {
+		username, _, _ = strings.Cut(identity.Email, "@")
+	}
+	return identity, username, verified, nil
+}
+
+// verifiedEmail asks the provider whether the user's email address is verified, picking their verified primary address when the profile has none.
+func (p *Provider) verifiedEmail(ctx context.Context, accessToken, email string) (string, bool, error) {
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, p.EmailsURL, accessToken, &emails); err != nil {
+		return "", false, err
+	}
+
+	for _, e := range emails {
+		if email == "" && e.Primary && e.Verified {
+			return e.Email, true, nil
+		}
+		if email != "" && strings.EqualFold(e.Email, email) {
+			return email, e.Verified, nil
+		}
+	}
+	return email, false, nil
+}
+
+// claimString returns a claim as a string. Some providers use numbers for ids.
+func claimString(v interface{}) string {
+	switch c := v.(type) {
+	case string:
+		return c
+	case float64:
+		return strconv.FormatFloat(c, 'f', -1, 64)
+	case json.Number:
+		return c.String()
+	}
+	return ""
+}
+
+// claimBool returns a boolean claim. Some providers send "true" as a string.
+func claimBool(v interface{}) bool {
+	switch c := v.(type) {
+	case bool:
+		return c
+	case string:
+		return c == "true"
+	}
+	return false
+}
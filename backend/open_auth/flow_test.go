@@ -0,0 +1,339 @@
+package openauth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jesee-kuya/forum/backend/config"
+	"github.com/jesee-kuya/forum/backend/models"
+)
+
+// fakeProvider is a local OAuth 2.0 and OpenID Connect server.
+type fakeProvider struct {
+	*httptest.Server
+	t   *testing.T
+	key *rsa.PrivateKey
+
+	challenge, nonce string                 // taken from the authorization request
+	idToken          map[string]interface{} // changes to the claims of the next ID token
+	signWith         *rsa.PrivateKey        // signs ID tokens with another key when set
+	userInfo         map[string]interface{}
+	emails           []map[string]interface{}
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeProvider{t: t, key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 f.URL,
+			"authorization_endpoint": f.URL + "/authorize",
+			"token_endpoint":         f.URL + "/token",
+			"userinfo_endpoint":      f.URL + "/userinfo",
+			"jwks_uri":               f.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "k1", "use": "sig", "alg": "RS256",
+			"n": base64.RawURLEncoding.EncodeToString(f.key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(f.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", f.token)
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(f.userInfo)
+	})
+	mux.HandleFunc("/emails", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(f.emails)
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+// token checks the code and PKCE verifier, and answers with an access token and, for OpenID Connect, an ID token.
+func (f *fakeProvider) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if r.Form.Get("code") != "good-code" || r.Form.Get("client_id") != "forum" ||
+		(f.challenge != "" && base64.RawURLEncoding.EncodeToString(sum[:]) != f.challenge) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	resp := map[string]string{"access_token": "access-token", "token_type": "Bearer"}
+	if f.nonce != "" {
+		claims := map[string]interface{}{
+			"iss": f.URL, "aud": "forum", "sub": "user-1", "nonce": f.nonce,
+			"email": "pat@example.com", "email_verified": true, "preferred_username": "pat",
+			"iat": time.Now().Unix(), "exp": time.Now().Add(time.Hour).Unix(),
+		}
+		for k, v := range f.idToken {
+			claims[k] = v
+		}
+		resp["id_token"] = f.sign(claims)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (f *fakeProvider) sign(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	key := f.key
+	if f.signWith != nil {
+		key = f.signWith
+	}
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+type signInResult struct {
+	called   bool
+	identity models.Identity
+	username string
+	verified bool
+}
+
+// fakeAccounts records the last sign-in instead of signing anyone in.
+type fakeAccounts struct {
+	last      signInResult
+	providers []string
+}
+
+func (a *fakeAccounts) OAuthSignIn(w http.ResponseWriter, r *http.Request, identity models.Identity, username string, verified bool) {
+	a.last = signInResult{true, identity, username, verified}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *fakeAccounts) RegisterIdentityProvider(name, displayName string) {
+	a.providers = append(a.providers, name)
+}
+
+// request returns a request to the forum at http://example.com, the address its redirect URIs are built from.
+func request(target string) *http.Request {
+	cfg := config.Default()
+	cfg.Server.BaseURL = "http://example.com"
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	return req.WithContext(config.NewContext(req.Context(), cfg))
+}
+
+func newService() (*Service, *fakeAccounts) {
+	accounts := &fakeAccounts{}
+	return New(accounts), accounts
+}
+
+// run signs in through the provider, as a browser would, answering the callback with the given code.
+func (f *fakeProvider) run(t *testing.T, s *Service, name, code string, tamper func(url.Values)) (*httptest.ResponseRecorder, signInResult) {
+	accounts := s.accounts.(*fakeAccounts)
+	accounts.last = signInResult{}
+
+	rec := httptest.NewRecorder()
+	s.Handler(rec, request("/auth/"+name))
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil || rec.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("authorization answered %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	params := location.Query()
+	f.challenge, f.nonce = params.Get("code_challenge"), params.Get("nonce")
+
+	if got := params.Get("redirect_uri"); got != "http://example.com/auth/"+name+"/callback" {
+		t.Errorf("redirect_uri = %q", got)
+	}
+
+	callback := url.Values{"code": {code}, "state": {params.Get("state")}}
+	if tamper != nil {
+		tamper(callback)
+	}
+	req := request("/auth/" + name + "/callback?" + callback.Encode())
+	for _, c := range rec.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	rec = httptest.NewRecorder()
+	s.Handler(rec, req)
+	return rec, accounts.last
+}
+
+func TestOpenIDConnectSignIn(t *testing.T) {
+	f := newFakeProvider(t)
+	s, _ := newService()
+	f.userInfo = map[string]interface{}{"sub": "user-1", "name": "Pat Doe"}
+	if err := s.Register(&Provider{Name: "fake", DisplayName: "Fake", ClientID: "forum", ClientSecret: "secret", Issuer: f.URL, PKCE: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec, result := f.run(t, s, "fake", "good-code", nil)
+	if !result.called {
+		t.Fatalf("sign-in failed: %d %s", rec.Code, rec.Header().Get("Location"))
+	}
+	if f.challenge == "" || f.nonce == "" {
+		t.Error("the authorization request had no PKCE challenge or nonce")
+	}
+	want := models.Identity{Provider: "fake", Subject: "user-1", Email: "pat@example.com"}
+	if result.identity != want || result.username != "pat" || !result.verified {
+		t.Errorf("got %+v %q %v, want %+v \"pat\" true", result.identity, result.username, result.verified, want)
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rejected := []struct {
+		name     string
+		code     string
+		idToken  map[string]interface{}
+		signWith *rsa.PrivateKey
+		tamper   func(url.Values)
+		location string
+	}{
+		{"wrong state", "good-code", nil, nil, func(v url.Values) { v.Set("state", "forged") }, "/sign-in?error=invalid_state"},
+		{"bad code", "bad-code", nil, nil, nil, "/sign-in?error=token_exchange_failed"},
+		{"refused at the provider", "good-code", nil, nil, func(v url.Values) { v.Set("error", "access_denied") }, "/sign-in?error=access_denied"},
+		{"wrong nonce", "good-code", map[string]interface{}{"nonce": "replayed"}, nil, nil, "/sign-in?error=user_info_failed"},
+		{"wrong audience", "good-code", map[string]interface{}{"aud": "someone-else"}, nil, nil, "/sign-in?error=user_info_failed"},
+		{"wrong issuer", "good-code", map[string]interface{}{"iss": "https://evil.example"}, nil, nil, "/sign-in?error=user_info_failed"},
+		{"expired", "good-code", map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}, nil, nil, "/sign-in?error=user_info_failed"},
+		{"bad signature", "good-code", nil, other, nil, "/sign-in?error=user_info_failed"},
+	}
+	for _, tc := range rejected {
+		f.idToken, f.signWith = tc.idToken, tc.signWith
+		rec, result := f.run(t, s, "fake", tc.code, tc.tamper)
+		if result.called {
+			t.Errorf("%s: sign-in went ahead", tc.name)
+		}
+		if got := rec.Header().Get("Location"); got != tc.location {
+			t.Errorf("%s: redirected to %q, want %q", tc.name, got, tc.location)
+		}
+	}
+
+	// Other issuers the provider is known by are accepted.
+	f.idToken, f.signWith = map[string]interface{}{"iss": "fake.example"}, nil
+	if err := s.Register(&Provider{Name: "alias", ClientID: "forum", Issuer: f.URL, Issuers: []string{"fake.example"}}); err != nil {
+		t.Fatal(err)
+	}
+	if rec, result := f.run(t, s, "alias", "good-code", nil); !result.called {
+		t.Errorf("an ID token from another accepted issuer was refused: %s", rec.Header().Get("Location"))
+	}
+
+	// The flow cookie only works for the provider it was made for.
+	f.idToken, f.signWith = nil, nil
+	if err := s.Register(&Provider{Name: "fake2", ClientID: "forum", Issuer: f.URL}); err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	s.Handler(rec, request("/auth/fake"))
+	location, _ := url.Parse(rec.Header().Get("Location"))
+	req := request("/auth/fake2/callback?code=good-code&state=" + location.Query().Get("state"))
+	for _, c := range rec.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	rec = httptest.NewRecorder()
+	s.Handler(rec, req)
+	if got := rec.Header().Get("Location"); got != "/sign-in?error=invalid_state" {
+		t.Errorf("a flow was finished at another provider: %q", got)
+	}
+}
+
+func TestOAuth2SignInWithClaimMapping(t *testing.T) {
+	f := newFakeProvider(t)
+	s, _ := newService()
+	f.userInfo = map[string]interface{}{"id": 4242, "login": "octo", "email": "octo@example.com"}
+	f.emails = []map[string]interface{}{
+		{"email": "octo@users.example", "primary": true, "verified": true},
+		{"email": "octo@example.com", "primary": false, "verified": false},
+	}
+	err := s.Register(&Provider{
+		Name:        "hub",
+		ClientID:    "forum",
+		AuthURL:     f.URL + "/authorize",
+		TokenURL:    f.URL + "/token",
+		UserInfoURL: f.URL + "/userinfo",
+		EmailsURL:   f.URL + "/emails",
+		Claims:      ClaimMap{Subject: "id", Email: "email", Username: "login"},
+		PKCE:        true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec, result := f.run(t, s, "hub", "good-code", nil)
+	if !result.called {
+		t.Fatalf("sign-in failed: %d %s", rec.Code, rec.Header().Get("Location"))
+	}
+	if f.nonce != "" {
+		t.Error("a plain OAuth 2.0 provider was sent a nonce")
+	}
+	want := models.Identity{Provider: "hub", Subject: "4242", Email: "octo@example.com"}
+	if result.identity != want || result.username != "octo" || result.verified {
+		t.Errorf("got %+v %q %v, want %+v \"octo\" false", result.identity, result.username, result.verified, want)
+	}
+
+	// Without a public email the verified primary one is used.
+	delete(f.userInfo, "email")
+	_, result = f.run(t, s, "hub", "good-code", nil)
+	if result.identity.Email != "octo@users.example" || !result.verified {
+		t.Errorf("got %q verified %v, want the verified primary email", result.identity.Email, result.verified)
+	}
+}
+
+func TestConfigureFromEnv(t *testing.T) {
+	t.Setenv("GOOGLE_CLIENT_ID", "")
+	t.Setenv("OAUTH_GOOGLE_CLIENT_ID", "")
+	t.Setenv("GITHUB_CLIENT_ID", "gh-id")
+	t.Setenv("OAUTH_PROVIDERS", "gitlab")
+	t.Setenv("OAUTH_GITLAB_CLIENT_ID", "gl-id")
+	t.Setenv("OAUTH_GITLAB_ISSUER", "https://gitlab.example")
+	t.Setenv("OAUTH_GITLAB_SCOPES", "openid,email")
+	t.Setenv("OAUTH_GITLAB_CLAIM_USERNAME", "nickname")
+
+	cfg, err := config.Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, accounts := newService()
+	if err := s.Configure(cfg.OAuth); err != nil {
+		t.Fatal(err)
+	}
+
+	github, ok := s.lookup("github")
+	if !ok || github.ClientID != "gh-id" || !strings.Contains(github.AuthURL, "github.com") {
+		t.Errorf("github not registered from GITHUB_CLIENT_ID: %+v", github)
+	}
+	gitlab, ok := s.lookup("gitlab")
+	if !ok || gitlab.Issuer != "https://gitlab.example" || strings.Join(gitlab.Scopes, " ") != "openid email" || gitlab.claims().Username != "nickname" {
+		t.Errorf("gitlab not registered from its variables: %+v", gitlab)
+	}
+	if _, ok := s.lookup("google"); ok {
+		t.Error("google registered without a client id")
+	}
+	if got := strings.Join(accounts.providers, ","); got != "github,gitlab" {
+		t.Errorf("providers listed on the sign-in pages = %q, want github,gitlab", got)
+	}
+}
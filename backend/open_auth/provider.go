@@ -0,0 +1,222 @@
+package openauth
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/jesee-kuya/forum/backend/config"
+	"github.com/jesee-kuya/forum/backend/models"
+)
+
+/*
+Provider describes an OAuth 2.0 or OpenID Connect sign-in provider. Providers with an Issuer are OpenID Connect providers: their endpoints are discovered from the issuer when not given, and the ID token they return is verified. Other providers are plain OAuth 2.0, and the user's details come from their user info endpoint alone.
+*/
+type Provider struct {
+	Name         string // used in the /auth/<name> paths and stored with linked accounts
+	DisplayName  string
+	ClientID     string
+	ClientSecret string
+
+	Issuer      string
+	AuthURL     string
+	TokenURL    string
+	UserInfoURL string
+	JWKSURL     string
+	Scopes      []string
+	AuthParams  map[string]string // extra parameters for the authorization request, such as prompt
+
+	// Issuers are other values an ID token's iss claim may hold for this provider, besides Issuer.
+	Issuers []string
+
+	// EmailsURL lists the user's email addresses with whether each is verified, for providers whose user info leaves that out.
+	EmailsURL string
+
+	Claims ClaimMap
+	PKCE   bool
+
+	mu         sync.Mutex
+	discovered bool
+}
+
+// ClaimMap names the claims or user info fields holding the user's details.
+type ClaimMap struct {
+	Subject       string
+	Email         string
+	EmailVerified string
+	Username      string
+}
+
+// standardClaims are the OpenID Connect claims, used for any the provider's ClaimMap leaves empty.
+var standardClaims = ClaimMap{
+	Subject:       "sub",
+	Email:         "email",
+	EmailVerified: "email_verified",
+	Username:      "preferred_username",
+}
+
+// Accounts is the part of the forum providers sign users in to, *handler.App in the running forum.
+type Accounts interface {
+	// OAuthSignIn finishes the sign-in once the provider has told who the user is.
+	OAuthSignIn(w http.ResponseWriter, r *http.Request, identity models.Identity, username string, emailVerified bool)
+	// RegisterIdentityProvider lists a provider on the sign-in pages and in the account settings.
+	RegisterIdentityProvider(name, displayName string)
+}
+
+// Service serves the sign-in flows of its registered providers.
+type Service struct {
+	accounts Accounts
+
+	mu        sync.RWMutex
+	providers map[string]*Provider
+}
+
+// New returns a service without providers that signs users in to accounts.
+func New(accounts Accounts) *Service {
+	return &Service{accounts: accounts, providers: make(map[string]*Provider)}
+}
+
+// Register makes a provider available for signing in and for linking to accounts.
+func (s *Service) Register(p *Provider) error {
+	if p.Name == "" || p.ClientID == "" {
+		return fmt.Errorf("provider %q needs a name and a client id", p.Name)
+	}
+	if p.Issuer == "" && (p.AuthURL == "" || p.TokenURL == "" || p.UserInfoURL == "") {
+		return fmt.Errorf("provider %q needs an issuer, or authorization, token and user info URLs", p.Name)
+	}
+	if p.DisplayName == "" {
+		p.DisplayName = p.Name
+	}
+
+	s.mu.Lock()
+	s.providers[p.Name] = p
+	s.mu.Unlock()
+	s.accounts.RegisterIdentityProvider(p.Name, p.DisplayName)
+	return nil
+}
+
+func (s *Service) lookup(name string) (*Provider, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.providers[name]
+	return p, ok
+}
+
+// builtinProviders are the providers the forum knows without being told their endpoints.
+func builtinProviders() []*Provider {
+	return []*Provider{
+		{
+			Name:        "google",
+			DisplayName: "Google",
+			Issuer:      "https://accounts.google.com",
+			Issuers:     []string{"accounts.google.com"}, // Google sometimes leaves the scheme off
+			AuthURL:     "https://accounts.google.com/o/oauth2/v2/auth",
+			TokenURL:    "https://oauth2.googleapis.com/token",
+			UserInfoURL: "https://openidconnect.googleapis.com/v1/userinfo",
+			JWKSURL:     "https://www.googleapis.com/oauth2/v3/certs",
+			Scopes:      []string{"openid", "email", "profile"},
+			AuthParams:  map[string]string{"prompt": "select_account"},
+			Claims:      ClaimMap{Username: "name"},
+			PKCE:        true,
+		},
+		{
+			Name:        "github",
+			DisplayName: "GitHub",
+			AuthURL:     "https://github.com/login/oauth/authorize",
+			TokenURL:    "https://github.com/login/oauth/access_token",
+			UserInfoURL: "https://api.github.com/user",
+			EmailsURL:   "https://api.github.com/user/emails",
+			Scopes:      []string{"user:email"},
+			Claims:      ClaimMap{Subject: "id", Email: "email", Username: "login"},
+			PKCE:        true,
+		},
+	}
+}
+
+/*
+Configure registers the configured providers that have a client id. Settings left empty keep those of the built-in providers, Google and GitHub, and any other provider must be given an issuer or its endpoints.
+*/
+func (s *Service) Configure(providers map[string]config.Provider) error {
+	known := make(map[string]*Provider)
+	for _, p := range builtinProviders() {
+		known[p.Name] = p
+	}
+
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		c := providers[name]
+		if c.ClientID == "" {
+			continue
+		}
+		p := known[name]
+		if p == nil {
+			p = &Provider{Name: name, PKCE: true}
+		}
+		apply(p, c)
+		if err := s.Register(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply overrides a provider's settings with those configured for it.
+func apply(p *Provider, c config.Provider) {
+	set := func(field *string, value string) {
+		if value != "" {
+			*field = value
+		}
+	}
+	set(&p.ClientID, c.ClientID)
+	set(&p.ClientSecret, c.ClientSecret)
+	set(&p.DisplayName, c.DisplayName)
+	set(&p.Issuer, c.Issuer)
+	set(&p.AuthURL, c.AuthURL)
+	set(&p.TokenURL, c.TokenURL)
+	set(&p.UserInfoURL, c.UserInfoURL)
+	set(&p.JWKSURL, c.JWKSURL)
+	set(&p.EmailsURL, c.EmailsURL)
+	set(&p.Claims.Subject, c.Claims.Subject)
+	set(&p.Claims.Email, c.Claims.Email)
+	set(&p.Claims.EmailVerified, c.Claims.EmailVerified)
+	set(&p.Claims.Username, c.Claims.Username)
+
+	if len(c.Scopes) > 0 {
+		p.Scopes = c.Scopes
+	}
+	if len(c.AuthParams) > 0 {
+		if p.AuthParams == nil {
+			p.AuthParams = make(map[string]string)
+		}
+		for key, value := range c.AuthParams {
+			p.AuthParams[key] = value
+		}
+	}
+	if c.PKCE != nil {
+		p.PKCE = *c.PKCE
+	}
+}
+
+// claims returns the provider's claim names, falling back to the OpenID Connect ones.
+func (p *Provider) claims() ClaimMap {
+	c := p.Claims
+	if c.Subject == "" {
+		c.Subject = standardClaims.Subject
+	}
+	if c.Email == "" {
+		c.Email = standardClaims.Email
+	}
+	if c.EmailVerified == "" && p.EmailsURL == "" {
+		c.EmailVerified = standardClaims.EmailVerified
+	}
+	if c.Username == "" {
+		c.Username = standardClaims.Username
+	}
+	return c
+}
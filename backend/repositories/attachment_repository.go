@@ -0,0 +1,100 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jesee-kuya/forum/backend/models"
+)
+
+// GetAttachments returns the attachments of a post in their display order.
+func GetAttachments(ctx context.Context, db *sql.DB, postID int) ([]models.Attachment, error) {
+	query := `
+		SELECT id, post_id, file_url, caption, alt_text, position, file_size
+		FROM tblAttachments
+		WHERE post_id = ?
+		ORDER BY position ASC, id ASC
+	`
+	rows, err := db.QueryContext(ctx, query, postID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var attachments []models.Attachment
+
+	for rows.Next() {
+		attachment := models.Attachment{}
+
+		err := rows.Scan(&attachment.ID, &attachment.PostID, &attachment.FileURL, &attachment.Caption, &attachment.AltText, &attachment.Position, &attachment.FileSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		attachments = append(attachments, attachment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return attachments, nil
+}
+
+// InsertAttachments stores the attachments of a post, keeping the order they were uploaded in.
+func InsertAttachments(ctx context.Context, db *sql.DB, postID int64, attachments []models.Attachment) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := insertAttachments(ctx, tx, postID, attachments); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertAttachments(ctx context.Context, tx *sql.Tx, postID int64, attachments []models.Attachment) error {
+	query := "INSERT INTO tblAttachments (post_id, file_url, caption, alt_text, position, file_size) VALUES (?, ?, ?, ?, ?, ?)"
+	for i, attachment := range attachments {
+		if _, err := tx.ExecContext(ctx, query, postID, attachment.FileURL, attachment.Caption, attachment.AltText, i, attachment.FileSize); err != nil {
+			return fmt.Errorf("failed to insert into tblAttachments: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetReferencedMedia returns the set of uploaded files still used by visible posts and their attachments.
+func GetReferencedMedia(ctx context.Context, db *sql.DB) (map[string]bool, error) {
+	query := `
+		SELECT media_url FROM tblPosts
+		WHERE post_status = 'visible' AND media_url IS NOT NULL AND media_url != ''
+		UNION
+		SELECT a.file_url FROM tblAttachments a
+		JOIN tblPosts p ON a.post_id = p.id
+		WHERE p.post_status = 'visible'
+	`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	referenced := make(map[string]bool)
+
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		referenced[url] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return referenced, nil
+}
@@ -0,0 +1,125 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/jesee-kuya/forum/backend/models"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// setupTestDBA initializes a temporary SQLite database with an attachments table
+func setupTestDBA(t *testing.T) *sql.DB {
+	tempDBFile := "test_attachments.db"
+	db, err := sql.Open("sqlite3", tempDBFile)
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS tblAttachments (
+			id INTEGER PRIMARY KEY,
+			post_id INTEGER NOT NULL,
+			file_url TEXT NOT NULL,
+			caption TEXT DEFAULT '',
+			alt_text TEXT DEFAULT '',
+			position INTEGER NOT NULL DEFAULT 0,
+			file_size INTEGER NOT NULL DEFAULT 0
+		);
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create test table: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(tempDBFile)
+	})
+
+	return db
+}
+
+// TestInsertAndGetAttachments tests that attachments are stored and returned in upload order
+func TestInsertAndGetAttachments(t *testing.T) {
+	db := setupTestDBA(t)
+
+	attachments := []models.Attachment{
+		{FileURL: "uploads/upload-1.png", Caption: "First", AltText: "A cat", FileSize: 100},
+		{FileURL: "uploads/upload-2.jpg", Caption: "Second", AltText: "A dog", FileSize: 200},
+	}
+
+	if err := InsertAttachments(context.Background(), db, 7, attachments); err != nil {
+		t.Fatalf("InsertAttachments failed: %v", err)
+	}
+	if err := InsertAttachments(context.Background(), db, 8, []models.Attachment{{FileURL: "uploads/other.gif"}}); err != nil {
+		t.Fatalf("InsertAttachments failed: %v", err)
+	}
+
+	got, err := GetAttachments(context.Background(), db, 7)
+	if err != nil {
+		t.Fatalf("GetAttachments failed: %v", err)
+	}
+
+	expected := []models.Attachment{
+		{ID: 1, PostID: 7, FileURL: "uploads/upload-1.png", Caption: "First", AltText: "A cat", Position: 0, FileSize: 100},
+		{ID: 2, PostID: 7, FileURL: "uploads/upload-2.jpg", Caption: "Second", AltText: "A dog", Position: 1, FileSize: 200},
+	}
+
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Attachments do not match. Got: %+v, Expected: %+v", got, expected)
+	}
+}
+
+// TestGetAttachments_None tests that a post without attachments returns an empty result
+func TestGetAttachments_None(t *testing.T) {
+	db := setupTestDBA(t)
+
+	got, err := GetAttachments(context.Background(), db, 1)
+	if err != nil {
+		t.Fatalf("GetAttachments failed: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("Expected no attachments, got %d", len(got))
+	}
+}
+
+// TestInsertPostRollsBack tests that a post whose categories or attachments cannot be stored is not stored either
+func TestInsertPostRollsBack(t *testing.T) {
+	db := setupTestDBA(t)
+	if _, err := db.Exec(`
+		CREATE TABLE tblPosts (id INTEGER PRIMARY KEY, user_id INTEGER NOT NULL, post_title TEXT, body TEXT);
+		CREATE TABLE tblPostCategories (id INTEGER PRIMARY KEY, post_id INTEGER NOT NULL, category TEXT);
+	`); err != nil {
+		t.Fatal(err)
+	}
+	categories := []string{"Technology"}
+	attachments := []models.Attachment{{FileURL: "uploads/upload-1.png"}}
+
+	id, err := InsertPost(context.Background(), db, 1, "Title", "Body", categories, attachments)
+	if err != nil {
+		t.Fatalf("InsertPost failed: %v", err)
+	}
+	if got, err := GetAttachments(context.Background(), db, int(id)); err != nil || len(got) != 1 {
+		t.Errorf("Expected the post's attachment to be stored, got %v (%v)", got, err)
+	}
+	if got, err := GetCategories(context.Background(), db, int(id)); err != nil || len(got) != 1 || got[0].CategoryName != "Technology" {
+		t.Errorf("Expected the post's category to be stored, got %v (%v)", got, err)
+	}
+
+	for _, table := range []string{"tblAttachments", "tblPostCategories"} {
+		if _, err := db.Exec("DROP TABLE " + table); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := InsertPost(context.Background(), db, 1, "Title", "Body", categories, attachments); err == nil {
+			t.Fatalf("Expected InsertPost to fail without %s", table)
+		}
+		var posts int
+		db.QueryRow("SELECT COUNT(*) FROM tblPosts").Scan(&posts)
+		if posts != 1 {
+			t.Errorf("Expected the post failing on %s to be rolled back, got %d posts", table, posts)
+		}
+	}
+}
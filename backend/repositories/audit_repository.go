@@ -0,0 +1,48 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jesee-kuya/forum/backend/models"
+)
+
+// InsertAuditEvent appends an event to the audit log.
+func InsertAuditEvent(ctx context.Context, db *sql.DB, event models.AuditEvent) error {
+	_, err := InsertRecord(ctx, db, "tblAuditLog", []string{"user_id", "event", "ip_address", "user_agent", "details", "created_on"},
+		nullableID(event.UserID), event.Event, event.IPAddress, event.UserAgent, event.Details, time.Now().UTC())
+	return err
+}
+
+// GetAuditEvents returns the audit log of a user, newest first.
+func GetAuditEvents(ctx context.Context, db *sql.DB, userID int, limit int) ([]models.AuditEvent, error) {
+	query := `
+		SELECT id, user_id, event, ip_address, user_agent, details, created_on
+		FROM tblAuditLog
+		WHERE user_id = ?
+		ORDER BY julianday(created_on) DESC, id DESC
+		LIMIT ?
+	`
+	rows, err := db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.AuditEvent
+	for rows.Next() {
+		var event models.AuditEvent
+		err := rows.Scan(&event.ID, &event.UserID, &event.Event, &event.IPAddress, &event.UserAgent, &event.Details, &event.CreatedOn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return events, nil
+}
@@ -1,18 +1,19 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
 	"github.com/jesee-kuya/forum/backend/models"
 )
 
-func GetCategories(db *sql.DB, id int) ([]models.Category, error) {
+func GetCategories(ctx context.Context, db *sql.DB, id int) ([]models.Category, error) {
 	query := `
 		SELECT * FROM tblPostCategories
 		WHERE post_id = ? 
 	`
-	rows, err := db.Query(query, id)
+	rows, err := db.QueryContext(ctx, query, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
@@ -38,3 +39,13 @@ func GetCategories(db *sql.DB, id int) ([]models.Category, error) {
 
 	return categories, nil
 }
+
+// insertCategories files a post under the given categories, as part of the transaction storing the post.
+func insertCategories(ctx context.Context, tx *sql.Tx, postID int64, categories []string) error {
+	for _, category := range categories {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO tblPostCategories (post_id, category) VALUES (?, ?)", postID, category); err != nil {
+			return fmt.Errorf("failed to insert into tblPostCategories: %w", err)
+		}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package repositories
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
@@ -25,7 +26,7 @@ func TestGetCategories_QueryError(t *testing.T) {
 	mock.ExpectQuery(query).WithArgs(postID).WillReturnError(fmt.Errorf("mock query error"))
 
 	// Call the function under test
-	categories, err := GetCategories(db, postID)
+	categories, err := GetCategories(context.Background(), db, postID)
 
 	// Assert that an error is returned
 	assert.Error(t, err)
@@ -60,7 +61,7 @@ func TestGetCategories_ScanError(t *testing.T) {
 	mock.ExpectQuery(query).WithArgs(postID).WillReturnRows(rows)
 
 	// Call the function under test
-	categories, err := GetCategories(db, postID)
+	categories, err := GetCategories(context.Background(), db, postID)
 
 	// Assert that an error is returned
 	assert.Error(t, err)
@@ -1,18 +1,18 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"strings"
 
 	"github.com/jesee-kuya/forum/backend/models"
-	"github.com/jesee-kuya/forum/backend/util"
 	_ "github.com/mattn/go-sqlite3" // SQLite3 driver
 )
 
 // insertPost inserts a Post into the tblPosts table
-func InsertRecord(db *sql.DB, table string, columns []string, values ...interface{}) (int64, error) {
+func InsertRecord(ctx context.Context, db *sql.DB, table string, columns []string, values ...interface{}) (int64, error) {
 	// Constructing column names and placeholders
 	columnsStr := strings.Join(columns, ", ")
 	placeholders := strings.Repeat("?, ", len(columns))
@@ -22,7 +22,7 @@ func InsertRecord(db *sql.DB, table string, columns []string, values ...interfac
 	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, columnsStr, placeholders)
 
 	// Executing the query
-	result, err := db.Exec(query, values...)
+	result, err := db.ExecContext(ctx, query, values...)
 	if err != nil {
 		return 0, fmt.Errorf("failed to insert into %s: %w", table, err)
 	}
@@ -37,12 +37,12 @@ func InsertRecord(db *sql.DB, table string, columns []string, values ...interfac
 }
 
 // deletePost deletes a record from tblPosts based on its ID
-func DeleteRecord(db *sql.DB, table, column string, id int) error {
+func DeleteRecord(ctx context.Context, db *sql.DB, table, column string, id int) error {
 	// Use a parameterized query for safety
 	query := fmt.Sprintf("UPDATE %s SET %s = ? WHERE id = ?", table, column)
 
 	// Execute the query safely with parameters
-	result, err := db.Exec(query, "Deleted", id)
+	result, err := db.ExecContext(ctx, query, "Deleted", id)
 	if err != nil {
 		return fmt.Errorf("failed to delete record from %s: %w", table, err)
 	}
@@ -56,16 +56,16 @@ func DeleteRecord(db *sql.DB, table, column string, id int) error {
 		return fmt.Errorf("no record found with ID %d in %s", id, table)
 	}
 
-	log.Printf("Successfully marked record with ID %d as deleted in table %s", id, table)
+	slog.Debug("Marked record as deleted", "table", table, "id", id)
 	return nil
 }
 
-func GetUserByEmail(email string) (models.User, error) {
+func GetUserByEmail(ctx context.Context, db *sql.DB, email string) (models.User, error) {
 	var user models.User
 	var password sql.NullString // handle NULL passwords
 
 	query := "SELECT id, username, email, user_password FROM tblUsers WHERE email = ?"
-	err := util.DB.QueryRow(query, email).Scan(
+	err := db.QueryRowContext(ctx, query, email).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
@@ -84,21 +84,30 @@ func GetUserByEmail(email string) (models.User, error) {
 	return user, nil
 }
 
-func GetUserByName(name string) (models.User, error) {
+func GetUserByName(ctx context.Context, db *sql.DB, name string) (models.User, error) {
 	query := "SELECT id, username, email, user_password FROM tblUsers WHERE username  = ?"
-	row := util.DB.QueryRow(query, name)
+	row := db.QueryRowContext(ctx, query, name)
 	user, err := UserDetails(row)
 	return user, err
 }
 
+func GetUserByID(ctx context.Context, db *sql.DB, id int) (models.User, error) {
+	query := "SELECT id, username, email, user_password FROM tblUsers WHERE id = ?"
+	row := db.QueryRowContext(ctx, query, id)
+	return UserDetails(row)
+}
+
 func UserDetails(row *sql.Row) (models.User, error) {
 	var user models.User
-	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password)
+	var password sql.NullString // handle NULL passwords of OAuth accounts
+
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &password)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return user, fmt.Errorf("user not found")
+			return user, fmt.Errorf("user not found: %w", err)
 		}
 		return user, fmt.Errorf("failed to retrieve user: %v", err)
 	}
+	user.Password = password.String
 	return user, nil
 }
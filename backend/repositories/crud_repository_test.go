@@ -1,6 +1,7 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
 	"os"
 	"testing"
@@ -46,7 +47,7 @@ func TestInsertRecord(t *testing.T) {
 	values := []interface{}{"Test Title", "Test Content", "Active"}
 
 	// Insert a record
-	id, err := InsertRecord(db, table, columns, values...)
+	id, err := InsertRecord(context.Background(), db, table, columns, values...)
 	if err != nil {
 		t.Fatalf("InsertRecord failed: %v", err)
 	}
@@ -73,13 +74,13 @@ func TestDeleteRecord(t *testing.T) {
 	table := "tblPosts"
 	columns := []string{"title", "content", "status"}
 	values := []interface{}{"Test Title", "Test Content", "Active"}
-	id, err := InsertRecord(db, table, columns, values...)
+	id, err := InsertRecord(context.Background(), db, table, columns, values...)
 	if err != nil {
 		t.Fatalf("Failed to insert test record: %v", err)
 	}
 
 	// Delete the record
-	err = DeleteRecord(db, table, "status", int(id))
+	err = DeleteRecord(context.Background(), db, table, "status", int(id))
 	if err != nil {
 		t.Fatalf("DeleteRecord failed: %v", err)
 	}
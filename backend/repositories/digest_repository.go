@@ -0,0 +1,79 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// DigestSubscriber is a user receiving the digest emails, and the time their next digest starts from.
+type DigestSubscriber struct {
+	ID       int
+	Username string
+	Email    string
+	Since    time.Time
+}
+
+// DigestPost is a post listed in a digest email.
+type DigestPost struct {
+	ID       int
+	Title    string
+	Username string
+}
+
+// DigestSubscribers returns the users subscribed to the digest emails whose email address is confirmed.
+func DigestSubscribers(ctx context.Context, db *sql.DB) ([]DigestSubscriber, error) {
+	rows, err := db.QueryContext(ctx, "SELECT id, username, email, user_digest_since FROM tblUsers WHERE user_digest_since IS NOT NULL AND email_verified = 1 ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list digest subscribers: %w", err)
+	}
+	defer rows.Close()
+
+	var subscribers []DigestSubscriber
+	for rows.Next() {
+		var s DigestSubscriber
+		if err := rows.Scan(&s.ID, &s.Username, &s.Email, &s.Since); err != nil {
+			return nil, fmt.Errorf("failed to read digest subscriber: %w", err)
+		}
+		subscribers = append(subscribers, s)
+	}
+	return subscribers, rows.Err()
+}
+
+/*
+DigestPosts returns at most limit visible posts, leaving comments out, made after since and no later than until by anyone but the user excluded, newest first.
+*/
+func DigestPosts(ctx context.Context, db *sql.DB, since, until time.Time, excludeUser, limit int) ([]DigestPost, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT p.id, COALESCE(p.post_title, ''), u.username
+		FROM tblPosts p
+		JOIN tblUsers u ON u.id = p.user_id
+		WHERE p.parent_id IS NULL AND p.post_status = 'visible' AND p.user_id != ?
+			AND julianday(p.created_on) > julianday(?) AND julianday(p.created_on) <= julianday(?)
+		ORDER BY p.created_on DESC, p.id DESC
+		LIMIT ?`, excludeUser, since.UTC(), until.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list digest posts: %w", err)
+	}
+	defer rows.Close()
+
+	var posts []DigestPost
+	for rows.Next() {
+		var p DigestPost
+		if err := rows.Scan(&p.ID, &p.Title, &p.Username); err != nil {
+			return nil, fmt.Errorf("failed to read digest post: %w", err)
+		}
+		posts = append(posts, p)
+	}
+	return posts, rows.Err()
+}
+
+// MarkDigestSent moves the start of a subscriber's next digest to until, unless they unsubscribed meanwhile.
+func MarkDigestSent(ctx context.Context, db *sql.DB, userID int, until time.Time) error {
+	_, err := db.ExecContext(ctx, "UPDATE tblUsers SET user_digest_since = ? WHERE id = ? AND user_digest_since IS NOT NULL", until.UTC(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to record digest of user %d: %w", userID, err)
+	}
+	return nil
+}
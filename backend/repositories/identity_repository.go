@@ -0,0 +1,114 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/jesee-kuya/forum/backend/models"
+)
+
+// ErrIdentityLinked is returned when a provider account is already linked to a user.
+var ErrIdentityLinked = errors.New("identity already linked")
+
+// LinkIdentity links a provider account to a user. A user can link one account per provider.
+func LinkIdentity(ctx context.Context, db *sql.DB, identity models.Identity) error {
+	_, err := InsertRecord(ctx, db, "tblUserIdentities", []string{"user_id", "provider", "subject", "email", "created_on"},
+		identity.UserID, identity.Provider, identity.Subject, identity.Email, time.Now().UTC())
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrIdentityLinked
+		}
+		return fmt.Errorf("failed to link identity: %w", err)
+	}
+	return nil
+}
+
+// IdentityUser returns the id of the user a provider account is linked to, or sql.ErrNoRows.
+func IdentityUser(ctx context.Context, db *sql.DB, provider, subject string) (int, error) {
+	var userID int
+	err := db.QueryRowContext(ctx, "SELECT user_id FROM tblUserIdentities WHERE provider = ? AND subject = ?", provider, subject).Scan(&userID)
+	if err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// ListIdentities returns the provider accounts linked to a user.
+func ListIdentities(ctx context.Context, db *sql.DB, userID int) ([]models.Identity, error) {
+	query := `
+		SELECT id, user_id, provider, subject, email, created_on
+		FROM tblUserIdentities
+		WHERE user_id = ?
+		ORDER BY provider
+	`
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var identities []models.Identity
+	for rows.Next() {
+		var identity models.Identity
+		err := rows.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedOn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		identities = append(identities, identity)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return identities, nil
+}
+
+// UnlinkIdentity removes a user's link to a provider. It returns sql.ErrNoRows when none was linked.
+func UnlinkIdentity(ctx context.Context, db *sql.DB, userID int, provider string) error {
+	res, err := db.ExecContext(ctx, "DELETE FROM tblUserIdentities WHERE user_id = ? AND provider = ?", userID, provider)
+	if err != nil {
+		return fmt.Errorf("failed to unlink identity: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+/*
+CreateIdentityUser creates a user signing up through a provider, with the provider account linked. The email address counts as verified when the provider verified it.
+*/
+func CreateIdentityUser(ctx context.Context, db *sql.DB, username string, identity models.Identity, emailVerified bool) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO tblUsers (username, email, auth_provider, email_verified) VALUES (?, ?, ?, ?)",
+		username, identity.Email, identity.Provider, emailVerified)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create user: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read user id: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO tblUserIdentities (user_id, provider, subject, email, created_on) VALUES (?, ?, ?, ?, ?)",
+		id, identity.Provider, identity.Subject, identity.Email, time.Now().UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to link identity: %w", err)
+	}
+	return int(id), tx.Commit()
+}
+
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
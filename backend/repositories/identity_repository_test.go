@@ -0,0 +1,98 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/jesee-kuya/forum/backend/models"
+)
+
+func setupTestDBI(t *testing.T) *sql.DB {
+	tempDBFile := "test_identities.db"
+	db, err := sql.Open("sqlite3", tempDBFile)
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS tblUsers (
+			id INTEGER PRIMARY KEY,
+			username TEXT UNIQUE NOT NULL,
+			email TEXT UNIQUE NOT NULL,
+			auth_provider TEXT NOT NULL DEFAULT '',
+			email_verified INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE TABLE IF NOT EXISTS tblUserIdentities (
+			id INTEGER PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			provider TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			email TEXT NOT NULL DEFAULT '',
+			created_on TIMESTAMP NOT NULL,
+			UNIQUE (provider, subject),
+			UNIQUE (user_id, provider)
+		);
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create test tables: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(tempDBFile)
+	})
+	return db
+}
+
+func TestIdentities(t *testing.T) {
+	db := setupTestDBI(t)
+
+	userID, err := CreateIdentityUser(context.Background(), db, "ivan", models.Identity{Provider: "github", Subject: "42", Email: "ivan@example.com"}, true)
+	if err != nil {
+		t.Fatalf("CreateIdentityUser failed: %v", err)
+	}
+	var provider string
+	var verified bool
+	db.QueryRow("SELECT auth_provider, email_verified FROM tblUsers WHERE id = ?", userID).Scan(&provider, &verified)
+	if provider != "github" || !verified {
+		t.Errorf("new user has provider %q and verified %v", provider, verified)
+	}
+
+	if err := LinkIdentity(context.Background(), db, models.Identity{UserID: userID, Provider: "google", Subject: "g-1", Email: "ivan@gmail.example"}); err != nil {
+		t.Fatalf("LinkIdentity failed: %v", err)
+	}
+	// One account per provider per user, and each account links to one user.
+	if err := LinkIdentity(context.Background(), db, models.Identity{UserID: userID, Provider: "google", Subject: "g-2"}); !errors.Is(err, ErrIdentityLinked) {
+		t.Errorf("second google account: got %v, want ErrIdentityLinked", err)
+	}
+	if err := LinkIdentity(context.Background(), db, models.Identity{UserID: userID + 1, Provider: "github", Subject: "42"}); !errors.Is(err, ErrIdentityLinked) {
+		t.Errorf("linking a linked account: got %v, want ErrIdentityLinked", err)
+	}
+
+	if id, err := IdentityUser(context.Background(), db, "google", "g-1"); err != nil || id != userID {
+		t.Errorf("IdentityUser = %d, %v, want %d", id, err, userID)
+	}
+	if _, err := IdentityUser(context.Background(), db, "google", "unknown"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("unknown identity: got %v, want sql.ErrNoRows", err)
+	}
+
+	identities, err := ListIdentities(context.Background(), db, userID)
+	if err != nil {
+		t.Fatalf("ListIdentities failed: %v", err)
+	}
+	if len(identities) != 2 || identities[0].Provider != "github" || identities[1].Email != "ivan@gmail.example" {
+		t.Errorf("unexpected identities: %+v", identities)
+	}
+
+	if err := UnlinkIdentity(context.Background(), db, userID, "google"); err != nil {
+		t.Fatalf("UnlinkIdentity failed: %v", err)
+	}
+	if err := UnlinkIdentity(context.Background(), db, userID, "google"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("unlinking twice: got %v, want sql.ErrNoRows", err)
+	}
+}
@@ -0,0 +1,99 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jesee-kuya/forum/backend/models"
+)
+
+// InsertJob queues a job of the given type to run no earlier than runAt.
+func InsertJob(ctx context.Context, db *sql.DB, jobType, payload string, maxAttempts int, runAt time.Time) (int64, error) {
+	return InsertRecord(ctx, db, "tblJobs", []string{"job_type", "payload", "max_attempts", "run_at"}, jobType, payload, maxAttempts, runAt.UTC())
+}
+
+/*
+ClaimJob marks the oldest due pending job as running and returns it. It returns sql.ErrNoRows when no job is due.
+*/
+func ClaimJob(ctx context.Context, db *sql.DB, now time.Time) (models.Job, error) {
+	var job models.Job
+
+	query := `
+		UPDATE tblJobs
+		SET job_status = 'running', attempts = attempts + 1, updated_on = ?
+		WHERE id = (
+			SELECT id FROM tblJobs
+			WHERE job_status = 'pending' AND julianday(run_at) <= julianday(?)
+			ORDER BY julianday(run_at), id
+			LIMIT 1
+		)
+		RETURNING id, job_type, payload, job_status, attempts, max_attempts, last_error
+	`
+	err := db.QueryRowContext(ctx, query, now.UTC(), now.UTC()).Scan(&job.ID, &job.JobType, &job.Payload, &job.JobStatus, &job.Attempts, &job.MaxAttempts, &job.LastError)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return job, sql.ErrNoRows
+		}
+		return job, fmt.Errorf("failed to claim job: %w", err)
+	}
+	return job, nil
+}
+
+// CompleteJob marks a job as done.
+func CompleteJob(ctx context.Context, db *sql.DB, id int) error {
+	_, err := db.ExecContext(ctx, "UPDATE tblJobs SET job_status = 'done', last_error = '', updated_on = ? WHERE id = ?", time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to complete job %d: %w", id, err)
+	}
+	return nil
+}
+
+// RetryJob puts a failed job back in the queue to run again at runAt.
+func RetryJob(ctx context.Context, db *sql.DB, id int, jobErr string, runAt time.Time) error {
+	_, err := db.ExecContext(ctx, "UPDATE tblJobs SET job_status = 'pending', last_error = ?, run_at = ?, updated_on = ? WHERE id = ?", jobErr, runAt.UTC(), time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to reschedule job %d: %w", id, err)
+	}
+	return nil
+}
+
+// FailJob marks a job as permanently failed after it ran out of attempts.
+func FailJob(ctx context.Context, db *sql.DB, id int, jobErr string) error {
+	_, err := db.ExecContext(ctx, "UPDATE tblJobs SET job_status = 'failed', last_error = ?, updated_on = ? WHERE id = ?", jobErr, time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to mark job %d as failed: %w", id, err)
+	}
+	return nil
+}
+
+// ClearJobPayload replaces the payload of a finished job with an empty one, erasing the secrets it held.
+func ClearJobPayload(ctx context.Context, db *sql.DB, id int) error {
+	_, err := db.ExecContext(ctx, "UPDATE tblJobs SET payload = '{}' WHERE id = ? AND job_status IN ('done', 'failed')", id)
+	if err != nil {
+		return fmt.Errorf("failed to clear the payload of job %d: %w", id, err)
+	}
+	return nil
+}
+
+/*
+ResetRunningJobs returns jobs left running by a previous process, for instance after a crash, to the queue.
+*/
+func ResetRunningJobs(ctx context.Context, db *sql.DB) (int64, error) {
+	result, err := db.ExecContext(ctx, "UPDATE tblJobs SET job_status = 'pending', updated_on = ? WHERE job_status = 'running'", time.Now().UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to reset running jobs: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// DeleteFinishedJobs removes completed jobs last updated before the given time.
+func DeleteFinishedJobs(ctx context.Context, db *sql.DB, before time.Time) (int64, error) {
+	result, err := db.ExecContext(ctx, "DELETE FROM tblJobs WHERE job_status = 'done' AND julianday(updated_on) < julianday(?)", before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete finished jobs: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,109 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// RecordLoginAttempt stores a sign-in attempt. userID is 0 when the identifier matched no account.
+func RecordLoginAttempt(ctx context.Context, db *sql.DB, userID int, identifier, ip string, succeeded bool) error {
+	_, err := InsertRecord(ctx, db, "tblLoginAttempts", []string{"user_id", "identifier", "ip_address", "succeeded", "attempted_on"},
+		nullableID(userID), identifier, ip, succeeded, time.Now().UTC())
+	return err
+}
+
+// AccountLoginFailures returns how many failed sign-ins an account has had since the given time, and when the latest one happened.
+func AccountLoginFailures(ctx context.Context, db *sql.DB, userID int, since time.Time) (int, time.Time, error) {
+	return loginFailures(ctx, db, "user_id", userID, since)
+}
+
+// IPLoginFailures returns how many failed sign-ins came from an IP address since the given time, and when the latest one happened.
+func IPLoginFailures(ctx context.Context, db *sql.DB, ip string, since time.Time) (int, time.Time, error) {
+	return loginFailures(ctx, db, "ip_address", ip, since)
+}
+
+func loginFailures(ctx context.Context, db *sql.DB, column string, value interface{}, since time.Time) (int, time.Time, error) {
+	query := fmt.Sprintf(`
+		SELECT attempted_on FROM tblLoginAttempts
+		WHERE %s = ? AND succeeded = 0 AND julianday(attempted_on) >= julianday(?)
+		ORDER BY julianday(attempted_on) DESC
+	`, column)
+	rows, err := db.QueryContext(ctx, query, value, since.UTC())
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to count login failures: %w", err)
+	}
+	defer rows.Close()
+
+	var count int
+	var latest time.Time
+	for rows.Next() {
+		var attemptedOn time.Time
+		if err := rows.Scan(&attemptedOn); err != nil {
+			return 0, time.Time{}, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if count == 0 {
+			latest = attemptedOn
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, time.Time{}, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return count, latest, nil
+}
+
+// ClearLoginFailures forgets the failed sign-ins of an account after it signs in or is unlocked.
+func ClearLoginFailures(ctx context.Context, db *sql.DB, userID int) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM tblLoginAttempts WHERE user_id = ? AND succeeded = 0", userID)
+	if err != nil {
+		return fmt.Errorf("failed to clear login failures: %w", err)
+	}
+	return nil
+}
+
+// DeleteLoginAttempts removes sign-in attempts older than before.
+func DeleteLoginAttempts(ctx context.Context, db *sql.DB, before time.Time) (int64, error) {
+	result, err := db.ExecContext(ctx, "DELETE FROM tblLoginAttempts WHERE julianday(attempted_on) < julianday(?)", before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete login attempts: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// LockAccount prevents an account from signing in until the given time.
+func LockAccount(ctx context.Context, db *sql.DB, userID int, until time.Time) error {
+	_, err := db.ExecContext(ctx, "UPDATE tblUsers SET locked_until = ? WHERE id = ?", until.UTC(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to lock account: %w", err)
+	}
+	return nil
+}
+
+// UnlockAccount lifts a lockout and forgets the failed sign-ins that caused it.
+func UnlockAccount(ctx context.Context, db *sql.DB, userID int) error {
+	_, err := db.ExecContext(ctx, "UPDATE tblUsers SET locked_until = NULL WHERE id = ?", userID)
+	if err != nil {
+		return fmt.Errorf("failed to unlock account: %w", err)
+	}
+	return ClearLoginFailures(ctx, db, userID)
+}
+
+// AccountLockedUntil returns when the lockout of an account ends, or the zero time when it is not locked.
+func AccountLockedUntil(ctx context.Context, db *sql.DB, userID int) (time.Time, error) {
+	var lockedUntil sql.NullTime
+	err := db.QueryRowContext(ctx, "SELECT locked_until FROM tblUsers WHERE id = ?", userID).Scan(&lockedUntil)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read account lock: %w", err)
+	}
+	if !lockedUntil.Valid || lockedUntil.Time.Before(time.Now()) {
+		return time.Time{}, nil
+	}
+	return lockedUntil.Time, nil
+}
+
+// nullableID stores 0 as NULL in optional foreign key columns.
+func nullableID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
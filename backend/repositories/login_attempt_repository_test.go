@@ -0,0 +1,165 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// setupTestDBL initializes a temporary SQLite database with the tables used to guard sign-ins
+func setupTestDBL(t *testing.T) *sql.DB {
+	tempDBFile := "test_login_attempts.db"
+	db, err := sql.Open("sqlite3", tempDBFile)
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS tblUsers (
+			id INTEGER PRIMARY KEY,
+			username TEXT,
+			locked_until TIMESTAMP NULL
+		);
+		CREATE TABLE IF NOT EXISTS tblLoginAttempts (
+			id INTEGER PRIMARY KEY,
+			user_id INTEGER NULL,
+			identifier TEXT NOT NULL DEFAULT '',
+			ip_address TEXT NOT NULL DEFAULT '',
+			succeeded INTEGER NOT NULL DEFAULT 0,
+			attempted_on TIMESTAMP NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS tblUserTokens (
+			id INTEGER PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			purpose TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP NULL,
+			created_on TIMESTAMP NOT NULL
+		);
+		INSERT INTO tblUsers (id, username) VALUES (1, 'alice');
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create test tables: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(tempDBFile)
+	})
+
+	return db
+}
+
+func TestLoginFailures(t *testing.T) {
+	db := setupTestDBL(t)
+	since := time.Now().Add(-time.Minute)
+
+	attempts := []struct {
+		userID    int
+		ip        string
+		succeeded bool
+	}{
+		{1, "203.0.113.7", false},
+		{1, "203.0.113.7", false},
+		{0, "203.0.113.7", false},
+		{1, "198.51.100.2", true},
+	}
+	for _, a := range attempts {
+		if err := RecordLoginAttempt(context.Background(), db, a.userID, "alice", a.ip, a.succeeded); err != nil {
+			t.Fatalf("RecordLoginAttempt failed: %v", err)
+		}
+	}
+
+	count, latest, err := AccountLoginFailures(context.Background(), db, 1, since)
+	if err != nil || count != 2 || latest.IsZero() {
+		t.Errorf("AccountLoginFailures(context.Background(), ) = %d, %v, %v; want 2 failures", count, latest, err)
+	}
+	if count, _, _ := IPLoginFailures(context.Background(), db, "203.0.113.7", since); count != 3 {
+		t.Errorf("Expected 3 failures from the IP address, got %d", count)
+	}
+	if count, _, _ := AccountLoginFailures(context.Background(), db, 1, time.Now().Add(time.Minute)); count != 0 {
+		t.Errorf("Expected failures before the window to be ignored, got %d", count)
+	}
+
+	if err := ClearLoginFailures(context.Background(), db, 1); err != nil {
+		t.Fatalf("ClearLoginFailures failed: %v", err)
+	}
+	if count, _, _ := AccountLoginFailures(context.Background(), db, 1, since); count != 0 {
+		t.Errorf("Expected no failures after clearing, got %d", count)
+	}
+	// Failures that matched no account still count against the IP address
+	if count, _, _ := IPLoginFailures(context.Background(), db, "203.0.113.7", since); count != 1 {
+		t.Errorf("Expected 1 remaining failure from the IP address, got %d", count)
+	}
+}
+
+func TestLockAccount(t *testing.T) {
+	db := setupTestDBL(t)
+
+	if until, err := AccountLockedUntil(context.Background(), db, 1); err != nil || !until.IsZero() {
+		t.Fatalf("Expected account to start unlocked, got %v, %v", until, err)
+	}
+
+	if err := LockAccount(context.Background(), db, 1, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("LockAccount failed: %v", err)
+	}
+	if until, _ := AccountLockedUntil(context.Background(), db, 1); until.IsZero() {
+		t.Error("Expected account to be locked")
+	}
+
+	if err := UnlockAccount(context.Background(), db, 1); err != nil {
+		t.Fatalf("UnlockAccount failed: %v", err)
+	}
+	if until, _ := AccountLockedUntil(context.Background(), db, 1); !until.IsZero() {
+		t.Errorf("Expected account to be unlocked, locked until %v", until)
+	}
+
+	// An expired lock no longer applies
+	LockAccount(context.Background(), db, 1, time.Now().Add(-time.Minute))
+	if until, _ := AccountLockedUntil(context.Background(), db, 1); !until.IsZero() {
+		t.Errorf("Expected expired lock to be ignored, locked until %v", until)
+	}
+}
+
+func TestUserTokens(t *testing.T) {
+	db := setupTestDBL(t)
+
+	token, err := CreateUserToken(context.Background(), db, 1, "unlock_account", time.Hour)
+	if err != nil {
+		t.Fatalf("CreateUserToken failed: %v", err)
+	}
+
+	if _, err := ConsumeUserToken(context.Background(), db, "reset_password", token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected token to be rejected for another purpose, got %v", err)
+	}
+	// Looking a token up does not use it
+	if userID, err := FindUserToken(context.Background(), db, "unlock_account", token); err != nil || userID != 1 {
+		t.Fatalf("FindUserToken(context.Background(), ) = %d, %v; want user 1", userID, err)
+	}
+	userID, err := ConsumeUserToken(context.Background(), db, "unlock_account", token)
+	if err != nil || userID != 1 {
+		t.Fatalf("ConsumeUserToken(context.Background(), ) = %d, %v; want user 1", userID, err)
+	}
+	if _, err := ConsumeUserToken(context.Background(), db, "unlock_account", token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected token to be single use, got %v", err)
+	}
+
+	revoked, _ := CreateUserToken(context.Background(), db, 1, "unlock_account", time.Hour)
+	if err := DeleteUserTokens(context.Background(), db, 1, "unlock_account"); err != nil {
+		t.Fatalf("DeleteUserTokens failed: %v", err)
+	}
+	if _, err := FindUserToken(context.Background(), db, "unlock_account", revoked); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected revoked token to be rejected, got %v", err)
+	}
+
+	expired, _ := CreateUserToken(context.Background(), db, 1, "unlock_account", -time.Minute)
+	if _, err := ConsumeUserToken(context.Background(), db, "unlock_account", expired); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected expired token to be rejected, got %v", err)
+	}
+}
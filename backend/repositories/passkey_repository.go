@@ -0,0 +1,73 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jesee-kuya/forum/backend/models"
+)
+
+// StorePasskey saves a newly registered passkey.
+func StorePasskey(ctx context.Context, db *sql.DB, passkey models.Passkey) error {
+	_, err := InsertRecord(ctx, db, "tblPasskeys", []string{"user_id", "credential_id", "credential", "name", "created_on"},
+		passkey.UserID, passkey.CredentialID, passkey.Credential, passkey.Name, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to store passkey: %w", err)
+	}
+	return nil
+}
+
+// ListPasskeys returns the passkeys of a user, oldest first.
+func ListPasskeys(ctx context.Context, db *sql.DB, userID int) ([]models.Passkey, error) {
+	query := `
+		SELECT id, user_id, credential_id, credential, name, created_on, last_used_on
+		FROM tblPasskeys
+		WHERE user_id = ?
+		ORDER BY id
+	`
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var passkeys []models.Passkey
+	for rows.Next() {
+		var passkey models.Passkey
+		var lastUsed sql.NullTime
+		err := rows.Scan(&passkey.ID, &passkey.UserID, &passkey.CredentialID, &passkey.Credential, &passkey.Name, &passkey.CreatedOn, &lastUsed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		passkey.LastUsedOn = lastUsed.Time
+		passkeys = append(passkeys, passkey)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return passkeys, nil
+}
+
+// UpdatePasskeyCredential stores the credential record after a sign-in, which carries its new signature counter.
+func UpdatePasskeyCredential(ctx context.Context, db *sql.DB, credentialID, credential string) error {
+	query := "UPDATE tblPasskeys SET credential = ?, last_used_on = ? WHERE credential_id = ?"
+	if _, err := db.ExecContext(ctx, query, credential, time.Now().UTC(), credentialID); err != nil {
+		return fmt.Errorf("failed to update passkey: %w", err)
+	}
+	return nil
+}
+
+/*
+DeletePasskey removes one of a user's passkeys and returns its name. Passkeys of other users are left untouched, and sql.ErrNoRows is returned for them.
+*/
+func DeletePasskey(ctx context.Context, db *sql.DB, userID, passkeyID int) (string, error) {
+	var name string
+	err := db.QueryRowContext(ctx, "DELETE FROM tblPasskeys WHERE id = ? AND user_id = ? RETURNING name", passkeyID, userID).Scan(&name)
+	if err != nil {
+		return "", err
+	}
+	return name, nil
+}
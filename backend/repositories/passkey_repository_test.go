@@ -0,0 +1,92 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/jesee-kuya/forum/backend/models"
+)
+
+func setupTestDBK(t *testing.T) *sql.DB {
+	tempDBFile := "test_passkeys.db"
+	db, err := sql.Open("sqlite3", tempDBFile)
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS tblPasskeys (
+			id INTEGER PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			credential_id TEXT NOT NULL UNIQUE,
+			credential TEXT NOT NULL,
+			name TEXT NOT NULL DEFAULT '',
+			created_on TIMESTAMP NOT NULL,
+			last_used_on TIMESTAMP NULL
+		);
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create test table: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(tempDBFile)
+	})
+	return db
+}
+
+func TestPasskeys(t *testing.T) {
+	db := setupTestDBK(t)
+
+	for _, p := range []models.Passkey{
+		{UserID: 1, CredentialID: "cred-a", Credential: "{}", Name: "Laptop"},
+		{UserID: 1, CredentialID: "cred-b", Credential: "{}", Name: "Phone"},
+		{UserID: 2, CredentialID: "cred-c", Credential: "{}", Name: "Key"},
+	} {
+		if err := StorePasskey(context.Background(), db, p); err != nil {
+			t.Fatalf("StorePasskey failed: %v", err)
+		}
+	}
+	if err := StorePasskey(context.Background(), db, models.Passkey{UserID: 2, CredentialID: "cred-a", Credential: "{}"}); err == nil {
+		t.Error("a credential was stored twice")
+	}
+
+	passkeys, err := ListPasskeys(context.Background(), db, 1)
+	if err != nil {
+		t.Fatalf("ListPasskeys failed: %v", err)
+	}
+	if len(passkeys) != 2 || passkeys[0].Name != "Laptop" || passkeys[1].Name != "Phone" {
+		t.Fatalf("unexpected passkeys: %+v", passkeys)
+	}
+	if !passkeys[0].LastUsedOn.IsZero() {
+		t.Error("a new passkey has a last use")
+	}
+
+	if err := UpdatePasskeyCredential(context.Background(), db, "cred-a", `{"updated":true}`); err != nil {
+		t.Fatalf("UpdatePasskeyCredential failed: %v", err)
+	}
+	passkeys, _ = ListPasskeys(context.Background(), db, 1)
+	if passkeys[0].Credential != `{"updated":true}` || passkeys[0].LastUsedOn.IsZero() {
+		t.Errorf("passkey not updated: %+v", passkeys[0])
+	}
+
+	// Users cannot remove each other's passkeys.
+	other, _ := ListPasskeys(context.Background(), db, 2)
+	if _, err := DeletePasskey(context.Background(), db, 1, other[0].ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("deleting another user's passkey: got %v, want sql.ErrNoRows", err)
+	}
+
+	name, err := DeletePasskey(context.Background(), db, 1, passkeys[1].ID)
+	if err != nil || name != "Phone" {
+		t.Fatalf("DeletePasskey = %q, %v", name, err)
+	}
+	if passkeys, _ = ListPasskeys(context.Background(), db, 1); len(passkeys) != 1 {
+		t.Errorf("expected 1 passkey left, got %d", len(passkeys))
+	}
+}
@@ -1,6 +1,7 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
@@ -10,7 +11,36 @@ import (
 
 var PostQuery string
 
-func GetPosts(db *sql.DB) ([]models.Post, error) {
+// InsertPost stores a post by userID together with its categories and attachments, in one transaction so a post is never left without them. It returns the ID of the post.
+func InsertPost(ctx context.Context, db *sql.DB, userID int, title, body string, categories []string, attachments []models.Attachment) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "INSERT INTO tblPosts (post_title, body, user_id) VALUES (?, ?, ?)", title, body, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert into tblPosts: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve last insert ID for tblPosts: %w", err)
+	}
+
+	if err := insertCategories(ctx, tx, id, categories); err != nil {
+		return 0, err
+	}
+	if err := insertAttachments(ctx, tx, id, attachments); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit post: %w", err)
+	}
+	return id, nil
+}
+
+func GetPosts(ctx context.Context, db *sql.DB) ([]models.Post, error) {
 	query := `
 		SELECT p.id, p.user_id, u.username, p.post_title, p.body, p.created_on, p.media_url
 		FROM tblPosts p
@@ -19,7 +49,7 @@ func GetPosts(db *sql.DB) ([]models.Post, error) {
 		ORDER BY p.created_on DESC
 		`
 
-	rows, err := db.Query(query)
+	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
@@ -33,7 +63,7 @@ func GetPosts(db *sql.DB) ([]models.Post, error) {
 	return posts, err
 }
 
-func GetComments(db *sql.DB, id int) ([]models.Post, error) {
+func GetComments(ctx context.Context, db *sql.DB, id int) ([]models.Post, error) {
 	query := `
 		SELECT p.id, p.user_id, u.username, p.post_title, p.body, p.created_on, p.media_url
 		FROM tblPosts p
@@ -41,7 +71,7 @@ func GetComments(db *sql.DB, id int) ([]models.Post, error) {
 		WHERE p.parent_id = ? AND p.post_status = 'visible'
 		ORDER BY p.created_on DESC
 	`
-	rows, err := db.Query(query, id)
+	rows, err := db.QueryContext(ctx, query, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
@@ -55,7 +85,7 @@ func GetComments(db *sql.DB, id int) ([]models.Post, error) {
 	return posts, err
 }
 
-func FilterPostsByCategories(db *sql.DB, categories []string) ([]models.Post, error) {
+func FilterPostsByCategories(ctx context.Context, db *sql.DB, categories []string) ([]models.Post, error) {
 	placeholders := strings.Repeat("?,", len(categories)-1) + "?"
 
 	query := fmt.Sprintf(`
@@ -72,7 +102,7 @@ func FilterPostsByCategories(db *sql.DB, categories []string) ([]models.Post, er
 		args[i] = v
 	}
 
-	rows, err := db.Query(query, args...)
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %v", err)
 	}
@@ -86,7 +116,7 @@ func FilterPostsByCategories(db *sql.DB, categories []string) ([]models.Post, er
 	return posts, nil
 }
 
-func FilterPostsByUser(db *sql.DB, id int) ([]models.Post, error) {
+func FilterPostsByUser(ctx context.Context, db *sql.DB, id int) ([]models.Post, error) {
 	query := `
 		SELECT DISTINCT p.id, p.user_id, u.username, p.post_title, p.body, p.created_on, p.media_url
 		FROM tblPosts p
@@ -95,7 +125,7 @@ func FilterPostsByUser(db *sql.DB, id int) ([]models.Post, error) {
 		ORDER BY p.created_on DESC
 		`
 
-	rows, err := db.Query(query, id)
+	rows, err := db.QueryContext(ctx, query, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %v", err)
 	}
@@ -110,7 +140,7 @@ func FilterPostsByUser(db *sql.DB, id int) ([]models.Post, error) {
 }
 
 // FilterPosts - Fetch posts based on category or user
-func FilterPostsByLikes(db *sql.DB, id int) ([]models.Post, error) {
+func FilterPostsByLikes(ctx context.Context, db *sql.DB, id int) ([]models.Post, error) {
 	query := `
 		SELECT DISTINCT p.id, p.user_id, u.username, p.post_title, p.body, p.created_on, p.media_url
 		FROM tblPosts p
@@ -124,7 +154,7 @@ func FilterPostsByLikes(db *sql.DB, id int) ([]models.Post, error) {
 		ORDER BY p.created_on DESC
 		`
 
-	rows, err := db.Query(query, id)
+	rows, err := db.QueryContext(ctx, query, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %v", err)
 	}
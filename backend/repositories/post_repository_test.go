@@ -1,6 +1,7 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
 	"os"
 	"reflect"
@@ -35,6 +36,7 @@ func setupTestDBP(t *testing.T) *sql.DB {
 			created_on DATETIME,
 			parent_id INTEGER,
 			post_status TEXT DEFAULT 'visible',
+			media_url TEXT DEFAULT '',
 			FOREIGN KEY (user_id) REFERENCES tblUsers(id)
 		);
 
@@ -65,21 +67,13 @@ func TestGetPosts(t *testing.T) {
 	db := setupTestDBP(t)
 
 	// Call GetPosts
-	posts, err := GetPosts(db)
+	posts, err := GetPosts(context.Background(), db)
 	if err != nil {
 		t.Fatalf("GetPosts failed: %v", err)
 	}
 
-	// Verify the results
+	// Verify the results, newest post first
 	expectedPosts := []models.Post{
-		{
-			ID:        1,
-			UserID:    1,
-			UserName:  "user1",
-			PostTitle: "Post 1",
-			Body:      "Content 1",
-			CreatedOn: time.Date(2023, 10, 1, 10, 0, 0, 0, time.UTC),
-		},
 		{
 			ID:        2,
 			UserID:    2,
@@ -88,6 +82,14 @@ func TestGetPosts(t *testing.T) {
 			Body:      "Content 2",
 			CreatedOn: time.Date(2023, 10, 2, 11, 0, 0, 0, time.UTC),
 		},
+		{
+			ID:        1,
+			UserID:    1,
+			UserName:  "user1",
+			PostTitle: "Post 1",
+			Body:      "Content 1",
+			CreatedOn: time.Date(2023, 10, 1, 10, 0, 0, 0, time.UTC),
+		},
 	}
 
 	if len(posts) != len(expectedPosts) {
@@ -106,7 +108,7 @@ func TestGetComments(t *testing.T) {
 	db := setupTestDBP(t)
 
 	// Call GetComments for post ID 1
-	comments, err := GetComments(db, 1)
+	comments, err := GetComments(context.Background(), db, 1)
 	if err != nil {
 		t.Fatalf("GetComments failed: %v", err)
 	}
@@ -140,7 +142,7 @@ func TestProcessSQLData(t *testing.T) {
 
 	// Query rows from the database
 	rows, err := db.Query(`
-		SELECT p.id, p.user_id, u.username, p.post_title, p.body, p.created_on
+		SELECT p.id, p.user_id, u.username, p.post_title, p.body, p.created_on, p.media_url
 		FROM tblPosts p
 		JOIN tblUsers u ON p.user_id = u.id
 		WHERE p.parent_id IS NULL AND p.post_status = 'visible'
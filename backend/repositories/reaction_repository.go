@@ -1,19 +1,20 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 
 	"github.com/jesee-kuya/forum/backend/models"
 )
 
-func GetReactions(db *sql.DB, id int, react string) ([]models.Reaction, error) {
+func GetReactions(ctx context.Context, db *sql.DB, id int, react string) ([]models.Reaction, error) {
 	query := `
 		SELECT * FROM tblReactions
 		WHERE post_id = ? AND reaction = ? AND reaction_status = 'clicked'
 	`
-	rows, err := db.Query(query, id, react)
+	rows, err := db.QueryContext(ctx, query, id, react)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
@@ -40,21 +41,21 @@ func GetReactions(db *sql.DB, id int, react string) ([]models.Reaction, error) {
 	return Reactions, nil
 }
 
-func CheckReactions(db *sql.DB, userId, postId int) (bool, string) {
+func CheckReactions(ctx context.Context, db *sql.DB, userId, postId int) (bool, string) {
 	query := `
     SELECT * FROM tblReactions
     WHERE post_id = ? AND user_id = ?
 `
 
-	rows, err := db.Query(query, postId, userId)
+	rows, err := db.QueryContext(ctx, query, postId, userId)
 	if err != nil {
-		log.Println("error executing query:", err)
+		slog.Error("Error executing query", "err", err)
 		return false, ""
 	}
 	defer rows.Close()
 
 	if !rows.Next() {
-		log.Println("No matching rows found")
+		slog.Debug("No matching rows found")
 		return false, ""
 	}
 
@@ -68,21 +69,21 @@ func CheckReactions(db *sql.DB, userId, postId int) (bool, string) {
 	return true, reaction.Reaction
 }
 
-func UpdateReaction(db *sql.DB, reaction string, userId, postId int) error {
+func UpdateReaction(ctx context.Context, db *sql.DB, reaction string, userId, postId int) error {
 	query := `
 	UPDATE tblReactions
 	SET reaction = ?
 	 WHERE post_id = ? AND user_id = ?
 	`
-	_, err := db.Exec(query, reaction, postId, userId)
+	_, err := db.ExecContext(ctx, query, reaction, postId, userId)
 	if err != nil {
-		log.Println("error executing query:", err)
+		slog.Error("Error executing query", "err", err)
 		return err
 	}
 	return nil
 }
 
-func UpdateReactionStatus(db *sql.DB, userId, postId int) error {
+func UpdateReactionStatus(ctx context.Context, db *sql.DB, userId, postId int) error {
 	query := `
     UPDATE tblReactions
     SET reaction_status = 
@@ -93,9 +94,9 @@ func UpdateReactionStatus(db *sql.DB, userId, postId int) error {
     WHERE post_id = ? AND user_id = ?
 `
 
-	_, err := db.Exec(query, postId, userId)
+	_, err := db.ExecContext(ctx, query, postId, userId)
 	if err != nil {
-		log.Println("Error executing query:", err)
+		slog.Error("Error executing query", "err", err)
 		return err
 	}
 	return nil
@@ -103,15 +104,15 @@ func UpdateReactionStatus(db *sql.DB, userId, postId int) error {
 
 // AddReaction adds a reaction to the database
 
-func InsertReaction(db *sql.DB, reaction models.Reaction) error {
+func InsertReaction(ctx context.Context, db *sql.DB, reaction models.Reaction) error {
 	query := `
 	INSERT INTO tblReactions (reaction, reaction_status, user_id, post_id)
 	VALUES (?, 'clicked', ?, ?)
 `
 
-	_, err := db.Exec(query, reaction.Reaction, reaction.UserID, reaction.PostID)
+	_, err := db.ExecContext(ctx, query, reaction.Reaction, reaction.UserID, reaction.PostID)
 	if err != nil {
-		log.Println("Error executing query:", err)
+		slog.Error("Error executing query", "err", err)
 		return err
 	}
 	return nil
@@ -1,6 +1,7 @@
 package repositories
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
@@ -34,7 +35,7 @@ func TestGetReactions(t *testing.T) {
 		WillReturnRows(rows)
 
 	// Call the function under test
-	reactions, err := GetReactions(db, postID, reactionType)
+	reactions, err := GetReactions(context.Background(), db, postID, reactionType)
 	assert.NoError(t, err)
 	assert.Equal(t, expectedReactions, reactions)
 
@@ -61,7 +62,7 @@ func TestGetReactions_Error(t *testing.T) {
 		WillReturnError(fmt.Errorf("some error"))
 
 	// Call the function under test
-	reactions, err := GetReactions(db, postID, reactionType)
+	reactions, err := GetReactions(context.Background(), db, postID, reactionType)
 	assert.Error(t, err)
 	assert.Nil(t, reactions)
 
@@ -1,60 +1,94 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
-	"github.com/jesee-kuya/forum/backend/util"
+	"github.com/jesee-kuya/forum/backend/models"
 )
 
-// StoreSession creates a new session for a user with expiration time
-func StoreSession(userID int, sessionToken string, expiryTime time.Time) error {
-	_, err := InsertRecord(util.DB, "tblSessions", []string{"user_id", "session_token", "expires_at"}, userID, sessionToken, expiryTime)
+// StoreSession creates a new session for a user with expiration time and the device it was created from
+func StoreSession(ctx context.Context, db *sql.DB, session models.Session) error {
+	now := time.Now().UTC()
+	_, err := InsertRecord(ctx, db, "tblSessions",
+		[]string{"user_id", "session_token", "expires_at", "absolute_expires_at", "remember_me", "created_on", "last_seen", "ip_address", "user_agent", "device"},
+		session.UserID, session.Token, session.ExpiresAt.UTC(), session.AbsoluteExpiresAt.UTC(), session.RememberMe, now, now, session.IPAddress, session.UserAgent, session.Device)
 	if err != nil {
-		log.Println("Error inserting session:", err)
+		slog.Error("Error inserting session", "err", err)
 		return err
 	}
 	return nil
 }
 
-// ValidateSession checks if a session token is valid and not expired
-func ValidateSession(sessionToken string) (string, error) {
-	query := "SELECT user_id, expires_at FROM tblSessions WHERE session_token = ?"
-	row := util.DB.QueryRow(query, sessionToken)
+// ValidateSession checks if a session token is valid and not expired, returning the session
+func ValidateSession(ctx context.Context, db *sql.DB, sessionToken string) (models.Session, error) {
+	query := "SELECT id, user_id, expires_at, absolute_expires_at, remember_me, last_seen FROM tblSessions WHERE session_token = ?"
+	row := db.QueryRowContext(ctx, query, sessionToken)
 
-	var sessionTOken string
-	var expiresAt time.Time
+	session := models.Session{Token: sessionToken}
+	var absoluteExpiresAt, lastSeen sql.NullTime
 
-	err := row.Scan(&sessionToken, &expiresAt)
+	err := row.Scan(&session.ID, &session.UserID, &session.ExpiresAt, &absoluteExpiresAt, &session.RememberMe, &lastSeen)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return "", fmt.Errorf("invalid or expired session token")
+			return session, fmt.Errorf("invalid or expired session token")
 		}
-		return "", fmt.Errorf("error validating session: %v", err)
+		return session, fmt.Errorf("error validating session: %v", err)
 	}
 
-	if expiresAt.Before(time.Now()) {
-		_, _ = util.DB.Exec("DELETE FROM tblSessions WHERE session_token = ?", sessionToken)
-		return "", fmt.Errorf("session expired")
+	// Sessions created before renewal existed never outlive their original expiry
+	session.AbsoluteExpiresAt = session.ExpiresAt
+	if absoluteExpiresAt.Valid {
+		session.AbsoluteExpiresAt = absoluteExpiresAt.Time
 	}
-	return sessionTOken, nil
+	session.LastSeen = lastSeen.Time
+
+	now := time.Now()
+	if session.ExpiresAt.Before(now) || session.AbsoluteExpiresAt.Before(now) {
+		_, _ = db.ExecContext(ctx, "DELETE FROM tblSessions WHERE session_token = ?", sessionToken)
+		return session, fmt.Errorf("session expired")
+	}
+	return session, nil
+}
+
+// RenewSession records activity on a session and pushes its idle expiry forward
+func RenewSession(ctx context.Context, db *sql.DB, sessionToken string, now, expiresAt time.Time) error {
+	query := "UPDATE tblSessions SET last_seen = ?, expires_at = ? WHERE session_token = ?"
+	_, err := db.ExecContext(ctx, query, now.UTC(), expiresAt.UTC(), sessionToken)
+	if err != nil {
+		return fmt.Errorf("failed to renew session: %v", err)
+	}
+	return nil
+}
+
+// RotateSessionToken replaces the token of a session, keeping everything else about it
+func RotateSessionToken(ctx context.Context, db *sql.DB, oldToken, newToken string) error {
+	result, err := db.ExecContext(ctx, "UPDATE tblSessions SET session_token = ? WHERE session_token = ?", newToken, oldToken)
+	if err != nil {
+		return fmt.Errorf("failed to rotate session: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("session not found")
+	}
+	return nil
 }
 
 // DeleteSession removes a session when a user logs out
-func DeleteSession(sessionToken string) error {
+func DeleteSession(ctx context.Context, db *sql.DB, sessionToken string) error {
 	query := "DELETE FROM tblSessions WHERE session_token = ?"
-	_, err := util.DB.Exec(query, sessionToken)
+	_, err := db.ExecContext(ctx, query, sessionToken)
 	if err != nil {
 		return fmt.Errorf("failed to delete session: %v", err)
 	}
 	return nil
 }
 
-func DeleteSessionByUser(userId int) error {
+func DeleteSessionByUser(ctx context.Context, db *sql.DB, userId int) error {
 	query := "DELETE FROM tblSessions WHERE user_id = ?"
-	_, err := util.DB.Exec(query, userId)
+	_, err := db.ExecContext(ctx, query, userId)
 	if err != nil {
 		return fmt.Errorf("failed to delete session: %v", err)
 	}
@@ -62,18 +96,124 @@ func DeleteSessionByUser(userId int) error {
 }
 
 // GetSessionByUserEmail fetches the session token associated with a given user email.
-func GetSessionByUserId(user_id int) (string, error) {
+func GetSessionByUserId(ctx context.Context, db *sql.DB, user_id int) (string, error) {
 	var sessionToken string
 
 	query := "SELECT session_token FROM tblSessions WHERE user_id = ?"
-	err := util.DB.QueryRow(query, user_id).Scan(&sessionToken)
+	err := db.QueryRowContext(ctx, query, user_id).Scan(&sessionToken)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			log.Println("No session found for user:", user_id)
+			slog.Debug("No session found for user", "user_id", user_id)
 			return "", nil
 		}
-		log.Println("Error retrieving session:", err)
+		slog.Error("Error retrieving session", "err", err)
 		return "", err
 	}
 	return sessionToken, nil
 }
+
+// ListUserSessions returns the unexpired sessions of a user, most recently used first.
+func ListUserSessions(ctx context.Context, db *sql.DB, userID int) ([]models.Session, error) {
+	query := `
+		SELECT id, user_id, session_token, expires_at, created_on, last_seen, ip_address, user_agent, device
+		FROM tblSessions
+		WHERE user_id = ? AND julianday(expires_at) >= julianday(?)
+		ORDER BY julianday(COALESCE(last_seen, created_on, expires_at)) DESC
+	`
+	rows, err := db.QueryContext(ctx, query, userID, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+
+	for rows.Next() {
+		var session models.Session
+		var createdOn, lastSeen sql.NullTime
+
+		err := rows.Scan(&session.ID, &session.UserID, &session.Token, &session.ExpiresAt, &createdOn, &lastSeen, &session.IPAddress, &session.UserAgent, &session.Device)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		// Sessions created before metadata was recorded only know their expiry
+		session.CreatedOn = createdOn.Time
+		session.LastSeen = lastSeen.Time
+		if !lastSeen.Valid {
+			session.LastSeen = createdOn.Time
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return sessions, nil
+}
+
+/*
+DeleteUserSession removes one of a user's sessions and returns its token. Sessions belonging to other users are left untouched.
+*/
+func DeleteUserSession(ctx context.Context, db *sql.DB, userID, sessionID int) (string, error) {
+	var token string
+	err := db.QueryRowContext(ctx, "DELETE FROM tblSessions WHERE id = ? AND user_id = ? RETURNING session_token", sessionID, userID).Scan(&token)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("no session %d for user %d", sessionID, userID)
+		}
+		return "", fmt.Errorf("failed to delete session: %v", err)
+	}
+	return token, nil
+}
+
+// DeleteOtherSessions removes every session of a user except the one with keepToken and returns the removed tokens.
+func DeleteOtherSessions(ctx context.Context, db *sql.DB, userID int, keepToken string) ([]string, error) {
+	return deleteSessionTokens(ctx, db, "DELETE FROM tblSessions WHERE user_id = ? AND session_token != ? RETURNING session_token", userID, keepToken)
+}
+
+// DeleteUserSessions signs a user out everywhere and returns the removed tokens.
+func DeleteUserSessions(ctx context.Context, db *sql.DB, userID int) ([]string, error) {
+	return deleteSessionTokens(ctx, db, "DELETE FROM tblSessions WHERE user_id = ? RETURNING session_token", userID)
+}
+
+// CountActiveSessions returns the number of sessions that have not expired.
+func CountActiveSessions(ctx context.Context, db *sql.DB) (int, error) {
+	var count int
+	now := time.Now().UTC()
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM tblSessions WHERE julianday(expires_at) >= julianday(?) AND (absolute_expires_at IS NULL OR julianday(absolute_expires_at) >= julianday(?))", now, now).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count sessions: %w", err)
+	}
+	return count, nil
+}
+
+// DeleteExpiredSessions removes every session whose idle or absolute expiry time has passed and returns the removed tokens.
+func DeleteExpiredSessions(ctx context.Context, db *sql.DB) ([]string, error) {
+	now := time.Now().UTC()
+	return deleteSessionTokens(ctx, db, "DELETE FROM tblSessions WHERE julianday(expires_at) < julianday(?) OR (absolute_expires_at IS NOT NULL AND julianday(absolute_expires_at) < julianday(?)) RETURNING session_token", now, now)
+}
+
+func deleteSessionTokens(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete sessions: %v", err)
+	}
+	defer rows.Close()
+
+	var tokens []string
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return tokens, nil
+}
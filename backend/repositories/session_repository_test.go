@@ -0,0 +1,227 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// setupTestDBS initializes a temporary SQLite database with sessions for two users
+func setupTestDBS(t *testing.T) *sql.DB {
+	tempDBFile := "test_sessions.db"
+	db, err := sql.Open("sqlite3", tempDBFile)
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS tblSessions (
+			id INTEGER PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			session_token TEXT NOT NULL UNIQUE,
+			expires_at TIMESTAMP NULL,
+			absolute_expires_at TIMESTAMP NULL,
+			remember_me INTEGER NOT NULL DEFAULT 0,
+			created_on TIMESTAMP NULL,
+			last_seen TIMESTAMP NULL,
+			ip_address TEXT NOT NULL DEFAULT '',
+			user_agent TEXT NOT NULL DEFAULT '',
+			device TEXT NOT NULL DEFAULT ''
+		);
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create test table: %v", err)
+	}
+
+	now := time.Now().UTC()
+	sessions := []struct {
+		userID   int
+		token    string
+		expires  time.Time
+		lastSeen time.Time
+	}{
+		{1, "laptop", now.Add(time.Hour), now.Add(-time.Minute)},
+		{1, "phone", now.Add(time.Hour), now.Add(-time.Hour)},
+		{1, "stale", now.Add(-time.Hour), now.Add(-2 * time.Hour)},
+		{2, "other-user", now.Add(time.Hour), now},
+	}
+	for _, s := range sessions {
+		_, err := InsertRecord(context.Background(), db, "tblSessions", []string{"user_id", "session_token", "expires_at", "created_on", "last_seen", "device"}, s.userID, s.token, s.expires, s.lastSeen, s.lastSeen, "Firefox on Linux")
+		if err != nil {
+			t.Fatalf("Failed to insert session: %v", err)
+		}
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(tempDBFile)
+	})
+
+	return db
+}
+
+func TestListUserSessions(t *testing.T) {
+	db := setupTestDBS(t)
+
+	sessions, err := ListUserSessions(context.Background(), db, 1)
+	if err != nil {
+		t.Fatalf("ListUserSessions failed: %v", err)
+	}
+
+	if len(sessions) != 2 {
+		t.Fatalf("Expected 2 active sessions, got %d", len(sessions))
+	}
+	if sessions[0].Token != "laptop" || sessions[1].Token != "phone" {
+		t.Errorf("Expected most recently used session first, got %q then %q", sessions[0].Token, sessions[1].Token)
+	}
+	if sessions[0].Device != "Firefox on Linux" || sessions[0].LastSeen.IsZero() {
+		t.Errorf("Session metadata not loaded: %+v", sessions[0])
+	}
+}
+
+func TestDeleteUserSession(t *testing.T) {
+	db := setupTestDBS(t)
+
+	// Another user's session cannot be revoked
+	if _, err := DeleteUserSession(context.Background(), db, 1, 4); err == nil {
+		t.Fatal("Expected an error when revoking another user's session")
+	}
+
+	token, err := DeleteUserSession(context.Background(), db, 1, 2)
+	if err != nil {
+		t.Fatalf("DeleteUserSession failed: %v", err)
+	}
+	if token != "phone" {
+		t.Errorf("Expected token %q, got %q", "phone", token)
+	}
+}
+
+func TestDeleteOtherSessions(t *testing.T) {
+	db := setupTestDBS(t)
+
+	tokens, err := DeleteOtherSessions(context.Background(), db, 1, "laptop")
+	if err != nil {
+		t.Fatalf("DeleteOtherSessions failed: %v", err)
+	}
+	sort.Strings(tokens)
+	if len(tokens) != 2 || tokens[0] != "phone" || tokens[1] != "stale" {
+		t.Errorf("Unexpected revoked tokens: %v", tokens)
+	}
+
+	var remaining int
+	db.QueryRow("SELECT COUNT(*) FROM tblSessions").Scan(&remaining)
+	if remaining != 2 {
+		t.Errorf("Expected 2 remaining sessions, got %d", remaining)
+	}
+}
+
+func TestDeleteUserSessions(t *testing.T) {
+	db := setupTestDBS(t)
+
+	tokens, err := DeleteUserSessions(context.Background(), db, 1)
+	if err != nil {
+		t.Fatalf("DeleteUserSessions failed: %v", err)
+	}
+	if len(tokens) != 3 {
+		t.Errorf("Expected 3 revoked tokens, got %v", tokens)
+	}
+
+	var remaining int
+	db.QueryRow("SELECT COUNT(*) FROM tblSessions").Scan(&remaining)
+	if remaining != 1 {
+		t.Errorf("Expected only the other user's session to remain, got %d", remaining)
+	}
+}
+
+func TestDeleteExpiredSessions(t *testing.T) {
+	db := setupTestDBS(t)
+
+	// A remember me session kept alive by activity past its absolute expiry
+	now := time.Now().UTC()
+	_, err := InsertRecord(context.Background(), db, "tblSessions", []string{"user_id", "session_token", "expires_at", "absolute_expires_at", "remember_me"}, 2, "outlived", now.Add(time.Hour), now.Add(-time.Minute), true)
+	if err != nil {
+		t.Fatalf("Failed to insert session: %v", err)
+	}
+
+	tokens, err := DeleteExpiredSessions(context.Background(), db)
+	if err != nil {
+		t.Fatalf("DeleteExpiredSessions failed: %v", err)
+	}
+	sort.Strings(tokens)
+	if len(tokens) != 2 || tokens[0] != "outlived" || tokens[1] != "stale" {
+		t.Errorf("Expected the idle and the outlived sessions to be reaped, got %v", tokens)
+	}
+}
+
+func TestCountActiveSessions(t *testing.T) {
+	db := setupTestDBS(t)
+
+	count, err := CountActiveSessions(context.Background(), db)
+	if err != nil {
+		t.Fatalf("CountActiveSessions failed: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 active sessions, got %d", count)
+	}
+}
+
+func TestValidateAndRenewSession(t *testing.T) {
+	db := setupTestDBS(t)
+
+	session, err := ValidateSession(context.Background(), db, "laptop")
+	if err != nil {
+		t.Fatalf("ValidateSession failed: %v", err)
+	}
+	if session.UserID != 1 || session.RememberMe {
+		t.Errorf("Unexpected session: %+v", session)
+	}
+	// Sessions without an absolute expiry end at their current expiry
+	if !session.AbsoluteExpiresAt.Equal(session.ExpiresAt) {
+		t.Errorf("Expected absolute expiry %v, got %v", session.ExpiresAt, session.AbsoluteExpiresAt)
+	}
+
+	now := time.Now()
+	if err := RenewSession(context.Background(), db, "laptop", now, now.Add(2*time.Hour)); err != nil {
+		t.Fatalf("RenewSession failed: %v", err)
+	}
+	renewed, err := ValidateSession(context.Background(), db, "laptop")
+	if err != nil {
+		t.Fatalf("ValidateSession after renewal failed: %v", err)
+	}
+	if renewed.ExpiresAt.Sub(now) < 119*time.Minute {
+		t.Errorf("Expected expiry to slide forward, got %v", renewed.ExpiresAt)
+	}
+
+	if _, err := ValidateSession(context.Background(), db, "stale"); err == nil {
+		t.Error("Expected expired session to be rejected")
+	}
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM tblSessions WHERE session_token = 'stale'").Scan(&count)
+	if count != 0 {
+		t.Error("Expected expired session to be deleted")
+	}
+}
+
+func TestRotateSessionToken(t *testing.T) {
+	db := setupTestDBS(t)
+
+	if err := RotateSessionToken(context.Background(), db, "phone", "phone-rotated"); err != nil {
+		t.Fatalf("RotateSessionToken failed: %v", err)
+	}
+	if _, err := ValidateSession(context.Background(), db, "phone"); err == nil {
+		t.Error("Expected old token to be invalid")
+	}
+	session, err := ValidateSession(context.Background(), db, "phone-rotated")
+	if err != nil || session.UserID != 1 {
+		t.Errorf("Expected rotated token to belong to user 1, got %+v (%v)", session, err)
+	}
+
+	if err := RotateSessionToken(context.Background(), db, "missing", "anything"); err == nil {
+		t.Error("Expected error rotating an unknown session")
+	}
+}
@@ -0,0 +1,218 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jesee-kuya/forum/backend/models"
+)
+
+// SettingTwoFactorRoles names the site setting listing the roles that must use two-factor authentication.
+const SettingTwoFactorRoles = "two_factor_required_roles"
+
+// GetTwoFactor returns the TOTP settings of a user.
+func GetTwoFactor(ctx context.Context, db *sql.DB, userID int) (models.TwoFactor, error) {
+	var tf models.TwoFactor
+	var secret sql.NullString
+	query := "SELECT totp_secret, totp_enabled, totp_last_step FROM tblUsers WHERE id = ?"
+	if err := db.QueryRowContext(ctx, query, userID).Scan(&secret, &tf.Enabled, &tf.LastStep); err != nil {
+		return tf, fmt.Errorf("failed to get two-factor settings: %w", err)
+	}
+	tf.Secret = secret.String
+	return tf, nil
+}
+
+// SetPendingTOTPSecret stores a secret the user has yet to confirm with a code. It does nothing once two-factor authentication is enabled.
+func SetPendingTOTPSecret(ctx context.Context, db *sql.DB, userID int, secret string) error {
+	_, err := db.ExecContext(ctx, "UPDATE tblUsers SET totp_secret = ? WHERE id = ? AND totp_enabled = 0", secret, userID)
+	if err != nil {
+		return fmt.Errorf("failed to store TOTP secret: %w", err)
+	}
+	return nil
+}
+
+// EnableTwoFactor turns on two-factor authentication with the pending secret, marking the code that confirmed it as used.
+func EnableTwoFactor(ctx context.Context, db *sql.DB, userID int, step int64) error {
+	_, err := db.ExecContext(ctx, "UPDATE tblUsers SET totp_enabled = 1, totp_last_step = ? WHERE id = ? AND totp_secret IS NOT NULL", step, userID)
+	if err != nil {
+		return fmt.Errorf("failed to enable two-factor authentication: %w", err)
+	}
+	return nil
+}
+
+// DisableTwoFactor turns off two-factor authentication and forgets the secret and recovery codes.
+func DisableTwoFactor(ctx context.Context, db *sql.DB, userID int) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "UPDATE tblUsers SET totp_secret = NULL, totp_enabled = 0, totp_last_step = 0 WHERE id = ?", userID); err != nil {
+		return fmt.Errorf("failed to disable two-factor authentication: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM tblRecoveryCodes WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	return tx.Commit()
+}
+
+/*
+UseTOTPStep records that the code of a period was used. It returns false if that period or a later one was used already, so each code works only once.
+*/
+func UseTOTPStep(ctx context.Context, db *sql.DB, userID int, step int64) (bool, error) {
+	result, err := db.ExecContext(ctx, "UPDATE tblUsers SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?", step, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("failed to record TOTP step: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to record TOTP step: %w", err)
+	}
+	return rows == 1, nil
+}
+
+// ReplaceRecoveryCodes stores the hashes of a new set of recovery codes, invalidating the previous set.
+func ReplaceRecoveryCodes(ctx context.Context, db *sql.DB, userID int, hashes []string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM tblRecoveryCodes WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	now := time.Now().UTC()
+	for _, hash := range hashes {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO tblRecoveryCodes (user_id, code_hash, created_on) VALUES (?, ?, ?)", userID, hash, now); err != nil {
+			return fmt.Errorf("failed to store recovery code: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// UseRecoveryCode marks an unused recovery code as used. It returns ErrInvalidToken if the user has no such code.
+func UseRecoveryCode(ctx context.Context, db *sql.DB, userID int, hash string) error {
+	query := "UPDATE tblRecoveryCodes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL"
+	result, err := db.ExecContext(ctx, query, time.Now().UTC(), userID, hash)
+	if err != nil {
+		return fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	if rows == 0 {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// CountRecoveryCodes returns how many unused recovery codes a user has left.
+func CountRecoveryCodes(ctx context.Context, db *sql.DB, userID int) (int, error) {
+	var count int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM tblRecoveryCodes WHERE user_id = ? AND used_at IS NULL", userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+	return count, nil
+}
+
+// GetUserRole returns the role of a user.
+func GetUserRole(ctx context.Context, db *sql.DB, userID int) (string, error) {
+	var role string
+	if err := db.QueryRowContext(ctx, "SELECT user_role FROM tblUsers WHERE id = ?", userID).Scan(&role); err != nil {
+		return "", fmt.Errorf("failed to get user role: %w", err)
+	}
+	return role, nil
+}
+
+// GetSetting returns the value of a site setting, or "" when it was never set.
+func GetSetting(ctx context.Context, db *sql.DB, name string) (string, error) {
+	var value string
+	err := db.QueryRowContext(ctx, "SELECT value FROM tblSiteSettings WHERE name = ?", name).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get setting %s: %w", name, err)
+	}
+	return value, nil
+}
+
+// SetSetting stores the value of a site setting.
+func SetSetting(ctx context.Context, db *sql.DB, name, value string) error {
+	query := "INSERT INTO tblSiteSettings (name, value) VALUES (?, ?) ON CONFLICT (name) DO UPDATE SET value = excluded.value"
+	if _, err := db.ExecContext(ctx, query, name, value); err != nil {
+		return fmt.Errorf("failed to store setting %s: %w", name, err)
+	}
+	return nil
+}
+
+// TwoFactorRequiredRoles returns the roles whose members must use two-factor authentication.
+func TwoFactorRequiredRoles(ctx context.Context, db *sql.DB) ([]string, error) {
+	value, err := GetSetting(ctx, db, SettingTwoFactorRoles)
+	if err != nil || value == "" {
+		return nil, err
+	}
+	return strings.Split(value, ","), nil
+}
+
+// SetTwoFactorRequiredRoles sets the roles whose members must use two-factor authentication.
+func SetTwoFactorRequiredRoles(ctx context.Context, db *sql.DB, roles []string) error {
+	return SetSetting(ctx, db, SettingTwoFactorRoles, strings.Join(roles, ","))
+}
+
+/*
+TwoFactorEnrollmentRequired reports whether a user's role requires two-factor authentication that they have not enabled yet.
+*/
+func TwoFactorEnrollmentRequired(ctx context.Context, db *sql.DB, userID int) (bool, error) {
+	roles, err := TwoFactorRequiredRoles(ctx, db)
+	if err != nil || len(roles) == 0 {
+		return false, err
+	}
+
+	var role string
+	var enabled bool
+	if err := db.QueryRowContext(ctx, "SELECT user_role, totp_enabled FROM tblUsers WHERE id = ?", userID).Scan(&role, &enabled); err != nil {
+		return false, fmt.Errorf("failed to check two-factor requirement: %w", err)
+	}
+	if enabled {
+		return false, nil
+	}
+	for _, required := range roles {
+		if role == required {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ListStaff returns the moderators and admins, with whether they use two-factor authentication.
+func ListStaff(ctx context.Context, db *sql.DB) ([]models.StaffMember, error) {
+	query := `
+		SELECT username, user_role, totp_enabled FROM tblUsers
+		WHERE user_role IN (?, ?)
+		ORDER BY user_role, username
+	`
+	rows, err := db.QueryContext(ctx, query, models.RoleModerator, models.RoleAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list staff: %w", err)
+	}
+	defer rows.Close()
+
+	var staff []models.StaffMember
+	for rows.Next() {
+		var member models.StaffMember
+		if err := rows.Scan(&member.Username, &member.Role, &member.TwoFactorEnabled); err != nil {
+			return nil, fmt.Errorf("failed to scan staff member: %w", err)
+		}
+		staff = append(staff, member)
+	}
+	return staff, rows.Err()
+}
@@ -0,0 +1,126 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func setupTestDBT(t *testing.T) *sql.DB {
+	db := setupTestDBL(t)
+	_, err := db.Exec(`
+		ALTER TABLE tblUsers ADD COLUMN user_role TEXT NOT NULL DEFAULT 'user';
+		ALTER TABLE tblUsers ADD COLUMN totp_secret TEXT NULL;
+		ALTER TABLE tblUsers ADD COLUMN totp_enabled INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE tblUsers ADD COLUMN totp_last_step INTEGER NOT NULL DEFAULT 0;
+		INSERT INTO tblUsers (id, username, user_role) VALUES (2, 'mod', 'moderator');
+		CREATE TABLE IF NOT EXISTS tblRecoveryCodes (
+			id INTEGER PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			code_hash TEXT NOT NULL,
+			used_at TIMESTAMP NULL,
+			created_on TIMESTAMP NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS tblSiteSettings (
+			name TEXT PRIMARY KEY,
+			value TEXT NOT NULL
+		);
+	`)
+	if err != nil {
+		t.Fatalf("Failed to set up two-factor tables: %v", err)
+	}
+	return db
+}
+
+func TestTwoFactorLifecycle(t *testing.T) {
+	db := setupTestDBT(t)
+
+	if err := SetPendingTOTPSecret(context.Background(), db, 1, "SECRET"); err != nil {
+		t.Fatalf("SetPendingTOTPSecret failed: %v", err)
+	}
+	if tf, _ := GetTwoFactor(context.Background(), db, 1); tf.Secret != "SECRET" || tf.Enabled {
+		t.Fatalf("Expected a pending secret, got %+v", tf)
+	}
+
+	if err := EnableTwoFactor(context.Background(), db, 1, 100); err != nil {
+		t.Fatalf("EnableTwoFactor failed: %v", err)
+	}
+	// An enabled secret cannot be swapped for another one
+	SetPendingTOTPSecret(context.Background(), db, 1, "OTHER")
+	if tf, _ := GetTwoFactor(context.Background(), db, 1); tf.Secret != "SECRET" || !tf.Enabled {
+		t.Fatalf("Expected two-factor to be enabled with the first secret, got %+v", tf)
+	}
+
+	// The code that confirmed enrollment and older ones cannot be reused
+	if fresh, _ := UseTOTPStep(context.Background(), db, 1, 100); fresh {
+		t.Error("Expected the enrollment step to be used up")
+	}
+	if fresh, _ := UseTOTPStep(context.Background(), db, 1, 101); !fresh {
+		t.Error("Expected a later step to be accepted")
+	}
+	if fresh, _ := UseTOTPStep(context.Background(), db, 1, 101); fresh {
+		t.Error("Expected a replayed step to be rejected")
+	}
+
+	if err := DisableTwoFactor(context.Background(), db, 1); err != nil {
+		t.Fatalf("DisableTwoFactor failed: %v", err)
+	}
+	if tf, _ := GetTwoFactor(context.Background(), db, 1); tf.Secret != "" || tf.Enabled || tf.LastStep != 0 {
+		t.Errorf("Expected two-factor settings to be cleared, got %+v", tf)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	db := setupTestDBT(t)
+
+	if err := ReplaceRecoveryCodes(context.Background(), db, 1, []string{"a", "b"}); err != nil {
+		t.Fatalf("ReplaceRecoveryCodes failed: %v", err)
+	}
+	if err := UseRecoveryCode(context.Background(), db, 1, "a"); err != nil {
+		t.Fatalf("UseRecoveryCode failed: %v", err)
+	}
+	if err := UseRecoveryCode(context.Background(), db, 1, "a"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected a used code to be rejected, got %v", err)
+	}
+	if err := UseRecoveryCode(context.Background(), db, 2, "b"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected another user's code to be rejected, got %v", err)
+	}
+	if left, _ := CountRecoveryCodes(context.Background(), db, 1); left != 1 {
+		t.Errorf("Expected 1 code left, got %d", left)
+	}
+
+	ReplaceRecoveryCodes(context.Background(), db, 1, []string{"c"})
+	if err := UseRecoveryCode(context.Background(), db, 1, "b"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected replaced codes to be rejected, got %v", err)
+	}
+}
+
+func TestTwoFactorEnrollmentRequired(t *testing.T) {
+	db := setupTestDBT(t)
+
+	if required, err := TwoFactorEnrollmentRequired(context.Background(), db, 2); err != nil || required {
+		t.Fatalf("Expected no requirement without a policy, got %v (%v)", required, err)
+	}
+
+	if err := SetTwoFactorRequiredRoles(context.Background(), db, []string{"moderator", "admin"}); err != nil {
+		t.Fatalf("SetTwoFactorRequiredRoles failed: %v", err)
+	}
+	if required, _ := TwoFactorEnrollmentRequired(context.Background(), db, 2); !required {
+		t.Error("Expected the moderator to be required to enroll")
+	}
+	if required, _ := TwoFactorEnrollmentRequired(context.Background(), db, 1); required {
+		t.Error("Expected a regular user not to be required to enroll")
+	}
+
+	SetPendingTOTPSecret(context.Background(), db, 2, "SECRET")
+	EnableTwoFactor(context.Background(), db, 2, 1)
+	if required, _ := TwoFactorEnrollmentRequired(context.Background(), db, 2); required {
+		t.Error("Expected an enrolled moderator to pass")
+	}
+
+	staff, err := ListStaff(context.Background(), db)
+	if err != nil || len(staff) != 1 || staff[0].Username != "mod" || !staff[0].TwoFactorEnabled {
+		t.Errorf("Unexpected staff list %+v (%v)", staff, err)
+	}
+}
@@ -0,0 +1,168 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// IsEmailVerified reports whether a user has confirmed their email address.
+func IsEmailVerified(ctx context.Context, db *sql.DB, userID int) (bool, error) {
+	var verified bool
+	err := db.QueryRowContext(ctx, "SELECT email_verified FROM tblUsers WHERE id = ?", userID).Scan(&verified)
+	if err != nil {
+		return false, fmt.Errorf("failed to read email verification: %w", err)
+	}
+	return verified, nil
+}
+
+/*
+MarkEmailVerified confirms the email address of a user. It only succeeds while the address is still the one the link was sent to, and returns sql.ErrNoRows otherwise.
+*/
+func MarkEmailVerified(ctx context.Context, db *sql.DB, userID int, email string) error {
+	result, err := db.ExecContext(ctx, "UPDATE tblUsers SET email_verified = 1 WHERE id = ? AND email = ?", userID, email)
+	if err != nil {
+		return fmt.Errorf("failed to verify email: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// UpdatePassword replaces the password hash of a user.
+func UpdatePassword(ctx context.Context, db *sql.DB, userID int, hash string) error {
+	_, err := db.ExecContext(ctx, "UPDATE tblUsers SET user_password = ? WHERE id = ?", hash, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	return nil
+}
+
+/*
+UsernameAvailable reports whether a username can be taken by the user with the given id, or by a new user when userID is 0. Names other users had before renaming stay reserved, so links to their old names cannot be taken over.
+*/
+func UsernameAvailable(ctx context.Context, db *sql.DB, username string, userID int) (bool, error) {
+	query := `
+		SELECT COUNT(*) FROM (
+			SELECT id AS user_id FROM tblUsers WHERE username = ?
+			UNION ALL
+			SELECT user_id FROM tblUsernameHistory WHERE username = ?
+		) WHERE user_id != ?
+	`
+	var count int
+	if err := db.QueryRowContext(ctx, query, username, username, userID).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to check username: %w", err)
+	}
+	return count == 0, nil
+}
+
+// EmailAvailable reports whether an email address can be used by the user with the given id, or by a new user when userID is 0.
+func EmailAvailable(ctx context.Context, db *sql.DB, email string, userID int) (bool, error) {
+	var count int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM tblUsers WHERE email = ? AND id != ?", email, userID).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to check email: %w", err)
+	}
+	return count == 0, nil
+}
+
+// UpdateUsername renames a user, keeping the old name so links to it can be redirected.
+func UpdateUsername(ctx context.Context, db *sql.DB, userID int, oldName, newName string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "UPDATE tblUsers SET username = ? WHERE id = ?", newName, userID); err != nil {
+		return fmt.Errorf("failed to update username: %w", err)
+	}
+	query := `
+		INSERT INTO tblUsernameHistory (user_id, username, changed_on) VALUES (?, ?, ?)
+		ON CONFLICT (username) DO UPDATE SET user_id = excluded.user_id, changed_on = excluded.changed_on
+	`
+	if _, err := tx.ExecContext(ctx, query, userID, oldName, time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to record old username: %w", err)
+	}
+	// Taking back an old name makes it current again
+	if _, err := tx.ExecContext(ctx, "DELETE FROM tblUsernameHistory WHERE username = ?", newName); err != nil {
+		return fmt.Errorf("failed to update username history: %w", err)
+	}
+	return tx.Commit()
+}
+
+// ResolveUsername returns the current name of the user who has or once had the given username.
+func ResolveUsername(ctx context.Context, db *sql.DB, username string) (string, error) {
+	query := `
+		SELECT u.username FROM tblUsers u WHERE u.username = ?
+		UNION ALL
+		SELECT u.username FROM tblUsernameHistory h JOIN tblUsers u ON u.id = h.user_id WHERE h.username = ?
+		LIMIT 1
+	`
+	var current string
+	err := db.QueryRowContext(ctx, query, username, username).Scan(&current)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", sql.ErrNoRows
+		}
+		return "", fmt.Errorf("failed to resolve username: %w", err)
+	}
+	return current, nil
+}
+
+// UpdateEmail changes the email address of a user to one they have just confirmed.
+func UpdateEmail(ctx context.Context, db *sql.DB, userID int, email string) error {
+	_, err := db.ExecContext(ctx, "UPDATE tblUsers SET email = ?, email_verified = 1 WHERE id = ?", email, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update email: %w", err)
+	}
+	return nil
+}
+
+// GetUserLanguage returns the language a user chose for the forum, or "" when they have not chosen one.
+func GetUserLanguage(ctx context.Context, db *sql.DB, userID int) (string, error) {
+	var lang string
+	err := db.QueryRowContext(ctx, "SELECT user_language FROM tblUsers WHERE id = ?", userID).Scan(&lang)
+	if err != nil {
+		return "", fmt.Errorf("failed to read language: %w", err)
+	}
+	return lang, nil
+}
+
+// SetUserLanguage saves the language a user chose for the forum.
+func SetUserLanguage(ctx context.Context, db *sql.DB, userID int, lang string) error {
+	_, err := db.ExecContext(ctx, "UPDATE tblUsers SET user_language = ? WHERE id = ?", lang, userID)
+	if err != nil {
+		return fmt.Errorf("failed to save language: %w", err)
+	}
+	return nil
+}
+
+// GetUserDigest reports whether a user receives the digest emails.
+func GetUserDigest(ctx context.Context, db *sql.DB, userID int) (bool, error) {
+	var subscribed bool
+	err := db.QueryRowContext(ctx, "SELECT user_digest_since IS NOT NULL FROM tblUsers WHERE id = ?", userID).Scan(&subscribed)
+	if err != nil {
+		return false, fmt.Errorf("failed to read digest subscription: %w", err)
+	}
+	return subscribed, nil
+}
+
+/*
+SetUserDigest subscribes a user to the digest emails or unsubscribes them. A new subscription covers the posts made from now on; subscribing again keeps the start of the next digest.
+*/
+func SetUserDigest(ctx context.Context, db *sql.DB, userID int, subscribed bool) error {
+	var err error
+	if subscribed {
+		_, err = db.ExecContext(ctx, "UPDATE tblUsers SET user_digest_since = COALESCE(user_digest_since, ?) WHERE id = ?", time.Now().UTC(), userID)
+	} else {
+		_, err = db.ExecContext(ctx, "UPDATE tblUsers SET user_digest_since = NULL WHERE id = ?", userID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save digest subscription: %w", err)
+	}
+	return nil
+}
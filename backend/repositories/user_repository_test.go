@@ -0,0 +1,138 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestEmailVerification(t *testing.T) {
+	db := setupTestDBL(t)
+	_, err := db.Exec(`
+		ALTER TABLE tblUsers ADD COLUMN email TEXT;
+		ALTER TABLE tblUsers ADD COLUMN email_verified INTEGER NOT NULL DEFAULT 0;
+		UPDATE tblUsers SET email = 'alice@example.com' WHERE id = 1;
+	`)
+	if err != nil {
+		t.Fatalf("Failed to add user columns: %v", err)
+	}
+
+	if verified, err := IsEmailVerified(context.Background(), db, 1); err != nil || verified {
+		t.Fatalf("Expected new user to be unverified, got %v (%v)", verified, err)
+	}
+
+	// A link sent to an address the user no longer has must not verify the new one
+	if err := MarkEmailVerified(context.Background(), db, 1, "old@example.com"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected stale address to be rejected, got %v", err)
+	}
+
+	if err := MarkEmailVerified(context.Background(), db, 1, "alice@example.com"); err != nil {
+		t.Fatalf("MarkEmailVerified failed: %v", err)
+	}
+	if verified, _ := IsEmailVerified(context.Background(), db, 1); !verified {
+		t.Error("Expected user to be verified")
+	}
+}
+
+func setupUsernameHistory(t *testing.T) *sql.DB {
+	db := setupTestDBL(t)
+	_, err := db.Exec(`
+		ALTER TABLE tblUsers ADD COLUMN email TEXT;
+		ALTER TABLE tblUsers ADD COLUMN email_verified INTEGER NOT NULL DEFAULT 0;
+		UPDATE tblUsers SET email = 'alice@example.com' WHERE id = 1;
+		INSERT INTO tblUsers (id, username, email) VALUES (2, 'bob', 'bob@example.com');
+		CREATE TABLE IF NOT EXISTS tblUsernameHistory (
+			id INTEGER PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			username TEXT NOT NULL UNIQUE,
+			changed_on TIMESTAMP NOT NULL
+		);
+	`)
+	if err != nil {
+		t.Fatalf("Failed to set up users: %v", err)
+	}
+	return db
+}
+
+func TestUpdateUsername(t *testing.T) {
+	db := setupUsernameHistory(t)
+
+	if err := UpdateUsername(context.Background(), db, 1, "alice", "alicia"); err != nil {
+		t.Fatalf("UpdateUsername failed: %v", err)
+	}
+
+	current, err := ResolveUsername(context.Background(), db, "alice")
+	if err != nil || current != "alicia" {
+		t.Errorf("Expected old name to resolve to alicia, got %q (%v)", current, err)
+	}
+	if current, _ := ResolveUsername(context.Background(), db, "alicia"); current != "alicia" {
+		t.Errorf("Expected current name to resolve to itself, got %q", current)
+	}
+	if _, err := ResolveUsername(context.Background(), db, "carol"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected unknown name to be sql.ErrNoRows, got %v", err)
+	}
+
+	// Alice's old name stays reserved for her
+	if available, _ := UsernameAvailable(context.Background(), db, "alice", 2); available {
+		t.Error("Expected an old name to be taken for other users")
+	}
+	if available, _ := UsernameAvailable(context.Background(), db, "alice", 1); !available {
+		t.Error("Expected an old name to be available to its former owner")
+	}
+
+	// Taking it back makes it current again
+	if err := UpdateUsername(context.Background(), db, 1, "alicia", "alice"); err != nil {
+		t.Fatalf("UpdateUsername failed: %v", err)
+	}
+	if current, _ := ResolveUsername(context.Background(), db, "alicia"); current != "alice" {
+		t.Errorf("Expected alicia to redirect to alice, got %q", current)
+	}
+	if current, _ := ResolveUsername(context.Background(), db, "alice"); current != "alice" {
+		t.Errorf("Expected alice to be current, got %q", current)
+	}
+}
+
+func TestAvailabilityAndUpdateEmail(t *testing.T) {
+	db := setupUsernameHistory(t)
+
+	if available, _ := UsernameAvailable(context.Background(), db, "bob", 0); available {
+		t.Error("Expected bob to be taken")
+	}
+	if available, _ := UsernameAvailable(context.Background(), db, "carol", 0); !available {
+		t.Error("Expected carol to be available")
+	}
+	if available, _ := EmailAvailable(context.Background(), db, "bob@example.com", 1); available {
+		t.Error("Expected bob's address to be taken for alice")
+	}
+	if available, _ := EmailAvailable(context.Background(), db, "alice@example.com", 1); !available {
+		t.Error("Expected alice's own address to be available to her")
+	}
+
+	if err := UpdateEmail(context.Background(), db, 1, "alice@example.org"); err != nil {
+		t.Fatalf("UpdateEmail failed: %v", err)
+	}
+	var email string
+	var verified bool
+	db.QueryRow("SELECT email, email_verified FROM tblUsers WHERE id = 1").Scan(&email, &verified)
+	if email != "alice@example.org" || !verified {
+		t.Errorf("Expected confirmed new address, got %q verified=%v", email, verified)
+	}
+}
+
+func TestUserLanguage(t *testing.T) {
+	db := setupTestDBL(t)
+	if _, err := db.Exec("ALTER TABLE tblUsers ADD COLUMN user_language TEXT NOT NULL DEFAULT ''"); err != nil {
+		t.Fatalf("Failed to add user column: %v", err)
+	}
+
+	if lang, err := GetUserLanguage(context.Background(), db, 1); err != nil || lang != "" {
+		t.Fatalf("Expected no language before one is chosen, got %q (%v)", lang, err)
+	}
+	if err := SetUserLanguage(context.Background(), db, 1, "sw"); err != nil {
+		t.Fatalf("SetUserLanguage failed: %v", err)
+	}
+	if lang, _ := GetUserLanguage(context.Background(), db, 1); lang != "sw" {
+		t.Errorf("Expected the saved language, got %q", lang)
+	}
+}
@@ -0,0 +1,83 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jesee-kuya/forum/backend/util"
+)
+
+// ErrInvalidToken is returned for tokens that are unknown, expired, already used or meant for something else.
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+/*
+CreateUserToken issues a single-use token for an emailed link, such as unlocking an account. Only a hash of the token is stored, so the returned value is the only copy.
+*/
+func CreateUserToken(ctx context.Context, db *sql.DB, userID int, purpose string, ttl time.Duration) (string, error) {
+	token := util.RandomToken(32)
+	now := time.Now().UTC()
+	_, err := InsertRecord(ctx, db, "tblUserTokens", []string{"user_id", "purpose", "token_hash", "expires_at", "created_on"},
+		userID, purpose, util.HashToken(token), now.Add(ttl), now)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConsumeUserToken marks a token as used and returns the user it was issued to.
+func ConsumeUserToken(ctx context.Context, db *sql.DB, purpose, token string) (int, error) {
+	var userID int
+	query := `
+		UPDATE tblUserTokens SET used_at = ?
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND julianday(expires_at) >= julianday(?)
+		RETURNING user_id
+	`
+	now := time.Now().UTC()
+	err := db.QueryRowContext(ctx, query, now, util.HashToken(token), purpose, now).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidToken
+		}
+		return 0, fmt.Errorf("failed to consume token: %w", err)
+	}
+	return userID, nil
+}
+
+// FindUserToken returns the user a token was issued to without using it up, for showing the form a link leads to.
+func FindUserToken(ctx context.Context, db *sql.DB, purpose, token string) (int, error) {
+	var userID int
+	query := `
+		SELECT user_id FROM tblUserTokens
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND julianday(expires_at) >= julianday(?)
+	`
+	err := db.QueryRowContext(ctx, query, util.HashToken(token), purpose, time.Now().UTC()).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidToken
+		}
+		return 0, fmt.Errorf("failed to find token: %w", err)
+	}
+	return userID, nil
+}
+
+// DeleteUserTokens revokes every outstanding token a user has for the given purpose.
+func DeleteUserTokens(ctx context.Context, db *sql.DB, userID int, purpose string) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM tblUserTokens WHERE user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose)
+	if err != nil {
+		return fmt.Errorf("failed to delete user tokens: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredUserTokens removes tokens that expired or were used before the given time.
+func DeleteExpiredUserTokens(ctx context.Context, db *sql.DB, before time.Time) (int64, error) {
+	query := "DELETE FROM tblUserTokens WHERE julianday(expires_at) < julianday(?) OR julianday(used_at) < julianday(?)"
+	result, err := db.ExecContext(ctx, query, before.UTC(), before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete user tokens: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -4,38 +4,102 @@ import (
 	"net/http"
 
 	"github.com/jesee-kuya/forum/backend/handler"
+	"github.com/jesee-kuya/forum/backend/metrics"
 	"github.com/jesee-kuya/forum/backend/middleware"
+	"github.com/jesee-kuya/forum/backend/models"
 	openauth "github.com/jesee-kuya/forum/backend/open_auth"
+	"github.com/jesee-kuya/forum/backend/tracing"
+	"github.com/jesee-kuya/forum/backend/util"
 )
 
-func InitRoutes() *http.ServeMux {
-	r := http.NewServeMux()
+// InitRoutes registers the routes of app and the sign-in flows of auth, leaving out those of the features turned off.
+func InitRoutes(app *handler.App, auth *openauth.Service) *http.ServeMux {
+	mux := http.NewServeMux()
+	cfg := app.Config
+
+	// Every route is counted, timed and traced under the pattern it is registered with
+	handle := func(pattern string, h http.Handler) {
+		mux.Handle(pattern, metrics.Instrument(pattern, tracing.Route(pattern, h)))
+	}
+	handleFunc := func(pattern string, h http.HandlerFunc) {
+		handle(pattern, h)
+	}
 
 	fs := http.FileServer(http.Dir("./frontend"))
-	r.Handle("/frontend/", http.StripPrefix("/frontend/", fs))
+	handle("/frontend/", http.StripPrefix("/frontend/", fs))
+
+	uploadFs := http.FileServer(http.Dir(cfg.Uploads.Dir))
+	handle("/uploads/", http.StripPrefix("/uploads/", uploadFs))
+
+	// Rate limits, counted per signed in user or else per client IP address
+	posting := middleware.RateLimit(middleware.PerMinute(5, 5))
+	commenting := middleware.RateLimit(middleware.PerMinute(10, 10))
+	reacting := middleware.RateLimit(middleware.PerMinute(60, 20))
+	signingUp := middleware.RateLimit(middleware.PerMinute(10, 10), http.MethodPost)
+	validating := middleware.RateLimit(middleware.PerMinute(20, 10))
+	resending := middleware.RateLimit(middleware.PerMinute(1, 3))
+	resetting := middleware.RateLimit(middleware.PerMinute(3, 5), http.MethodPost)
+	changingAccount := middleware.RateLimit(middleware.PerMinute(5, 5))
+	passkeySignIn := middleware.RateLimit(middleware.PerMinute(10, 10))
+
+	authenticated := middleware.Authenticate(app.DB)
+	verified := middleware.RequireVerifiedEmail(app.DB)
 
-	uploadFs := http.FileServer(http.Dir("./uploads"))
-	r.Handle("/uploads/", http.StripPrefix("/uploads/", uploadFs))
+	// Probes for load balancers and the Docker health check, and metrics for Prometheus
+	handleFunc("/healthz", app.HealthzHandler)
+	handleFunc("/readyz", app.ReadyzHandler)
+	handleFunc("/version", handler.VersionHandler)
+	handle("/metrics", metrics.Handler(app.ActiveSessions, cfg.Metrics.Token))
 
 	// App routes
-	r.HandleFunc("/home", middleware.Authenticate(handler.IndexHandler))
-	r.HandleFunc("/", handler.HomeHandler)
-	r.HandleFunc("/sign-in", handler.LoginHandler)
-	r.HandleFunc("/sign-up", handler.SignupHandler)
-	r.HandleFunc("/upload", middleware.Authenticate(handler.CreatePost))
-	r.HandleFunc("/logout", middleware.Authenticate(handler.LogoutHandler))
-	r.HandleFunc("/comments", middleware.Authenticate(handler.CommentHandler))
-	r.HandleFunc("/reaction", middleware.Authenticate(handler.ReactionHandler))
-	r.HandleFunc("/likes", middleware.Authenticate(handler.ReactionHandler))
-	r.HandleFunc("/dilikes", middleware.Authenticate(handler.ReactionHandler))
-	r.HandleFunc("/filter", handler.FilterPosts)
-
-	r.HandleFunc("/validate", handler.ValidateInputHandler)
-
-	r.HandleFunc("/auth/google", openauth.GoogleAuth)
-	r.HandleFunc("/auth/google/callback", openauth.GoogleCallback)
-
-	r.HandleFunc("/auth/github", openauth.GitHubAuth)
-	r.HandleFunc("/auth/github/callback", openauth.GitHubCallback)
-	return r
+	handleFunc("/home", authenticated(util.Handle(app.IndexHandler)))
+	handleFunc("/", util.Handle(app.HomeHandler))
+	handleFunc("/sign-in", util.Handle(app.LoginHandler))
+	handleFunc("/sign-in/2fa", util.Handle(app.TwoFactorLoginHandler))
+	handleFunc("/sign-up", signingUp(util.Handle(app.SignupHandler)))
+	handleFunc("/unlock", util.Handle(app.UnlockAccountHandler))
+	handleFunc("/verify-email", util.Handle(app.VerifyEmailHandler))
+	handleFunc("/forgot-password", resetting(util.Handle(app.ForgotPasswordHandler)))
+	handleFunc("/reset-password", util.Handle(app.ResetPasswordHandler))
+	handleFunc("/verify-email/resend", authenticated(resending(util.Handle(app.ResendVerificationHandler))))
+	handleFunc("/upload", authenticated(verified(posting(util.Handle(app.CreatePost)))))
+	handleFunc("/logout", authenticated(util.Handle(app.LogoutHandler)))
+	handleFunc("/comments", authenticated(verified(commenting(util.Handle(app.CommentHandler)))))
+	handleFunc("/reaction", authenticated(reacting(util.Handle(app.ReactionHandler))))
+	handleFunc("/sessions", authenticated(util.Handle(app.SessionsHandler)))
+	handleFunc("/sessions/revoke", authenticated(util.Handle(app.RevokeSessionHandler)))
+	handleFunc("/sessions/revoke-others", authenticated(util.Handle(app.RevokeOtherSessionsHandler)))
+	handleFunc("/settings", authenticated(util.Handle(app.SettingsHandler)))
+	handleFunc("/settings/username", authenticated(changingAccount(util.Handle(app.ChangeUsernameHandler))))
+	handleFunc("/settings/email", authenticated(changingAccount(util.Handle(app.ChangeEmailHandler))))
+	handleFunc("/settings/email/confirm", util.Handle(app.ConfirmEmailChangeHandler))
+	handleFunc("/settings/password", authenticated(changingAccount(util.Handle(app.ChangePasswordHandler))))
+	handleFunc("/settings/2fa", authenticated(util.Handle(app.TwoFactorSettingsHandler)))
+	handleFunc("/settings/2fa/enable", authenticated(changingAccount(util.Handle(app.EnableTwoFactorHandler))))
+	handleFunc("/settings/2fa/disable", authenticated(changingAccount(util.Handle(app.DisableTwoFactorHandler))))
+	handleFunc("/settings/2fa/recovery-codes", authenticated(changingAccount(util.Handle(app.RegenerateRecoveryCodesHandler))))
+	handleFunc("/settings/identities/link", authenticated(changingAccount(util.Handle(app.LinkIdentityHandler))))
+	handleFunc("/settings/digest", authenticated(util.Handle(app.DigestSettingsHandler)))
+	handleFunc("/settings/identities/unlink", authenticated(changingAccount(util.Handle(app.UnlinkIdentityHandler))))
+	handleFunc("/admin/security", authenticated(middleware.RequireRole(app.DB, models.RoleAdmin)(util.Handle(app.AdminSecurityHandler))))
+	handleFunc("/user/", util.Handle(app.UserPostsHandler))
+	handleFunc("/likes", authenticated(reacting(util.Handle(app.ReactionHandler))))
+	handleFunc("/dilikes", authenticated(reacting(util.Handle(app.ReactionHandler))))
+	handleFunc("/filter", util.Handle(app.FilterPosts))
+	handleFunc("/posts", util.Handle(app.GetAllPostsAPI))
+
+	handleFunc("/validate", validating(util.Handle(app.ValidateInputHandler)))
+	handleFunc("/language", util.Handle(app.LanguageHandler))
+
+	handleFunc("/auth/", util.Handle(auth.Handler))
+
+	if cfg.Features.Passkeys {
+		handleFunc("/passkeys/login/begin", passkeySignIn(util.Handle(app.BeginPasskeyLoginHandler)))
+		handleFunc("/passkeys/login/finish", util.Handle(app.FinishPasskeyLoginHandler))
+		handleFunc("/settings/passkeys", authenticated(util.Handle(app.PasskeysHandler)))
+		handleFunc("/settings/passkeys/register/begin", authenticated(changingAccount(util.Handle(app.BeginPasskeyRegistrationHandler))))
+		handleFunc("/settings/passkeys/register/finish", authenticated(util.Handle(app.FinishPasskeyRegistrationHandler)))
+		handleFunc("/settings/passkeys/delete", authenticated(changingAccount(util.Handle(app.DeletePasskeyHandler))))
+	}
+	return mux
 }
@@ -0,0 +1,115 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/jesee-kuya/forum/backend/config"
+)
+
+// recordSpans sends the spans started for the rest of the test to a recorder.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestMiddlewareNamesSpansAfterRoutes(t *testing.T) {
+	recorder := recordSpans(t)
+
+	var traceID string
+	h := Middleware(Route("/post/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceID = TraceID(r.Context())
+	})))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/post/7", nil))
+
+	if traceID == "" {
+		t.Fatal("Expected the request to be served in a trace")
+	}
+	if got := rec.Header().Get(TraceIDHeader); got != traceID {
+		t.Errorf("Expected the %s header to carry %q, got %q", TraceIDHeader, traceID, got)
+	}
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	if name := spans[0].Name(); name != "GET /post/{id}" {
+		t.Errorf("Expected the span to be named after the route, got %q", name)
+	}
+}
+
+func TestMiddlewareContinuesTraces(t *testing.T) {
+	recordSpans(t)
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(previous) })
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	Middleware(http.NotFoundHandler()).ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(TraceIDHeader); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected the caller's trace to be continued, got %q", got)
+	}
+}
+
+func TestTransportPropagatesTraces(t *testing.T) {
+	recorder := recordSpans(t)
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(previous) })
+
+	var traceparent string
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer provider.Close()
+
+	ctx, parent := Tracer().Start(context.Background(), "request")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, provider.URL, nil)
+	resp, err := (&http.Client{Transport: Transport(http.DefaultTransport)}).Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	parent.End()
+
+	if traceparent == "" {
+		t.Error("Expected the trace to be passed on to the provider")
+	}
+	if spans := recorder.Ended(); len(spans) != 2 || spans[0].Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("Expected a child span for the outbound call, got %d spans", len(spans))
+	}
+}
+
+func TestSetupWithoutExporter(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	shutdown, err := Setup(context.Background(), config.Tracing{Exporter: "none", SampleRatio: 1})
+	if err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	defer shutdown(context.Background())
+
+	ctx, span := Tracer().Start(context.Background(), "request")
+	defer span.End()
+	if span.IsRecording() {
+		t.Error("Expected spans not to be recorded without an exporter")
+	}
+	if TraceID(ctx) == "" {
+		t.Error("Expected a trace ID even without an exporter")
+	}
+}
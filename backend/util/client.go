@@ -0,0 +1,115 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/jesee-kuya/forum/backend/config"
+)
+
+/*
+ClientIP returns the address of the client that sent the request. When the request came through one of the trusted proxies configured in server.trusted_proxies, the X-Forwarded-For header is read from the right, skipping further trusted proxies, so clients cannot spoof their address by sending the header themselves.
+*/
+func ClientIP(r *http.Request) string {
+	server := config.From(r).Server
+	host := peerAddr(r)
+	if !server.TrustsProxy(host) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !server.TrustsProxy(hop) {
+			return hop
+		}
+		host = hop
+	}
+	return host
+}
+
+// FromTrustedProxy reports whether the request was sent by a trusted proxy, whose headers can be believed.
+func FromTrustedProxy(r *http.Request) bool {
+	return config.From(r).Server.TrustsProxy(peerAddr(r))
+}
+
+// peerAddr returns the address of the peer the request came from, the client or a proxy.
+func peerAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+/*
+DescribeDevice turns a User-Agent header into a short label such as "Firefox on Linux" for listing sessions.
+*/
+func DescribeDevice(userAgent string) string {
+	browsers := []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	}
+	systems := []struct{ token, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	}
+
+	browser, system := "Unknown browser", ""
+	for _, b := range browsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, s := range systems {
+		if strings.Contains(userAgent, s.token) {
+			system = s.name
+			break
+		}
+	}
+
+	if system == "" {
+		return browser
+	}
+	return browser + " on " + system
+}
+
+// ErrUntrustedHost is the cause of the error BaseURL returns for a request addressed to a host that is not allowed.
+var ErrUntrustedHost = errors.New("host is not in server.allowed_hosts")
+
+/*
+BaseURL returns the address of the forum for links in emails, sign-in callbacks and passkeys, taken from the configured base URL or else from the request. The Host header is chosen by the client, so without a base URL it is only used when it names one of the allowed hosts; otherwise a link to someone else's site could be emailed with a live token in it.
+*/
+func BaseURL(r *http.Request) (string, error) {
+	cfg := config.From(r)
+	if base := cfg.Server.BaseURL; base != "" {
+		return strings.TrimSuffix(base, "/"), nil
+	}
+	host := (&url.URL{Host: r.Host}).Hostname()
+	if host == "" || !slices.Contains(cfg.Server.AllowedHosts, strings.ToLower(host)) {
+		return "", NewError(http.StatusBadRequest, "error.untrusted_host", fmt.Errorf("%w: %q", ErrUntrustedHost, r.Host))
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host, nil
+}
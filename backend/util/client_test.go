@@ -0,0 +1,98 @@
+package util
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jesee-kuya/forum/backend/config"
+)
+
+func TestClientIP(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "203.0.113.7:52100"
+
+	if got := ClientIP(req); got != "203.0.113.7" {
+		t.Errorf("ClientIP() = %q, want %q", got, "203.0.113.7")
+	}
+}
+
+func TestClientIP_TrustedProxies(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.TrustedProxies = []string{"10.0.0.0/8", "127.0.0.1"}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		expectedAddr string
+	}{
+		{"Untrusted peer ignores header", "203.0.113.7:52100", "198.51.100.1", "203.0.113.7"},
+		{"Trusted proxy", "127.0.0.1:52100", "198.51.100.1", "198.51.100.1"},
+		{"Spoofed hops are skipped", "127.0.0.1:52100", "1.2.3.4, 198.51.100.1, 10.0.0.5", "198.51.100.1"},
+		{"Missing header", "10.0.0.5:52100", "", "10.0.0.5"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req = req.WithContext(config.NewContext(req.Context(), cfg))
+			req.RemoteAddr = tc.remoteAddr
+			if tc.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tc.forwardedFor)
+			}
+			if got := ClientIP(req); got != tc.expectedAddr {
+				t.Errorf("ClientIP() = %q, want %q", got, tc.expectedAddr)
+			}
+		})
+	}
+}
+
+func TestBaseURL(t *testing.T) {
+	request := func(host string, cfg *config.Config) *http.Request {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Host = host
+		return req.WithContext(config.NewContext(req.Context(), cfg))
+	}
+
+	cfg := config.Default()
+	for _, host := range []string{"localhost:9000", "LOCALHOST", "127.0.0.1:9000", "[::1]:9000"} {
+		if got, err := BaseURL(request(host, cfg)); err != nil || got != "http://"+host {
+			t.Errorf("BaseURL for %q = %q, %v; want the request's host", host, got, err)
+		}
+	}
+	for _, host := range []string{"evil.example", "evil.example:9000", "localhost.evil.example", ""} {
+		_, err := BaseURL(request(host, cfg))
+		var appErr *AppError
+		if !errors.Is(err, ErrUntrustedHost) || !errors.As(err, &appErr) || appErr.Status != http.StatusBadRequest {
+			t.Errorf("BaseURL for %q = %v; want a bad request for an untrusted host", host, err)
+		}
+	}
+
+	cfg = config.Default()
+	cfg.Server.BaseURL = "https://forum.example/"
+	if got, err := BaseURL(request("evil.example", cfg)); err != nil || got != "https://forum.example" {
+		t.Errorf("BaseURL = %q, %v; want the configured base URL whatever the host", got, err)
+	}
+}
+
+func TestDescribeDevice(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		expected  string
+	}{
+		{"Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0", "Firefox on Linux"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.0.0", "Edge on Windows"},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1", "Safari on iOS"},
+		{"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Mobile Safari/537.36", "Chrome on Android"},
+		{"curl/8.5.0", "curl"},
+		{"", "Unknown browser"},
+	}
+
+	for _, tc := range tests {
+		if got := DescribeDevice(tc.userAgent); got != tc.expected {
+			t.Errorf("DescribeDevice(%q) = %q, want %q", tc.userAgent, got, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package util
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestValidCSRFToken(t *testing.T) {
+	token := NewCSRFToken(context.Background())
+	if !ValidCSRFToken(context.Background(), token) {
+		t.Fatalf("Expected freshly issued token %q to be valid", token)
+	}
+
+	nonce, _, _ := strings.Cut(token, ".")
+	for _, forged := range []string{"", nonce, nonce + ".forged", "other." + Sign(context.Background(), "csrf", nonce)} {
+		if ValidCSRFToken(context.Background(), forged) {
+			t.Errorf("Expected forged token %q to be rejected", forged)
+		}
+	}
+}
+
+func TestVerifyCSRF(t *testing.T) {
+	token := NewCSRFToken(context.Background())
+
+	tests := []struct {
+		name      string
+		cookie    string
+		header    string
+		field     string
+		expectErr bool
+	}{
+		{"Form field", token, "", token, false},
+		{"Header", token, token, "", false},
+		{"Missing token", token, "", "", true},
+		{"Mismatched token", token, "", NewCSRFToken(context.Background()), true},
+		{"Missing cookie", "", "", token, true},
+		{"Unsigned cookie", "nonce.signature", "", "nonce.signature", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			form := url.Values{}
+			if tc.field != "" {
+				form.Set(CSRFFieldName, tc.field)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/comments", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tc.header != "" {
+				req.Header.Set(CSRFHeaderName, tc.header)
+			}
+			if tc.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: CSRFCookieName, Value: tc.cookie})
+			}
+
+			err := VerifyCSRF(req)
+			if (err != nil) != tc.expectErr {
+				t.Errorf("VerifyCSRF() error = %v, expectErr %v", err, tc.expectErr)
+			}
+		})
+	}
+}
@@ -1,35 +1,170 @@
 package util
 
 import (
-	"log"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"strconv"
-	"text/template"
+	"strings"
+
+	"github.com/jesee-kuya/forum/backend/i18n"
+	"github.com/jesee-kuya/forum/backend/tracing"
 )
 
+// InternalErrorMessage is the message shown to users for failures they can do nothing about.
+const InternalErrorMessage = "error.internal"
+
+type templatesContextKey struct{}
+
+// WithTemplates returns a copy of r whose errors are rendered with the error page, error.html, of t.
+func WithTemplates(r *http.Request, t *Templates) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), templatesContextKey{}, t))
+}
+
+/*
+AppError is an error a handler failed with: the status and message sent to the user, a code naming the kind of failure for scripts, and the cause, which is logged but never shown. Message is the key of a message in the i18n catalogs, translated with Args into the language of the request when the error is written.
+*/
+type AppError struct {
+	Code    string
+	Status  int
+	Message string
+	Args    []interface{}
+	Err     error
+}
+
+// NewError returns an AppError with the code matching status, showing the message with the key message formatted with args.
+func NewError(status int, message string, cause error, args ...interface{}) *AppError {
+	return &AppError{Code: errorCode(status), Status: status, Message: message, Args: args, Err: cause}
+}
+
+// Internal returns the error for an unexpected failure, shown to the user as InternalErrorMessage. When cause wraps an AppError, such as the one BaseURL returns, its status and message are kept instead.
+func Internal(cause error) *AppError {
+	var appErr *AppError
+	if errors.As(cause, &appErr) {
+		return &AppError{Code: appErr.Code, Status: appErr.Status, Message: appErr.Message, Args: appErr.Args, Err: cause}
+	}
+	return NewError(http.StatusInternalServerError, InternalErrorMessage, cause)
+}
+
+// MethodNotAllowed returns the error for a request sent with a method the route does not handle.
+func MethodNotAllowed() *AppError {
+	return NewError(http.StatusMethodNotAllowed, "error.method_not_allowed", nil)
+}
+
+func (e *AppError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s (%d): %v", e.Message, e.Status, e.Err)
+	}
+	return fmt.Sprintf("%s (%d)", e.Message, e.Status)
+}
+
+func (e *AppError) Unwrap() error {
+	return e.Err
+}
+
+// errorCode names the kind of failure a status stands for, such as "not_found".
+func errorCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	return strings.ReplaceAll(strings.ToLower(text), " ", "_")
+}
+
+// Message is the data of the error page.
 type Message struct {
 	Code       string
 	ErrMessage string
+	// Reference is the trace ID of the request, for users to quote when asking for support.
+	Reference string
 }
 
-func ErrorHandler(w http.ResponseWriter, errval string, statusCode int) {
-	tmpl, err := template.ParseFiles("frontend/templates/error.html")
-	if err != nil {
-		log.Printf("Failed to load error template: %v", err)
-		http.Error(w, errval, statusCode)
-		return
+// WantsJSON reports whether a request was sent by a script expecting JSON rather than a page.
+func WantsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json") || r.Header.Get(CSRFHeaderName) != ""
+}
+
+/*
+WriteError logs err and answers the request with it, as JSON for scripts and as an error page otherwise: the error page of the templates set with WithTemplates, or plain text without them. Errors other than AppError are reported as internal errors. Failures with a cause are logged at the error level for server errors and the info level otherwise; those without one are expected, such as a page that does not exist, and only logged at the debug level.
+*/
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	var appErr *AppError
+	if !errors.As(err, &appErr) {
+		appErr = Internal(err)
+	}
+
+	if appErr.Err == nil {
+		slog.DebugContext(r.Context(), "Request failed", "status", appErr.Status, "code", appErr.Code, "message", appErr.Message)
+	} else {
+		level := slog.LevelInfo
+		if appErr.Status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.Log(r.Context(), level, "Request failed", "status", appErr.Status, "code", appErr.Code, "message", appErr.Message, "err", appErr.Err)
 	}
 
-	code := strconv.Itoa(statusCode)
+	reference := w.Header().Get(tracing.TraceIDHeader)
+	message := i18n.T(r.Context(), appErr.Message, appErr.Args...)
+	if WantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(appErr.Status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "code": appErr.Code, "message": message, "trace_id": reference})
+		return
+	}
 
-	data := Message{
-		Code:       code,
-		ErrMessage: errval,
+	templates, _ := r.Context().Value(templatesContextKey{}).(*Templates)
+	if templates == nil {
+		http.Error(w, message, appErr.Status)
+		return
+	}
+	data := Message{Code: strconv.Itoa(appErr.Status), ErrMessage: message, Reference: reference}
+	if tmplErr := templates.Render(w, r, appErr.Status, "error.html", data); tmplErr != nil {
+		slog.ErrorContext(r.Context(), "Failed to render error page", "err", tmplErr)
+		http.Error(w, message, appErr.Status)
 	}
+}
+
+// HandlerFunc is a handler returning its failures, for Handle to answer with.
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
 
-	err = tmpl.Execute(w, data)
-	if err != nil {
-		log.Printf("Error executing the template: %v", err)
-		http.Error(w, "An Unexpected Error Occurred. Try Again Later", http.StatusInternalServerError)
+/*
+Handle adapts h to an http.HandlerFunc answering the errors it returns with WriteError. An error returned after h has started its response cannot be sent any more, so it is only logged.
+*/
+func Handle(h HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &startRecorder{ResponseWriter: w}
+		err := h(rec, r)
+		if err == nil {
+			return
+		}
+		if rec.started {
+			slog.ErrorContext(r.Context(), "Failed after the response was started", "err", err)
+			return
+		}
+		WriteError(w, r, err)
 	}
 }
+
+// startRecorder remembers whether a response was started.
+type startRecorder struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (rec *startRecorder) WriteHeader(code int) {
+	rec.started = true
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *startRecorder) Write(b []byte) (int, error) {
+	rec.started = true
+	return rec.ResponseWriter.Write(b)
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer, to flush or hijack it.
+func (rec *startRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
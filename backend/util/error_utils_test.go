@@ -1,67 +1,147 @@
 package util
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/jesee-kuya/forum/backend/i18n"
 )
 
-func TestErrorHandler(t *testing.T) {
+// errorTemplates renders the error page; tests run from the package directory.
+var errorTemplates = NewTemplates(filepath.Join("..", "..", "frontend", "templates"), false)
+
+// errorRequest returns a request whose errors are rendered with the forum's error page.
+func errorRequest(method, target string) *http.Request {
+	return WithTemplates(httptest.NewRequest(method, target, nil), errorTemplates)
+}
+
+func TestWriteError(t *testing.T) {
 	// Define test cases
 	tests := []struct {
 		name       string
-		errval     string
+		err        error
 		statusCode int
 		expected   string
 	}{
 		{
 			name:       "Internal Server Error",
-			errval:     "Internal Server Error",
+			err:        Internal(errors.New("database is locked")),
 			statusCode: http.StatusInternalServerError,
 			expected:   "500",
 		},
 		{
 			name:       "Not Found",
-			errval:     "Not Found",
+			err:        NewError(http.StatusNotFound, "Not Found", nil),
 			statusCode: http.StatusNotFound,
 			expected:   "404",
 		},
 		{
 			name:       "Bad Request",
-			errval:     "Bad Request",
+			err:        NewError(http.StatusBadRequest, "Bad Request", nil),
 			statusCode: http.StatusBadRequest,
 			expected:   "400",
 		},
+		{
+			name:       "Plain error",
+			err:        errors.New("disk full"),
+			statusCode: http.StatusInternalServerError,
+			expected:   "500",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Create a request to pass to our handler
-			_, err := http.NewRequest("GET", "/error", nil)
-			if err != nil {
-				t.Fatal(err)
-			}
-
-			// Create a ResponseRecorder to record the response
 			rr := httptest.NewRecorder()
+			WriteError(rr, errorRequest(http.MethodGet, "/error"), tt.err)
 
-			// Call the ErrorHandler function directly
-			ErrorHandler(rr, tt.errval, tt.statusCode)
-
-			// Check the status code
 			if status := rr.Code; status != tt.statusCode {
 				t.Errorf("handler returned wrong status code: got %v want %v",
 					status, tt.statusCode)
 			}
-
-			// Check the response body
-			expectedCode := tt.expected
-			if rr.Body.String() != "" {
-				t.Logf("Response body: %v", rr.Body.String())
-			} else {
+			if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+				t.Errorf("Expected an error page, got %q", ct)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expected) {
 				t.Errorf("handler returned unexpected body: got %v want %v",
-					rr.Body.String(), expectedCode)
+					rr.Body.String(), tt.expected)
+			}
+			if strings.Contains(rr.Body.String(), "database is locked") || strings.Contains(rr.Body.String(), "disk full") {
+				t.Error("Expected the cause not to be shown")
 			}
 		})
 	}
 }
+
+func TestWriteErrorWithoutTemplates(t *testing.T) {
+	rr := httptest.NewRecorder()
+	WriteError(rr, httptest.NewRequest(http.MethodGet, "/error", nil), NewError(http.StatusNotFound, "error.page_not_found", nil))
+	if rr.Code != http.StatusNotFound || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/plain") || !strings.Contains(rr.Body.String(), "Page does not exist") {
+		t.Errorf("Expected a plain text error, got %d %q %q", rr.Code, rr.Header().Get("Content-Type"), rr.Body.String())
+	}
+}
+
+func TestWriteErrorJSON(t *testing.T) {
+	rr := httptest.NewRecorder()
+	rr.Header().Set("X-Trace-ID", "trace-1")
+	req := httptest.NewRequest(http.MethodPost, "/comments", nil)
+	req.Header.Set("Accept", "application/json")
+	WriteError(rr, req, NewError(http.StatusTooManyRequests, "Slow down", nil))
+
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status 429, got %d", rr.Code)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Expected JSON, got %q: %v", rr.Body.String(), err)
+	}
+	if body["success"] != false || body["code"] != "too_many_requests" || body["message"] != "Slow down" || body["trace_id"] != "trace-1" {
+		t.Errorf("Unexpected error body %v", body)
+	}
+}
+
+func TestWriteErrorTranslates(t *testing.T) {
+	sw, _ := i18n.Lookup("sw")
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/upload", nil)
+	req.Header.Set("Accept", "application/json")
+	req = req.WithContext(i18n.NewContext(req.Context(), sw))
+	WriteError(rr, req, NewError(http.StatusBadRequest, "error.too_many_files", nil, 4))
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Expected JSON, got %q: %v", rr.Body.String(), err)
+	}
+	if body["message"] != "Unaweza kuambatisha picha 4 tu kwenye chapisho." {
+		t.Errorf("Expected the message in Swahili, got %v", body["message"])
+	}
+}
+
+func TestHandle(t *testing.T) {
+	failing := Handle(func(w http.ResponseWriter, r *http.Request) error {
+		return NewError(http.StatusForbidden, "Forbidden", nil)
+	})
+	rr := httptest.NewRecorder()
+	failing(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected the returned error to be written, got %d", rr.Code)
+	}
+
+	// An error after a redirect must not write a second response
+	late := Handle(func(w http.ResponseWriter, r *http.Request) error {
+		http.Redirect(w, r, "/home", http.StatusSeeOther)
+		return errors.New("audit failed")
+	})
+	rr = httptest.NewRecorder()
+	late(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/home" {
+		t.Errorf("Expected the redirect to stand, got %d", rr.Code)
+	}
+	if strings.Contains(rr.Body.String(), i18n.Default().T(InternalErrorMessage)) {
+		t.Error("Expected no error page after the redirect")
+	}
+}
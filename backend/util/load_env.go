@@ -1,46 +0,0 @@
-package util
-
-import (
-	"bufio"
-	"os"
-	"strings"
-)
-
-var (
-	GoogleClientID, GoogleClientSecret, GithubClientID, GithubClientSecret string
-)
-
-// LoadEnv reads the .env file to set envrionment variables.
-func LoadEnv(filename string) error {
-	file, err := os.Open(filename)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-
-		// Split key-value pair
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) != 2 {
-			continue
-		}
-		key := strings.TrimSpace(parts[0])
-		value := strings.TrimSpace(parts[1])
-
-		// Set environment variable
-		os.Setenv(key, value)
-	}
-	GoogleClientID = os.Getenv("GOOGLE_CLIENT_ID")
-	GoogleClientSecret = os.Getenv("GOOGLE_CLIENT_SECRET")
-	GithubClientID = os.Getenv("GITHUB_CLIENT_ID")
-	GithubClientSecret = os.Getenv("GITHUB_CLIENT_SECRET")
-
-	return scanner.Err()
-}
@@ -0,0 +1,148 @@
+package util
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/jesee-kuya/forum/backend/config"
+	"github.com/jesee-kuya/forum/backend/i18n"
+)
+
+// SessionCookieName is the cookie holding the session token.
+const SessionCookieName = "session_token"
+
+type sessionUserContextKey struct{}
+
+// WithSessionUser returns a copy of r signed in as the user with the given id, whose session was checked against the database.
+func WithSessionUser(r *http.Request, userID int) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), sessionUserContextKey{}, userID))
+}
+
+// SessionUser returns the id of the user r was signed in as with WithSessionUser.
+func SessionUser(r *http.Request) (int, bool) {
+	userID, ok := r.Context().Value(sessionUserContextKey{}).(int)
+	return userID, ok
+}
+
+/*
+SessionExpiry returns when a session used at now should idle out under the given session settings, which is never later than its absolute expiry.
+*/
+func SessionExpiry(s config.Session, now, absoluteExpiry time.Time, rememberMe bool) time.Time {
+	idle, _ := s.Limits(rememberMe)
+	expiry := now.Add(idle)
+	if !absoluteExpiry.IsZero() && expiry.After(absoluteExpiry) {
+		return absoluteExpiry
+	}
+	return expiry
+}
+
+/*
+SetSessionCookie writes the session cookie. "Remember me" sessions get a persistent cookie that expires with the session; others last until the browser is closed.
+*/
+func SetSessionCookie(w http.ResponseWriter, r *http.Request, sessionToken string, expires time.Time, rememberMe bool) {
+	cookie := &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    sessionToken,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   secureCookies(r),
+		SameSite: http.SameSiteLaxMode,
+	}
+	if rememberMe {
+		cookie.Expires = expires.UTC()
+	}
+	http.SetCookie(w, cookie)
+}
+
+// ClearSessionCookie removes the session cookie from the browser.
+func ClearSessionCookie(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   secureCookies(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// TwoFactorCookieName is the cookie holding a sign-in that still waits for its second factor.
+const TwoFactorCookieName = "two_factor_login"
+
+// SetTwoFactorCookie writes the pending sign-in cookie, which is only sent to the second factor form.
+func SetTwoFactorCookie(w http.ResponseWriter, r *http.Request, value string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     TwoFactorCookieName,
+		Value:    value,
+		Path:     "/sign-in/2fa",
+		Expires:  expires.UTC(),
+		HttpOnly: true,
+		Secure:   secureCookies(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ClearTwoFactorCookie removes the pending sign-in cookie from the browser.
+func ClearTwoFactorCookie(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     TwoFactorCookieName,
+		Value:    "",
+		Path:     "/sign-in/2fa",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   secureCookies(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// LinkCookieName is the cookie marking a trip to a sign-in provider made to link it to the signed in account.
+const LinkCookieName = "oauth_link"
+
+// SetLinkCookie writes the account linking cookie, which is only sent to the providers' callbacks.
+func SetLinkCookie(w http.ResponseWriter, r *http.Request, value string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     LinkCookieName,
+		Value:    value,
+		Path:     "/auth/",
+		Expires:  expires.UTC(),
+		HttpOnly: true,
+		Secure:   secureCookies(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ClearLinkCookie removes the account linking cookie from the browser.
+func ClearLinkCookie(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     LinkCookieName,
+		Value:    "",
+		Path:     "/auth/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   secureCookies(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// languageCookieLifetime is how long the browser remembers the language chosen with the language menu.
+const languageCookieLifetime = 365 * 24 * time.Hour
+
+// SetLanguageCookie writes the cookie holding the language the forum is shown in, for i18n.Negotiate to read.
+func SetLanguageCookie(w http.ResponseWriter, r *http.Request, lang string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     i18n.CookieName,
+		Value:    lang,
+		Path:     "/",
+		Expires:  time.Now().Add(languageCookieLifetime).UTC(),
+		HttpOnly: true,
+		Secure:   secureCookies(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// secureCookies reports whether the cookies set while serving r are restricted to HTTPS.
+func secureCookies(r *http.Request) bool {
+	return config.From(r).Session.SecureCookies
+}
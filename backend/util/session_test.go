@@ -0,0 +1,59 @@
+package util
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jesee-kuya/forum/backend/config"
+)
+
+func TestSessionExpiry(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := config.Default().Session
+
+	tests := []struct {
+		name       string
+		absolute   time.Time
+		rememberMe bool
+		expected   time.Time
+	}{
+		{"Slides with activity", now.Add(s.Lifetime), false, now.Add(s.IdleTimeout)},
+		{"Capped by absolute expiry", now.Add(time.Hour), false, now.Add(time.Hour)},
+		{"Remember me", now.Add(s.RememberMe), true, now.Add(s.RememberMe)},
+		{"No absolute expiry recorded", time.Time{}, false, now.Add(s.IdleTimeout)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := SessionExpiry(s, now, tc.absolute, tc.rememberMe); !got.Equal(tc.expected) {
+				t.Errorf("SessionExpiry() = %v, want %v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestSetSessionCookie(t *testing.T) {
+	expires := time.Now().Add(time.Hour)
+	req := httptest.NewRequest("GET", "/", nil)
+
+	rr := httptest.NewRecorder()
+	SetSessionCookie(rr, req, "token", expires, false)
+	if cookie := rr.Result().Cookies()[0]; !cookie.Expires.IsZero() {
+		t.Errorf("Expected a browser session cookie, got expiry %v", cookie.Expires)
+	}
+
+	rr = httptest.NewRecorder()
+	SetSessionCookie(rr, req, "token", expires, true)
+	if cookie := rr.Result().Cookies()[0]; cookie.Expires.IsZero() || !cookie.Secure {
+		t.Error("Expected a persistent secure cookie for remember me sessions")
+	}
+
+	cfg := config.Default()
+	cfg.Session.SecureCookies = false
+	rr = httptest.NewRecorder()
+	SetSessionCookie(rr, req.WithContext(config.NewContext(req.Context(), cfg)), "token", expires, false)
+	if cookie := rr.Result().Cookies()[0]; cookie.Secure {
+		t.Error("Expected a cookie sent over plain HTTP when secure cookies are turned off")
+	}
+}
@@ -0,0 +1,47 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Errors returned by VerifyValues.
+var (
+	ErrBadSignature = errors.New("invalid link signature")
+	ErrLinkExpired  = errors.New("link has expired")
+)
+
+/*
+SignValues adds an expiry time and a signature to link parameters, so that a link such as an email verification link can be checked later without storing anything. The purpose keeps a link made for one action from being accepted by another.
+*/
+func SignValues(ctx context.Context, purpose string, params url.Values, ttl time.Duration) url.Values {
+	signed := url.Values{}
+	for key, values := range params {
+		signed[key] = values
+	}
+	signed.Set("expires", strconv.FormatInt(time.Now().Add(ttl).Unix(), 10))
+	signed.Set("signature", Sign(ctx, purpose, signed.Encode()))
+	return signed
+}
+
+// VerifyValues checks the signature and expiry added by SignValues.
+func VerifyValues(ctx context.Context, purpose string, params url.Values) error {
+	unsigned := url.Values{}
+	for key, values := range params {
+		if key != "signature" {
+			unsigned[key] = values
+		}
+	}
+	if !ValidSignature(ctx, params.Get("signature"), purpose, unsigned.Encode()) {
+		return ErrBadSignature
+	}
+
+	expires, err := strconv.ParseInt(params.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return ErrLinkExpired
+	}
+	return nil
+}
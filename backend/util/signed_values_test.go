@@ -0,0 +1,38 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSignValues(t *testing.T) {
+	params := url.Values{"user": {"7"}, "email": {"alice@example.com"}}
+	signed := SignValues(context.Background(), "verify-email", params, time.Hour)
+
+	// Round trip through a URL like the emailed link
+	parsed, err := url.ParseQuery(signed.Encode())
+	if err != nil {
+		t.Fatalf("Failed to parse signed values: %v", err)
+	}
+	if err := VerifyValues(context.Background(), "verify-email", parsed); err != nil {
+		t.Errorf("Expected signed values to verify, got %v", err)
+	}
+
+	if err := VerifyValues(context.Background(), "reset-password", parsed); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Expected values signed for another purpose to be rejected, got %v", err)
+	}
+
+	tampered, _ := url.ParseQuery(signed.Encode())
+	tampered.Set("email", "mallory@example.com")
+	if err := VerifyValues(context.Background(), "verify-email", tampered); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Expected tampered values to be rejected, got %v", err)
+	}
+
+	expired := SignValues(context.Background(), "verify-email", params, -time.Minute)
+	if err := VerifyValues(context.Background(), "verify-email", expired); !errors.Is(err, ErrLinkExpired) {
+		t.Errorf("Expected expired values to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package util
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"strings"
+
+	"github.com/jesee-kuya/forum/backend/config"
+)
+
+// RandomToken returns n random bytes encoded for use in URLs and cookies.
+func RandomToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatalf("Failed to generate random token: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+/*
+Sign returns an HMAC-SHA256 signature of the given parts, keyed with the secret key of the configuration carried by ctx. The parts are joined with a separator that cannot appear in URL-safe tokens, so ("a", "bc") and ("ab", "c") sign differently.
+*/
+func Sign(ctx context.Context, parts ...string) string {
+	mac := hmac.New(sha256.New, []byte(config.FromContext(ctx).Server.SecretKey))
+	mac.Write([]byte(strings.Join(parts, "\x00")))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ValidSignature reports whether signature was produced by Sign for the same parts.
+func ValidSignature(ctx context.Context, signature string, parts ...string) bool {
+	return hmac.Equal([]byte(signature), []byte(Sign(ctx, parts...)))
+}
+
+// HashToken returns the SHA-256 hash of a token, for storing tokens that are only ever compared.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
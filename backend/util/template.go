@@ -0,0 +1,216 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer/html"
+
+	"github.com/jesee-kuya/forum/backend/config"
+	"github.com/jesee-kuya/forum/backend/i18n"
+)
+
+// Layouts and partials are read from these directories of the template directory and shared by every page.
+const (
+	layoutDir  = "layouts"
+	partialDir = "partials"
+)
+
+// baseTemplate is the layout every page is rendered through.
+const baseTemplate = "base"
+
+/*
+TemplateFuncs returns the helpers available to every page template:
+
+	csrfToken     the CSRF token of the request, for meta tags and scripts
+	csrfField     a hidden input carrying the CSRF token, for forms
+	feature       whether a feature such as "passkeys" is turned on
+	uploads       the upload limits, for the post form
+	t             a message of the catalog in the language of the request, such as {{ t "nav.sign_in" }}
+	tn            the form of a message matching a count, such as {{ tn "post.comment_count" .CommentCount }}
+	lang          the language of the request, such as "sw"
+	languages     the languages with a catalog, for the language menu
+	date          a date and time written the way the language writes them
+	relativeTime  how long ago a time was, such as "3 hours ago"
+	markdown      Markdown rendered to HTML, with raw HTML and unsafe links left out
+
+The request helpers read r, which may be nil when templates are only parsed.
+*/
+func TemplateFuncs(r *http.Request) template.FuncMap {
+	return template.FuncMap{
+		"csrfToken": func() string {
+			return CSRFToken(r)
+		},
+		"csrfField": func() template.HTML {
+			return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s" />`, CSRFFieldName, template.HTMLEscapeString(CSRFToken(r))))
+		},
+		"feature": func(name string) bool {
+			return config.From(r).Features.Enabled(name)
+		},
+		"uploads": func() config.Uploads {
+			return config.From(r).Uploads
+		},
+		"t": func(key string, args ...interface{}) string {
+			return translator(r).T(key, args...)
+		},
+		"tn": func(key string, n int, args ...interface{}) string {
+			return translator(r).N(key, n, args...)
+		},
+		"lang": func() string {
+			return translator(r).Lang()
+		},
+		"languages": i18n.Languages,
+		"date": func(t time.Time) string {
+			return translator(r).Date(t)
+		},
+		"relativeTime": func(t time.Time) string {
+			return translator(r).Ago(t)
+		},
+		"markdown": Markdown,
+	}
+}
+
+// translator returns the Translator the Locale middleware chose for r, or that of the default language.
+func translator(r *http.Request) *i18n.Translator {
+	if r == nil {
+		return i18n.Default()
+	}
+	return i18n.FromContext(r.Context())
+}
+
+// markdownRenderer keeps goldmark's safe defaults: raw HTML and links such as javascript: are not rendered.
+var markdownRenderer = goldmark.New(
+	goldmark.WithExtensions(extension.Strikethrough, extension.Linkify),
+	goldmark.WithRendererOptions(html.WithHardWraps()),
+)
+
+// Markdown renders s as Markdown. Line breaks are kept, as posts were written as plain text.
+func Markdown(s string) template.HTML {
+	var buf bytes.Buffer
+	if err := markdownRenderer.Convert([]byte(s), &buf); err != nil {
+		return template.HTML(template.HTMLEscapeString(s))
+	}
+	return template.HTML(buf.String())
+}
+
+/*
+Templates renders the pages of a template directory. Every page is parsed with the layouts and partials and must define the "content" block the base layout renders; it may also define "title", "head" and "scripts". Pages are parsed once and kept, unless reload is set, as in development, where they are parsed again on every render so edits show without a restart.
+*/
+type Templates struct {
+	dir    string
+	reload bool
+
+	mu    sync.RWMutex
+	pages map[string]*template.Template
+}
+
+// NewTemplates returns the templates of the pages in dir. Pages are parsed on first use, or all at once by Load.
+func NewTemplates(dir string, reload bool) *Templates {
+	return &Templates{dir: dir, reload: reload, pages: make(map[string]*template.Template)}
+}
+
+// Pages returns the names of the pages in the template directory, such as "index.html".
+func (t *Templates) Pages() ([]string, error) {
+	entries, err := os.ReadDir(t.dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".html") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Load parses every page, so a broken template stops the forum at startup rather than failing a request.
+func (t *Templates) Load() error {
+	names, err := t.Pages()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if _, err := t.page(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// page returns the parsed page name, parsing it if it is not cached or reload is set.
+func (t *Templates) page(name string) (*template.Template, error) {
+	if !t.reload {
+		t.mu.RLock()
+		tmpl, ok := t.pages[name]
+		t.mu.RUnlock()
+		if ok {
+			return tmpl, nil
+		}
+	}
+
+	tmpl, err := t.parse(name)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	t.pages[name] = tmpl
+	t.mu.Unlock()
+	return tmpl, nil
+}
+
+func (t *Templates) parse(name string) (*template.Template, error) {
+	var files []string
+	for _, dir := range []string{layoutDir, partialDir} {
+		shared, err := filepath.Glob(filepath.Join(t.dir, dir, "*.html"))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, shared...)
+	}
+	files = append(files, filepath.Join(t.dir, name))
+
+	// A page using a field its data lacks fails rather than showing an empty value
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(TemplateFuncs(nil)).ParseFiles(files...)
+	if err != nil {
+		return nil, fmt.Errorf("parse template %s: %w", name, err)
+	}
+	if tmpl.Lookup(baseTemplate) == nil {
+		return nil, fmt.Errorf("parse template %s: no %q layout", name, baseTemplate)
+	}
+	return tmpl, nil
+}
+
+/*
+Render writes the page name, rendered with data, with the given status. The page is rendered before anything is written, so a failure returns an error the caller can still answer with an error page.
+*/
+func (t *Templates) Render(w http.ResponseWriter, r *http.Request, status int, name string, data interface{}) error {
+	page, err := t.page(name)
+	if err != nil {
+		return err
+	}
+	tmpl, err := page.Clone()
+	if err != nil {
+		return fmt.Errorf("render template %s: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Funcs(TemplateFuncs(r)).ExecuteTemplate(&buf, baseTemplate, data); err != nil {
+		return fmt.Errorf("render template %s: %w", name, err)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, err = buf.WriteTo(w)
+	return err
+}
@@ -0,0 +1,229 @@
+package util
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jesee-kuya/forum/backend/i18n"
+	"github.com/jesee-kuya/forum/backend/models"
+)
+
+// templateDir is the forum's template directory, seen from the package directory.
+var templateDir = filepath.Join("..", "..", "frontend", "templates")
+
+// pageData has every field the pages use, so each of them can be rendered with it.
+func pageData(page string) map[string]interface{} {
+	created := time.Now().Add(-3 * time.Hour)
+	item := map[string]interface{}{
+		"ID": 1, "Name": "Laptop", "DisplayName": "Google", "Provider": "google", "Linked": true,
+		"Email": "alice@example.com", "Username": "alice", "Role": "admin", "TwoFactorEnabled": true,
+		"Device": "Firefox on Linux", "IPAddress": "192.0.2.1", "Current": true,
+		"CreatedOn": created, "LastUsedOn": created, "LastSeen": created,
+	}
+	post := models.Post{
+		ID:        1,
+		UserName:  "alice",
+		PostTitle: "<script>alert(1)</script>",
+		Body:      "Some **bold** text\n<img src=x onerror=alert(1)>",
+		CreatedOn: created,
+		Likes:     2,
+		Categories: []models.Category{
+			{CategoryName: "Technology"},
+		},
+		Attachments: []models.Attachment{
+			{FileURL: "uploads/cat.png", Caption: "A cat", AltText: "A sleeping cat"},
+		},
+		Comments: []models.Post{
+			{ID: 2, UserName: "bob", Body: "Nice & short"},
+		},
+		CommentCount: 1,
+	}
+	data := map[string]interface{}{
+		"Notice": "Saved.", "Error": "", "Code": "404", "ErrMessage": "Not Found", "Reference": "trace-1",
+		"Name": "alice", "Username": "alice", "Email": "alice@example.com", "Role": "admin", "Token": "reset-token",
+		"IsLoggedIn": true, "EmailVerified": false, "HasPassword": true, "TwoFactorEnabled": false, "DigestEnabled": true, "Digest": false,
+		"Required": false, "Enabled": false, "CodesLeft": 0, "RecoveryCodes": []string{"abcd-efgh"},
+		"Secret": "JBSWY3DPEHPK3PXP", "URI": "https://example.com/otp", "QRCode": "iVBORw0KGgo=",
+		"Posts":     []models.Post{post},
+		"Staff":     []interface{}{item},
+		"Passkeys":  []interface{}{item},
+		"Sessions":  []interface{}{item},
+		"Providers": []interface{}{item},
+	}
+	if page == "admin-security.html" {
+		// The policy page lists the roles requiring two-factor authentication
+		data["Required"] = map[string]bool{"admin": true}
+	}
+	return data
+}
+
+func TestRenderEveryPage(t *testing.T) {
+	tmpl := NewTemplates(templateDir, false)
+	if err := tmpl.Load(); err != nil {
+		t.Fatalf("Failed to load templates: %v", err)
+	}
+	pages, err := tmpl.Pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) < 12 {
+		t.Fatalf("Expected every page to be found, got %v", pages)
+	}
+
+	for _, page := range pages {
+		t.Run(page, func(t *testing.T) {
+			r := WithCSRFToken(httptest.NewRequest(http.MethodGet, "/", nil), "token-123")
+			rr := httptest.NewRecorder()
+			if err := tmpl.Render(rr, r, http.StatusOK, page, pageData(page)); err != nil {
+				t.Fatalf("Failed to render: %v", err)
+			}
+			body := rr.Body.String()
+			for _, want := range []string{"<!DOCTYPE html>", "<title>", `<nav class="navbar">`, `<meta name="csrf-token" content="token-123" />`} {
+				if !strings.Contains(body, want) {
+					t.Errorf("Expected the page to contain %q", want)
+				}
+			}
+			if strings.Contains(body, "ZgotmplZ") {
+				t.Error("Expected no value to be rejected by the escaper")
+			}
+		})
+	}
+}
+
+func TestRenderEscapesPosts(t *testing.T) {
+	tmpl := NewTemplates(templateDir, false)
+	rr := httptest.NewRecorder()
+	r := WithCSRFToken(httptest.NewRequest(http.MethodGet, "/", nil), "token-123")
+	if err := tmpl.Render(rr, r, http.StatusOK, "index.html", pageData("index.html")); err != nil {
+		t.Fatal(err)
+	}
+	body := rr.Body.String()
+
+	for _, want := range []string{
+		"&lt;script&gt;alert(1)&lt;/script&gt;",
+		"<strong>bold</strong>",
+		"Nice &amp; short",
+		"3 hours ago",
+		"1 Comment",
+		`<input type="hidden" name="csrf_token" value="token-123" />`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected the page to contain %q", want)
+		}
+	}
+	for _, unwanted := range []string{"<script>alert(1)", "onerror=alert"} {
+		if strings.Contains(body, unwanted) {
+			t.Errorf("Expected %q to be escaped", unwanted)
+		}
+	}
+}
+
+func TestRenderTranslates(t *testing.T) {
+	sw, _ := i18n.Lookup("sw")
+	tmpl := NewTemplates(templateDir, false)
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(i18n.NewContext(r.Context(), sw))
+	if err := tmpl.Render(rr, r, http.StatusOK, "index.html", pageData("index.html")); err != nil {
+		t.Fatal(err)
+	}
+	body := rr.Body.String()
+
+	for _, want := range []string{`<html lang="sw">`, "<title>Nyumbani</title>", "Chuja Kwa:", "saa 3 zilizopita", "Maoni 1", `<option value="sw" selected>Kiswahili</option>`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected the page to contain %q", want)
+		}
+	}
+	if strings.Contains(body, "Filter By:") {
+		t.Error("Expected no English text")
+	}
+}
+
+// writeTemplates creates a template directory with a layout and one page.
+func writeTemplates(t *testing.T, page string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, layoutDir), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	layout := `{{ define "base" }}[{{ template "content" . }}]{{ end }}`
+	if err := os.WriteFile(filepath.Join(dir, layoutDir, "base.html"), []byte(layout), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "page.html"), []byte(page), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func renderString(t *testing.T, tmpl *Templates) string {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	if err := tmpl.Render(rr, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK, "page.html", nil); err != nil {
+		t.Fatal(err)
+	}
+	return rr.Body.String()
+}
+
+func TestTemplatesReload(t *testing.T) {
+	dir := writeTemplates(t, `{{ define "content" }}one{{ end }}`)
+	cached := NewTemplates(dir, false)
+	reloading := NewTemplates(dir, true)
+	if got := renderString(t, cached); got != "[one]" {
+		t.Fatalf("Expected [one], got %q", got)
+	}
+	renderString(t, reloading)
+
+	if err := os.WriteFile(filepath.Join(dir, "page.html"), []byte(`{{ define "content" }}two{{ end }}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := renderString(t, cached); got != "[one]" {
+		t.Errorf("Expected the parsed page to be kept, got %q", got)
+	}
+	if got := renderString(t, reloading); got != "[two]" {
+		t.Errorf("Expected the page to be parsed again, got %q", got)
+	}
+}
+
+func TestRenderFailureWritesNothing(t *testing.T) {
+	dir := writeTemplates(t, `{{ define "content" }}{{ .Missing }}{{ end }}`)
+	rr := httptest.NewRecorder()
+	err := NewTemplates(dir, false).Render(rr, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK, "page.html", map[string]string{})
+	if err == nil {
+		t.Fatal("Expected a missing field to fail the render")
+	}
+	if rr.Body.Len() != 0 {
+		t.Errorf("Expected nothing written, got %q", rr.Body.String())
+	}
+
+	broken := writeTemplates(t, `{{ define "content" }}{{ if }}{{ end }}`)
+	if err := NewTemplates(broken, false).Load(); err == nil {
+		t.Error("Expected Load to report a broken page")
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	tests := []struct {
+		in, want, unwanted string
+	}{
+		{"*hi*", "<em>hi</em>", ""},
+		{"line one\nline two", "line one<br>", ""},
+		{"<script>alert(1)</script>", "", "<script>"},
+		{"[click](javascript:alert(1))", "", "javascript:"},
+		{"visit https://example.com", `<a href="https://example.com">`, ""},
+	}
+	for _, tc := range tests {
+		got := string(Markdown(tc.in))
+		if tc.want != "" && !strings.Contains(got, tc.want) {
+			t.Errorf("Markdown(%q) = %q, want it to contain %q", tc.in, got, tc.want)
+		}
+		if tc.unwanted != "" && strings.Contains(got, tc.unwanted) {
+			t.Errorf("Markdown(%q) = %q, want no %q", tc.in, got, tc.unwanted)
+		}
+	}
+}
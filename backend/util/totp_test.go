@@ -0,0 +1,67 @@
+package util
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors, "12345678901234567890", in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// The RFC lists 8 digit codes; ours are their last 6 digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := TOTPCode(rfcSecret, TOTPStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("TOTPCode failed: %v", err)
+		}
+		if got != tt.code {
+			t.Errorf("TOTPCode at %d = %s, want %s", tt.unix, got, tt.code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, _ := TOTPCode(rfcSecret, TOTPStep(now))
+
+	if step, ok := ValidateTOTP(rfcSecret, code, now); !ok || step != TOTPStep(now) {
+		t.Errorf("Expected current code to match step %d, got %d (%v)", TOTPStep(now), step, ok)
+	}
+	if _, ok := ValidateTOTP(rfcSecret, code, now.Add(TOTPPeriod)); !ok {
+		t.Error("Expected a code one period old to be accepted")
+	}
+	if _, ok := ValidateTOTP(rfcSecret, code, now.Add(3*TOTPPeriod)); ok {
+		t.Error("Expected a code three periods old to be rejected")
+	}
+	if _, ok := ValidateTOTP(rfcSecret, "12345", now); ok {
+		t.Error("Expected a short code to be rejected")
+	}
+}
+
+func TestNewTOTPSecret(t *testing.T) {
+	secret := NewTOTPSecret()
+	if len(secret) != 32 {
+		t.Errorf("Expected a 32 character secret, got %q", secret)
+	}
+	if _, err := TOTPCode(secret, 1); err != nil {
+		t.Errorf("Generated secret cannot be used: %v", err)
+	}
+
+	uri := OTPAuthURI("Forum", "alice@example.com", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/Forum:alice@example.com?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("Unexpected otpauth URI %q", uri)
+	}
+}
@@ -4,20 +4,21 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"unicode/utf8"
+)
+
+// The longest caption and alt text an attachment may have, in characters.
+const (
+	MaxCaptionLength = 200
+	MaxAltTextLength = 1000
 )
 
 /*
 ValidateInput checks for the validity of input values provided via the form.
 */
 func ValidateFormFields(userName, email, password string) error {
-	if len(strings.TrimSpace(userName)) == 0 {
-		return fmt.Errorf("username field cannot be empty")
-	}
-
-	for _, v := range userName {
-		if (v < '0' || v > '9') && (v < 'a' || v > 'z') && (v < 'A' || v > 'Z') {
-			return fmt.Errorf("username must contain only letters and numbers")
-		}
+	if err := ValidateUsername(userName); err != nil {
+		return err
 	}
 
 	if len(strings.TrimSpace(email)) == 0 {
@@ -33,8 +34,47 @@ func ValidateFormFields(userName, email, password string) error {
 		return fmt.Errorf("invalid email address format")
 	}
 
+	return ValidatePassword(password)
+}
+
+// ValidateUsername checks a username against the rules applied at sign up.
+func ValidateUsername(userName string) error {
+	if len(strings.TrimSpace(userName)) == 0 {
+		return fmt.Errorf("username field cannot be empty")
+	}
+
+	for _, v := range userName {
+		if (v < '0' || v > '9') && (v < 'a' || v > 'z') && (v < 'A' || v > 'Z') {
+			return fmt.Errorf("username must contain only letters and numbers")
+		}
+	}
+	return nil
+}
+
+// ValidatePassword checks a new password against the rules applied at sign up.
+func ValidatePassword(password string) error {
+	if len(strings.TrimSpace(password)) == 0 {
+		return fmt.Errorf("password field cannot be empty")
+	}
+
 	if len(strings.TrimSpace(password)) < 8 {
 		return fmt.Errorf("password must contain atleast 8 characters")
 	}
 	return nil
 }
+
+// ValidateCaption checks an attachment's caption against MaxCaptionLength.
+func ValidateCaption(caption string) error {
+	if utf8.RuneCountInString(caption) > MaxCaptionLength {
+		return fmt.Errorf("caption must contain at most %d characters", MaxCaptionLength)
+	}
+	return nil
+}
+
+// ValidateAltText checks an attachment's alt text against MaxAltTextLength.
+func ValidateAltText(altText string) error {
+	if utf8.RuneCountInString(altText) > MaxAltTextLength {
+		return fmt.Errorf("alt text must contain at most %d characters", MaxAltTextLength)
+	}
+	return nil
+}
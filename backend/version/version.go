@@ -0,0 +1,53 @@
+/*
+Package version describes the build of the forum. Commit and BuildTime are set when building, for example:
+
+	go build -ldflags "-X github.com/jesee-kuya/forum/backend/version.Commit=$(git rev-parse HEAD) -X github.com/jesee-kuya/forum/backend/version.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+
+Builds without them fall back to the version control details the Go toolchain records when building from a git checkout.
+*/
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Set with -ldflags "-X ...".
+var (
+	Commit    string
+	BuildTime string
+)
+
+// Info is what Get reports about the running build.
+type Info struct {
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	Modified  bool   `json:"modified,omitempty"` // built from a checkout with uncommitted changes
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the details of the running build. Details that are not known are "unknown".
+func Get() Info {
+	info := Info{Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+	if build, ok := debug.ReadBuildInfo(); ok && Commit == "" {
+		for _, s := range build.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				info.Commit = s.Value
+			case "vcs.time":
+				if info.BuildTime == "" {
+					info.BuildTime = s.Value
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildTime == "" {
+		info.BuildTime = "unknown"
+	}
+	return info
+}
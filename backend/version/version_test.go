@@ -0,0 +1,19 @@
+package version
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	info := Get()
+	if info.GoVersion != runtime.Version() || info.Commit == "" || info.BuildTime == "" {
+		t.Errorf("Get() = %+v", info)
+	}
+
+	Commit, BuildTime = "abc123", "2024-05-01T12:00:00Z"
+	t.Cleanup(func() { Commit, BuildTime = "", "" })
+	if info := Get(); info.Commit != "abc123" || info.BuildTime != "2024-05-01T12:00:00Z" || info.Modified {
+		t.Errorf("Get() = %+v, want the values set at build time", info)
+	}
+}
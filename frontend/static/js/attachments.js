@@ -0,0 +1,43 @@
+// Add caption and alt text inputs for every image selected in the create post form
+document.addEventListener('DOMContentLoaded', () => {
+  const fileInput = document.querySelector('input[name="uploaded-file"]');
+  const fieldsContainer = document.querySelector('.attachment-fields');
+
+  if (!fileInput || !fieldsContainer) return;
+
+  const maxFiles = parseInt(fileInput.dataset.maxFiles, 10);
+
+  fileInput.addEventListener('change', () => {
+    fieldsContainer.innerHTML = '';
+
+    if (fileInput.files.length > maxFiles) {
+      alert(`You can attach at most ${maxFiles} images to a post.`);
+      fileInput.value = '';
+      return;
+    }
+
+    Array.from(fileInput.files).forEach((file) => {
+      const row = document.createElement('div');
+      row.className = 'attachment-field';
+
+      const name = document.createElement('p');
+      name.className = 'attachment-name';
+      name.textContent = file.name;
+
+      const caption = document.createElement('input');
+      caption.type = 'text';
+      caption.name = 'attachment-caption[]';
+      caption.placeholder = 'Caption (optional)';
+      caption.maxLength = 200;
+
+      const alt = document.createElement('input');
+      alt.type = 'text';
+      alt.name = 'attachment-alt[]';
+      alt.placeholder = 'Describe the image for screen readers';
+      alt.maxLength = 1000;
+
+      row.append(name, caption, alt);
+      fieldsContainer.appendChild(row);
+    });
+  });
+});
@@ -0,0 +1,129 @@
+document.addEventListener('DOMContentLoaded', function () {
+  const addButton = document.getElementById('passkey-add');
+  const signInButton = document.getElementById('passkey-sign-in');
+
+  // WebAuthn works with ArrayBuffers, the server sends and expects base64url strings.
+  function toBuffer(value) {
+    const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+    const padded = base64 + '='.repeat((4 - (base64.length % 4)) % 4);
+    return Uint8Array.from(atob(padded), (c) => c.charCodeAt(0)).buffer;
+  }
+
+  function toBase64URL(buffer) {
+    const bytes = String.fromCharCode(...new Uint8Array(buffer));
+    return btoa(bytes).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+  }
+
+  function csrfToken() {
+    const field = document.querySelector('input[name="csrf_token"]');
+    if (field) {
+      return field.value;
+    }
+    const meta = document.querySelector('meta[name="csrf-token"]');
+    return meta ? meta.content : '';
+  }
+
+  async function post(url, body) {
+    const response = await fetch(url, {
+      method: 'POST',
+      body: body ? JSON.stringify(body) : undefined,
+      headers: {
+        'Content-Type': 'application/json',
+        Accept: 'application/json',
+        'X-CSRF-Token': csrfToken(),
+      },
+    });
+    const data = await response.json();
+    if (!response.ok && data.success === undefined) {
+      throw new Error(data.error || data.message || 'Request failed');
+    }
+    return data;
+  }
+
+  function showError(message) {
+    const popup = document.getElementById('message-popup');
+    const error = document.getElementById('passkey-error');
+    if (popup) {
+      popup.textContent = message;
+      popup.classList.add('show', 'error');
+      setTimeout(() => popup.classList.remove('show', 'error'), 3000);
+    } else if (error) {
+      error.textContent = message;
+      error.hidden = false;
+    }
+  }
+
+  if (addButton) {
+    addButton.addEventListener('click', async () => {
+      try {
+        const { ceremony, options } = await post('/settings/passkeys/register/begin');
+        const publicKey = options.publicKey;
+        publicKey.challenge = toBuffer(publicKey.challenge);
+        publicKey.user.id = toBuffer(publicKey.user.id);
+        (publicKey.excludeCredentials || []).forEach((c) => {
+          c.id = toBuffer(c.id);
+        });
+
+        const credential = await navigator.credentials.create({ publicKey });
+        const name = document.getElementById('passkey-name').value;
+        const params = new URLSearchParams({ ceremony, name });
+        const data = await post(`/settings/passkeys/register/finish?${params}`, {
+          id: credential.id,
+          rawId: toBase64URL(credential.rawId),
+          type: credential.type,
+          response: {
+            clientDataJSON: toBase64URL(credential.response.clientDataJSON),
+            attestationObject: toBase64URL(credential.response.attestationObject),
+            transports: credential.response.getTransports ? credential.response.getTransports() : [],
+          },
+        });
+
+        if (data.success) {
+          window.location.reload();
+        } else {
+          showError(data.message);
+        }
+      } catch (error) {
+        console.error('Error:', error);
+        showError('The passkey could not be added.');
+      }
+    });
+  }
+
+  if (signInButton) {
+    signInButton.addEventListener('click', async () => {
+      try {
+        const { ceremony, options } = await post('/passkeys/login/begin');
+        const publicKey = options.publicKey;
+        publicKey.challenge = toBuffer(publicKey.challenge);
+
+        const credential = await navigator.credentials.get({ publicKey });
+        const remember = document.querySelector('input[name="remember-me"]');
+        const params = new URLSearchParams({ ceremony });
+        if (remember && remember.checked) {
+          params.set('remember-me', 'on');
+        }
+        const data = await post(`/passkeys/login/finish?${params}`, {
+          id: credential.id,
+          rawId: toBase64URL(credential.rawId),
+          type: credential.type,
+          response: {
+            clientDataJSON: toBase64URL(credential.response.clientDataJSON),
+            authenticatorData: toBase64URL(credential.response.authenticatorData),
+            signature: toBase64URL(credential.response.signature),
+            userHandle: credential.response.userHandle ? toBase64URL(credential.response.userHandle) : null,
+          },
+        });
+
+        if (data.success) {
+          window.location.href = '/';
+        } else {
+          showError(data.message);
+        }
+      } catch (error) {
+        console.error('Error:', error);
+        showError('Signing in with a passkey failed.');
+      }
+    });
+  }
+});
@@ -1,3 +1,5 @@
+const csrfToken = document.querySelector('meta[name="csrf-token"]').content;
+
 document.querySelectorAll('.like-button, .dislike-button, .like-comment-button, .dislike-comment-button').forEach((button) => {
   button.addEventListener('click', function (event) {
     event.preventDefault();
@@ -7,7 +9,10 @@ document.querySelectorAll('.like-button, .dislike-button, .like-comment-button,
 
     fetch('/reaction', {
       method: 'POST',
-      headers: { 'Content-Type': 'application/x-www-form-urlencoded' },
+      headers: {
+        'Content-Type': 'application/x-www-form-urlencoded',
+        'X-CSRF-Token': csrfToken,
+      },
       credentials: 'include',
       body: `post_id=${postId}&reaction=${reaction}`,
     })
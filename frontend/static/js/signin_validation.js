@@ -22,20 +22,9 @@ document.addEventListener('DOMContentLoaded', function () {
     history.replaceState(null, '', window.location.pathname);
   }
 
-  document.querySelector('.google-btn').addEventListener('click', (e) => {
-    e.preventDefault();
-    window.location.href = '/auth/google';
-  });
-
-  document.querySelector('.github-btn').addEventListener('click', (e) => {
-    e.preventDefault();
-    window.location.href = '/auth/github';
-  });
-
   signinForm.addEventListener('submit', async (e) => {
     e.preventDefault();
     const signinFormData = new URLSearchParams(new FormData(signinForm));
-    console.log(Object.fromEntries(signinFormData));
 
     try {
       const response = await fetch('/sign-in', {
@@ -43,19 +32,25 @@ document.addEventListener('DOMContentLoaded', function () {
         body: signinFormData,
         headers: {
           'Content-Type': 'application/x-www-form-urlencoded',
+          Accept: 'application/json',
         },
       });
 
       const data = await response.json();
 
-      if (data.success) {
+      if (data.success && data.redirect) {
+        window.location.href = data.redirect;
+      } else if (data.success) {
         showMessage('Sign In Successful!', true);
 
         setTimeout(() => {
           window.location.href = '/';
         }, 1000);
       } else {
-        showMessage('Operation failed. Please check your input.', false);
+        showMessage(
+          data.message || 'Operation failed. Please check your input.',
+          false
+        );
       }
     } catch (error) {
       console.error('Error:', error);
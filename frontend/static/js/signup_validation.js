@@ -32,7 +32,8 @@ document.addEventListener('DOMContentLoaded', () => {
 
     try {
       const response = await fetch(
-        `/validate?${field}=${encodeURIComponent(value)}`
+        `/validate?${field}=${encodeURIComponent(value)}`,
+        { headers: { Accept: 'application/json' } }
       );
       const data = await response.json();
 
@@ -126,16 +127,6 @@ document.addEventListener('DOMContentLoaded', () => {
     history.replaceState(null, '', window.location.pathname);
   }
 
-  document.querySelector('.google-btn').addEventListener('click', (e) => {
-    e.preventDefault();
-    window.location.href = '/auth/google';
-  });
-
-  document.querySelector('.github-btn').addEventListener('click', (e) => {
-    e.preventDefault();
-    window.location.href = '/auth/github';
-  });
-
   // Handle regular form submission
   signupForm.addEventListener('submit', async (e) => {
     e.preventDefault();
@@ -147,6 +138,7 @@ document.addEventListener('DOMContentLoaded', () => {
         body: signUpFormData,
         headers: {
           'Content-Type': 'application/x-www-form-urlencoded',
+          Accept: 'application/json',
         },
       });
 
@@ -1,41 +1,220 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/jesee-kuya/forum/backend/config"
+	"github.com/jesee-kuya/forum/backend/database"
+	"github.com/jesee-kuya/forum/backend/handler"
+	"github.com/jesee-kuya/forum/backend/janitor"
+	"github.com/jesee-kuya/forum/backend/jobs"
+	"github.com/jesee-kuya/forum/backend/logging"
+	"github.com/jesee-kuya/forum/backend/mailer"
+	"github.com/jesee-kuya/forum/backend/middleware"
+	openauth "github.com/jesee-kuya/forum/backend/open_auth"
 	"github.com/jesee-kuya/forum/backend/route"
-	"github.com/jesee-kuya/forum/backend/util"
+	"github.com/jesee-kuya/forum/backend/tracing"
 )
 
 func main() {
-	err := util.LoadEnv(".env")
-	if err != nil {
-		fmt.Println("Error loading .env file:", err)
+	if len(os.Args) > 1 && os.Args[1] == "gc-uploads" {
+		gcUploads(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "healthcheck" {
+		healthcheck(os.Args[2:])
 		return
 	}
 
-	util.Init()
-	defer util.DB.Close()
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Error loading configuration: %v", err)
+	}
 
-	port, err := util.ValidatePort()
+	if err := run(cfg); err != nil {
+		log.Fatal(err)
+	}
+}
+
+/*
+run serves the forum until it receives SIGINT or SIGTERM, or the server fails, and then shuts down in order: the App reports itself as draining, the server stops accepting connections and waits for in-flight requests, running background jobs get what is left of the shutdown timeout to finish, the spans not yet exported are flushed, and the database log is checkpointed as the database is closed. A second signal stops the process at once.
+*/
+func run(cfg *config.Config) error {
+	if err := logging.Setup(cfg.Log); err != nil {
+		return err
+	}
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
 	if err != nil {
-		log.Fatalf("Error validating port: %v", err)
-		return
+		return err
+	}
+	db := database.CreateConnection(cfg.Database.Path)
+	defer func() {
+		if err := database.Close(db); err != nil {
+			slog.Error("Failed to close the database", "err", err)
+		}
+	}()
+
+	app := handler.New(db, cfg)
+	if err := app.Templates.Load(); err != nil {
+		return fmt.Errorf("failed to load templates: %w", err)
+	}
+	auth := openauth.New(app)
+	if err := auth.Configure(cfg.OAuth); err != nil {
+		return fmt.Errorf("failed to configure sign-in providers: %w", err)
+	}
+
+	runner := jobs.NewRunner(db, cfg.Jobs.Workers)
+	if err := jobs.RegisterBuiltins(runner, db, jobs.Builtins{UploadDir: cfg.Uploads.Dir, Mailer: mailer.New(cfg.Mail), Digest: cfg.Jobs.Digest, BaseURL: cfg.Server.BaseURL}); err != nil {
+		return fmt.Errorf("failed to register jobs: %w", err)
 	}
-	router := route.InitRoutes()
 
+	var h http.Handler = middleware.Locale(middleware.Recover(middleware.CSRF(route.InitRoutes(app, auth), "/upload")))
+	if cfg.Log.AccessLog {
+		h = middleware.AccessLog(h)
+	}
+	// The configuration and templates of the App come first, as every middleware may read them
+	h = middleware.WithConfig(cfg, middleware.WithTemplates(app.Templates, middleware.RequestID(h)))
 	server := &http.Server{
-		Addr:         port,
-		Handler:      router,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		Addr:         cfg.Addr(),
+		Handler:      tracing.Middleware(h),
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		ErrorLog:     logging.ErrorLog(),
+	}
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to start server: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	runner.Start(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		slog.Info("Server started", "url", "http://localhost"+cfg.Addr())
+		served <- server.Serve(listener)
+	}()
+
+	select {
+	case <-ctx.Done():
+		slog.Info("Shutting down, signal again to stop at once")
+	case err = <-served:
+		err = fmt.Errorf("server stopped: %w", err)
+	}
+	stop()
+
+	app.Drain()
+	if err == nil && cfg.Server.DrainDelay > 0 {
+		slog.Info("Reporting as draining before closing the listener", "delay", cfg.Server.DrainDelay)
+		time.Sleep(cfg.Server.DrainDelay)
 	}
 
-	log.Printf("Server started at http://localhost%s\n", port)
-	if err = server.ListenAndServe(); err != nil {
-		log.Fatalf("Error starting server: %v", err)
+	drainCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if shutdownErr := server.Shutdown(drainCtx); shutdownErr != nil {
+		slog.Warn("Requests did not finish in time, closing their connections", "err", shutdownErr)
+		server.Close()
+	}
+
+	slog.Info("Waiting for running jobs to finish")
+	if shutdownErr := runner.Shutdown(drainCtx); shutdownErr != nil {
+		slog.Warn("Background jobs did not finish in time", "err", shutdownErr)
+	}
+	if shutdownErr := shutdownTracing(drainCtx); shutdownErr != nil {
+		slog.Warn("Failed to export the last spans", "err", shutdownErr)
+	}
+	return err
+}
+
+/*
+gcUploads implements the 'gc-uploads' command, which removes uploaded files no longer referenced by any visible post.
+*/
+func gcUploads(args []string) {
+	flags := flag.NewFlagSet("gc-uploads", flag.ExitOnError)
+	load := config.Flags(flags)
+	dryRun := flags.Bool("dry-run", false, "list orphaned uploads without deleting them")
+	grace := flags.Duration("grace", 24*time.Hour, "keep orphaned uploads younger than this")
+	dir := flags.String("dir", "", "directory holding uploaded media (default uploads.dir of the configuration)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: forum gc-uploads [-config forum.yaml] [-db path] [-dry-run] [-grace 24h] [-dir uploads]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	cfg, err := load()
+	if err != nil {
+		log.Fatalf("Error loading configuration: %v", err)
+	}
+	if err := logging.Setup(cfg.Log); err != nil {
+		log.Fatal(err)
+	}
+	if *dir == "" {
+		*dir = cfg.Uploads.Dir
+	}
+
+	db := database.CreateConnection(cfg.Database.Path)
+	defer database.Close(db)
+
+	report, err := janitor.CollectUploads(context.Background(), db, janitor.Options{Dir: *dir, Grace: *grace, DryRun: *dryRun})
+	if err != nil {
+		database.Close(db)
+		log.Fatalf("Error collecting uploads: %v", err)
+	}
+
+	for _, path := range report.Orphans {
+		if *dryRun {
+			fmt.Println("would remove", path)
+		} else {
+			fmt.Println("removed", path)
+		}
+	}
+	if *dryRun {
+		fmt.Print("dry run: ")
+	}
+	fmt.Println(report)
+}
+
+/*
+healthcheck implements the 'healthcheck' command, used as the Docker HEALTHCHECK. It asks the running server whether it is ready and exits with status 1 when it is not, printing the answer either way.
+*/
+func healthcheck(args []string) {
+	flags := flag.NewFlagSet("healthcheck", flag.ExitOnError)
+	load := config.Flags(flags)
+	target := flags.String("url", "", "address to check (default http://localhost:<port>/readyz, with the configured port)")
+	flags.Parse(args)
+
+	if *target == "" {
+		cfg, err := load()
+		if err != nil {
+			log.Fatalf("Error loading configuration: %v", err)
+		}
+		*target = "http://localhost" + cfg.Addr() + "/readyz"
+	}
+
+	client := &http.Client{Timeout: handler.ReadinessTimeout + 3*time.Second}
+	resp, err := client.Get(*target)
+	if err != nil {
+		log.Fatalf("Health check failed: %v", err)
+	}
+	io.Copy(os.Stdout, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		os.Exit(1)
 	}
 }